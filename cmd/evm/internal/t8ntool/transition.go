@@ -0,0 +1,212 @@
+package t8ntool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/tests"
+	"github.com/urfave/cli"
+)
+
+const stdinSelector = "stdin"
+
+// input is the combined input of the transition, used when reading from stdin
+type input struct {
+	Alloc core.GenesisAlloc  `json:"alloc,omitempty"`
+	Env   *stEnv             `json:"env,omitempty"`
+	Txs   types.Transactions `json:"txs,omitempty"`
+}
+
+// Main runs the state transition tool: it applies the transactions to the prestate
+// alloc within the given environment, and writes out the post state alloc and the
+// result of the execution.
+func Main(ctx *cli.Context) error {
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	var (
+		err       error
+		baseDir   = ""
+		getTracer func(txIndex int, txHash common.Hash) (vm.Tracer, error)
+	)
+
+	// If user specified a basedir, make sure it exists
+	if ctx.IsSet(OutputBasedir.Name) {
+		if base := ctx.String(OutputBasedir.Name); len(base) > 0 {
+			if err = os.MkdirAll(base, 0755); err != nil {
+				return fmt.Errorf("failed creating output basedir: %v", err)
+			}
+			baseDir = base
+		}
+	}
+	if ctx.Bool(TraceFlag.Name) {
+		// Configure the EVM logger
+		logConfig := &vm.LogConfig{
+			DisableStack:  ctx.Bool(TraceDisableStackFlag.Name),
+			DisableMemory: ctx.Bool(TraceDisableMemoryFlag.Name),
+			Debug:         true,
+		}
+		var prevFile *os.File
+		// This one closes the last file
+		defer func() {
+			if prevFile != nil {
+				prevFile.Close()
+			}
+		}()
+		getTracer = func(txIndex int, txHash common.Hash) (vm.Tracer, error) {
+			if prevFile != nil {
+				prevFile.Close()
+			}
+			traceFile, err := os.Create(filepath.Join(baseDir, fmt.Sprintf("trace-%d-%v.jsonl", txIndex, txHash.String())))
+			if err != nil {
+				return nil, fmt.Errorf("failed creating trace-file: %v", err)
+			}
+			prevFile = traceFile
+			return vm.NewJSONLogger(logConfig, traceFile), nil
+		}
+	} else {
+		getTracer = func(txIndex int, txHash common.Hash) (vm.Tracer, error) {
+			return nil, nil
+		}
+	}
+	// We need to load three things: alloc, env and transactions. May be either in
+	// stdin input or in files.
+	// Check if anything needs to be read from stdin
+	var (
+		prestate  Prestate
+		txs       types.Transactions // txs to apply
+		allocStr  = ctx.String(InputAllocFlag.Name)
+		envStr    = ctx.String(InputEnvFlag.Name)
+		txStr     = ctx.String(InputTxsFlag.Name)
+		inputData = &input{}
+	)
+	if allocStr == stdinSelector || envStr == stdinSelector || txStr == stdinSelector {
+		decoder := json.NewDecoder(os.Stdin)
+		if err = decoder.Decode(inputData); err != nil {
+			return fmt.Errorf("failed unmarshaling stdin: %v", err)
+		}
+	}
+	if allocStr != stdinSelector {
+		if err = readJSONFile(allocStr, &inputData.Alloc); err != nil {
+			return fmt.Errorf("failed reading alloc file: %v", err)
+		}
+	}
+	prestate.Pre = inputData.Alloc
+
+	// Set the block environment
+	if envStr != stdinSelector {
+		var env stEnv
+		if err = readJSONFile(envStr, &env); err != nil {
+			return fmt.Errorf("failed reading env file: %v", err)
+		}
+		inputData.Env = &env
+	}
+	if inputData.Env == nil {
+		return fmt.Errorf("missing env in stdin input")
+	}
+	prestate.Env = *inputData.Env
+
+	// Construct the chainconfig
+	fork := ctx.String(ForknameFlag.Name)
+	forkConfig, ok := tests.Forks[fork]
+	if !ok {
+		return tests.UnsupportedForkError{Name: fork}
+	}
+	chainConfig := new(params.ChainConfig)
+	*chainConfig = *forkConfig
+	chainConfig.ChainID = big.NewInt(ctx.Int64(ChainIDFlag.Name))
+
+	if txStr != stdinSelector {
+		if err = readJSONFile(txStr, &inputData.Txs); err != nil {
+			return fmt.Errorf("failed reading txs file: %v", err)
+		}
+	}
+	txs = inputData.Txs
+
+	// Run the test and aggregate the result
+	tds, result, err := prestate.Apply(vm.Config{}, chainConfig, txs, ctx.Int64(RewardFlag.Name), getTracer)
+	if err != nil {
+		return err
+	}
+	alloc, err := dumpAlloc(tds)
+	if err != nil {
+		return err
+	}
+	return dispatchOutput(ctx, baseDir, result, alloc)
+}
+
+// readJSONFile decodes the JSON contents of the given file into v
+func readJSONFile(name string, v interface{}) error {
+	blob, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, v)
+}
+
+// saveFile marshals the object to the given file
+func saveFile(baseDir, filename string, data interface{}) error {
+	b, err := json.MarshalIndent(data, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed marshalling output: %v", err)
+	}
+	location := filepath.Join(baseDir, filename)
+	if err = ioutil.WriteFile(location, b, 0644); err != nil {
+		return fmt.Errorf("failed writing output: %v", err)
+	}
+	log.Info("Wrote file", "file", location)
+	return nil
+}
+
+// dispatchOutput writes the output data to either stderr or stdout, or to the specified
+// files
+func dispatchOutput(ctx *cli.Context, baseDir string, result *ExecutionResult, alloc core.GenesisAlloc) error {
+	stdOutObject := make(map[string]interface{})
+	stdErrObject := make(map[string]interface{})
+	dispatch := func(baseDir, fName, name string, obj interface{}) error {
+		switch fName {
+		case "stdout":
+			stdOutObject[name] = obj
+		case "stderr":
+			stdErrObject[name] = obj
+		default: // save to file
+			if err := saveFile(baseDir, fName, obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := dispatch(baseDir, ctx.String(OutputAllocFlag.Name), "alloc", alloc); err != nil {
+		return err
+	}
+	if err := dispatch(baseDir, ctx.String(OutputResultFlag.Name), "result", result); err != nil {
+		return err
+	}
+	if len(stdOutObject) > 0 {
+		b, err := json.MarshalIndent(stdOutObject, "", " ")
+		if err != nil {
+			return fmt.Errorf("failed marshalling output: %v", err)
+		}
+		os.Stdout.Write(b)
+	}
+	if len(stdErrObject) > 0 {
+		b, err := json.MarshalIndent(stdErrObject, "", " ")
+		if err != nil {
+			return fmt.Errorf("failed marshalling output: %v", err)
+		}
+		os.Stderr.Write(b)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestT8n(t *testing.T) {
+	for _, tc := range []struct {
+		dir    string
+		fork   string
+		reward string
+	}{
+		// Before Byzantium, the receipts hold the intermediate state roots
+		{dir: "testdata/1", fork: "Homestead", reward: "2000000000000000000"},
+		// Since Byzantium, the receipts hold the status instead
+		{dir: "testdata/2", fork: "Byzantium", reward: "2000000000000000000"},
+	} {
+		tc := tc
+		t.Run(tc.dir, func(t *testing.T) {
+			outDir, err := ioutil.TempDir("", "t8n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(outDir)
+
+			args := []string{"evm", "t8n",
+				"--input.alloc", filepath.Join(tc.dir, "alloc.json"),
+				"--input.env", filepath.Join(tc.dir, "env.json"),
+				"--input.txs", filepath.Join(tc.dir, "txs.json"),
+				"--state.fork", tc.fork,
+				"--state.reward", tc.reward,
+				"--output.basedir", outDir,
+				"--verbosity", "0",
+			}
+			if err = app.Run(args); err != nil {
+				t.Fatal(err)
+			}
+
+			var expected map[string]interface{}
+			readJSON(t, filepath.Join(tc.dir, "exp.json"), &expected)
+			for name, file := range map[string]string{"alloc": "alloc.json", "result": "result.json"} {
+				var have interface{}
+				readJSON(t, filepath.Join(outDir, file), &have)
+				if !reflect.DeepEqual(have, expected[name]) {
+					haveJSON, _ := json.MarshalIndent(have, "", " ")
+					wantJSON, _ := json.MarshalIndent(expected[name], "", " ")
+					t.Errorf("%s mismatch\nhave: %s\nwant: %s", name, haveJSON, wantJSON)
+				}
+			}
+		})
+	}
+}
+
+func readJSON(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	blob, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(blob, v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -411,18 +411,16 @@ func removeDB(ctx *cli.Context) error {
 	} else {
 		log.Info("Full node state database missing", "path", path)
 	}
-	// Remove the full node ancient database
-	path = config.Eth.DatabaseFreezer
-	switch {
-	case path == "":
-		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
-	case !filepath.IsAbs(path):
-		path = config.Node.ResolvePath(path)
-	}
-	if common.FileExist(path) {
-		confirmAndRemoveDB(path, "full node ancient database")
-	} else {
-		log.Info("Full node ancient database missing", "path", path)
+	// Remove the full node ancient database, which is only used if its directory is specified
+	if path = config.Eth.DatabaseFreezer; path != "" {
+		if !filepath.IsAbs(path) {
+			path = config.Node.ResolvePath(path)
+		}
+		if common.FileExist(path) {
+			confirmAndRemoveDB(path, "full node ancient database")
+		} else {
+			log.Info("Full node ancient database missing", "path", path)
+		}
 	}
 	// Remove the light node database
 	path = stack.ResolvePath("lightchaindata")
@@ -94,6 +94,9 @@ var (
 		utils.GCModeLimitFlag,
 		utils.GCModeBlockToPruneFlag,
 		utils.GCModeTickTimeout,
+		utils.PruningWatchAddressesFlag,
+		utils.PruningCheckpointsFlag,
+		utils.PruningKeepAboveFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
@@ -107,10 +110,20 @@ var (
 		utils.CacheGCFlag,
 		utils.TrieCacheGenFlag,
 		utils.DownloadOnlyFlag,
+		utils.ServeWitnessesFlag,
+		utils.WitnessRetentionFlag,
+		utils.BinaryTrieFlag,
+		utils.ParallelExecutionFlag,
 		utils.StorageModeFlag,
 		utils.ArchiveSyncInterval,
 		utils.DatabaseFlag,
 		utils.RemoteDbListenAddress,
+		utils.RemoteDbTLSCertFlag,
+		utils.RemoteDbTLSKeyFlag,
+		utils.RemoteDbTLSCAFlag,
+		utils.RemoteDbTokenFlag,
+		utils.RemoteDbWritableFlag,
+		utils.RemoteDbWritableBucketsFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
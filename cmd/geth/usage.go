@@ -81,11 +81,18 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.GCModeLimitFlag,
 			utils.GCModeBlockToPruneFlag,
 			utils.GCModeTickTimeout,
+			utils.PruningWatchAddressesFlag,
+			utils.PruningCheckpointsFlag,
+			utils.PruningKeepAboveFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
 			utils.WhitelistFlag,
 			utils.DownloadOnlyFlag,
+			utils.ServeWitnessesFlag,
+			utils.WitnessRetentionFlag,
+			utils.BinaryTrieFlag,
+			utils.ParallelExecutionFlag,
 			utils.StorageModeFlag,
 			utils.ArchiveSyncInterval,
 		},
@@ -183,6 +190,12 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
 			utils.RemoteDbListenAddress,
+			utils.RemoteDbTLSCertFlag,
+			utils.RemoteDbTLSKeyFlag,
+			utils.RemoteDbTLSCAFlag,
+			utils.RemoteDbTokenFlag,
+			utils.RemoteDbWritableFlag,
+			utils.RemoteDbWritableBucketsFlag,
 		},
 	},
 	{
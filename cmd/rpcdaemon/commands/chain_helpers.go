@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// getBlockNumber resolves the block number, taking care of the
+// rpc.LatestBlockNumber and rpc.PendingBlockNumber meta block numbers.
+// rpcdaemon does not have access to the pending block, so latest is used instead.
+func getBlockNumber(number rpc.BlockNumber, dbReader rawdb.DatabaseReader) (uint64, error) {
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber:
+		headHash := rawdb.ReadHeadBlockHash(dbReader)
+		if headHash == (common.Hash{}) {
+			return 0, fmt.Errorf("head block hash not found")
+		}
+		blockNumber := rawdb.ReadHeaderNumber(dbReader, headHash)
+		if blockNumber == nil {
+			return 0, fmt.Errorf("head block number not found for hash %x", headHash)
+		}
+		return *blockNumber, nil
+	default:
+		return uint64(number.Int64()), nil
+	}
+}
+
+// getBlockNumberOrHash resolves the number and the hash of the block referenced by blockNrOrHash.
+func getBlockNumberOrHash(blockNrOrHash rpc.BlockNumberOrHash, dbReader rawdb.DatabaseReader) (uint64, common.Hash, error) {
+	if number, ok := blockNrOrHash.Number(); ok {
+		blockNumber, err := getBlockNumber(number, dbReader)
+		if err != nil {
+			return 0, common.Hash{}, err
+		}
+		hash := rawdb.ReadCanonicalHash(dbReader, blockNumber)
+		if hash == (common.Hash{}) {
+			return 0, common.Hash{}, fmt.Errorf("block %d not found", blockNumber)
+		}
+		return blockNumber, hash, nil
+	}
+	hash, ok := blockNrOrHash.Hash()
+	if !ok {
+		return 0, common.Hash{}, fmt.Errorf("invalid arguments; neither block nor hash specified")
+	}
+	blockNumber := rawdb.ReadHeaderNumber(dbReader, hash)
+	if blockNumber == nil {
+		return 0, common.Hash{}, fmt.Errorf("block %x not found", hash)
+	}
+	if blockNrOrHash.RequireCanonical && rawdb.ReadCanonicalHash(dbReader, *blockNumber) != hash {
+		return 0, common.Hash{}, fmt.Errorf("hash %x is not currently canonical", hash)
+	}
+	return *blockNumber, hash, nil
+}
+
+// getChainConfig reads the chain config stored alongside the genesis block,
+// falling back to the mainnet config if it is missing.
+func getChainConfig(dbReader rawdb.DatabaseReader) *params.ChainConfig {
+	genesisHash := rawdb.ReadCanonicalHash(dbReader, 0)
+	if genesisHash == (common.Hash{}) {
+		return params.MainnetChainConfig
+	}
+	if config := rawdb.ReadChainConfig(dbReader, genesisHash); config != nil {
+		return config
+	}
+	return params.MainnetChainConfig
+}
+
+// stateAndHeaderAt returns the state after the execution of the given block, and its header.
+func stateAndHeaderAt(blockNrOrHash rpc.BlockNumberOrHash, dbReader ethdb.Getter) (*state.IntraBlockState, *types.Header, error) {
+	blockNumber, hash, err := getBlockNumberOrHash(blockNrOrHash, dbReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := rawdb.ReadHeader(dbReader, hash, blockNumber)
+	if header == nil {
+		return nil, nil, fmt.Errorf("header %d (%x) not found", blockNumber, hash)
+	}
+	return state.New(state.NewDbState(dbReader, blockNumber)), header, nil
+}
@@ -2,11 +2,10 @@ package commands
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"fmt"
-	"io"
 	"math/big"
-	"net"
 	"os"
 	"os/signal"
 	"strings"
@@ -22,6 +21,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/eth"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
@@ -44,6 +44,15 @@ func splitAndTrim(input string) []string {
 type EthAPI interface {
 	BlockNumber(ctx context.Context) (hexutil.Uint64, error)
 	GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error)
+	GetBalance(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error)
+	GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Uint64, error)
+	GetCode(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetStorageAt(ctx context.Context, address common.Address, index string, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	GetTransactionByHash(ctx context.Context, hash common.Hash) (*ethapi.RPCTransaction, error)
+	GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error)
+	GetLogs(ctx context.Context, crit filters.FilterCriteria) ([]*types.Log, error)
+	Call(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error)
+	EstimateGas(ctx context.Context, args ethapi.CallArgs) (hexutil.Uint64, error)
 }
 
 // APIImpl is implementation of the EthAPI interface based on remote Db access
@@ -51,11 +60,17 @@ type APIImpl struct {
 	db           *remote.DB
 	dbReader     ethdb.Getter
 	chainContext core.ChainContext
+	gasCap       *big.Int
 }
 
 // PrivateDebugAPI
 type PrivateDebugAPI interface {
 	StorageRangeAt(ctx context.Context, blockHash common.Hash, txIndex int, contractAddress common.Address, keyStart hexutil.Bytes, maxResult int) (eth.StorageRangeResult, error)
+	TraceTransaction(ctx context.Context, hash common.Hash, config *eth.TraceConfig) (interface{}, error)
+	TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *eth.TraceConfig) ([]*txTraceResult, error)
+	TraceBlockByHash(ctx context.Context, hash common.Hash, config *eth.TraceConfig) ([]*txTraceResult, error)
+	TraceBlock(ctx context.Context, blob []byte, config *eth.TraceConfig) ([]*txTraceResult, error)
+	StateDiff(ctx context.Context, blockNr rpc.BlockNumber) (eth.StateDiffResult, error)
 }
 
 // APIImpl is implementation of the EthAPI interface based on remote Db access
@@ -66,11 +81,12 @@ type PrivateDebugAPIImpl struct {
 }
 
 // NewAPI returns APIImpl instance
-func NewAPI(db *remote.DB, dbReader ethdb.Getter, chainContext core.ChainContext) *APIImpl {
+func NewAPI(db *remote.DB, dbReader ethdb.Getter, chainContext core.ChainContext, gasCap *big.Int) *APIImpl {
 	return &APIImpl{
 		db:           db,
 		dbReader:     dbReader,
 		chainContext: chainContext,
+		gasCap:       gasCap,
 	}
 }
 
@@ -278,7 +294,8 @@ func (api *PrivateDebugAPIImpl) computeTxEnv(ctx context.Context, blockHash comm
 	}
 	statedb, dbstate := api.computeIntraBlockState(parent)
 	// Recompute transactions up to the target index.
-	signer := types.MakeSigner(params.MainnetChainConfig, block.Number())
+	chainConfig := getChainConfig(api.dbReader)
+	signer := types.MakeSigner(chainConfig, block.Number())
 
 	for idx, tx := range block.Transactions() {
 		select {
@@ -289,12 +306,12 @@ func (api *PrivateDebugAPIImpl) computeTxEnv(ctx context.Context, blockHash comm
 
 		// Assemble the transaction call message and return if the requested offset
 		msg, _ := tx.AsMessage(signer)
-		EVMcontext := core.NewEVMContext(msg, block.Header(), &chainContext{db: api.dbReader}, nil)
+		EVMcontext := core.NewEVMContext(msg, block.Header(), api.chainContext, nil)
 		if idx == txIndex {
 			return msg, EVMcontext, statedb, dbstate, parent.NumberU64(), nil
 		}
 		// Not yet the searched for transaction, execute on top of the current state
-		vmenv := vm.NewEVM(EVMcontext, statedb, params.MainnetChainConfig, vm.Config{})
+		vmenv := vm.NewEVM(EVMcontext, statedb, chainConfig, vm.Config{})
 		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
 			return nil, vm.Context{}, nil, nil, 0, fmt.Errorf("transaction %x failed: %v", tx.Hash(), err)
 		}
@@ -334,15 +351,16 @@ func daemon(cfg Config) {
 	cors := splitAndTrim(cfg.rpcCORSDomain)
 	enabledApis := splitAndTrim(cfg.rpcAPI)
 
-	dial := func(ctx context.Context) (in io.Reader, out io.Writer, closer io.Closer, err error) {
-		dialer := net.Dialer{}
-		conn, err := dialer.DialContext(ctx, "tcp", cfg.remoteDbAddress)
+	var tlsConfig *tls.Config
+	if cfg.remoteDbTLSCA != "" || cfg.remoteDbTLSCert != "" {
+		var err error
+		tlsConfig, err = remote.ClientTLSConfig(cfg.remoteDbTLSCert, cfg.remoteDbTLSKey, cfg.remoteDbTLSCA)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("could not connect to remoteDb. addr: %s. err: %w", cfg.remoteDbAddress, err)
+			log.Error("Could not configure TLS for remoteDb", "error", err)
+			return
 		}
-		return conn, conn, conn, nil
 	}
-	db, err := remote.NewDB(context.Background(), dial)
+	db, err := remote.NewDB(context.Background(), remote.TCPDialFunc(cfg.remoteDbAddress, tlsConfig), cfg.remoteDbToken)
 	if err != nil {
 		log.Error("Could not connect to remoteDb", "error", err)
 		return
@@ -351,7 +369,11 @@ func daemon(cfg Config) {
 	var rpcAPI = []rpc.API{}
 	dbReader := remote.NewRemoteBoltDatabase(db)
 	chainContext := NewChainContext(dbReader)
-	apiImpl := NewAPI(db, dbReader, chainContext)
+	var gasCap *big.Int
+	if cfg.rpcGasCap > 0 {
+		gasCap = new(big.Int).SetUint64(cfg.rpcGasCap)
+	}
+	apiImpl := NewAPI(db, dbReader, chainContext, gasCap)
 	dbgAPIImpl := NewPrivateDebugAPI(db, dbReader, chainContext)
 
 	for _, enabledAPI := range enabledApis {
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// GetBalance implements eth_getBalance. Returns the balance of an account for a given address.
+func (api *APIImpl) GetBalance(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	ibs, _, err := stateAndHeaderAt(blockNrOrHash, api.dbReader)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(ibs.GetBalance(address)), ibs.Error()
+}
+
+// GetTransactionCount implements eth_getTransactionCount. Returns the number of transactions sent from an address (the nonce).
+func (api *APIImpl) GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Uint64, error) {
+	ibs, _, err := stateAndHeaderAt(blockNrOrHash, api.dbReader)
+	if err != nil {
+		return nil, err
+	}
+	nonce := ibs.GetNonce(address)
+	return (*hexutil.Uint64)(&nonce), ibs.Error()
+}
+
+// GetCode implements eth_getCode. Returns the byte code at a given address (if it's a smart contract).
+func (api *APIImpl) GetCode(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	ibs, _, err := stateAndHeaderAt(blockNrOrHash, api.dbReader)
+	if err != nil {
+		return nil, err
+	}
+	return ibs.GetCode(address), ibs.Error()
+}
+
+// GetStorageAt implements eth_getStorageAt. Returns the value from a storage position at a given address.
+func (api *APIImpl) GetStorageAt(ctx context.Context, address common.Address, index string, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	ibs, _, err := stateAndHeaderAt(blockNrOrHash, api.dbReader)
+	if err != nil {
+		return nil, err
+	}
+	value := ibs.GetState(address, common.HexToHash(index))
+	return value[:], ibs.Error()
+}
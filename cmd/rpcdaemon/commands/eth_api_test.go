@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+
+	ethereum "github.com/ledgerwatch/turbo-geth"
+	"github.com/ledgerwatch/turbo-geth/accounts/abi/bind/backends"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// Runtime code of the counter contract: increments the storage item 0, emits it as a log
+// with the caller as the topic, and returns it.
+var counterCode = common.FromHex("600054600101806000556000523360206000a160206000f3")
+
+// newTestAPI generates a small chain, and serves it to the API through an in-memory remote DB.
+// It returns the simulated backend which produced the chain, so that the results of the API
+// can be compared with the ones of the node.
+func newTestAPI(t *testing.T, ctx context.Context) (*APIImpl, *backends.SimulatedBackend, []*types.Transaction, common.Address) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address  = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		funds    = big.NewInt(1000000000)
+		db       = ethdb.NewMemDatabase()
+	)
+	alloc := core.GenesisAlloc{
+		address:  {Balance: funds},
+		contract: {Balance: new(big.Int), Code: counterCode},
+	}
+	backend := backends.NewSimulatedBackendWithDatabase(db, alloc, 10000000)
+	signer := types.HomesteadSigner{}
+	var txs []*types.Transaction
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 2; j++ {
+			tx, err := types.SignTx(types.NewTransaction(uint64(len(txs)), contract, big.NewInt(1), 100000, big.NewInt(1), nil), signer, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = backend.SendTransaction(ctx, tx); err != nil {
+				t.Fatal(err)
+			}
+			txs = append(txs, tx)
+		}
+		backend.Commit()
+	}
+
+	remoteDB, err := remote.NewDB(ctx, func(dialCtx context.Context) (in io.Reader, out io.Writer, closer io.Closer, err error) {
+		c1, c2 := net.Pipe()
+		go func() {
+			// dialCtx is cancelled after the dial, the server has to live longer
+			_ = remote.Server(ctx, db.DB(), c2, c2, c2)
+		}()
+		return c1, c1, c1, nil
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbReader := remote.NewRemoteBoltDatabase(remoteDB)
+	return NewAPI(remoteDB, dbReader, NewChainContext(dbReader), nil), backend, txs, contract
+}
+
+func TestGetLogs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api, backend, _, contract := newTestAPI(t, ctx)
+	defer backend.Close()
+
+	for _, tt := range []struct {
+		crit  filters.FilterCriteria
+		count int
+	}{
+		{filters.FilterCriteria{FromBlock: big.NewInt(0), ToBlock: big.NewInt(3)}, 6},
+		{filters.FilterCriteria{FromBlock: big.NewInt(2), ToBlock: big.NewInt(2), Addresses: []common.Address{contract}}, 2},
+		{filters.FilterCriteria{FromBlock: big.NewInt(0), ToBlock: big.NewInt(3), Addresses: []common.Address{{}}}, 0},
+		{filters.FilterCriteria{BlockHash: hashPtr(backend.Blockchain().GetBlockByNumber(1).Hash())}, 2},
+	} {
+		crit := tt.crit
+		logs, err := api.GetLogs(ctx, crit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := backend.FilterLogs(ctx, ethereum.FilterQuery(crit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != len(expected) || len(logs) != tt.count {
+			t.Fatalf("number of logs, got %d, expected %d (node returned %d)", len(logs), tt.count, len(expected))
+		}
+		for i := range logs {
+			got, _ := json.Marshal(logs[i])
+			want, _ := json.Marshal(&expected[i])
+			if !bytes.Equal(got, want) {
+				t.Errorf("log %d\ngot:  %s\nwant: %s", i, got, want)
+			}
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api, backend, _, contract := newTestAPI(t, ctx)
+	defer backend.Close()
+
+	gas := hexutil.Uint64(100000)
+	result, err := api.Call(ctx, ethapi.CallArgs{To: &contract, Gas: &gas}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := backend.CallContract(ctx, ethereum.CallMsg{To: &contract, Gas: uint64(gas)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, expected) {
+		t.Errorf("call result, got %x, expected %x", []byte(result), expected)
+	}
+	if new(big.Int).SetBytes(result).Uint64() != 7 {
+		t.Errorf("call result, got %x, expected 7", []byte(result))
+	}
+}
+
+func TestGetTransactionReceipt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api, backend, txs, _ := newTestAPI(t, ctx)
+	defer backend.Close()
+
+	for _, tx := range txs {
+		fields, err := api.GetTransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipt, err := backend.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt == nil {
+			t.Fatalf("receipt of %x not found", tx.Hash())
+		}
+		if fields["status"] != hexutil.Uint(receipt.Status) {
+			t.Errorf("status of %x, got %v, expected %d", tx.Hash(), fields["status"], receipt.Status)
+		}
+		if fields["gasUsed"] != hexutil.Uint64(receipt.GasUsed) {
+			t.Errorf("gasUsed of %x, got %v, expected %d", tx.Hash(), fields["gasUsed"], receipt.GasUsed)
+		}
+		if fields["cumulativeGasUsed"] != hexutil.Uint64(receipt.CumulativeGasUsed) {
+			t.Errorf("cumulativeGasUsed of %x, got %v, expected %d", tx.Hash(), fields["cumulativeGasUsed"], receipt.CumulativeGasUsed)
+		}
+		if fields["blockHash"] != receipt.BlockHash || fields["transactionIndex"] != hexutil.Uint64(receipt.TransactionIndex) {
+			t.Errorf("position of %x, got %v/%v, expected %x/%d", tx.Hash(), fields["blockHash"], fields["transactionIndex"], receipt.BlockHash, receipt.TransactionIndex)
+		}
+		if fields["logsBloom"] != receipt.Bloom {
+			t.Errorf("logsBloom of %x differs", tx.Hash())
+		}
+		got, _ := json.Marshal(fields["logs"])
+		want, _ := json.Marshal(receipt.Logs)
+		if !bytes.Equal(got, want) {
+			t.Errorf("logs of %x\ngot:  %s\nwant: %s", tx.Hash(), got, want)
+		}
+	}
+}
+
+func hashPtr(h common.Hash) *common.Hash {
+	return &h
+}
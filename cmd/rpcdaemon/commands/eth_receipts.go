@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/filters"
+	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// GetTransactionByHash implements eth_getTransactionByHash. Returns information about a transaction given the transaction's hash.
+func (api *APIImpl) GetTransactionByHash(ctx context.Context, hash common.Hash) (*ethapi.RPCTransaction, error) {
+	tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(api.dbReader, hash)
+	if tx == nil {
+		return nil, nil
+	}
+	return newRPCTransaction(tx, blockHash, blockNumber, txIndex), nil
+}
+
+// GetTransactionReceipt implements eth_getTransactionReceipt. Returns the receipt of a transaction given the transaction's hash.
+func (api *APIImpl) GetTransactionReceipt(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	tx, blockHash, blockNumber, txIndex := rawdb.ReadTransaction(api.dbReader, hash)
+	if tx == nil {
+		return nil, nil
+	}
+	receipts := rawdb.ReadReceipts(api.dbReader, blockHash, blockNumber, getChainConfig(api.dbReader))
+	if len(receipts) <= int(txIndex) {
+		return nil, fmt.Errorf("receipt not found for transaction %x", hash)
+	}
+	return marshalReceipt(receipts[txIndex], tx, blockHash, blockNumber, txIndex), nil
+}
+
+// GetLogs implements eth_getLogs. Returns an array of logs matching a given filter object.
+func (api *APIImpl) GetLogs(ctx context.Context, crit filters.FilterCriteria) ([]*types.Log, error) {
+	var begin, end uint64
+	if crit.BlockHash != nil {
+		number := rawdb.ReadHeaderNumber(api.dbReader, *crit.BlockHash)
+		if number == nil {
+			return nil, fmt.Errorf("block not found: %x", *crit.BlockHash)
+		}
+		begin, end = *number, *number
+	} else {
+		latest, err := getBlockNumber(rpc.LatestBlockNumber, api.dbReader)
+		if err != nil {
+			return nil, err
+		}
+		begin, end = latest, latest
+		if crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 {
+			begin = crit.FromBlock.Uint64()
+		}
+		if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 {
+			end = crit.ToBlock.Uint64()
+		}
+	}
+
+	config := getChainConfig(api.dbReader)
+	logs := []*types.Log{}
+	for blockNumber := begin; blockNumber <= end; blockNumber++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		blockHash := rawdb.ReadCanonicalHash(api.dbReader, blockNumber)
+		if crit.BlockHash != nil {
+			blockHash = *crit.BlockHash
+		}
+		if blockHash == (common.Hash{}) {
+			break
+		}
+		header := rawdb.ReadHeader(api.dbReader, blockHash, blockNumber)
+		if header == nil {
+			return nil, fmt.Errorf("header %d (%x) not found", blockNumber, blockHash)
+		}
+		if !bloomFilter(header.Bloom, crit.Addresses, crit.Topics) {
+			continue
+		}
+		var unfiltered []*types.Log
+		for _, receipt := range rawdb.ReadReceipts(api.dbReader, blockHash, blockNumber, config) {
+			unfiltered = append(unfiltered, receipt.Logs...)
+		}
+		logs = append(logs, filterLogs(unfiltered, nil, nil, crit.Addresses, crit.Topics)...)
+	}
+	return logs, nil
+}
@@ -16,11 +16,16 @@ import (
 
 type Config struct {
 	remoteDbAddress  string
+	remoteDbTLSCert  string
+	remoteDbTLSKey   string
+	remoteDbTLSCA    string
+	remoteDbToken    string
 	rpcListenAddress string
 	rpcPort          int
 	rpcCORSDomain    string
 	rpcVirtualHost   string
 	rpcAPI           string
+	rpcGasCap        uint64
 }
 
 var (
@@ -35,11 +40,16 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cpuprofile, "cpuprofile", "", "write cpu profile `file`")
 	rootCmd.PersistentFlags().StringVar(&memprofile, "memprofile", "", "write memory profile `file`")
 	rootCmd.Flags().StringVar(&cfg.remoteDbAddress, "remote-db-addr", "localhost:9999", "address of remote DB listener of a turbo-geth node")
+	rootCmd.Flags().StringVar(&cfg.remoteDbTLSCert, "remote-db-tls-cert", "", "client certificate `file` (PEM) to present to the remote DB listener")
+	rootCmd.Flags().StringVar(&cfg.remoteDbTLSKey, "remote-db-tls-key", "", "private key `file` (PEM) of the client certificate")
+	rootCmd.Flags().StringVar(&cfg.remoteDbTLSCA, "remote-db-tls-ca", "", "CA certificate `file` (PEM) to verify the remote DB listener with. Enables TLS")
+	rootCmd.Flags().StringVar(&cfg.remoteDbToken, "remote-db-token", "", "shared token to authenticate with the remote DB listener")
 	rootCmd.Flags().StringVar(&cfg.rpcListenAddress, "rpcaddr", node.DefaultHTTPHost, "HTTP-RPC server listening interface")
 	rootCmd.Flags().IntVar(&cfg.rpcPort, "rpcport", node.DefaultHTTPPort, "HTTP-RPC server listening port")
 	rootCmd.Flags().StringVar(&cfg.rpcCORSDomain, "rpccorsdomain", "", "Comma separated list of domains from which to accept cross origin requests (browser enforced)")
 	rootCmd.Flags().StringVar(&cfg.rpcVirtualHost, "rpcvhosts", strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","), "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.")
 	rootCmd.Flags().StringVar(&cfg.rpcAPI, "rpcapi", "", "API's offered over the HTTP-RPC interface")
+	rootCmd.Flags().Uint64Var(&cfg.rpcGasCap, "rpc.gascap", 0, "Sets a cap on gas that can be used in eth_call/estimateGas")
 }
 
 var rootCmd = &cobra.Command{
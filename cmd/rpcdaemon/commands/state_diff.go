@@ -0,0 +1,17 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/turbo-geth/eth"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// StateDiff re-implementation of eth/api.go:StateDiff
+func (api *PrivateDebugAPIImpl) StateDiff(ctx context.Context, blockNr rpc.BlockNumber) (eth.StateDiffResult, error) {
+	blockNumber, err := getBlockNumber(blockNr, api.dbReader)
+	if err != nil {
+		return nil, err
+	}
+	return eth.StateDiff(api.dbReader, blockNumber)
+}
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// txTraceResult is the result of a single transaction trace.
+type txTraceResult struct {
+	Result interface{} `json:"result,omitempty"` // Trace results produced by the tracer
+	Error  string      `json:"error,omitempty"`  // Trace failure produced by the tracer
+}
+
+// TraceTransaction re-implementation of eth/api_tracer.go:TraceTransaction
+func (api *PrivateDebugAPIImpl) TraceTransaction(ctx context.Context, hash common.Hash, config *eth.TraceConfig) (interface{}, error) {
+	// Retrieve the transaction and assemble its EVM context
+	tx, blockHash, _, txIndex := rawdb.ReadTransaction(api.dbReader, hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	msg, vmctx, ibs, _, _, err := api.computeTxEnv(ctx, blockHash, int(txIndex))
+	if err != nil {
+		return nil, err
+	}
+	// Trace the transaction and return
+	return eth.TraceTx(ctx, msg, vmctx, ibs, config, getChainConfig(api.dbReader))
+}
+
+// TraceBlockByNumber re-implementation of eth/api_tracer.go:TraceBlockByNumber
+func (api *PrivateDebugAPIImpl) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber, config *eth.TraceConfig) ([]*txTraceResult, error) {
+	blockNumber, err := getBlockNumber(number, api.dbReader)
+	if err != nil {
+		return nil, err
+	}
+	block := rawdb.ReadBlockByNumber(api.dbReader, blockNumber)
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return api.traceBlock(ctx, block, config)
+}
+
+// TraceBlockByHash re-implementation of eth/api_tracer.go:TraceBlockByHash
+func (api *PrivateDebugAPIImpl) TraceBlockByHash(ctx context.Context, hash common.Hash, config *eth.TraceConfig) ([]*txTraceResult, error) {
+	block := rawdb.ReadBlockByHash(api.dbReader, hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	return api.traceBlock(ctx, block, config)
+}
+
+// TraceBlock re-implementation of eth/api_tracer.go:TraceBlock
+func (api *PrivateDebugAPIImpl) TraceBlock(ctx context.Context, blob []byte, config *eth.TraceConfig) ([]*txTraceResult, error) {
+	block := new(types.Block)
+	if err := rlp.Decode(bytes.NewReader(blob), block); err != nil {
+		return nil, fmt.Errorf("could not decode block: %v", err)
+	}
+	return api.traceBlock(ctx, block, config)
+}
+
+// traceBlock executes all the transactions of the block on top of the state of its parent,
+// tracing each of them. Unlike eth/api_tracer.go:traceBlock, transactions are traced
+// sequentially, so that each of them is executed only once against the remote state.
+func (api *PrivateDebugAPIImpl) traceBlock(ctx context.Context, block *types.Block, config *eth.TraceConfig) ([]*txTraceResult, error) {
+	parent := rawdb.ReadBlock(api.dbReader, block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	chainConfig := getChainConfig(api.dbReader)
+	ibs, dbstate := api.computeIntraBlockState(parent)
+	signer := types.MakeSigner(chainConfig, block.Number())
+
+	txs := block.Transactions()
+	results := make([]*txTraceResult, len(txs))
+	for i, tx := range txs {
+		select {
+		default:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		msg, _ := tx.AsMessage(signer)
+		vmctx := core.NewEVMContext(msg, block.Header(), api.chainContext, nil)
+		res, err := eth.TraceTx(ctx, msg, vmctx, ibs, config, chainConfig)
+		if err != nil {
+			results[i] = &txTraceResult{Error: err.Error()}
+		} else {
+			results[i] = &txTraceResult{Result: res}
+		}
+		// Finalize the state so any modifications are visible to the next transaction
+		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
+		if err := ibs.FinalizeTx(chainConfig.WithEIPsFlags(context.Background(), block.Number()), dbstate); err != nil {
+			return nil, fmt.Errorf("could not finalize transaction %#x: %v", tx.Hash(), err)
+		}
+	}
+	return results, nil
+}
@@ -7,6 +7,10 @@ var (
 	statsfile       string
 	block           uint64
 	remoteDbAddress string
+	remoteDbTLSCert string
+	remoteDbTLSKey  string
+	remoteDbTLSCA   string
+	remoteDbToken   string
 )
 
 func withBlock(cmd *cobra.Command) {
@@ -29,4 +33,8 @@ func withStatsfile(cmd *cobra.Command) {
 
 func withRemoteDb(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&remoteDbAddress, "remote-db-addr", "", "remote db rpc address")
+	cmd.Flags().StringVar(&remoteDbTLSCert, "remote-db-tls-cert", "", "client certificate `file` (PEM) to present to the remote DB listener")
+	cmd.Flags().StringVar(&remoteDbTLSKey, "remote-db-tls-key", "", "private key `file` (PEM) of the client certificate")
+	cmd.Flags().StringVar(&remoteDbTLSCA, "remote-db-tls-ca", "", "CA certificate `file` (PEM) to verify the remote DB listener with. Enables TLS")
+	cmd.Flags().StringVar(&remoteDbToken, "remote-db-token", "", "shared token to authenticate with the remote DB listener")
 }
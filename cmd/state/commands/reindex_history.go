@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/state/stateless"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyBucket string
+	bufferSize    int
+	numSamples    int
+)
+
+func init() {
+	withChaindata(reindexHistoryCmd)
+	reindexHistoryCmd.Flags().StringVar(&historyBucket, "bucket", "", "history bucket to re-index (hAT or hST), both if empty")
+	reindexHistoryCmd.Flags().IntVar(&bufferSize, "buffer", 1000000, "number of changes to collect before writing them into the index")
+	reindexHistoryCmd.Flags().IntVar(&numSamples, "samples", 10000, "number of sampled changes to verify the index on")
+	rootCmd.AddCommand(reindexHistoryCmd)
+}
+
+var reindexHistoryCmd = &cobra.Command{
+	Use:   "reindexHistory",
+	Short: "Rebuilds the indexes of the history buckets (hAT/hST) from the change sets, requires THIN_HISTORY",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var hBuckets [][]byte
+		switch historyBucket {
+		case "":
+			hBuckets = [][]byte{dbutils.AccountsHistoryBucket, dbutils.StorageHistoryBucket}
+		case string(dbutils.AccountsHistoryBucket), string(dbutils.StorageHistoryBucket):
+			hBuckets = [][]byte{[]byte(historyBucket)}
+		default:
+			return fmt.Errorf("unknown history bucket %s", historyBucket)
+		}
+		return stateless.ReindexHistory(getContext(), chaindata, hBuckets, bufferSize, numSamples)
+	},
+}
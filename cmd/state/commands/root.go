@@ -2,9 +2,9 @@ package commands
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"os/signal"
 	"runtime"
@@ -47,16 +47,15 @@ func getContext() context.Context {
 }
 
 func connectRemoteDb(ctx context.Context, remoteDbAddress string) (*remote.DB, error) {
-	dial := func(ctx context.Context) (in io.Reader, out io.Writer, closer io.Closer, err error) {
-		dialer := net.Dialer{}
-		conn, err := dialer.DialContext(ctx, "tcp", remoteDbAddress)
+	var tlsConfig *tls.Config
+	if remoteDbTLSCA != "" || remoteDbTLSCert != "" {
+		var err error
+		tlsConfig, err = remote.ClientTLSConfig(remoteDbTLSCert, remoteDbTLSKey, remoteDbTLSCA)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("could not connect to remoteDb. addr: %s. err: %w", remoteDbAddress, err)
+			return nil, err
 		}
-		return conn, conn, conn, err
 	}
-
-	return remote.NewDB(ctx, dial)
+	return remote.NewDB(ctx, remote.TCPDialFunc(remoteDbAddress, tlsConfig), remoteDbToken)
 }
 
 var rootCmd = &cobra.Command{
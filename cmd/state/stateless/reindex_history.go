@@ -0,0 +1,326 @@
+package stateless
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+var errNotThinHistory = errors.New("history indexes are only used with THIN_HISTORY set")
+
+// historySample is a change taken from a change set, which is used to verify the rebuilt index.
+type historySample struct {
+	key      []byte
+	blockNum uint64
+	value    []byte
+}
+
+// historyIndexer rebuilds the index of a history bucket (hAT/hST) from the change sets.
+// The changes are collected into a bounded buffer, which is sorted by key and merged into
+// the bucket once it is full. The progress is saved after every flush, so that the
+// indexing can be resumed after an interruption.
+type historyIndexer struct {
+	db         ethdb.Database
+	hBucket    []byte
+	bufferSize int
+
+	buffer      map[string][]uint64
+	bufferCount int
+
+	samples    []historySample
+	numSamples int
+	numChanges int
+}
+
+// ReindexHistory rebuilds the indexes of the history buckets in the chaindata
+// from the change sets and verifies them on the sampled keys.
+func ReindexHistory(ctx context.Context, chaindata string, hBuckets [][]byte, bufferSize int, numSamples int) error {
+	if !debug.IsThinHistory() {
+		return errNotThinHistory
+	}
+	db, err := ethdb.NewBoltDatabase(chaindata)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, hBucket := range hBuckets {
+		if err := reindexHistory(ctx, db, hBucket, bufferSize, numSamples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reindexHistory(ctx context.Context, db ethdb.Database, hBucket []byte, bufferSize int, numSamples int) error {
+	if !bytes.Equal(hBucket, dbutils.AccountsHistoryBucket) && !bytes.Equal(hBucket, dbutils.StorageHistoryBucket) {
+		return fmt.Errorf("unknown history bucket %s", hBucket)
+	}
+	if bufferSize <= 0 {
+		return fmt.Errorf("invalid buffer size %d", bufferSize)
+	}
+	hi := &historyIndexer{
+		db:         db,
+		hBucket:    hBucket,
+		bufferSize: bufferSize,
+		buffer:     make(map[string][]uint64),
+		numSamples: numSamples,
+	}
+
+	from, resumed, err := hi.readProgress()
+	if err != nil {
+		return err
+	}
+	if resumed {
+		log.Info("Resuming history indexing", "bucket", string(hBucket), "block", from)
+	} else {
+		log.Info("Clearing history index", "bucket", string(hBucket))
+		if err = hi.clear(); err != nil {
+			return err
+		}
+	}
+
+	startTime := time.Now()
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		var lastBlock uint64
+		if lastBlock, done, err = hi.collect(from); err != nil {
+			return err
+		}
+		if hi.bufferCount == 0 {
+			break
+		}
+		if err = hi.flush(lastBlock); err != nil {
+			return err
+		}
+		log.Info("Indexed history", "bucket", string(hBucket), "block", lastBlock, "changes", hi.numChanges)
+		from = lastBlock + 1
+	}
+	log.Info("History indexing finished", "bucket", string(hBucket), "changes", hi.numChanges, "elapsed", time.Since(startTime))
+
+	if err = hi.verify(); err != nil {
+		return err
+	}
+	return db.Delete(dbutils.HistoryIndexProgressKey, hBucket)
+}
+
+// readProgress returns the first block which changes are not indexed yet, and whether
+// there was an interrupted indexing to resume.
+func (hi *historyIndexer) readProgress() (uint64, bool, error) {
+	v, err := hi.db.Get(dbutils.HistoryIndexProgressKey, hi.hBucket)
+	if err == ethdb.ErrKeyNotFound || len(v) == 0 {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint64(v) + 1, true, nil
+}
+
+// indexKey reports whether the key of the history bucket belongs to the index layout.
+// The storage history also keeps the values keyed by composite key + block number,
+// while the accounts history consists of the index only.
+func (hi *historyIndexer) indexKey(k []byte) bool {
+	if bytes.Equal(hi.hBucket, dbutils.AccountsHistoryBucket) {
+		return true
+	}
+	return len(k) == common.HashLength+8+common.HashLength
+}
+
+// clear removes the existing index from the history bucket in batches.
+func (hi *historyIndexer) clear() error {
+	var startkey []byte
+	for {
+		var keys [][]byte
+		if err := hi.db.Walk(hi.hBucket, startkey, 0, func(k, _ []byte) (bool, error) {
+			startkey = common.CopyBytes(k)
+			if hi.indexKey(k) {
+				keys = append(keys, startkey)
+			}
+			return len(keys) < hi.bufferSize, nil
+		}); err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		batch := hi.db.NewBatch()
+		for _, k := range keys {
+			if err := batch.Delete(hi.hBucket, k); err != nil {
+				return err
+			}
+		}
+		if _, err := batch.Commit(); err != nil {
+			return err
+		}
+		if len(keys) < hi.bufferSize {
+			return nil
+		}
+	}
+}
+
+// collect reads the change sets starting from the given block into the buffer,
+// until the buffer is full. It returns the last block read, and whether all the change sets have been read.
+func (hi *historyIndexer) collect(from uint64) (uint64, bool, error) {
+	var lastBlock uint64
+	done := true
+	err := hi.db.Walk(dbutils.ChangeSetBucket, dbutils.EncodeTimestamp(from), 0, func(k, v []byte) (bool, error) {
+		if !bytes.HasSuffix(k, hi.hBucket) {
+			return true, nil
+		}
+		if hi.bufferCount >= hi.bufferSize {
+			done = false
+			return false, nil
+		}
+		blockNum, _ := dbutils.DecodeTimestamp(k)
+		changes, err := dbutils.DecodeChangeSet(v)
+		if err != nil {
+			return false, err
+		}
+		if err := changes.Walk(func(key, value []byte) error {
+			hi.buffer[string(key)] = append(hi.buffer[string(key)], blockNum)
+			hi.bufferCount++
+			hi.sample(key, blockNum, value)
+			return nil
+		}); err != nil {
+			return false, err
+		}
+		lastBlock = blockNum
+		return true, nil
+	})
+	return lastBlock, done, err
+}
+
+// sample keeps a uniform random sample of the changes (reservoir sampling).
+func (hi *historyIndexer) sample(key []byte, blockNum uint64, value []byte) {
+	hi.numChanges++
+	if hi.numSamples == 0 {
+		return
+	}
+	i := len(hi.samples)
+	if i >= hi.numSamples {
+		// #nosec G404
+		if i = rand.Intn(hi.numChanges); i >= hi.numSamples {
+			return
+		}
+	}
+	s := historySample{key: common.CopyBytes(key), blockNum: blockNum, value: common.CopyBytes(value)}
+	if i == len(hi.samples) {
+		hi.samples = append(hi.samples, s)
+	} else {
+		hi.samples[i] = s
+	}
+}
+
+// flush merges the buffer into the history bucket in the key order, and saves the progress.
+func (hi *historyIndexer) flush(lastBlock uint64) error {
+	keys := make([]string, 0, len(hi.buffer))
+	for k := range hi.buffer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	batch := hi.db.NewBatch()
+	for _, k := range keys {
+		index := new(ethdb.HistoryIndex)
+		v, err := hi.db.Get(hi.hBucket, []byte(k))
+		if err != nil && err != ethdb.ErrKeyNotFound {
+			return err
+		}
+		if err = index.Decode(v); err != nil {
+			return err
+		}
+		for _, blockNum := range hi.buffer[k] {
+			// The blocks that have been indexed before the interruption are skipped
+			if n := len(*index); n > 0 && (*index)[n-1] >= blockNum {
+				continue
+			}
+			index.Append(blockNum)
+		}
+		enc, err := index.Encode()
+		if err != nil {
+			return err
+		}
+		if err = batch.Put(hi.hBucket, []byte(k), enc); err != nil {
+			return err
+		}
+		if batch.BatchSize() >= hi.db.IdealBatchSize() {
+			if _, err = batch.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	progress := make([]byte, 8)
+	binary.BigEndian.PutUint64(progress, lastBlock)
+	if err := batch.Put(dbutils.HistoryIndexProgressKey, common.CopyBytes(hi.hBucket), progress); err != nil {
+		return err
+	}
+	if _, err := batch.Commit(); err != nil {
+		return err
+	}
+	hi.buffer = make(map[string][]uint64)
+	hi.bufferCount = 0
+	return nil
+}
+
+// verify checks that the sampled changes are found in the index. For the accounts,
+// the values are also read by GetAsOf. The storage values are read by GetAsOf
+// from the composite keys instead of the index, so only the index is checked for them.
+func (hi *historyIndexer) verify() error {
+	var mismatches int
+	for _, s := range hi.samples {
+		ok, err := hi.verifySample(s)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("history index of %s is inconsistent with the change sets: %d of %d samples mismatch", hi.hBucket, mismatches, len(hi.samples))
+	}
+	log.Info("History index verified", "bucket", string(hi.hBucket), "samples", len(hi.samples))
+	return nil
+}
+
+func (hi *historyIndexer) verifySample(s historySample) (bool, error) {
+	v, err := hi.db.Get(hi.hBucket, s.key)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return false, err
+	}
+	index := new(ethdb.HistoryIndex)
+	if err = index.Decode(v); err != nil {
+		return false, err
+	}
+	if found, ok := index.Search(s.blockNum); !ok || found != s.blockNum {
+		log.Error("Block is missing in the history index", "bucket", string(hi.hBucket), "key", common.Bytes2Hex(s.key), "block", s.blockNum)
+		return false, nil
+	}
+	if !bytes.Equal(hi.hBucket, dbutils.AccountsHistoryBucket) {
+		return true, nil
+	}
+	if v, err = hi.db.GetAsOf(dbutils.AccountsBucket, hi.hBucket, s.key, s.blockNum); err != nil && err != ethdb.ErrKeyNotFound {
+		return false, err
+	}
+	if !bytes.Equal(v, s.value) {
+		log.Error("History value mismatch", "bucket", string(hi.hBucket), "key", common.Bytes2Hex(s.key), "block", s.blockNum,
+			"expected", common.Bytes2Hex(s.value), "got", common.Bytes2Hex(v))
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,110 @@
+package stateless
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func readBucket(t *testing.T, db ethdb.Database, bucket []byte) map[string]string {
+	data := make(map[string]string)
+	if err := db.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+		data[string(k)] = string(v)
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReindexHistory(t *testing.T) {
+	if !debug.IsThinHistory() {
+		t.Skip()
+	}
+	db := ethdb.NewMemDatabase()
+	accountBlocks := make(map[string][]uint64)
+	storageBlocks := make(map[string][]uint64)
+	for blockNum := uint64(1); blockNum <= 20; blockNum++ {
+		batch := db.NewBatch()
+		for i := uint64(0); i < 5; i++ {
+			if (blockNum+i)%3 == 0 {
+				continue
+			}
+			addrHash := common.BigToHash(new(big.Int).SetUint64(i))
+			if err := batch.PutS(dbutils.AccountsHistoryBucket, addrHash[:], addrHash[:], blockNum, true); err != nil {
+				t.Fatal(err)
+			}
+			accountBlocks[string(addrHash[:])] = append(accountBlocks[string(addrHash[:])], blockNum)
+			storageKey := dbutils.GenerateCompositeStorageKey(addrHash, 1, common.Hash{byte(blockNum % 2)})
+			if err := batch.PutS(dbutils.StorageHistoryBucket, storageKey, []byte{byte(blockNum)}, blockNum, true); err != nil {
+				t.Fatal(err)
+			}
+			storageBlocks[string(storageKey)] = append(storageBlocks[string(storageKey)], blockNum)
+		}
+		if _, err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectedIndexes := func(blocks map[string][]uint64) map[string]string {
+		indexes := make(map[string]string)
+		for k, b := range blocks {
+			index := ethdb.HistoryIndex(b)
+			enc, err := index.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexes[k] = string(enc)
+		}
+		return indexes
+	}
+	expectedAccounts := expectedIndexes(accountBlocks)
+	expectedStorage := expectedIndexes(storageBlocks)
+
+	// A stale index entry is removed, while the values of the storage history are kept
+	if err := db.Put(dbutils.AccountsHistoryBucket, common.Hash{0xff}.Bytes(), []byte{0xc1, 0x01}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(dbutils.StorageHistoryBucket, make([]byte, 2*common.HashLength+8), []byte{0xc1, 0x01}); err != nil {
+		t.Fatal(err)
+	}
+	composite, _ := dbutils.CompositeKeySuffix(make([]byte, 2*common.HashLength+8), 1)
+	if err := db.Put(dbutils.StorageHistoryBucket, composite, []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+	expectedStorage[string(composite)] = string([]byte{0x01})
+
+	for _, hBucket := range [][]byte{dbutils.AccountsHistoryBucket, dbutils.StorageHistoryBucket} {
+		if err := reindexHistory(context.Background(), db, hBucket, 7, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(expectedAccounts, readBucket(t, db, dbutils.AccountsHistoryBucket)) {
+		t.Error("unexpected accounts history")
+	}
+	if !reflect.DeepEqual(expectedStorage, readBucket(t, db, dbutils.StorageHistoryBucket)) {
+		t.Error("unexpected storage history")
+	}
+	if len(readBucket(t, db, dbutils.HistoryIndexProgressKey)) != 0 {
+		t.Error("progress is not removed")
+	}
+
+	// Resuming an interrupted indexing doesn't duplicate the blocks already indexed
+	progress := make([]byte, 8)
+	binary.BigEndian.PutUint64(progress, 10)
+	if err := db.Put(dbutils.HistoryIndexProgressKey, dbutils.AccountsHistoryBucket, progress); err != nil {
+		t.Fatal(err)
+	}
+	if err := reindexHistory(context.Background(), db, dbutils.AccountsHistoryBucket, 7, 10); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expectedAccounts, readBucket(t, db, dbutils.AccountsHistoryBucket)) {
+		t.Error("unexpected accounts history after resuming")
+	}
+}
@@ -63,6 +63,11 @@ func runBlock(dbstate *state.Stateless, chainConfig *params.ChainConfig,
 	}
 	if checkRoot {
 		if err := dbstate.CheckRoot(header.Root); err != nil {
+			filename := fmt.Sprintf("root_%d.txt", block.NumberU64())
+			if f, err1 := os.Create(filename); err1 == nil {
+				dbstate.PrintTrie(f)
+				f.Close()
+			}
 			fmt.Printf("block hash = %x\n", block.Hash())
 			return fmt.Errorf("error processing block %d: %v", block.NumberU64(), err)
 		}
@@ -145,7 +145,7 @@ var (
 	}
 	AncientFlag = DirectoryFlag{
 		Name:  "datadir.ancient",
-		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
+		Usage: "Data directory for ancient chain segments (kept in chaindata if not set)",
 	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
@@ -217,7 +217,7 @@ var (
 	defaultSyncMode = eth.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "light", "beam", "stateless", or "firehose")`,
 		Value: &defaultSyncMode,
 	}
 	GCModePruningFlag = cli.BoolFlag{
@@ -239,6 +239,18 @@ var (
 		Usage: `Time of tick`,
 		Value: time.Second * 2,
 	}
+	PruningWatchAddressesFlag = cli.StringFlag{
+		Name:  "pruning.watch_addresses",
+		Usage: "Comma separated accounts, which history and storage history are never pruned",
+	}
+	PruningCheckpointsFlag = cli.Uint64Flag{
+		Name:  "pruning.checkpoints",
+		Usage: "Keep the state as of every Nth block readable from the history (0 = disabled)",
+	}
+	PruningKeepAboveFlag = cli.Uint64Flag{
+		Name:  "pruning.keep_above",
+		Usage: "Never prune the history above this block (0 = disabled)",
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -314,6 +326,22 @@ var (
 		Name:  "download-only",
 		Usage: "Run in download only mode - only fetch blocks but not process them",
 	}
+	ServeWitnessesFlag = cli.BoolFlag{
+		Name:  "witness.serve",
+		Usage: "Extract the witnesses of the inserted blocks and serve the recent ones over the witness protocol",
+	}
+	WitnessRetentionFlag = cli.Uint64Flag{
+		Name:  "witness.retention",
+		Usage: "Number of the most recent blocks which witnesses are stored in the database and served via RPC (0 = disabled)",
+	}
+	BinaryTrieFlag = cli.BoolFlag{
+		Name:  "trie.binary",
+		Usage: "Maintain the binary state trie in memory and store its root for each inserted block (test networks and small states only)",
+	}
+	ParallelExecutionFlag = cli.IntFlag{
+		Name:  "exec.parallel",
+		Usage: "Number of goroutines executing the transactions of the inserted blocks concurrently (0 or 1 = sequential)",
+	}
 	// Ethash settings
 	EthashCacheDirFlag = DirectoryFlag{
 		Name:  "ethash.cachedir",
@@ -430,7 +458,10 @@ var (
 	StorageModeFlag = cli.StringFlag{
 		Name: "storage-mode",
 		Usage: `Configures the storage mode of the app:
+* a - write the accounts and storage items read and written by each transaction to the DB
+* c - write call trace from and to address index to the DB
 * h - write history to the DB
+* l - write log address and topic index to the DB
 * p - write preimages to the DB
 * r - write receipts to the DB
 * t - write tx lookup index to the DB`,
@@ -451,6 +482,35 @@ var (
 		Usage: "network address (for example, localhost:9999) to start remote database server on",
 		Value: "",
 	}
+	RemoteDbTLSCertFlag = cli.StringFlag{
+		Name:  "remote-db-tls-cert",
+		Usage: "Certificate file (PEM) of the remote database server, enables TLS",
+		Value: "",
+	}
+	RemoteDbTLSKeyFlag = cli.StringFlag{
+		Name:  "remote-db-tls-key",
+		Usage: "Private key file (PEM) of the remote database server certificate",
+		Value: "",
+	}
+	RemoteDbTLSCAFlag = cli.StringFlag{
+		Name:  "remote-db-tls-ca",
+		Usage: "CA certificate file (PEM) to verify remote database clients with, requires client certificates",
+		Value: "",
+	}
+	RemoteDbTokenFlag = cli.StringFlag{
+		Name:  "remote-db-token",
+		Usage: "Shared token the remote database clients have to present",
+		Value: "",
+	}
+	RemoteDbWritableFlag = cli.BoolFlag{
+		Name:  "remote-db-writable",
+		Usage: "Allow remote database clients to write into the buckets listed in --remote-db-writable-buckets",
+	}
+	RemoteDbWritableBucketsFlag = cli.StringFlag{
+		Name:  "remote-db-writable-buckets",
+		Usage: "Comma separated list of buckets remote database clients may write into (state and history buckets are not allowed)",
+		Value: "",
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -1002,6 +1062,14 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 // read-only interface to the databae
 func setRemoteDb(ctx *cli.Context, cfg *node.Config) {
 	cfg.RemoteDbListenAddress = ctx.GlobalString(RemoteDbListenAddress.Name)
+	cfg.RemoteDbTLSCert = ctx.GlobalString(RemoteDbTLSCertFlag.Name)
+	cfg.RemoteDbTLSKey = ctx.GlobalString(RemoteDbTLSKeyFlag.Name)
+	cfg.RemoteDbTLSCA = ctx.GlobalString(RemoteDbTLSCAFlag.Name)
+	cfg.RemoteDbToken = ctx.GlobalString(RemoteDbTokenFlag.Name)
+	cfg.RemoteDbWritable = ctx.GlobalBool(RemoteDbWritableFlag.Name)
+	if ctx.GlobalIsSet(RemoteDbWritableBucketsFlag.Name) {
+		cfg.RemoteDbWritableBuckets = splitAndTrim(ctx.GlobalString(RemoteDbWritableBucketsFlag.Name))
+	}
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -1487,8 +1555,22 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	cfg.BlocksBeforePruning = ctx.GlobalUint64(GCModeLimitFlag.Name)
 	cfg.BlocksToPrune = ctx.GlobalUint64(GCModeBlockToPruneFlag.Name)
 	cfg.PruningTimeout = ctx.GlobalDuration(GCModeTickTimeout.Name)
+	if ctx.GlobalIsSet(PruningWatchAddressesFlag.Name) {
+		for _, account := range splitAndTrim(ctx.GlobalString(PruningWatchAddressesFlag.Name)) {
+			if !common.IsHexAddress(account) {
+				Fatalf("Invalid account in --%s: %s", PruningWatchAddressesFlag.Name, account)
+			}
+			cfg.PruningWatchAddresses = append(cfg.PruningWatchAddresses, common.HexToAddress(account))
+		}
+	}
+	cfg.PruningCheckpoints = ctx.GlobalUint64(PruningCheckpointsFlag.Name)
+	cfg.PruningKeepAbove = ctx.GlobalUint64(PruningKeepAboveFlag.Name)
 
 	cfg.DownloadOnly = ctx.GlobalBoolT(DownloadOnlyFlag.Name)
+	cfg.ServeWitnesses = ctx.GlobalBool(ServeWitnessesFlag.Name)
+	cfg.WitnessRetention = ctx.GlobalUint64(WitnessRetentionFlag.Name)
+	cfg.BinaryTrie = ctx.GlobalBool(BinaryTrieFlag.Name)
+	cfg.ParallelExecution = ctx.GlobalInt(ParallelExecutionFlag.Name)
 
 	mode, err := eth.StorageModeFromString(ctx.GlobalString(StorageModeFlag.Name))
 	if err != nil {
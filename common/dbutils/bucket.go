@@ -79,4 +79,53 @@ var (
 	// last block that was pruned
 	// it's saved one in 5 minutes
 	LastPrunedBlockKey = []byte("LastPrunedBlock")
+
+	// last block which changes are re-indexed in the history bucket
+	// key - history bucket(hAT/hST)
+	// value - block number (uint64 big endian)
+	HistoryIndexProgressKey = []byte("HistoryIndexProgress")
+
+	// key - log address
+	// value - list of blocks (ethdb.HistoryIndex encoding) with logs emitted by the address
+	LogAddressIndexBucket = []byte("lAI")
+
+	// key - log topic
+	// value - list of blocks (ethdb.HistoryIndex encoding) with logs carrying the topic
+	LogTopicIndexBucket = []byte("lTI")
+
+	// key - num (uint64 big endian) + hash
+	// value - RLP encoded distinct log addresses and topics of the block, used to unwind the log index
+	LogIndexChangeSetBucket = []byte("lCS")
+
+	// first block which logs are indexed in the log index buckets
+	// value - block number (uint64 big endian)
+	LogIndexStartKey = []byte("LogIndexStart")
+
+	// key - num (uint64 big endian) + hash
+	// value - RLP encoded witness of the block and the keys touched by the block
+	BlockWitnessBucket = []byte("wtn")
+
+	// key - num (uint64 big endian) + hash
+	// value - root hash of the binary state trie after the block
+	BinaryStateRootBucket = []byte("bRT")
+
+	// key - address
+	// value - list of blocks (ethdb.HistoryIndex encoding) with call traces made from the address
+	CallFromIndexBucket = []byte("cFI")
+
+	// key - address
+	// value - list of blocks (ethdb.HistoryIndex encoding) with call traces made to the address
+	CallToIndexBucket = []byte("cTI")
+
+	// key - num (uint64 big endian) + hash
+	// value - RLP encoded distinct call trace from and to addresses of the block, used to unwind the call trace index
+	CallTraceIndexChangeSetBucket = []byte("cCS")
+
+	// first block which call traces are indexed in the call trace index buckets
+	// value - block number (uint64 big endian)
+	CallTraceIndexStartKey = []byte("CallTraceIndexStart")
+
+	// key - num (uint64 big endian) + hash
+	// value - RLP encoded access lists of the transactions of the block
+	BlockAccessListsBucket = []byte("aLS")
 )
@@ -55,11 +55,16 @@ func HeaderNumberKey(hash common.Hash) []byte {
 
 // blockBodyKey = blockBodyPrefix + num (uint64 big endian) + hash
 func BlockBodyKey(number uint64, hash common.Hash) []byte {
-	return append(EncodeBlockNumber(number), hash.Bytes()...)
+	return BlockNumHashKey(number, hash)
 }
 
 // blockReceiptsKey = blockReceiptsPrefix + num (uint64 big endian) + hash
 func BlockReceiptsKey(number uint64, hash common.Hash) []byte {
+	return BlockNumHashKey(number, hash)
+}
+
+// BlockNumHashKey = num (uint64 big endian) + hash, the key of the per-block data
+func BlockNumHashKey(number uint64, hash common.Hash) []byte {
 	return append(EncodeBlockNumber(number), hash.Bytes()...)
 }
 
@@ -124,26 +124,7 @@ func (v *BlockValidator) ValidateBody(ctx context.Context, block *types.Block) e
 func (v *BlockValidator) ValidateState(block, parent *types.Block, statedb *state.IntraBlockState, tds *state.TrieDbState, receipts types.Receipts, usedGas uint64) error {
 	header := block.Header()
 	var errorBuf strings.Builder
-	if block.GasUsed() != usedGas {
-		fmt.Fprintf(&errorBuf, "invalid gas used (remote: %d local: %d)", block.GasUsed(), usedGas)
-	}
-	// Validate the received block's bloom with the one derived from the generated receipts.
-	// For valid blocks this should always validate to true.
-	rbloom := types.CreateBloom(receipts)
-	if rbloom != header.Bloom {
-		if errorBuf.Len() > 0 {
-			errorBuf.WriteString("; ")
-		}
-		fmt.Fprintf(&errorBuf, "invalid bloom (remote: %x  local: %x)", header.Bloom, rbloom)
-	}
-	// Tre receipt Trie's root (R = (Tr [[H1, R1], ... [Hn, R1]]))
-	receiptSha := types.DeriveSha(receipts)
-	if receiptSha != header.ReceiptHash {
-		if errorBuf.Len() > 0 {
-			errorBuf.WriteString("; ")
-		}
-		fmt.Fprintf(&errorBuf, "invalid receipt root hash (remote: %x local: %x)", header.ReceiptHash, receiptSha)
-	}
+	validateReceipts(header, receipts, usedGas, &errorBuf)
 	// Validate the state root against the received state root and throw
 	// an error if they don't match.
 	if root := tds.LastRoot(); header.Root != root {
@@ -173,6 +154,49 @@ func (v *BlockValidator) ValidateState(block, parent *types.Block, statedb *stat
 	return nil
 }
 
+// ValidateStatelessState is like ValidateState, but for the blocks executed on top of
+// the state built from their witnesses. The state root is computed by the stateless state.
+func (v *BlockValidator) ValidateStatelessState(block *types.Block, s *state.Stateless, receipts types.Receipts, usedGas uint64) error {
+	header := block.Header()
+	var errorBuf strings.Builder
+	validateReceipts(header, receipts, usedGas, &errorBuf)
+	if err := s.CheckRoot(header.Root); err != nil {
+		if errorBuf.Len() > 0 {
+			errorBuf.WriteString("; ")
+		}
+		fmt.Fprintf(&errorBuf, "invalid merkle root: %v", err)
+	}
+	if errorBuf.Len() > 0 {
+		return errors.New(errorBuf.String())
+	}
+	return nil
+}
+
+// validateReceipts checks the gas used, the bloom and the receipt root of the block
+// against the ones derived from the generated receipts, appending the mismatches to errorBuf.
+func validateReceipts(header *types.Header, receipts types.Receipts, usedGas uint64, errorBuf *strings.Builder) {
+	if header.GasUsed != usedGas {
+		fmt.Fprintf(errorBuf, "invalid gas used (remote: %d local: %d)", header.GasUsed, usedGas)
+	}
+	// Validate the received block's bloom with the one derived from the generated receipts.
+	// For valid blocks this should always validate to true.
+	rbloom := types.CreateBloom(receipts)
+	if rbloom != header.Bloom {
+		if errorBuf.Len() > 0 {
+			errorBuf.WriteString("; ")
+		}
+		fmt.Fprintf(errorBuf, "invalid bloom (remote: %x  local: %x)", header.Bloom, rbloom)
+	}
+	// Tre receipt Trie's root (R = (Tr [[H1, R1], ... [Hn, R1]]))
+	receiptSha := types.DeriveSha(receipts)
+	if receiptSha != header.ReceiptHash {
+		if errorBuf.Len() > 0 {
+			errorBuf.WriteString("; ")
+		}
+		fmt.Fprintf(errorBuf, "invalid receipt root hash (remote: %x local: %x)", header.ReceiptHash, receiptSha)
+	}
+}
+
 // CalcGasLimit computes the gas limit of the next block after parent. It aims
 // to keep the baseline gas above the provided floor, and increase it towards the
 // ceil if the blocks are full. If the ceil is exceeded, it will always decrease
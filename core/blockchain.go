@@ -35,6 +35,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common/mclock"
 	"github.com/ledgerwatch/turbo-geth/common/prque"
 	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
@@ -83,6 +84,7 @@ const (
 	blockCacheLimit     = 256
 	receiptsCacheLimit  = 32
 	txLookupCacheLimit  = 1024
+	witnessCacheLimit   = 256
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
 	badBlockLimit       = 10
@@ -126,6 +128,7 @@ type CacheConfig struct {
 	ArchiveSyncInterval uint64
 	DownloadOnly        bool
 	NoHistory           bool
+	RetentionPolicy     RetentionPolicy // Parts of the history, which the pruner keeps (optional)
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -165,13 +168,19 @@ type BlockChain struct {
 	currentBlock     atomic.Value // Current head of the block chain
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
 
-	trieDbState   *state.TrieDbState
+	trieDbState    *state.TrieDbState
+	stateFetcher   state.StateFetcher // fetches the missing state on demand (beam sync)
+	witnessFetcher WitnessFetcher     // fetches the block witnesses, if the blocks are validated without the state
+
 	bodyCache     *lru.Cache // Cache for the most recent block bodies
 	bodyRLPCache  *lru.Cache // Cache for the most recent block bodies in RLP encoded format
 	receiptsCache *lru.Cache // Cache for the most recent receipts per block
 	blockCache    *lru.Cache // Cache for the most recent entire blocks
 	txLookupCache *lru.Cache // Cache for the most recent transaction lookup data.
 	futureBlocks  *lru.Cache // future blocks are blocks added for later processing
+	witnessCache  *lru.Cache // Cache for the witnesses of the most recent blocks, nil if they are not extracted
+
+	witnessRetention uint64 // Number of the most recent blocks which witnesses are stored in the database, 0 if they are not stored
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
@@ -186,16 +195,20 @@ type BlockChain struct {
 	processor  Processor  // Block transaction processor interface
 	vmConfig   vm.Config
 
-	badBlocks           *lru.Cache                     // Bad block cache
-	shouldPreserve      func(*types.Block) bool        // Function used to determine whether should preserve the given block.
-	terminateInsert     func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
-	highestKnownBlock   uint64
-	highestKnownBlockMu sync.Mutex
-	enableReceipts      bool // Whether receipts need to be written to the database
-	enableTxLookupIndex bool // Whether we store tx lookup index into the database
-	enablePreimages     bool // Whether we store preimages into the database
-	resolveReads        bool
-	pruner              Pruner
+	badBlocks            *lru.Cache                     // Bad block cache
+	shouldPreserve       func(*types.Block) bool        // Function used to determine whether should preserve the given block.
+	terminateInsert      func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
+	highestKnownBlock    uint64
+	highestKnownBlockMu  sync.Mutex
+	enableReceipts       bool // Whether receipts need to be written to the database
+	enableTxLookupIndex  bool // Whether we store tx lookup index into the database
+	enablePreimages      bool // Whether we store preimages into the database
+	enableLogIndex       bool // Whether we store log address and topic index into the database
+	enableBinaryTrie     bool // Whether the binary state trie is maintained and its roots are stored into the database
+	enableCallTraceIndex bool // Whether we store call trace from and to address index into the database
+	enableAccessLists    bool // Whether we store the access lists of the transactions into the database
+	resolveReads         bool
+	pruner               Pruner
 }
 
 // NewBlockChain returns a fully initialised block chain using information
@@ -349,6 +362,115 @@ func (bc *BlockChain) EnablePreimages(ep bool) {
 	bc.enablePreimages = ep
 }
 
+// EnableLogIndex turns the maintenance of the log address and topic index on or off.
+// Turning it off discards the start of the index, so that the filters stop using it.
+func (bc *BlockChain) EnableLogIndex(el bool) {
+	bc.enableLogIndex = el
+	if !el && rawdb.ReadLogIndexStart(bc.db) != nil {
+		rawdb.DeleteLogIndexStart(bc.db)
+	}
+}
+
+// EnableCallTraceIndex turns the maintenance of the call trace from and to address index on or off.
+// While it is on, the blocks are processed with the call tracer, which replaces the tracer of the VM config.
+// Turning it off discards the start of the index, so that the trace filters stop using it.
+func (bc *BlockChain) EnableCallTraceIndex(ec bool) {
+	bc.enableCallTraceIndex = ec
+	if !ec && rawdb.ReadCallTraceIndexStart(bc.db) != nil {
+		rawdb.DeleteCallTraceIndexStart(bc.db)
+	}
+}
+
+// EnableBinaryTrie makes the blockchain maintain the binary state trie alongside the hexary one
+// and store its root for each inserted block. The binary trie is kept entirely in memory,
+// so it is disabled with a warning if the state has more than state.MaxBinaryTrieItems items.
+func (bc *BlockChain) EnableBinaryTrie(eb bool) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	bc.enableBinaryTrie = eb
+	// The state is re-created with or without the binary trie on the next insertion
+	bc.trieDbState = nil
+}
+
+// EnableAccessLists makes the blockchain store the accounts and storage items read and written
+// by each transaction of the inserted blocks.
+func (bc *BlockChain) EnableAccessLists(ea bool) {
+	bc.enableAccessLists = ea
+}
+
+// SetParallelExecution makes the blockchain execute the transactions of the inserted blocks
+// concurrently, with the given number of goroutines, speculatively on top of the state before
+// the block. The transactions conflicting with the preceding ones are executed again, so the
+// results are the same as of the sequential execution. Fewer than 2 workers turn it off.
+func (bc *BlockChain) SetParallelExecution(workers int) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	if p, ok := bc.processor.(*StateProcessor); ok {
+		p.SetParallelWorkers(workers)
+	}
+}
+
+// SetWitnessFetcher makes the blockchain validate the blocks without having the state locally.
+// Each block is executed on top of the state built from its witness, which is fetched
+// from the network, and is accepted only if the resulting state root matches the header.
+func (bc *BlockChain) SetWitnessFetcher(f WitnessFetcher) {
+	bc.witnessFetcher = f
+}
+
+// EnableWitnessCache makes the blockchain extract the witnesses of the inserted blocks
+// and keep the ones of the most recent blocks in memory, to be served to the stateless peers.
+func (bc *BlockChain) EnableWitnessCache(ew bool) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	if !ew {
+		bc.witnessCache = nil
+	} else if bc.witnessCache == nil {
+		bc.witnessCache, _ = lru.New(witnessCacheLimit)
+	}
+	bc.updateWitnessExtraction()
+}
+
+// SetWitnessRetention makes the blockchain extract the witnesses of the inserted blocks
+// and store the ones of the given number of the most recent blocks in the database.
+// Zero retention turns the storing off, the witnesses already stored are kept.
+func (bc *BlockChain) SetWitnessRetention(retention uint64) {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+	bc.witnessRetention = retention
+	bc.updateWitnessExtraction()
+}
+
+// extractWitnesses tells whether the witnesses of the inserted blocks are needed.
+func (bc *BlockChain) extractWitnesses() bool {
+	return bc.witnessCache != nil || bc.witnessRetention > 0
+}
+
+func (bc *BlockChain) updateWitnessExtraction() {
+	if bc.trieDbState != nil {
+		bc.trieDbState.SetResolveReads(bc.resolveReads || bc.extractWitnesses())
+		bc.trieDbState.SetExtractWitness(bc.extractWitnesses())
+	}
+}
+
+// GetBlockWitness retrieves the witness of a recently inserted block,
+// or nil if it's not cached.
+func (bc *BlockChain) GetBlockWitness(hash common.Hash) []byte {
+	cache := bc.witnessCache
+	if cache == nil {
+		return nil
+	}
+	if witness, ok := cache.Get(hash); ok {
+		return witness.([]byte)
+	}
+	return nil
+}
+
+// SetStateFetcher makes the blockchain execute blocks without having the whole state locally.
+// The missing accounts, storage items and bytecodes are fetched and stored on demand.
+func (bc *BlockChain) SetStateFetcher(f state.StateFetcher) {
+	bc.stateFetcher = f
+}
+
 func (bc *BlockChain) GetTrieDbState() (*state.TrieDbState, error) {
 	if bc.trieDbState == nil {
 		var err error
@@ -372,12 +494,23 @@ func (bc *BlockChain) GetTrieDbStateByBlock(root common.Hash, blockNr uint64) (*
 			return nil, err
 		}
 		tds.SetNoHistory(bc.NoHistory())
-		tds.SetResolveReads(bc.resolveReads)
+		tds.SetResolveReads(bc.resolveReads || bc.extractWitnesses())
+		tds.SetExtractWitness(bc.extractWitnesses())
 		tds.EnablePreimages(bc.enablePreimages)
-		if err := tds.Rebuild(); err != nil {
+		if bc.stateFetcher != nil {
+			// The state is not expected to be complete, so the trie is built on demand
+			tds.SetStateFetcher(bc.stateFetcher)
+		} else if err := tds.Rebuild(); err != nil {
 			log.Error("Rebuiling aborted", "error", err)
 			return nil, err
 		}
+		if bc.enableBinaryTrie && bc.stateFetcher == nil {
+			if err := tds.EnableBinaryTrie(); err != nil {
+				// The binary trie is optional, so the blocks are still imported without it
+				log.Warn("Binary state trie disabled", "error", err)
+				bc.enableBinaryTrie = false
+			}
+		}
 		log.Info("Creation complete.")
 		return tds, nil
 	}
@@ -544,6 +677,8 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	bc.chainmu.Lock()
 	bc.currentBlock.Store(block)
 	headBlockGauge.Update(int64(block.NumberU64()))
+	// The state of the previous head is no longer relevant
+	bc.trieDbState = nil
 	bc.chainmu.Unlock()
 
 	log.Info("Committed new head block", "number", block.Number(), "hash", hash)
@@ -840,6 +975,8 @@ func (bc *BlockChain) GetBlockByNumber(number uint64) *types.Block {
 }
 
 // GetReceiptsByHash retrieves the receipts for all transactions in a given block.
+// If the receipts are not stored (see EnableReceipts), they are regenerated by
+// re-executing the block on top of the historical state.
 func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	if receipts, ok := bc.receiptsCache.Get(hash); ok {
 		return receipts.(types.Receipts)
@@ -850,12 +987,88 @@ func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	}
 	receipts := rawdb.ReadReceipts(bc.db, hash, *number, bc.chainConfig)
 	if receipts == nil {
-		return nil
+		block := bc.GetBlock(hash, *number)
+		if block == nil {
+			return nil
+		}
+		var err error
+		if receipts, err = bc.regenerateReceipts(block); err != nil {
+			log.Warn("Failed to regenerate receipts", "number", *number, "hash", hash, "err", err)
+			return nil
+		}
 	}
 	bc.receiptsCache.Add(hash, receipts)
 	return receipts
 }
 
+// regenerateReceipts derives the receipts of the block by re-executing its transactions
+// on top of the state as of the parent block. The result is checked against the receipt
+// root of the header, as the history needed to reconstruct the state may be pruned.
+func (bc *BlockChain) regenerateReceipts(block *types.Block) (types.Receipts, error) {
+	receipts := make(types.Receipts, 0, len(block.Transactions()))
+	if len(block.Transactions()) > 0 {
+		var (
+			header  = block.Header()
+			usedGas = new(uint64)
+			gp      = new(GasPool).AddGas(block.GasLimit())
+			// Before Byzantium, the receipts hold the intermediate state roots,
+			// so the transactions are applied to the historical trie
+			byzantium   = bc.chainConfig.IsByzantium(block.Number())
+			tds         *state.TrieDbState
+			stateReader state.StateReader
+			stateWriter state.StateWriter
+		)
+		if byzantium {
+			dbstate := state.NewDbState(bc.db, block.NumberU64()-1)
+			stateReader, stateWriter = dbstate, dbstate
+		} else {
+			parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+			if parent == nil {
+				return nil, fmt.Errorf("parent block #%d not found", block.NumberU64()-1)
+			}
+			var err error
+			if tds, err = state.NewTrieDbState(parent.Root, bc.db, parent.Number.Uint64()); err != nil {
+				return nil, err
+			}
+			tds.SetHistorical(true)
+			tds.StartNewBuffer()
+			stateReader, stateWriter = tds, tds.TrieStateWriter()
+		}
+		statedb := state.New(stateReader)
+		// Mutate the state according to any hard-fork specs, as the block processing does
+		if bc.chainConfig.DAOForkSupport && bc.chainConfig.DAOForkBlock != nil && bc.chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+			misc.ApplyDAOHardFork(statedb)
+		}
+		for i, tx := range block.Transactions() {
+			statedb.Prepare(tx.Hash(), block.Hash(), i)
+			receipt, err := ApplyTransaction(bc.chainConfig, bc, nil, gp, statedb, stateWriter, header, tx, usedGas, vm.Config{})
+			if err != nil {
+				return nil, err
+			}
+			receipts = append(receipts, receipt)
+			if !byzantium {
+				tds.StartNewBuffer()
+			}
+		}
+		if !byzantium {
+			roots, err := tds.ComputeTrieRoots()
+			if err != nil {
+				return nil, err
+			}
+			for i, receipt := range receipts {
+				receipt.PostState = roots[i].Bytes()
+			}
+		}
+	}
+	if err := receipts.DeriveFields(bc.chainConfig, block.Hash(), block.NumberU64(), block.Transactions()); err != nil {
+		return nil, err
+	}
+	if hash := types.DeriveSha(receipts); hash != block.ReceiptHash() {
+		return nil, fmt.Errorf("regenerated receipt root mismatch: have %x, want %x", hash, block.ReceiptHash())
+	}
+	return receipts, nil
+}
+
 // GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
 // [deprecated by eth/62]
 func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
@@ -1074,9 +1287,13 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 	// this function only accepts canonical chain data. All side chain will be reverted
 	// eventually.
 	writeAncient := func(blockChain types.Blocks, receiptChain []types.Receipts) (int, error) {
+		if _, err := bc.db.Ancients(); err != nil {
+			return 0, fmt.Errorf("ancient store unavailable: %v", err)
+		}
 		var (
-			previous = bc.CurrentFastBlock()
-			batch    = bc.db.NewBatch()
+			previous  = bc.CurrentFastBlock()
+			batch     = bc.db.NewBatch()
+			ancientDb = bc.db.(ethdb.AncientWriter)
 		)
 		// If any error occurs before updating the head or we are inserting a side chain,
 		// all the data written this time wll be rolled back.
@@ -1102,16 +1319,43 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 				return i, fmt.Errorf("containing header #%d [%x…] unknown", block.Number(), block.Hash().Bytes()[:4])
 			}
 
-			// Turbo-Geth doesn't have fast sync support
+			// Migrate all the blocks below the inserted ones, which are not frozen yet
+			// (at least the genesis block, when the ancient store is empty).
+			for {
+				frozen, err := bc.db.Ancients()
+				if err != nil {
+					return i, err
+				}
+				if frozen >= block.NumberU64() {
+					break
+				}
+				h := rawdb.ReadCanonicalHash(bc.db, frozen)
+				b := rawdb.ReadBlock(bc.db, h, frozen)
+				if b == nil {
+					return i, fmt.Errorf("canonical block #%d unknown", frozen)
+				}
+				size += rawdb.WriteAncientBlock(ancientDb, b, rawdb.ReadRawReceipts(bc.db, h, frozen), rawdb.ReadTd(bc.db, h, frozen))
 
+				// Always keep genesis block in active database.
+				if b.NumberU64() != 0 {
+					deleted = append(deleted, &numberHash{b.NumberU64(), b.Hash()})
+				}
+			}
 			// Flush data into ancient database.
-			size += rawdb.WriteAncientBlock(bc.db, block, receiptChain[i], bc.GetTd(block.Hash(), block.NumberU64()))
+			size += rawdb.WriteAncientBlock(ancientDb, block, receiptChain[i], bc.GetTd(block.Hash(), block.NumberU64()))
 			if bc.enableTxLookupIndex {
 				rawdb.WriteTxLookupEntries(batch, block)
 			}
+			if bc.enableLogIndex {
+				bc.writeLogIndex(batch, block, receiptLogs(receiptChain[i]))
+			}
 
 			stats.processed++
 		}
+		// Sync the ancient store explicitly to ensure all data has been flushed to disk.
+		if err := ancientDb.Sync(); err != nil {
+			return 0, err
+		}
 		// Flush all tx-lookup index data.
 		size += batch.BatchSize()
 		if _, err := batch.Commit(); err != nil {
@@ -1182,6 +1426,9 @@ func (bc *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain [
 			if bc.enableTxLookupIndex {
 				rawdb.WriteTxLookupEntries(batch, block)
 			}
+			if bc.enableLogIndex {
+				bc.writeLogIndex(batch, block, receiptLogs(receiptChain[i]))
+			}
 
 			stats.processed++
 			if batch.BatchSize() >= batch.IdealBatchSize() {
@@ -1313,6 +1560,9 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	if stateDb != nil && bc.enablePreimages && !bc.cacheConfig.DownloadOnly {
 		rawdb.WritePreimages(bc.db, stateDb.Preimages())
 	}
+	if bc.enableLogIndex && !bc.cacheConfig.DownloadOnly {
+		bc.writeLogIndex(bc.db, block, logs)
+	}
 
 	status = CanonStatTy
 	//} else {
@@ -1345,6 +1595,49 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	return status, nil
 }
 
+// writeLogIndex adds the logs of a canonical block to the log address and topic
+// index, marking the start of the index on its first use.
+func (bc *BlockChain) writeLogIndex(db rawdb.DatabaseReadWriter, block *types.Block, logs []*types.Log) {
+	if rawdb.ReadLogIndexStart(db) == nil {
+		rawdb.WriteLogIndexStart(db, block.NumberU64())
+	}
+	rawdb.WriteLogIndex(db, block.Hash(), block.NumberU64(), logs)
+}
+
+// writeCallTraceIndex adds the call traces of a canonical block to the call trace from and to
+// address index, marking the start of the index on its first use. The miner and the uncle miners
+// are indexed as the recipients of the block rewards.
+func (bc *BlockChain) writeCallTraceIndex(db rawdb.DatabaseReadWriter, block *types.Block, tracer *vm.CallTracer) {
+	if rawdb.ReadCallTraceIndexStart(db) == nil {
+		rawdb.WriteCallTraceIndexStart(db, block.NumberU64())
+	}
+	tos := tracer.Tos()
+	seen := make(map[common.Address]struct{}, len(tos))
+	for _, addr := range tos {
+		seen[addr] = struct{}{}
+	}
+	authors := []common.Address{block.Coinbase()}
+	for _, uncle := range block.Uncles() {
+		authors = append(authors, uncle.Coinbase)
+	}
+	for _, addr := range authors {
+		if _, ok := seen[addr]; !ok {
+			seen[addr] = struct{}{}
+			tos = append(tos, addr)
+		}
+	}
+	rawdb.WriteCallTraceIndex(db, block.Hash(), block.NumberU64(), tracer.Froms(), tos)
+}
+
+// receiptLogs flattens the logs of the given receipts.
+func receiptLogs(receipts types.Receipts) []*types.Log {
+	var logs []*types.Log
+	for _, receipt := range receipts {
+		logs = append(logs, receipt.Logs...)
+	}
+	return logs
+}
+
 // addFutureBlock checks if the block is within the max allowed window to get
 // accepted for future processing, and returns an error if the block is too far
 // ahead and was not added.
@@ -1394,7 +1687,16 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	if err := bc.addJob(); err != nil {
 		return 0, err
 	}
-	ctx := bc.WithContext(context.Background(), chain[0].Number())
+	ctx, cancel := context.WithCancel(bc.WithContext(context.Background(), chain[0].Number()))
+	defer cancel()
+	go func() {
+		// Stopping the blockchain aborts the fetches of the missing state
+		select {
+		case <-bc.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 	bc.chainmu.Lock()
 	defer func() {
 		bc.chainmu.Unlock()
@@ -1579,12 +1881,13 @@ func (bc *BlockChain) insertChain(ctx context.Context, chain types.Blocks, verif
 		}
 		readBlockNr := parentNumber
 		var root common.Hash
-		if bc.trieDbState == nil && !bc.cacheConfig.DownloadOnly {
+		stateful := !bc.cacheConfig.DownloadOnly && bc.witnessFetcher == nil
+		if bc.trieDbState == nil && stateful {
 			if _, err = bc.GetTrieDbState(); err != nil {
 				return k, err
 			}
 		}
-		if !bc.cacheConfig.DownloadOnly {
+		if stateful {
 			root = bc.trieDbState.LastRoot()
 		}
 		var parentRoot common.Hash
@@ -1592,7 +1895,7 @@ func (bc *BlockChain) insertChain(ctx context.Context, chain types.Blocks, verif
 			parentRoot = parent.Root()
 		}
 
-		if parent != nil && root != parentRoot && !bc.cacheConfig.DownloadOnly {
+		if parent != nil && root != parentRoot && stateful {
 			log.Info("Rewinding from", "block", bc.CurrentBlock().NumberU64(), "to block", readBlockNr)
 			if _, err = bc.db.Commit(); err != nil {
 				log.Error("Could not commit chainDb before rewinding", "error", err)
@@ -1630,14 +1933,33 @@ func (bc *BlockChain) insertChain(ctx context.Context, chain types.Blocks, verif
 			}
 		}
 		var stateDB *state.IntraBlockState
+		var callTracer *vm.CallTracer
 		var receipts types.Receipts
 		var usedGas uint64
 		var logs []*types.Log
-		if !bc.cacheConfig.DownloadOnly {
+		if bc.witnessFetcher != nil && !bc.cacheConfig.DownloadOnly {
+			if receipts, logs, usedGas, err = bc.processStateless(block, parentRoot); err != nil {
+				bc.reportBlock(block, receipts, err)
+				return k, err
+			}
+		} else if !bc.cacheConfig.DownloadOnly {
+			if bc.stateFetcher != nil {
+				// The missing state is fetched as part of the insertion, and abandoned together with it
+				bc.trieDbState.SetFetchContext(ctx)
+			}
 			stateDB = state.New(bc.trieDbState)
+			if bc.enableAccessLists {
+				stateDB.EnableAccessRecording()
+			}
+			vmConfig := bc.vmConfig
+			if bc.enableCallTraceIndex {
+				callTracer = vm.NewCallTracer()
+				vmConfig.Debug = true
+				vmConfig.Tracer = callTracer
+			}
 			// Process block using the parent state as reference point.
 			//t0 := time.Now()
-			receipts, logs, usedGas, err = bc.processor.Process(block, stateDB, bc.trieDbState, bc.vmConfig)
+			receipts, logs, usedGas, err = bc.processor.Process(block, stateDB, bc.trieDbState, vmConfig)
 			//t1 := time.Now()
 			if err != nil {
 				bc.db.Rollback()
@@ -1685,6 +2007,22 @@ func (bc *BlockChain) insertChain(ctx context.Context, chain types.Blocks, verif
 			bc.trieDbState = nil
 			return k, err
 		}
+		if bc.extractWitnesses() && stateDB != nil {
+			bc.storeWitness(block)
+		}
+		if callTracer != nil {
+			bc.writeCallTraceIndex(bc.db, block, callTracer)
+		}
+		if bc.enableAccessLists && stateDB != nil {
+			rawdb.WriteBlockAccessLists(bc.db, block.Hash(), block.NumberU64(), stateDB.AccessLists())
+		}
+		if bc.enableBinaryTrie && stateDB != nil {
+			if err := bc.storeBinaryRoot(block); err != nil {
+				bc.db.Rollback()
+				bc.trieDbState = nil
+				return k, err
+			}
+		}
 		//atomic.StoreUint32(&followupInterrupt, 1)
 
 		// Update the metrics touched during block commit
@@ -1743,6 +2081,57 @@ func (bc *BlockChain) insertChain(ctx context.Context, chain types.Blocks, verif
 	return 0, nil
 }
 
+// storeWitness caches the witness of the just inserted block and stores it in the database,
+// removing the witnesses of the blocks which fell out of the retention window. The witnesses
+// stored within the same batch are only removed after the batch is committed.
+func (bc *BlockChain) storeWitness(block *types.Block) {
+	witness := bc.trieDbState.LastWitness()
+	if witness == nil {
+		return
+	}
+	if bc.witnessCache != nil {
+		bc.witnessCache.Add(block.Hash(), witness)
+	}
+	if bc.witnessRetention > 0 {
+		rawdb.WriteBlockWitness(bc.db, block.Hash(), block.NumberU64(), &rawdb.BlockWitnessEntry{
+			Witness: witness,
+			Keys:    bc.trieDbState.LastWitnessKeys(),
+		})
+		if block.NumberU64() >= bc.witnessRetention {
+			rawdb.PruneBlockWitnesses(bc.db, block.NumberU64()-bc.witnessRetention)
+		}
+	}
+}
+
+// storeBinaryRoot stores the root of the binary state trie after the just inserted block.
+func (bc *BlockChain) storeBinaryRoot(block *types.Block) error {
+	root, ok, err := bc.trieDbState.BinaryRoot()
+	if err != nil {
+		return fmt.Errorf("could not compute binary state root of block %d: %v", block.NumberU64(), err)
+	}
+	if ok {
+		rawdb.WriteBinaryStateRoot(bc.db, block.Hash(), block.NumberU64(), root)
+	}
+	return nil
+}
+
+// processStateless executes the block on top of the state built from its witness
+// and validates the result, without accessing the state in the database.
+func (bc *BlockChain) processStateless(block *types.Block, parentRoot common.Hash) (types.Receipts, []*types.Log, uint64, error) {
+	s, err := bc.witnessFetcher.FetchBlockWitness(block, parentRoot)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("could not fetch witness of block %d: %v", block.NumberU64(), err)
+	}
+	receipts, logs, usedGas, err := bc.processor.ProcessStateless(block, s, bc.vmConfig)
+	if err != nil {
+		return receipts, nil, 0, err
+	}
+	if err = bc.Validator().ValidateStatelessState(block, s, receipts, usedGas); err != nil {
+		return receipts, nil, 0, err
+	}
+	return receipts, logs, usedGas, nil
+}
+
 // statsReportLimit is the time limit during import and export after which we
 // always print out progress. This avoids the user wondering what's going on.
 const statsReportLimit = 8 * time.Second
@@ -1920,6 +2309,15 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	// Delete the old chain
 	for _, oldBlock := range oldChain {
 		rawdb.DeleteCanonicalHash(bc.db, oldBlock.NumberU64())
+		if bc.enableLogIndex {
+			rawdb.UnindexLogs(bc.db, oldBlock.Hash(), oldBlock.NumberU64())
+		}
+		if bc.enableCallTraceIndex {
+			rawdb.UnindexCallTraces(bc.db, oldBlock.Hash(), oldBlock.NumberU64())
+		}
+		if bc.enableAccessLists {
+			rawdb.DeleteBlockAccessLists(bc.db, oldBlock.Hash(), oldBlock.NumberU64())
+		}
 	}
 	bc.insert(commonBlock)
 	// Insert the new chain, taking care of the proper incremental order
@@ -1934,6 +2332,12 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		if bc.enableTxLookupIndex {
 			rawdb.WriteTxLookupEntries(bc.db, newChain[i])
 		}
+		if bc.enableLogIndex {
+			rawdb.IndexLogs(bc.db, newChain[i].Hash(), newChain[i].NumberU64())
+		}
+		if bc.enableCallTraceIndex {
+			rawdb.IndexCallTraces(bc.db, newChain[i].Hash(), newChain[i].NumberU64())
+		}
 		addedTxs = append(addedTxs, newChain[i].Transactions()...)
 	}
 	// When transactions get deleted from the database, the receipts that were
@@ -1949,6 +2353,12 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			break
 		}
 		rawdb.DeleteCanonicalHash(bc.db, i)
+		if bc.enableLogIndex {
+			rawdb.UnindexLogs(bc.db, hash, i)
+		}
+		if bc.enableCallTraceIndex {
+			rawdb.UnindexCallTraces(bc.db, hash, i)
+		}
 	}
 
 	if _, err := bc.db.Commit(); err != nil {
@@ -17,7 +17,9 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -705,7 +707,7 @@ func TestFastVsFullChains(t *testing.T) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(frdir)
-	ancientDb, err := ethdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -757,6 +759,151 @@ func TestFastVsFullChains(t *testing.T) {
 	}
 }
 
+// Tests that the blocks inserted below the ancient limit are moved into the
+// freezer, and are still served from there.
+func TestAncientReceiptChainInsertion(t *testing.T) {
+	// Configure and generate a sample block chain
+	var (
+		gendb   = ethdb.NewMemDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(1000000000)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: funds}},
+		}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainID)
+	)
+	height := uint64(64)
+	blocks, receipts := GenerateChain(context.TODO(), gspec.Config, genesis, ethash.NewFaker(), gendb, int(height), func(i int, block *BlockGen) {
+		block.SetCoinbase(common.Address{0x00})
+		if i%3 == 2 {
+			tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	gspec.MustCommit(ancientDb)
+	ancient, _ := NewBlockChain(ancientDb, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	defer ancient.Stop()
+
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := ancient.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := ancient.InsertReceiptChain(blocks, receipts, height/2); err != nil {
+		t.Fatalf("failed to insert receipt %d: %v", n, err)
+	}
+	// The genesis block is migrated into the freezer together with the inserted blocks
+	if frozen, err := ancientDb.Ancients(); err != nil || frozen != height/2+1 {
+		t.Fatalf("failed to truncate ancient store, want %v, have %v", height/2+1, frozen)
+	}
+	for _, block := range blocks[:height/2] {
+		num, hash := block.NumberU64(), block.Hash()
+		if has, _ := ancientDb.Has(dbutils.BlockBodyPrefix, dbutils.BlockBodyKey(num, hash)); has {
+			t.Errorf("block #%d [%x]: body is not removed from the database", num, hash)
+		}
+		if anhash := rawdb.ReadCanonicalHash(ancientDb, num); anhash != hash {
+			t.Errorf("block #%d: canonical hash mismatch: have %x, want %x", num, anhash, hash)
+		}
+		if header := rawdb.ReadHeader(ancientDb, hash, num); header == nil || header.Hash() != hash {
+			t.Errorf("block #%d [%x]: header mismatch: have %v", num, hash, header)
+		}
+		if td := rawdb.ReadTd(ancientDb, hash, num); td == nil || td.Cmp(ancient.GetTd(block.ParentHash(), num-1)) <= 0 {
+			t.Errorf("block #%d [%x]: td mismatch: have %v", num, hash, td)
+		}
+		if anblock := rawdb.ReadBlock(ancientDb, hash, num); anblock == nil || types.DeriveSha(anblock.Transactions()) != types.DeriveSha(block.Transactions()) {
+			t.Errorf("block #%d [%x]: block mismatch: have %v, want %v", num, hash, anblock, block)
+		}
+		if anreceipts := rawdb.ReadReceipts(ancientDb, hash, num, gspec.Config); types.DeriveSha(anreceipts) != types.DeriveSha(receipts[num-1]) {
+			t.Errorf("block #%d [%x]: receipts mismatch: have %v, want %v", num, hash, anreceipts, receipts[num-1])
+		}
+	}
+	// The side chain header with the same number is not served from the freezer
+	side := types.CopyHeader(blocks[0].Header())
+	side.Extra = []byte("side")
+	if header := rawdb.ReadHeader(ancientDb, side.Hash(), 1); header != nil {
+		t.Errorf("side header served from the ancient store: %v", header)
+	}
+}
+
+// Tests that the receipts, which are not stored, are regenerated by re-executing the blocks.
+func TestReceiptsRegeneration(t *testing.T) {
+	testReceiptsRegeneration(t, params.TestChainConfig)
+}
+
+// Tests that the regenerated receipts of the blocks before Byzantium hold the intermediate state roots.
+func TestReceiptsRegenerationHomestead(t *testing.T) {
+	testReceiptsRegeneration(t, &params.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0)})
+}
+
+func testReceiptsRegeneration(t *testing.T, config *params.ChainConfig) {
+	var (
+		gendb   = ethdb.NewMemDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(1000000000)
+		gspec   = &Genesis{
+			Config: config,
+			Alloc:  GenesisAlloc{address: {Balance: funds}},
+		}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.MakeSigner(config, big.NewInt(1))
+	)
+	blocks, receipts := GenerateChain(context.TODO(), gspec.Config, genesis, ethash.NewFaker(), gendb, 8, func(i int, block *BlockGen) {
+		// Every other block is empty
+		for j := 0; j < i%2*(i+1); j++ {
+			tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{byte(j)}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	db := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	defer blockchain.Stop()
+	blockchain.EnableReceipts(false)
+
+	if n, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to process block %d: %v", n, err)
+	}
+	for i, block := range blocks {
+		if rawdb.HasReceipts(blockchain.db, block.Hash(), block.NumberU64()) {
+			t.Fatalf("block #%d: receipts are stored", block.NumberU64())
+		}
+		regenerated := blockchain.GetReceiptsByHash(block.Hash())
+		if regenerated == nil || len(regenerated) != len(receipts[i]) {
+			t.Fatalf("block #%d: receipts count mismatch: have %d, want %d", block.NumberU64(), len(regenerated), len(receipts[i]))
+		}
+		for j, receipt := range regenerated {
+			want := receipts[i][j]
+			if receipt.TxHash != want.TxHash || receipt.GasUsed != want.GasUsed || receipt.CumulativeGasUsed != want.CumulativeGasUsed || receipt.Status != want.Status || !bytes.Equal(receipt.PostState, want.PostState) {
+				t.Errorf("block #%d, receipt %d: mismatch: have %v, want %v", block.NumberU64(), j, receipt, want)
+			}
+			if receipt.BlockHash != block.Hash() || receipt.BlockNumber.Uint64() != block.NumberU64() || receipt.TransactionIndex != uint(j) {
+				t.Errorf("block #%d, receipt %d: derived fields mismatch: %v", block.NumberU64(), j, receipt)
+			}
+		}
+	}
+}
+
 // Tests that various import methods move the chain head pointers to the correct
 // positions.
 func TestLightVsFastVsFullChainHeads(t *testing.T) {
@@ -780,7 +927,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 			t.Fatalf("failed to create temp freezer dir: %v", err)
 		}
 		defer os.Remove(dir)
-		db, err := ethdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), dir, "")
+		db, err := rawdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), dir, "")
 		if err != nil {
 			t.Fatalf("failed to create temp freezer db: %v", err)
 		}
@@ -877,6 +1024,272 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	assert(t, "light", light, height/2, 0, 0)
 }
 
+// witnessSource is a WitnessFetcher serving the witnesses cached by a stateful blockchain.
+type witnessSource struct {
+	bc *BlockChain
+}
+
+func (ws *witnessSource) FetchBlockWitness(block *types.Block, parentRoot common.Hash) (*state.Stateless, error) {
+	witness := ws.bc.GetBlockWitness(block.Hash())
+	if witness == nil {
+		return nil, fmt.Errorf("no witness for block %d", block.NumberU64())
+	}
+	return state.NewStateless(parentRoot, witness, block.NumberU64()-1, false, false)
+}
+
+// Tests that the blocks are executed on top of the witnesses produced by a stateful
+// node, without writing any state, both before and after Byzantium.
+func TestStatelessValidation(t *testing.T) {
+	for _, config := range []*params.ChainConfig{params.TestChainConfig, {ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0)}} {
+		var (
+			key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+			addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+			// this code generates a log
+			code        = common.Hex2Bytes("60606040525b7f24ec1d3ff24c2f6ff210738839dbc339cd45a5294d85c79361016243157aae7b60405180905060405180910390a15b600a8060416000396000f360606040526008565b00")
+			gspec       = &Genesis{Config: config, Alloc: GenesisAlloc{addr1: {Balance: big.NewInt(10000000000000)}}}
+			db          = ethdb.NewMemDatabase()
+			genesis     = gspec.MustCommit(db)
+			statelessDb = db.MemCopy()
+			signer      = types.MakeSigner(config, big.NewInt(1))
+		)
+		full, _ := NewBlockChain(db, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+		full.EnableWitnessCache(true)
+		ctx := full.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+		chain, _ := GenerateChain(ctx, config, genesis, ethash.NewFaker(), db.MemCopy(), 5, func(i int, gen *BlockGen) {
+			var tx *types.Transaction
+			var err error
+			if i == 1 {
+				tx, err = types.SignTx(types.NewContractCreation(gen.TxNonce(addr1), new(big.Int), 1000000, new(big.Int), code), signer, key1)
+			} else {
+				tx, err = types.SignTx(types.NewTransaction(gen.TxNonce(addr1), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, nil, nil), signer, key1)
+			}
+			if err != nil {
+				t.Fatalf("failed to create tx: %v", err)
+			}
+			gen.AddTx(tx)
+		})
+		if _, err := full.InsertChain(chain); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+
+		stateless, _ := NewBlockChain(statelessDb, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+		stateless.SetWitnessFetcher(&witnessSource{full})
+		// The block is rejected if the result of its execution doesn't match the header
+		header := chain[0].Header()
+		header.GasUsed++
+		if _, err := stateless.InsertChain(types.Blocks{types.NewBlockWithHeader(header).WithBody(chain[0].Transactions(), chain[0].Uncles())}); err == nil {
+			t.Fatalf("block with invalid gas used accepted")
+		}
+		if _, err := stateless.InsertChain(chain); err != nil {
+			t.Fatalf("failed to insert chain statelessly: %v", err)
+		}
+		if head := stateless.CurrentBlock().Hash(); head != chain[len(chain)-1].Hash() {
+			t.Fatalf("head mismatch: have %x, want %x", head, chain[len(chain)-1].Hash())
+		}
+		if acc, _ := state.NewDbState(statelessDb, 5).ReadAccountData(common.Address{1}); acc != nil {
+			t.Fatalf("state written by stateless validation")
+		}
+		full.Stop()
+		stateless.Stop()
+	}
+}
+
+// Tests that the witnesses of the inserted blocks are stored, and the ones
+// falling out of the retention window are removed.
+func TestWitnessRetention(t *testing.T) {
+	var (
+		key1, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr1     = crypto.PubkeyToAddress(key1.PublicKey)
+		gspec     = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr1: {Balance: big.NewInt(10000000000000)}}}
+		db        = ethdb.NewMemDatabase()
+		genesis   = gspec.MustCommit(db)
+		signer    = types.HomesteadSigner{}
+		retention = uint64(3)
+	)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	defer blockchain.Stop()
+	blockchain.EnableWitnessCache(true)
+	blockchain.SetWitnessRetention(retention)
+
+	ctx := blockchain.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+	chain, _ := GenerateChain(ctx, gspec.Config, genesis, ethash.NewFaker(), db.MemCopy(), 8, func(i int, gen *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(gen.TxNonce(addr1), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, nil, nil), signer, key1)
+		if err != nil {
+			t.Fatalf("failed to create tx: %v", err)
+		}
+		gen.AddTx(tx)
+	})
+	// The blocks are inserted one by one, as they arrive at the head of the chain
+	for i := range chain {
+		if _, err := blockchain.InsertChain(chain[i : i+1]); err != nil {
+			t.Fatalf("failed to insert block %d: %v", chain[i].NumberU64(), err)
+		}
+	}
+	head := chain[len(chain)-1].NumberU64()
+	for _, block := range chain {
+		entry := rawdb.ReadBlockWitness(db, block.Hash(), block.NumberU64())
+		if block.NumberU64()+retention <= head {
+			if entry != nil {
+				t.Errorf("block %d: witness not removed", block.NumberU64())
+			}
+			continue
+		}
+		if entry == nil {
+			t.Fatalf("block %d: witness not stored", block.NumberU64())
+		}
+		if !bytes.Equal(entry.Witness, blockchain.GetBlockWitness(block.Hash())) {
+			t.Errorf("block %d: stored witness differs from the cached one", block.NumberU64())
+		}
+		if len(entry.Keys) == 0 {
+			t.Errorf("block %d: touched keys not stored", block.NumberU64())
+		}
+		if _, _, err := state.BinaryBlockWitness(block.NumberU64(), entry.Witness, entry.Keys); err != nil {
+			t.Errorf("block %d: could not convert witness: %v", block.NumberU64(), err)
+		}
+	}
+}
+
+// Tests that the blocks executed in parallel end up in the same state as the ones
+// executed sequentially, with both independent and conflicting transactions.
+func TestParallelExecution(t *testing.T) {
+	for _, config := range []*params.ChainConfig{params.TestChainConfig, {ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(0)}} {
+		var (
+			keys    = make([]*ecdsa.PrivateKey, 9)
+			addrs   = make([]common.Address, len(keys))
+			alloc   = make(GenesisAlloc)
+			counter = common.HexToAddress("0x000000000000000000000000000000000000cccc")
+			reader  = common.HexToAddress("0x000000000000000000000000000000000000dddd")
+			suicide = common.HexToAddress("0x000000000000000000000000000000000000aaaa")
+			// this code generates a log
+			code   = common.Hex2Bytes("60606040525b7f24ec1d3ff24c2f6ff210738839dbc339cd45a5294d85c79361016243157aae7b60405180905060405180910390a15b600a8060416000396000f360606040526008565b00")
+			signer = types.MakeSigner(config, big.NewInt(1))
+		)
+		for i := range keys {
+			keys[i], _ = crypto.GenerateKey()
+			addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+			alloc[addrs[i]] = GenesisAccount{Balance: big.NewInt(10000000000000)}
+		}
+		// Increments the storage item given in the calldata, and emits a log
+		alloc[counter] = GenesisAccount{
+			Code: []byte{
+				byte(vm.PUSH1), 0x00, byte(vm.CALLDATALOAD), byte(vm.DUP1), byte(vm.SLOAD),
+				byte(vm.PUSH1), 0x01, byte(vm.ADD), byte(vm.SWAP1), byte(vm.SSTORE),
+				byte(vm.PUSH1), 0x00, byte(vm.DUP1), byte(vm.LOG0), byte(vm.STOP),
+			},
+			Balance: new(big.Int),
+		}
+		// Stores the balance of the coinbase
+		alloc[reader] = GenesisAccount{
+			Code:    []byte{byte(vm.COINBASE), byte(vm.BALANCE), byte(vm.PUSH1), 0x00, byte(vm.SSTORE), byte(vm.STOP)},
+			Balance: new(big.Int),
+		}
+		// Selfdestructs if called
+		alloc[suicide] = GenesisAccount{Code: []byte{byte(vm.PC), byte(vm.SELFDESTRUCT)}, Balance: big.NewInt(1000)}
+
+		gspec := &Genesis{Config: config, Alloc: alloc}
+		db := ethdb.NewMemDatabase()
+		genesis := gspec.MustCommit(db)
+		parallelDb := db.MemCopy()
+
+		sequential, _ := NewBlockChain(db, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+		sequential.EnableAccessLists(true)
+		ctx := sequential.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+		chain, _ := GenerateChain(ctx, config, genesis, ethash.NewFaker(), db.MemCopy(), 4, func(i int, gen *BlockGen) {
+			gen.SetCoinbase(common.Address{0xc0})
+			txs := []struct {
+				key   int
+				to    *common.Address
+				value int64
+				data  []byte
+				gas   uint64
+			}{
+				{0, &common.Address{byte(i + 1)}, 1000, nil, params.TxGas},             // independent transfer
+				{1, &counter, 0, common.LeftPadBytes([]byte{1}, 32), 100000},           // increments the same item
+				{2, &counter, 0, common.LeftPadBytes([]byte{1}, 32), 100000},           // as this one
+				{3, &counter, 0, common.LeftPadBytes([]byte{2}, 32), 100000},           // but not this one
+				{0, &common.Address{byte(i + 1)}, 1000, nil, params.TxGas},             // same sender as the first one
+				{4, &reader, 0, nil, 100000},                                           // reads the fees paid so far
+				{5, nil, 0, code, 1000000},                                             // creates a contract
+				{6, &suicide, 0, nil, 100000},                                          // destroys the contract
+				{7, &common.Address{0xc0}, 1000, nil, params.TxGas},                    // pays the coinbase
+				{8, &counter, 0, common.LeftPadBytes([]byte{byte(i + 3)}, 32), 100000}, // independent from the rest
+			}
+			for _, tx := range txs {
+				var (
+					signed *types.Transaction
+					err    error
+				)
+				if tx.to == nil {
+					signed, err = types.SignTx(types.NewContractCreation(gen.TxNonce(addrs[tx.key]), new(big.Int), tx.gas, big.NewInt(1), tx.data), signer, keys[tx.key])
+				} else {
+					signed, err = types.SignTx(types.NewTransaction(gen.TxNonce(addrs[tx.key]), *tx.to, big.NewInt(tx.value), tx.gas, big.NewInt(1), tx.data), signer, keys[tx.key])
+				}
+				if err != nil {
+					t.Fatalf("failed to create tx: %v", err)
+				}
+				gen.AddTx(signed)
+			}
+		})
+		if _, err := sequential.InsertChain(chain); err != nil {
+			t.Fatalf("failed to insert chain sequentially: %v", err)
+		}
+		parallel, _ := NewBlockChain(parallelDb, nil, config, ethash.NewFaker(), vm.Config{}, nil)
+		parallel.SetParallelExecution(4)
+		parallel.EnableAccessLists(true)
+		// The blocks are rejected if the results of their execution don't match the headers
+		if _, err := parallel.InsertChain(chain); err != nil {
+			t.Fatalf("failed to insert chain in parallel: %v", err)
+		}
+		for _, block := range chain {
+			want := rawdb.ReadReceipts(db, block.Hash(), block.NumberU64(), config)
+			have := rawdb.ReadReceipts(parallelDb, block.Hash(), block.NumberU64(), config)
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("block %d: receipts mismatch: have %v, want %v", block.NumberU64(), have, want)
+			}
+			wantLists := rawdb.ReadBlockAccessLists(db, block.Hash(), block.NumberU64())
+			if len(wantLists) != len(block.Transactions()) {
+				t.Fatalf("block %d: access lists not stored: have %d, want %d", block.NumberU64(), len(wantLists), len(block.Transactions()))
+			}
+			if haveLists := rawdb.ReadBlockAccessLists(parallelDb, block.Hash(), block.NumberU64()); !reflect.DeepEqual(haveLists, wantLists) {
+				t.Errorf("block %d: access lists mismatch", block.NumberU64())
+			}
+		}
+		// Once its storage item exists, the counter is only written by having the item incremented
+		lists := rawdb.ReadBlockAccessLists(db, chain[1].Hash(), chain[1].NumberU64())
+		written := false
+		for _, write := range lists[1].Writes {
+			if write.Address == counter {
+				written = true
+				if write.Account || !reflect.DeepEqual(write.StorageKeys, []common.Hash{common.BytesToHash([]byte{1})}) {
+					t.Errorf("counter write mismatch: %+v", write)
+				}
+			}
+		}
+		if !written {
+			t.Errorf("counter write missing")
+		}
+		// Paying the fees to the coinbase writes it without reading it
+		coinbaseWritten := false
+		for _, write := range lists[0].Writes {
+			coinbaseWritten = coinbaseWritten || write.Address == common.Address{0xc0}
+		}
+		for _, read := range lists[0].Reads {
+			if read.Address == (common.Address{0xc0}) {
+				t.Errorf("coinbase read by a transfer: %+v", read)
+			}
+		}
+		if !coinbaseWritten {
+			t.Errorf("coinbase write missing")
+		}
+		st, _, _ := parallel.State()
+		if have, want := st.GetState(counter, common.BytesToHash([]byte{1})), common.BytesToHash([]byte{byte(2 * len(chain))}); have != want {
+			t.Errorf("counter mismatch: have %x, want %x", have, want)
+		}
+		sequential.Stop()
+		parallel.Stop()
+	}
+}
+
 // Tests that chain reorganisations handle transaction removals and reinsertions.
 func TestChainTxReorgs(t *testing.T) {
 	var (
@@ -1067,6 +1480,210 @@ func TestLogReorgs(t *testing.T) {
 	}
 }
 
+func TestLogIndexReorgs(t *testing.T) {
+	var (
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+		db      = ethdb.NewMemDatabase()
+		// this code generates a log
+		code      = common.Hex2Bytes("60606040525b7f24ec1d3ff24c2f6ff210738839dbc339cd45a5294d85c79361016243157aae7b60405180905060405180910390a15b600a8060416000396000f360606040526008565b00")
+		gspec     = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr1: {Balance: big.NewInt(10000000000000)}}}
+		genesis   = gspec.MustCommit(db)
+		genesisDb = db.MemCopy()
+		signer    = types.NewEIP155Signer(gspec.Config.ChainID)
+		contract  = crypto.CreateAddress(addr1, 0)
+	)
+
+	cacheConfig := &CacheConfig{
+		TrieCleanLimit: 256,
+		TrieDirtyLimit: 256,
+		TrieTimeLimit:  5 * time.Minute,
+		NoHistory:      false,
+		Disabled:       true,
+	}
+	blockchain, _ := NewBlockChain(db, cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	ctx := blockchain.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+	blockchain.EnableReceipts(true)
+	blockchain.EnableLogIndex(true)
+	defer blockchain.Stop()
+
+	// makeChain generates a chain of the given length, creating the log emitting contract in the given block
+	makeChain := func(n int, logBlock int) []*types.Block {
+		chain, _ := GenerateChain(ctx, params.TestChainConfig, genesis, ethash.NewFaker(), genesisDb.MemCopy(), n, func(i int, gen *BlockGen) {
+			if i == logBlock {
+				tx, err := types.SignTx(types.NewContractCreation(gen.TxNonce(addr1), new(big.Int), 1000000, new(big.Int), code), signer, key1)
+				if err != nil {
+					t.Fatalf("failed to create tx: %v", err)
+				}
+				gen.AddTx(tx)
+			}
+		})
+		return chain
+	}
+	checkIndex := func(want []uint64) {
+		t.Helper()
+		blocks, err := rawdb.FindLogIndexBlocks(blockchain.db, []common.Address{contract}, nil, 0, blockchain.CurrentBlock().NumberU64())
+		if err != nil {
+			t.Fatalf("failed to read log index: %v", err)
+		}
+		if !reflect.DeepEqual(blocks, want) {
+			t.Fatalf("log index mismatch: have %v, want %v", blocks, want)
+		}
+	}
+	chain := makeChain(2, 1)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if start := rawdb.ReadLogIndexStart(blockchain.db); start == nil || *start != 1 {
+		t.Fatalf("log index start mismatch: have %v, want 1", start)
+	}
+	checkIndex([]uint64{2})
+
+	// Reorg to a longer chain without logs, the block must be unindexed
+	if _, err := blockchain.InsertChain(makeChain(3, -1)); err != nil {
+		t.Fatalf("failed to insert forked chain: %v", err)
+	}
+	checkIndex(nil)
+	if entry := rawdb.ReadLogIndexEntry(blockchain.db, chain[1].Hash(), chain[1].NumberU64()); entry == nil || len(entry.Addresses) != 1 || entry.Addresses[0] != contract {
+		t.Fatalf("log index entry of the side block mismatch: %v", entry)
+	}
+	// Reorg to an even longer chain emitting the log in a later block
+	if _, err := blockchain.InsertChain(makeChain(4, 3)); err != nil {
+		t.Fatalf("failed to insert forked chain: %v", err)
+	}
+	checkIndex([]uint64{4})
+}
+
+// Tests that the call trace index follows the canonical chain on reorgs.
+func TestCallTraceIndexReorgs(t *testing.T) {
+	var (
+		key1, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr1     = crypto.PubkeyToAddress(key1.PublicKey)
+		target    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		db        = ethdb.NewMemDatabase()
+		gspec     = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr1: {Balance: big.NewInt(10000000000000)}}}
+		genesis   = gspec.MustCommit(db)
+		genesisDb = db.MemCopy()
+		signer    = types.NewEIP155Signer(gspec.Config.ChainID)
+	)
+
+	cacheConfig := &CacheConfig{
+		TrieCleanLimit: 256,
+		TrieDirtyLimit: 256,
+		TrieTimeLimit:  5 * time.Minute,
+		NoHistory:      false,
+		Disabled:       true,
+	}
+	blockchain, _ := NewBlockChain(db, cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	ctx := blockchain.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+	blockchain.EnableCallTraceIndex(true)
+	defer blockchain.Stop()
+
+	// makeChain generates a chain of the given length, sending a transfer to the target in the given block
+	makeChain := func(n int, callBlock int) []*types.Block {
+		chain, _ := GenerateChain(ctx, params.TestChainConfig, genesis, ethash.NewFaker(), genesisDb.MemCopy(), n, func(i int, gen *BlockGen) {
+			if i == callBlock {
+				tx, err := types.SignTx(types.NewTransaction(gen.TxNonce(addr1), target, big.NewInt(1), 21000, new(big.Int), nil), signer, key1)
+				if err != nil {
+					t.Fatalf("failed to create tx: %v", err)
+				}
+				gen.AddTx(tx)
+			}
+		})
+		return chain
+	}
+	checkIndex := func(froms, tos []common.Address, want []uint64) {
+		t.Helper()
+		blocks, err := rawdb.FindCallTraceBlocks(blockchain.db, froms, tos, 0, blockchain.CurrentBlock().NumberU64())
+		if err != nil {
+			t.Fatalf("failed to read call trace index: %v", err)
+		}
+		if !reflect.DeepEqual(blocks, want) {
+			t.Fatalf("call trace index mismatch: have %v, want %v", blocks, want)
+		}
+	}
+	chain := makeChain(2, 1)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if start := rawdb.ReadCallTraceIndexStart(blockchain.db); start == nil || *start != 1 {
+		t.Fatalf("call trace index start mismatch: have %v, want 1", start)
+	}
+	checkIndex(nil, []common.Address{target}, []uint64{2})
+	checkIndex([]common.Address{addr1}, []common.Address{target}, []uint64{2})
+	// The block rewards are indexed by the coinbase
+	checkIndex(nil, []common.Address{chain[0].Coinbase()}, []uint64{1, 2})
+
+	// Reorg to a longer chain without the transfer, the block must be unindexed
+	if _, err := blockchain.InsertChain(makeChain(3, -1)); err != nil {
+		t.Fatalf("failed to insert forked chain: %v", err)
+	}
+	checkIndex(nil, []common.Address{target}, nil)
+	if entry := rawdb.ReadCallTraceIndexEntry(blockchain.db, chain[1].Hash(), chain[1].NumberU64()); entry == nil || !reflect.DeepEqual(entry.Froms, []common.Address{addr1}) {
+		t.Fatalf("call trace index entry of the side block mismatch: %v", entry)
+	}
+	// Reorg to an even longer chain sending the transfer in a later block
+	if _, err := blockchain.InsertChain(makeChain(4, 3)); err != nil {
+		t.Fatalf("failed to insert forked chain: %v", err)
+	}
+	checkIndex(nil, []common.Address{target}, []uint64{4})
+}
+
+func TestAccessListsReorgs(t *testing.T) {
+	var (
+		key1, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr1     = crypto.PubkeyToAddress(key1.PublicKey)
+		target    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		db        = ethdb.NewMemDatabase()
+		gspec     = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr1: {Balance: big.NewInt(10000000000000)}}}
+		genesis   = gspec.MustCommit(db)
+		genesisDb = db.MemCopy()
+		signer    = types.NewEIP155Signer(gspec.Config.ChainID)
+	)
+
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil)
+	ctx := blockchain.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+	blockchain.EnableAccessLists(true)
+	defer blockchain.Stop()
+
+	// makeChain generates a chain of the given length, sending a transfer to the target in every block
+	makeChain := func(n int, seed byte) []*types.Block {
+		chain, _ := GenerateChain(ctx, params.TestChainConfig, genesis, ethash.NewFaker(), genesisDb.MemCopy(), n, func(i int, gen *BlockGen) {
+			gen.SetCoinbase(common.Address{seed})
+			tx, err := types.SignTx(types.NewTransaction(gen.TxNonce(addr1), target, big.NewInt(1), 21000, new(big.Int), nil), signer, key1)
+			if err != nil {
+				t.Fatalf("failed to create tx: %v", err)
+			}
+			gen.AddTx(tx)
+		})
+		return chain
+	}
+	chain := makeChain(2, 1)
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for _, block := range chain {
+		if lists := rawdb.ReadBlockAccessLists(db, block.Hash(), block.NumberU64()); len(lists) != 1 {
+			t.Fatalf("block %d: access lists not stored", block.NumberU64())
+		}
+	}
+	// Reorg to a longer chain, the access lists of the dropped blocks must be removed
+	fork := makeChain(3, 2)
+	if _, err := blockchain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert forked chain: %v", err)
+	}
+	for _, block := range chain {
+		if lists := rawdb.ReadBlockAccessLists(db, block.Hash(), block.NumberU64()); lists != nil {
+			t.Errorf("block %d: access lists of the dropped block not removed", block.NumberU64())
+		}
+	}
+	for _, block := range fork {
+		if lists := rawdb.ReadBlockAccessLists(db, block.Hash(), block.NumberU64()); len(lists) != 1 {
+			t.Errorf("block %d: access lists of the new block not stored", block.NumberU64())
+		}
+	}
+}
+
 func TestLogRebirth(t *testing.T) {
 	var (
 		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
@@ -1879,7 +2496,7 @@ func TestBlockchainRecovery(t *testing.T) {
 	}
 	defer os.Remove(frdir)
 
-	ancientDb, err := ethdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -1939,7 +2556,7 @@ func TestIncompleteAncientReceiptChainInsertion(t *testing.T) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(frdir)
-	ancientDb, err := ethdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
@@ -2152,7 +2769,7 @@ func testInsertKnownChainData(t *testing.T, typ string) {
 		t.Fatalf("failed to create temp freezer dir: %v", err)
 	}
 	defer os.Remove(dir)
-	chaindb, err := ethdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), dir, "")
+	chaindb, err := rawdb.NewDatabaseWithFreezer(ethdb.NewMemDatabase(), dir, "")
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
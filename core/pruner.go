@@ -74,12 +74,12 @@ func (p *BasicPruner) pruningLoop(db ethdb.Database) {
 			if cb == nil || cb.Number() == nil {
 				continue
 			}
-			from, to, ok := calculateNumOfPrunedBlocks(cb.Number().Uint64(), p.LastPrunedBlockNum, p.config.BlocksBeforePruning, p.config.BlocksToPrune)
+			from, to, ok := calculateNumOfPrunedBlocks(cb.Number().Uint64(), p.LastPrunedBlockNum, p.config.BlocksBeforePruning, p.config.BlocksToPrune, p.config.RetentionPolicy)
 			if !ok {
 				continue
 			}
 			log.Debug("Pruning history", "from", from, "to", to)
-			err := Prune(db, from, to)
+			err := Prune(db, from, to, p.config.RetentionPolicy)
 			if err != nil {
 				log.Error("Pruning error", "err", err)
 				return
@@ -89,11 +89,21 @@ func (p *BasicPruner) pruningLoop(db ethdb.Database) {
 	}
 }
 
-func calculateNumOfPrunedBlocks(currentBlock, lastPrunedBlock uint64, blocksBeforePruning uint64, blocksBatch uint64) (uint64, uint64, bool) {
+func calculateNumOfPrunedBlocks(currentBlock, lastPrunedBlock uint64, blocksBeforePruning uint64, blocksBatch uint64, policy RetentionPolicy) (uint64, uint64, bool) {
 	//underflow see https://github.com/ledgerwatch/turbo-geth/issues/115
 	if currentBlock <= lastPrunedBlock {
 		return lastPrunedBlock, lastPrunedBlock, false
 	}
+	if policy != nil {
+		// Nothing above the limit of the policy is ever pruned
+		maxPruned := policy.MaxPrunedBlock()
+		if lastPrunedBlock >= maxPruned {
+			return lastPrunedBlock, lastPrunedBlock, false
+		}
+		if maxPruned-lastPrunedBlock < blocksBatch {
+			blocksBatch = maxPruned - lastPrunedBlock
+		}
+	}
 
 	diff := currentBlock - lastPrunedBlock
 	if diff <= blocksBeforePruning {
@@ -132,30 +142,57 @@ func (p *BasicPruner) WriteLastPrunedBlockNum(num uint64) {
 	}
 }
 
-func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
+// Prune removes the change sets, the history and the access lists of the blocks from blockNumFrom to blockNumTo,
+// except for the parts that the retention policy keeps. The policy may be nil.
+func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64, policy RetentionPolicy) error {
 	keysToRemove := newKeysToRemove()
-	err := db.Walk(dbutils.ChangeSetBucket, []byte{}, 0, func(key, v []byte) (b bool, e error) {
-		timestamp, _ := dbutils.DecodeTimestamp(key)
-		if timestamp < blockNumFrom {
-			return true, nil
+	var changeSetsToKeep []dbutils.Change
+	// The changes since the last checkpoint before blockNumFrom are needed to find
+	// the first change of every key after a checkpoint
+	walkFrom := blockNumFrom
+	if policy != nil {
+		if checkpoint, ok := policy.LastCheckpoint(blockNumFrom); ok && checkpoint+1 < walkFrom {
+			walkFrom = checkpoint + 1
 		}
+	}
+	// Block numbers of the last changes of the keys, which are changed after walkFrom
+	lastChanges := make(map[string]uint64)
+	err := db.Walk(dbutils.ChangeSetBucket, dbutils.EncodeTimestamp(walkFrom), 0, func(key, v []byte) (b bool, e error) {
+		timestamp, _ := dbutils.DecodeTimestamp(key)
 		if timestamp > blockNumTo {
 			return false, nil
 		}
 
-		keysToRemove.ChangeSet = append(keysToRemove.ChangeSet, key)
-
 		changedKeys, err := dbutils.DecodeChangeSet(v)
 		if err != nil {
 			return false, err
 		}
+		if timestamp < blockNumFrom || (policy != nil && policy.KeepBlock(timestamp)) {
+			return true, changedKeys.Walk(func(cKey, _ []byte) error {
+				lastChanges[string(cKey)] = timestamp
+				return nil
+			})
+		}
 
-		err = changedKeys.Walk(func(cKey, _ []byte) error {
+		keptKeys := new(dbutils.ChangeSet)
+		err = changedKeys.Walk(func(cKey, cValue []byte) error {
+			prevChange, changed := lastChanges[string(cKey)]
+			lastChanges[string(cKey)] = timestamp
+			if policy != nil && policy.KeepKey(cKey) {
+				return keptKeys.Add(cKey, cValue)
+			}
+			// The first change after a checkpoint holds the value as of the checkpoint
+			if policy != nil {
+				if checkpoint, ok := policy.LastCheckpoint(timestamp); ok && (!changed || prevChange <= checkpoint) {
+					return keptKeys.Add(cKey, cValue)
+				}
+			}
 			compKey, _ := dbutils.CompositeKeySuffix(cKey, timestamp)
-			if bytes.HasSuffix(cKey, dbutils.AccountsHistoryBucket) {
+			// The bucket of the history is the suffix of the change set key, not of the changed key
+			if bytes.HasSuffix(key, dbutils.AccountsHistoryBucket) {
 				keysToRemove.AccountHistoryKeys = append(keysToRemove.AccountHistoryKeys, compKey)
 			}
-			if bytes.HasSuffix(cKey, dbutils.StorageHistoryBucket) {
+			if bytes.HasSuffix(key, dbutils.StorageHistoryBucket) {
 				keysToRemove.StorageHistoryKeys = append(keysToRemove.StorageHistoryKeys, compKey)
 			}
 			return nil
@@ -163,6 +200,32 @@ func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
 		if err != nil {
 			return false, err
 		}
+
+		switch {
+		case keptKeys.Len() == 0:
+			keysToRemove.ChangeSet = append(keysToRemove.ChangeSet, key)
+		case keptKeys.Len() < changedKeys.Len():
+			// Only the changes of the kept keys remain in the change set
+			enc, err := keptKeys.Encode()
+			if err != nil {
+				return false, err
+			}
+			changeSetsToKeep = append(changeSetsToKeep, dbutils.Change{Key: common.CopyBytes(key), Value: enc})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	// The access lists of the transactions are a part of the history of the blocks too
+	err = db.Walk(dbutils.BlockAccessListsBucket, dbutils.EncodeBlockNumber(blockNumFrom), 0, func(key, _ []byte) (bool, error) {
+		blockNum := binary.BigEndian.Uint64(key[:8])
+		if blockNum > blockNumTo {
+			return false, nil
+		}
+		if policy == nil || !policy.KeepBlock(blockNum) {
+			keysToRemove.BlockAccessLists = append(keysToRemove.BlockAccessLists, common.CopyBytes(key))
+		}
 		return true, nil
 	})
 	if err != nil {
@@ -172,12 +235,21 @@ func Prune(db ethdb.Database, blockNumFrom uint64, blockNumTo uint64) error {
 	if err != nil {
 		return err
 	}
-
-	return nil
+	if len(changeSetsToKeep) == 0 {
+		return nil
+	}
+	batch := db.NewBatch()
+	for _, cs := range changeSetsToKeep {
+		if err := batch.Put(dbutils.ChangeSetBucket, cs.Key, cs.Value); err != nil {
+			return err
+		}
+	}
+	_, err = batch.Commit()
+	return err
 }
 
 func batchDelete(db ethdb.Database, keys *keysToRemove) error {
-	log.Debug("Removing: ", "accounts", len(keys.AccountHistoryKeys), "storage", len(keys.StorageHistoryKeys), "suffix", len(keys.ChangeSet))
+	log.Debug("Removing: ", "accounts", len(keys.AccountHistoryKeys), "storage", len(keys.StorageHistoryKeys), "suffix", len(keys.ChangeSet), "access lists", len(keys.BlockAccessLists))
 	iterator := LimitIterator(keys, DeleteLimit)
 	for iterator.HasMore() {
 		iterator.ResetLimit()
@@ -206,6 +278,7 @@ func newKeysToRemove() *keysToRemove {
 		AccountHistoryKeys: make([][]byte, 0),
 		StorageHistoryKeys: make([][]byte, 0),
 		ChangeSet:          make([][]byte, 0),
+		BlockAccessLists:   make([][]byte, 0),
 	}
 }
 
@@ -213,6 +286,7 @@ type keysToRemove struct {
 	AccountHistoryKeys [][]byte
 	StorageHistoryKeys [][]byte
 	ChangeSet          [][]byte
+	BlockAccessLists   [][]byte
 }
 
 func LimitIterator(k *keysToRemove, limit int) *limitIterator {
@@ -251,6 +325,9 @@ func (i *limitIterator) GetNext() ([]byte, []byte, bool) {
 	if bytes.Equal(i.currentBucket, dbutils.ChangeSetBucket) {
 		return i.k.ChangeSet[i.currentNum], dbutils.ChangeSetBucket, true
 	}
+	if bytes.Equal(i.currentBucket, dbutils.BlockAccessListsBucket) {
+		return i.k.BlockAccessLists[i.currentNum], dbutils.BlockAccessListsBucket, true
+	}
 	return nil, nil, false
 }
 
@@ -259,7 +336,7 @@ func (i *limitIterator) ResetLimit() {
 }
 
 func (i *limitIterator) HasMore() bool {
-	if bytes.Equal(i.currentBucket, dbutils.ChangeSetBucket) && len(i.k.ChangeSet) == i.currentNum {
+	if bytes.Equal(i.currentBucket, dbutils.BlockAccessListsBucket) && len(i.k.BlockAccessLists) == i.currentNum {
 		return false
 	}
 	return true
@@ -278,4 +355,9 @@ func (i *limitIterator) updateBucket() {
 		i.currentBucket = dbutils.ChangeSetBucket
 		i.currentNum = 0
 	}
+
+	if bytes.Equal(i.currentBucket, dbutils.ChangeSetBucket) && len(i.k.ChangeSet) == i.currentNum {
+		i.currentBucket = dbutils.BlockAccessListsBucket
+		i.currentNum = 0
+	}
 }
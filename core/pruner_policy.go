@@ -0,0 +1,139 @@
+package core
+
+import (
+	"math"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+// RetentionPolicy decides which parts of the history the pruner must keep,
+// in addition to the last BlocksBeforePruning blocks.
+type RetentionPolicy interface {
+	// KeepBlock reports whether the whole history of the block must be kept.
+	KeepBlock(blockNum uint64) bool
+	// KeepKey reports whether the history of the account or the storage item must be kept.
+	// The key is the address hash for accounts, and the composite storage key
+	// (address hash + incarnation + key hash) for storage items.
+	KeepKey(key []byte) bool
+	// MaxPrunedBlock returns the highest block, which history may be pruned.
+	MaxPrunedBlock() uint64
+	// LastCheckpoint returns the last checkpoint block before the given block.
+	// The state as of every checkpoint stays readable with GetAsOf(checkpoint+1),
+	// so the first change of every key after a checkpoint is kept.
+	LastCheckpoint(blockNum uint64) (uint64, bool)
+}
+
+// WatchedAddressesPolicy keeps all the history of the watched accounts and their storage.
+type WatchedAddressesPolicy map[common.Hash]struct{}
+
+func NewWatchedAddressesPolicy(addresses ...common.Address) WatchedAddressesPolicy {
+	p := make(WatchedAddressesPolicy, len(addresses))
+	for _, address := range addresses {
+		p[crypto.Keccak256Hash(address[:])] = struct{}{}
+	}
+	return p
+}
+
+func (p WatchedAddressesPolicy) KeepBlock(uint64) bool {
+	return false
+}
+
+func (p WatchedAddressesPolicy) KeepKey(key []byte) bool {
+	if len(key) < common.HashLength {
+		return false
+	}
+	_, ok := p[common.BytesToHash(key[:common.HashLength])]
+	return ok
+}
+
+func (p WatchedAddressesPolicy) MaxPrunedBlock() uint64 {
+	return math.MaxUint64
+}
+
+func (p WatchedAddressesPolicy) LastCheckpoint(uint64) (uint64, bool) {
+	return 0, false
+}
+
+// CheckpointPolicy keeps the state as of every Kth block readable.
+type CheckpointPolicy uint64
+
+func (p CheckpointPolicy) KeepBlock(uint64) bool {
+	return false
+}
+
+func (p CheckpointPolicy) KeepKey([]byte) bool {
+	return false
+}
+
+func (p CheckpointPolicy) MaxPrunedBlock() uint64 {
+	return math.MaxUint64
+}
+
+func (p CheckpointPolicy) LastCheckpoint(blockNum uint64) (uint64, bool) {
+	if p == 0 || blockNum == 0 {
+		return 0, false
+	}
+	return (blockNum - 1) / uint64(p) * uint64(p), true
+}
+
+// KeepAbovePolicy keeps the history of all the blocks above the given block number.
+type KeepAbovePolicy uint64
+
+func (p KeepAbovePolicy) KeepBlock(blockNum uint64) bool {
+	return blockNum > uint64(p)
+}
+
+func (p KeepAbovePolicy) KeepKey([]byte) bool {
+	return false
+}
+
+func (p KeepAbovePolicy) MaxPrunedBlock() uint64 {
+	return uint64(p)
+}
+
+func (p KeepAbovePolicy) LastCheckpoint(uint64) (uint64, bool) {
+	return 0, false
+}
+
+// RetentionPolicies keeps the history if any of the policies keeps it.
+type RetentionPolicies []RetentionPolicy
+
+func (ps RetentionPolicies) KeepBlock(blockNum uint64) bool {
+	for _, p := range ps {
+		if p.KeepBlock(blockNum) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps RetentionPolicies) KeepKey(key []byte) bool {
+	for _, p := range ps {
+		if p.KeepKey(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps RetentionPolicies) MaxPrunedBlock() uint64 {
+	var maxPruned uint64 = math.MaxUint64
+	for _, p := range ps {
+		if m := p.MaxPrunedBlock(); m < maxPruned {
+			maxPruned = m
+		}
+	}
+	return maxPruned
+}
+
+func (ps RetentionPolicies) LastCheckpoint(blockNum uint64) (uint64, bool) {
+	var last uint64
+	var found bool
+	for _, p := range ps {
+		if c, ok := p.LastCheckpoint(blockNum); ok && (!found || c > last) {
+			last, found = c, true
+		}
+	}
+	return last, found
+}
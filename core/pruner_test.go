@@ -1,8 +1,16 @@
 package core
 
 import (
+	"bytes"
 	"strconv"
 	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
 func TestCalculateNumOfPrunedBlocks(t *testing.T) {
@@ -114,7 +122,7 @@ func TestCalculateNumOfPrunedBlocks(t *testing.T) {
 		i := i
 		v := testcases[i]
 		t.Run("case "+strconv.Itoa(i)+" "+v.Description, func(t *testing.T) {
-			from, to, res := calculateNumOfPrunedBlocks(v.CurrentBlock, v.LastPrunedBlock, v.BlocksBeforePruning, v.BlocksBatch)
+			from, to, res := calculateNumOfPrunedBlocks(v.CurrentBlock, v.LastPrunedBlock, v.BlocksBeforePruning, v.BlocksBatch, nil)
 			if from != v.From || to != v.To || res != v.Result {
 				t.Log("res", res, "from", from, "to", to)
 				t.Fatal("Failed case", i)
@@ -122,3 +130,219 @@ func TestCalculateNumOfPrunedBlocks(t *testing.T) {
 		})
 	}
 }
+
+func TestPruneRemovesHistory(t *testing.T) {
+	addrHash := crypto.Keccak256Hash(common.Address{1}.Bytes())
+	storageKey := dbutils.GenerateCompositeStorageKey(addrHash, 1, common.Hash{3})
+
+	db := ethdb.NewMemDatabase()
+	for blockNum := uint64(1); blockNum <= 4; blockNum++ {
+		encodedTS := dbutils.EncodeTimestamp(blockNum)
+		for _, ch := range []struct {
+			bucket []byte
+			key    []byte
+		}{
+			{dbutils.AccountsHistoryBucket, addrHash[:]},
+			{dbutils.StorageHistoryBucket, storageKey},
+		} {
+			changes := new(dbutils.ChangeSet)
+			if err := changes.Add(ch.key, []byte{byte(blockNum)}); err != nil {
+				t.Fatal(err)
+			}
+			enc, err := changes.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = db.Put(dbutils.ChangeSetBucket, dbutils.CompositeChangeSetKey(encodedTS, ch.bucket), enc); err != nil {
+				t.Fatal(err)
+			}
+			compKey, _ := dbutils.CompositeKeySuffix(ch.key, blockNum)
+			if err = db.Put(ch.bucket, compKey, []byte{byte(blockNum)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rawdb.WriteBlockAccessLists(db, common.Hash{byte(blockNum)}, blockNum, []*types.TxAccessList{{TxHash: common.Hash{byte(blockNum)}}})
+	}
+
+	if err := Prune(db, 0, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for blockNum := uint64(1); blockNum <= 4; blockNum++ {
+		pruned := blockNum <= 2
+		accKey, _ := dbutils.CompositeKeySuffix(addrHash[:], blockNum)
+		if _, err := db.Get(dbutils.AccountsHistoryBucket, accKey); (err != nil) != pruned {
+			t.Error("unexpected account history", "block", blockNum, "pruned", pruned)
+		}
+		storKey, _ := dbutils.CompositeKeySuffix(storageKey, blockNum)
+		if _, err := db.Get(dbutils.StorageHistoryBucket, storKey); (err != nil) != pruned {
+			t.Error("unexpected storage history", "block", blockNum, "pruned", pruned)
+		}
+		csKey := dbutils.CompositeChangeSetKey(dbutils.EncodeTimestamp(blockNum), dbutils.AccountsHistoryBucket)
+		if _, err := db.Get(dbutils.ChangeSetBucket, csKey); (err != nil) != pruned {
+			t.Error("unexpected change set", "block", blockNum, "pruned", pruned)
+		}
+		if lists := rawdb.ReadBlockAccessLists(db, common.Hash{byte(blockNum)}, blockNum); (lists == nil) != pruned {
+			t.Error("unexpected access lists", "block", blockNum, "pruned", pruned)
+		}
+	}
+}
+
+func TestCalculateNumOfPrunedBlocksWithPolicy(t *testing.T) {
+	testcases := []struct {
+		CurrentBlock    uint64
+		LastPrunedBlock uint64
+		Policy          RetentionPolicy
+
+		From   uint64
+		To     uint64
+		Result bool
+	}{
+		{30, 20, CheckpointPolicy(5), 20, 29, true},
+		{30, 20, KeepAbovePolicy(25), 20, 25, true},
+		{30, 25, KeepAbovePolicy(25), 25, 25, false},
+		{30, 20, KeepAbovePolicy(10), 20, 20, false},
+		{30, 20, RetentionPolicies{CheckpointPolicy(5), KeepAbovePolicy(27), KeepAbovePolicy(22)}, 20, 22, true},
+	}
+
+	for i, v := range testcases {
+		from, to, res := calculateNumOfPrunedBlocks(v.CurrentBlock, v.LastPrunedBlock, 1, 10, v.Policy)
+		if from != v.From || to != v.To || res != v.Result {
+			t.Fatal("Failed case", i, "res", res, "from", from, "to", to)
+		}
+	}
+}
+
+func TestPruneWithPolicy(t *testing.T) {
+	watched := common.Address{1}
+	other := common.Address{2}
+	watchedHash := crypto.Keccak256Hash(watched[:])
+	otherHash := crypto.Keccak256Hash(other[:])
+	storageKey := dbutils.GenerateCompositeStorageKey(watchedHash, 1, common.Hash{3})
+	// The watched account changes in every block, the other one only in some of them
+	otherChanges := map[uint64]bool{2: true, 3: true, 6: true, 7: true, 10: true}
+
+	db := ethdb.NewMemDatabase()
+	// The history of a block holds the values before the block, i.e. the block of the previous change
+	var otherPrev uint64
+	for blockNum := uint64(1); blockNum <= 10; blockNum++ {
+		encodedTS := dbutils.EncodeTimestamp(blockNum)
+		accountChanges := new(dbutils.ChangeSet)
+		for _, ch := range []struct {
+			addrHash []byte
+			prev     uint64
+		}{
+			{watchedHash[:], blockNum - 1},
+			{otherHash[:], otherPrev},
+		} {
+			if bytes.Equal(ch.addrHash, otherHash[:]) && !otherChanges[blockNum] {
+				continue
+			}
+			if err := accountChanges.Add(ch.addrHash, []byte{byte(ch.prev)}); err != nil {
+				t.Fatal(err)
+			}
+			compKey, _ := dbutils.CompositeKeySuffix(ch.addrHash, blockNum)
+			if err := db.Put(dbutils.AccountsHistoryBucket, compKey, []byte{byte(ch.prev)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if otherChanges[blockNum] {
+			otherPrev = blockNum
+		}
+		enc, err := accountChanges.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Put(dbutils.ChangeSetBucket, dbutils.CompositeChangeSetKey(encodedTS, dbutils.AccountsHistoryBucket), enc); err != nil {
+			t.Fatal(err)
+		}
+
+		storageChanges := new(dbutils.ChangeSet)
+		if err = storageChanges.Add(storageKey, []byte{byte(blockNum - 1)}); err != nil {
+			t.Fatal(err)
+		}
+		compKey, _ := dbutils.CompositeKeySuffix(storageKey, blockNum)
+		if err = db.Put(dbutils.StorageHistoryBucket, compKey, []byte{byte(blockNum - 1)}); err != nil {
+			t.Fatal(err)
+		}
+		if enc, err = storageChanges.Encode(); err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Put(dbutils.ChangeSetBucket, dbutils.CompositeChangeSetKey(encodedTS, dbutils.StorageHistoryBucket), enc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Put(dbutils.AccountsBucket, watchedHash[:], []byte{10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(dbutils.AccountsBucket, otherHash[:], []byte{byte(otherPrev)}); err != nil {
+		t.Fatal(err)
+	}
+
+	getAsOf := func(addrHash []byte, blockNum uint64) []byte {
+		v, err := db.GetAsOf(dbutils.AccountsBucket, dbutils.AccountsHistoryBucket, addrHash, blockNum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	otherAsOf := make(map[uint64][]byte)
+	for blockNum := uint64(1); blockNum <= 11; blockNum++ {
+		otherAsOf[blockNum] = getAsOf(otherHash[:], blockNum)
+	}
+
+	// Pruning in two batches, the second one starts after the last checkpoint
+	policy := RetentionPolicies{NewWatchedAddressesPolicy(watched), CheckpointPolicy(4), KeepAbovePolicy(8)}
+	if err := Prune(db, 0, 6, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := Prune(db, 6, 8, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	hasHistory := func(bucket []byte, key []byte, blockNum uint64) bool {
+		compKey, _ := dbutils.CompositeKeySuffix(key, blockNum)
+		_, err := db.Get(bucket, compKey)
+		return err == nil
+	}
+	// The first changes after the checkpoints 0 and 4, and everything above 8
+	otherKept := map[uint64]bool{2: true, 6: true, 10: true}
+	for blockNum := uint64(1); blockNum <= 10; blockNum++ {
+		if !hasHistory(dbutils.AccountsHistoryBucket, watchedHash[:], blockNum) {
+			t.Error("watched account history is pruned", "block", blockNum)
+		}
+		if !hasHistory(dbutils.StorageHistoryBucket, storageKey, blockNum) {
+			t.Error("watched storage history is pruned", "block", blockNum)
+		}
+		if hasHistory(dbutils.AccountsHistoryBucket, otherHash[:], blockNum) != otherKept[blockNum] {
+			t.Error("unexpected account history", "block", blockNum, "kept", otherKept[blockNum])
+		}
+
+		enc, err := db.Get(dbutils.ChangeSetBucket, dbutils.CompositeChangeSetKey(dbutils.EncodeTimestamp(blockNum), dbutils.AccountsHistoryBucket))
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err := dbutils.DecodeChangeSet(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = changes.FindFirst(watchedHash[:]); err != nil {
+			t.Error("watched account is removed from the change set", "block", blockNum)
+		}
+		if _, err = changes.FindFirst(otherHash[:]); (err == nil) != otherKept[blockNum] {
+			t.Error("unexpected change set", "block", blockNum, "kept", otherKept[blockNum])
+		}
+	}
+
+	// The state as of the checkpoints and of the kept blocks is unchanged
+	for _, blockNum := range []uint64{1, 5, 9, 10, 11} {
+		if v := getAsOf(otherHash[:], blockNum); !bytes.Equal(v, otherAsOf[blockNum]) {
+			t.Error("unexpected state", "block", blockNum, "got", v, "want", otherAsOf[blockNum])
+		}
+	}
+	for blockNum := uint64(1); blockNum <= 11; blockNum++ {
+		if v := getAsOf(watchedHash[:], blockNum); !bytes.Equal(v, []byte{byte(blockNum - 1)}) {
+			t.Error("unexpected watched state", "block", blockNum, "got", v)
+		}
+	}
+}
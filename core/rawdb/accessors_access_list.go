@@ -0,0 +1,41 @@
+package rawdb
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// ReadBlockAccessLists retrieves the stored access lists of the transactions of a block.
+func ReadBlockAccessLists(db DatabaseReader, hash common.Hash, number uint64) []*types.TxAccessList {
+	data, _ := db.Get(dbutils.BlockAccessListsBucket, dbutils.BlockNumHashKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	var lists []*types.TxAccessList
+	if err := rlp.DecodeBytes(data, &lists); err != nil {
+		log.Error("Invalid block access lists RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return lists
+}
+
+// WriteBlockAccessLists stores the access lists of the transactions of a block.
+func WriteBlockAccessLists(db DatabaseWriter, hash common.Hash, number uint64, lists []*types.TxAccessList) {
+	data, err := rlp.EncodeToBytes(lists)
+	if err != nil {
+		log.Crit("Failed to RLP encode block access lists", "err", err)
+	}
+	if err := db.Put(dbutils.BlockAccessListsBucket, dbutils.BlockNumHashKey(number, hash), data); err != nil {
+		log.Crit("Failed to store block access lists", "err", err)
+	}
+}
+
+// DeleteBlockAccessLists removes the stored access lists of the transactions of a block.
+func DeleteBlockAccessLists(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(dbutils.BlockAccessListsBucket, dbutils.BlockNumHashKey(number, hash)); err != nil {
+		log.Crit("Failed to delete block access lists", "err", err)
+	}
+}
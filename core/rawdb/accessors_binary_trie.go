@@ -0,0 +1,23 @@
+package rawdb
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// ReadBinaryStateRoot retrieves the root of the binary state trie after the block.
+func ReadBinaryStateRoot(db DatabaseReader, hash common.Hash, number uint64) (common.Hash, bool) {
+	data, _ := db.Get(dbutils.BinaryStateRootBucket, dbutils.BlockNumHashKey(number, hash))
+	if len(data) != common.HashLength {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(data), true
+}
+
+// WriteBinaryStateRoot stores the root of the binary state trie after the block.
+func WriteBinaryStateRoot(db DatabaseWriter, hash common.Hash, number uint64, root common.Hash) {
+	if err := db.Put(dbutils.BinaryStateRootBucket, dbutils.BlockNumHashKey(number, hash), root.Bytes()); err != nil {
+		log.Crit("Failed to store binary state root", "err", err)
+	}
+}
@@ -0,0 +1,150 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// CallTraceIndexEntry is the set of distinct from and to addresses of the call traces of a single block.
+// It is kept per block to be able to remove the block from the call trace index on reorg.
+type CallTraceIndexEntry struct {
+	Froms []common.Address
+	Tos   []common.Address
+}
+
+// ReadCallTraceIndexEntry retrieves the call trace index entry of a block.
+func ReadCallTraceIndexEntry(db DatabaseReader, hash common.Hash, number uint64) *CallTraceIndexEntry {
+	data, _ := db.Get(dbutils.CallTraceIndexChangeSetBucket, dbutils.BlockNumHashKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	entry := new(CallTraceIndexEntry)
+	if err := rlp.DecodeBytes(data, entry); err != nil {
+		log.Error("Invalid call trace index entry RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return entry
+}
+
+// WriteCallTraceIndex stores the call trace index entry of a block and adds the block to
+// the from and to address indices. Writing the same block twice is a no-op.
+func WriteCallTraceIndex(db DatabaseReadWriter, hash common.Hash, number uint64, froms, tos []common.Address) {
+	data, err := rlp.EncodeToBytes(&CallTraceIndexEntry{Froms: froms, Tos: tos})
+	if err != nil {
+		log.Crit("Failed to RLP encode call trace index entry", "err", err)
+	}
+	if err := db.Put(dbutils.CallTraceIndexChangeSetBucket, dbutils.BlockNumHashKey(number, hash), data); err != nil {
+		log.Crit("Failed to store call trace index entry", "err", err)
+	}
+	IndexCallTraces(db, hash, number)
+}
+
+// IndexCallTraces adds a block, which call trace index entry is already stored, to the
+// from and to address indices. It is used to re-index the blocks of a chain becoming canonical.
+func IndexCallTraces(db DatabaseReadWriter, hash common.Hash, number uint64) {
+	entry := ReadCallTraceIndexEntry(db, hash, number)
+	if entry == nil {
+		return
+	}
+	for i := range entry.Froms {
+		if err := addToLogIndex(db, dbutils.CallFromIndexBucket, entry.Froms[i][:], number); err != nil {
+			log.Crit("Failed to store call trace from index", "err", err)
+		}
+	}
+	for i := range entry.Tos {
+		if err := addToLogIndex(db, dbutils.CallToIndexBucket, entry.Tos[i][:], number); err != nil {
+			log.Crit("Failed to store call trace to index", "err", err)
+		}
+	}
+}
+
+// UnindexCallTraces removes a block from the from and to address indices, keeping its call
+// trace index entry so that the block can be re-indexed if it becomes canonical again.
+func UnindexCallTraces(db DatabaseReadWriter, hash common.Hash, number uint64) {
+	entry := ReadCallTraceIndexEntry(db, hash, number)
+	if entry == nil {
+		return
+	}
+	for i := range entry.Froms {
+		if err := removeFromLogIndex(db, dbutils.CallFromIndexBucket, entry.Froms[i][:], number); err != nil {
+			log.Crit("Failed to remove call trace from index", "err", err)
+		}
+	}
+	for i := range entry.Tos {
+		if err := removeFromLogIndex(db, dbutils.CallToIndexBucket, entry.Tos[i][:], number); err != nil {
+			log.Crit("Failed to remove call trace to index", "err", err)
+		}
+	}
+}
+
+// ReadCallTraceIndexStart retrieves the number of the first block covered by the call trace index.
+func ReadCallTraceIndexStart(db DatabaseReader) *uint64 {
+	data, _ := db.Get(dbutils.CallTraceIndexStartKey, dbutils.CallTraceIndexStartKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteCallTraceIndexStart stores the number of the first block covered by the call trace index.
+func WriteCallTraceIndexStart(db DatabaseWriter, number uint64) {
+	if err := db.Put(dbutils.CallTraceIndexStartKey, dbutils.CallTraceIndexStartKey, dbutils.EncodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store call trace index start", "err", err)
+	}
+}
+
+// DeleteCallTraceIndexStart marks the call trace index as not maintained.
+func DeleteCallTraceIndexStart(db DatabaseDeleter) {
+	if err := db.Delete(dbutils.CallTraceIndexStartKey, dbutils.CallTraceIndexStartKey); err != nil {
+		log.Crit("Failed to delete call trace index start", "err", err)
+	}
+}
+
+// FindCallTraceBlocks returns the numbers of the blocks within [from, to], which may contain
+// call traces made from any of the given from addresses and to any of the given to addresses.
+// The index does not pair the addresses of the same call, so the result is a superset of the
+// matching blocks and the traces still have to be filtered. At least one address has to be given.
+func FindCallTraceBlocks(db DatabaseReader, froms, tos []common.Address, from, to uint64) ([]uint64, error) {
+	var criteria []map[uint64]struct{}
+	for _, c := range []struct {
+		bucket    []byte
+		addresses []common.Address
+	}{
+		{dbutils.CallFromIndexBucket, froms},
+		{dbutils.CallToIndexBucket, tos},
+	} {
+		if len(c.addresses) == 0 {
+			continue
+		}
+		keys := make([][]byte, len(c.addresses))
+		for i := range c.addresses {
+			keys[i] = c.addresses[i][:]
+		}
+		blocks, err := readLogIndexUnion(db, c.bucket, keys, from, to)
+		if err != nil {
+			return nil, err
+		}
+		criteria = append(criteria, blocks)
+	}
+	if len(criteria) == 0 {
+		return nil, nil
+	}
+	var result []uint64
+Blocks:
+	for number := range criteria[0] {
+		for _, blocks := range criteria[1:] {
+			if _, ok := blocks[number]; !ok {
+				continue Blocks
+			}
+		}
+		result = append(result, number)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
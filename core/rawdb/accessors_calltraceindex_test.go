@@ -0,0 +1,72 @@
+package rawdb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// Tests that the call trace index can be written, unwound and queried.
+func TestCallTraceIndexStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	var (
+		addr1 = common.BytesToAddress([]byte{0x11})
+		addr2 = common.BytesToAddress([]byte{0x22})
+		addr3 = common.BytesToAddress([]byte{0x33})
+
+		hash1 = common.BytesToHash([]byte{0xa1})
+		hash2 = common.BytesToHash([]byte{0xa2})
+		hash3 = common.BytesToHash([]byte{0xa3})
+	)
+	if start := ReadCallTraceIndexStart(db); start != nil {
+		t.Fatalf("non existent call trace index start returned: %d", *start)
+	}
+	WriteCallTraceIndexStart(db, 1)
+	if start := ReadCallTraceIndexStart(db); start == nil || *start != 1 {
+		t.Fatalf("call trace index start mismatch: have %v, want 1", start)
+	}
+	WriteCallTraceIndex(db, hash1, 1, []common.Address{addr1}, []common.Address{addr2, addr3})
+	WriteCallTraceIndex(db, hash2, 2, []common.Address{addr2}, []common.Address{addr3})
+	WriteCallTraceIndex(db, hash3, 3, []common.Address{addr1}, []common.Address{addr1})
+	// Writing a block again must not duplicate it in the index
+	WriteCallTraceIndex(db, hash3, 3, []common.Address{addr1}, []common.Address{addr1})
+
+	if entry := ReadCallTraceIndexEntry(db, hash1, 1); entry == nil || !reflect.DeepEqual(entry, &CallTraceIndexEntry{Froms: []common.Address{addr1}, Tos: []common.Address{addr2, addr3}}) {
+		t.Fatalf("call trace index entry mismatch: %v", entry)
+	}
+	check := func(froms, tos []common.Address, from, to uint64, want []uint64) {
+		t.Helper()
+		blocks, err := FindCallTraceBlocks(db, froms, tos, from, to)
+		if err != nil {
+			t.Fatalf("failed to find blocks: %v", err)
+		}
+		if !reflect.DeepEqual(blocks, want) {
+			t.Fatalf("blocks mismatch for %x %x [%d, %d]: have %v, want %v", froms, tos, from, to, blocks, want)
+		}
+	}
+	check([]common.Address{addr1}, nil, 0, 10, []uint64{1, 3})
+	check([]common.Address{addr1, addr2}, nil, 0, 10, []uint64{1, 2, 3})
+	check([]common.Address{addr1, addr2}, nil, 2, 2, []uint64{2})
+	check(nil, []common.Address{addr3}, 0, 10, []uint64{1, 2})
+	check([]common.Address{addr1}, []common.Address{addr3}, 0, 10, []uint64{1})
+	check([]common.Address{addr3}, nil, 0, 10, nil)
+
+	// Unwinding a block removes it from the index, but keeps its entry for re-indexing
+	UnindexCallTraces(db, hash3, 3)
+	check([]common.Address{addr1}, nil, 0, 10, []uint64{1})
+	UnindexCallTraces(db, hash2, 2)
+	check(nil, []common.Address{addr3}, 0, 10, []uint64{1})
+	if entry := ReadCallTraceIndexEntry(db, hash2, 2); entry == nil {
+		t.Fatalf("call trace index entry of the unwound block is missing")
+	}
+	IndexCallTraces(db, hash2, 2)
+	check(nil, []common.Address{addr3}, 0, 10, []uint64{1, 2})
+
+	DeleteCallTraceIndexStart(db)
+	if start := ReadCallTraceIndexStart(db); start != nil {
+		t.Fatalf("deleted call trace index start returned: %d", *start)
+	}
+}
@@ -20,7 +20,9 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"math/big"
+	"os"
 	"testing"
 
 	"github.com/ledgerwatch/turbo-geth/common"
@@ -359,3 +361,103 @@ func checkReceiptsRLP(have, want types.Receipts) error {
 	}
 	return nil
 }
+
+// Tests the retrieval of the block data from the ancient store.
+func TestAncientStorage(t *testing.T) {
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	db, err := NewDatabaseWithFreezer(ethdb.NewMemDatabase(), frdir, "")
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend")
+	}
+	defer db.Close()
+
+	// Create test blocks, the second one is frozen without the receipts
+	var blocks []*types.Block
+	for i := 0; i < 2; i++ {
+		blocks = append(blocks, types.NewBlockWithHeader(&types.Header{
+			Number:      big.NewInt(int64(i)),
+			Extra:       []byte("test block"),
+			UncleHash:   types.EmptyUncleHash,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		}))
+	}
+	// Ensure nothing non-existent will be read
+	hash, number := blocks[0].Hash(), blocks[0].NumberU64()
+	if blob := ReadHeaderRLP(db, hash, number); len(blob) > 0 {
+		t.Fatalf("non existent header returned")
+	}
+	if blob := ReadBodyRLP(db, hash, number); len(blob) > 0 {
+		t.Fatalf("non existent body returned")
+	}
+	if blob := ReadReceiptsRLP(db, hash, number); len(blob) > 0 {
+		t.Fatalf("non existent receipts returned")
+	}
+	if blob := ReadTdRLP(db, hash, number); len(blob) > 0 {
+		t.Fatalf("non existent td returned")
+	}
+	// Write and verify the blocks in the ancient store
+	WriteAncientBlock(db.(ethdb.AncientWriter), blocks[0], types.Receipts{}, big.NewInt(100))
+	WriteAncientBlock(db.(ethdb.AncientWriter), blocks[1], nil, big.NewInt(200))
+
+	if frozen, err := db.Ancients(); err != nil || frozen != 2 {
+		t.Fatalf("ancients mismatch: have %d, want %d", frozen, 2)
+	}
+	// The data is read through the pending mutations as well
+	for _, reader := range []DatabaseReader{db, db.NewBatch()} {
+		if have := ReadCanonicalHash(reader, number); have != hash {
+			t.Fatalf("canonical hash mismatch: have %x, want %x", have, hash)
+		}
+		if blob := ReadHeaderRLP(reader, hash, number); len(blob) == 0 {
+			t.Fatalf("no header returned")
+		}
+		if !HasHeader(reader, hash, number) || !HasBody(reader, hash, number) || !HasReceipts(reader, hash, number) {
+			t.Fatalf("frozen block data not found")
+		}
+		if entry := ReadBlock(reader, hash, number); entry == nil || entry.Hash() != hash {
+			t.Fatalf("frozen block mismatch: have %v, want %v", entry, blocks[0])
+		}
+		if receipts := ReadRawReceipts(reader, hash, number); receipts == nil || len(receipts) != 0 {
+			t.Fatalf("frozen receipts mismatch: have %v", receipts)
+		}
+		if td := ReadTd(reader, hash, number); td == nil || td.Cmp(big.NewInt(100)) != 0 {
+			t.Fatalf("frozen td mismatch: have %v, want %v", td, 100)
+		}
+	}
+	// The receipts, which are not frozen, are not found
+	if HasReceipts(db, blocks[1].Hash(), 1) {
+		t.Fatalf("missing receipts found")
+	}
+	if receipts := ReadRawReceipts(db, blocks[1].Hash(), 1); receipts != nil {
+		t.Fatalf("missing receipts returned: %v", receipts)
+	}
+	// Use a fake hash for data retrieval, nothing should be returned.
+	fakeHash := common.BytesToHash([]byte{0x01, 0x02, 0x03})
+	if blob := ReadHeaderRLP(db, fakeHash, number); len(blob) != 0 {
+		t.Fatalf("invalid header returned")
+	}
+	if blob := ReadBodyRLP(db, fakeHash, number); len(blob) != 0 {
+		t.Fatalf("invalid body returned")
+	}
+	if blob := ReadReceiptsRLP(db, fakeHash, number); len(blob) != 0 {
+		t.Fatalf("invalid receipts returned")
+	}
+	if blob := ReadTdRLP(db, fakeHash, number); len(blob) != 0 {
+		t.Fatalf("invalid td returned")
+	}
+	if HasHeader(db, fakeHash, number) {
+		t.Fatalf("invalid header found")
+	}
+	// Truncate the ancient store, the truncated block is not found anymore
+	if err := db.TruncateAncients(1); err != nil {
+		t.Fatalf("failed to truncate ancient store: %v", err)
+	}
+	if entry := ReadBlock(db, blocks[1].Hash(), 1); entry != nil {
+		t.Fatalf("truncated block returned: %v", entry)
+	}
+}
@@ -0,0 +1,230 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// LogIndexEntry is the set of distinct log addresses and topics of a single block.
+// It is kept per block to be able to remove the block from the log index on reorg.
+type LogIndexEntry struct {
+	Addresses []common.Address
+	Topics    []common.Hash
+}
+
+// NewLogIndexEntry collects the distinct addresses and topics of the given logs.
+func NewLogIndexEntry(logs []*types.Log) *LogIndexEntry {
+	entry := new(LogIndexEntry)
+	addresses := make(map[common.Address]struct{})
+	topics := make(map[common.Hash]struct{})
+	for _, l := range logs {
+		if _, ok := addresses[l.Address]; !ok {
+			addresses[l.Address] = struct{}{}
+			entry.Addresses = append(entry.Addresses, l.Address)
+		}
+		for _, topic := range l.Topics {
+			if _, ok := topics[topic]; !ok {
+				topics[topic] = struct{}{}
+				entry.Topics = append(entry.Topics, topic)
+			}
+		}
+	}
+	return entry
+}
+
+// ReadLogIndexEntry retrieves the log index entry of a block.
+func ReadLogIndexEntry(db DatabaseReader, hash common.Hash, number uint64) *LogIndexEntry {
+	data, _ := db.Get(dbutils.LogIndexChangeSetBucket, dbutils.BlockNumHashKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	entry := new(LogIndexEntry)
+	if err := rlp.DecodeBytes(data, entry); err != nil {
+		log.Error("Invalid log index entry RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return entry
+}
+
+// WriteLogIndex stores the log index entry of a block and adds the block to
+// the address and topic indices. Writing the same block twice is a no-op.
+func WriteLogIndex(db DatabaseReadWriter, hash common.Hash, number uint64, logs []*types.Log) {
+	data, err := rlp.EncodeToBytes(NewLogIndexEntry(logs))
+	if err != nil {
+		log.Crit("Failed to RLP encode log index entry", "err", err)
+	}
+	if err := db.Put(dbutils.LogIndexChangeSetBucket, dbutils.BlockNumHashKey(number, hash), data); err != nil {
+		log.Crit("Failed to store log index entry", "err", err)
+	}
+	IndexLogs(db, hash, number)
+}
+
+// IndexLogs adds a block, which log index entry is already stored, to the
+// address and topic indices. It is used to re-index the blocks of a chain
+// becoming canonical.
+func IndexLogs(db DatabaseReadWriter, hash common.Hash, number uint64) {
+	entry := ReadLogIndexEntry(db, hash, number)
+	if entry == nil {
+		return
+	}
+	for i := range entry.Addresses {
+		if err := addToLogIndex(db, dbutils.LogAddressIndexBucket, entry.Addresses[i][:], number); err != nil {
+			log.Crit("Failed to store log address index", "err", err)
+		}
+	}
+	for i := range entry.Topics {
+		if err := addToLogIndex(db, dbutils.LogTopicIndexBucket, entry.Topics[i][:], number); err != nil {
+			log.Crit("Failed to store log topic index", "err", err)
+		}
+	}
+}
+
+// UnindexLogs removes a block from the address and topic indices, keeping its
+// log index entry so that the block can be re-indexed if it becomes canonical again.
+func UnindexLogs(db DatabaseReadWriter, hash common.Hash, number uint64) {
+	entry := ReadLogIndexEntry(db, hash, number)
+	if entry == nil {
+		return
+	}
+	for i := range entry.Addresses {
+		if err := removeFromLogIndex(db, dbutils.LogAddressIndexBucket, entry.Addresses[i][:], number); err != nil {
+			log.Crit("Failed to remove log address index", "err", err)
+		}
+	}
+	for i := range entry.Topics {
+		if err := removeFromLogIndex(db, dbutils.LogTopicIndexBucket, entry.Topics[i][:], number); err != nil {
+			log.Crit("Failed to remove log topic index", "err", err)
+		}
+	}
+}
+
+func addToLogIndex(db DatabaseReadWriter, bucket, key []byte, number uint64) error {
+	data, _ := db.Get(bucket, key)
+	index := new(ethdb.HistoryIndex)
+	if err := index.Decode(data); err != nil {
+		return err
+	}
+	if found, ok := index.Search(number); ok && found == number {
+		return nil
+	}
+	enc, err := index.Append(number).Encode()
+	if err != nil {
+		return err
+	}
+	return db.Put(bucket, common.CopyBytes(key), enc)
+}
+
+func removeFromLogIndex(db DatabaseReadWriter, bucket, key []byte, number uint64) error {
+	data, _ := db.Get(bucket, key)
+	if len(data) == 0 {
+		return nil
+	}
+	enc, empty, err := ethdb.RemoveFromIndex(data, number)
+	if err != nil {
+		return err
+	}
+	if empty {
+		return db.Delete(bucket, common.CopyBytes(key))
+	}
+	return db.Put(bucket, common.CopyBytes(key), enc)
+}
+
+// ReadLogIndexStart retrieves the number of the first block covered by the log index.
+func ReadLogIndexStart(db DatabaseReader) *uint64 {
+	data, _ := db.Get(dbutils.LogIndexStartKey, dbutils.LogIndexStartKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteLogIndexStart stores the number of the first block covered by the log index.
+func WriteLogIndexStart(db DatabaseWriter, number uint64) {
+	if err := db.Put(dbutils.LogIndexStartKey, dbutils.LogIndexStartKey, dbutils.EncodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store log index start", "err", err)
+	}
+}
+
+// DeleteLogIndexStart marks the log index as not maintained.
+func DeleteLogIndexStart(db DatabaseDeleter) {
+	if err := db.Delete(dbutils.LogIndexStartKey, dbutils.LogIndexStartKey); err != nil {
+		log.Crit("Failed to delete log index start", "err", err)
+	}
+}
+
+// FindLogIndexBlocks returns the numbers of the blocks within [from, to], which
+// may contain logs matching the given addresses and topics. Like the bloom
+// filters, the topic index is not positional, so the result is a superset of
+// the matching blocks and the logs still have to be filtered. At least one
+// address or topic has to be given.
+func FindLogIndexBlocks(db DatabaseReader, addresses []common.Address, topics [][]common.Hash, from, to uint64) ([]uint64, error) {
+	var criteria []map[uint64]struct{}
+	if len(addresses) > 0 {
+		keys := make([][]byte, len(addresses))
+		for i := range addresses {
+			keys[i] = addresses[i][:]
+		}
+		blocks, err := readLogIndexUnion(db, dbutils.LogAddressIndexBucket, keys, from, to)
+		if err != nil {
+			return nil, err
+		}
+		criteria = append(criteria, blocks)
+	}
+	for _, sub := range topics {
+		if len(sub) == 0 {
+			continue
+		}
+		keys := make([][]byte, len(sub))
+		for i := range sub {
+			keys[i] = sub[i][:]
+		}
+		blocks, err := readLogIndexUnion(db, dbutils.LogTopicIndexBucket, keys, from, to)
+		if err != nil {
+			return nil, err
+		}
+		criteria = append(criteria, blocks)
+	}
+	if len(criteria) == 0 {
+		return nil, nil
+	}
+	var result []uint64
+Blocks:
+	for number := range criteria[0] {
+		for _, blocks := range criteria[1:] {
+			if _, ok := blocks[number]; !ok {
+				continue Blocks
+			}
+		}
+		result = append(result, number)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+// readLogIndexUnion collects the blocks within [from, to] indexed under any of the given keys.
+func readLogIndexUnion(db DatabaseReader, bucket []byte, keys [][]byte, from, to uint64) (map[uint64]struct{}, error) {
+	blocks := make(map[uint64]struct{})
+	for _, key := range keys {
+		data, _ := db.Get(bucket, key)
+		index := new(ethdb.HistoryIndex)
+		if err := index.Decode(data); err != nil {
+			return nil, err
+		}
+		start := sort.Search(len(*index), func(i int) bool { return (*index)[i] >= from })
+		for _, number := range (*index)[start:] {
+			if number > to {
+				break
+			}
+			blocks[number] = struct{}{}
+		}
+	}
+	return blocks, nil
+}
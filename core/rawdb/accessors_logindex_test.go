@@ -0,0 +1,74 @@
+package rawdb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// Tests that the log index can be written, unwound and queried.
+func TestLogIndexStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+
+	var (
+		addr1  = common.BytesToAddress([]byte{0x11})
+		addr2  = common.BytesToAddress([]byte{0x22})
+		topic1 = common.BytesToHash([]byte{0x01})
+		topic2 = common.BytesToHash([]byte{0x02})
+
+		hash1 = common.BytesToHash([]byte{0xa1})
+		hash2 = common.BytesToHash([]byte{0xa2})
+		hash3 = common.BytesToHash([]byte{0xa3})
+	)
+	if start := ReadLogIndexStart(db); start != nil {
+		t.Fatalf("non existent log index start returned: %d", *start)
+	}
+	WriteLogIndexStart(db, 1)
+	if start := ReadLogIndexStart(db); start == nil || *start != 1 {
+		t.Fatalf("log index start mismatch: have %v, want 1", start)
+	}
+	WriteLogIndex(db, hash1, 1, []*types.Log{{Address: addr1, Topics: []common.Hash{topic1}}, {Address: addr1, Topics: []common.Hash{topic1, topic2}}})
+	WriteLogIndex(db, hash2, 2, []*types.Log{{Address: addr2, Topics: []common.Hash{topic2}}})
+	WriteLogIndex(db, hash3, 3, []*types.Log{{Address: addr1, Topics: []common.Hash{topic2}}})
+	// Writing a block again must not duplicate it in the index
+	WriteLogIndex(db, hash3, 3, []*types.Log{{Address: addr1, Topics: []common.Hash{topic2}}})
+
+	if entry := ReadLogIndexEntry(db, hash1, 1); entry == nil || !reflect.DeepEqual(entry, &LogIndexEntry{Addresses: []common.Address{addr1}, Topics: []common.Hash{topic1, topic2}}) {
+		t.Fatalf("log index entry mismatch: %v", entry)
+	}
+	check := func(addresses []common.Address, topics [][]common.Hash, from, to uint64, want []uint64) {
+		t.Helper()
+		blocks, err := FindLogIndexBlocks(db, addresses, topics, from, to)
+		if err != nil {
+			t.Fatalf("failed to find blocks: %v", err)
+		}
+		if !reflect.DeepEqual(blocks, want) {
+			t.Fatalf("blocks mismatch for %v %v [%d, %d]: have %v, want %v", addresses, topics, from, to, blocks, want)
+		}
+	}
+	check([]common.Address{addr1}, nil, 0, 10, []uint64{1, 3})
+	check([]common.Address{addr1, addr2}, nil, 0, 10, []uint64{1, 2, 3})
+	check([]common.Address{addr1, addr2}, nil, 2, 2, []uint64{2})
+	check(nil, [][]common.Hash{{topic2}}, 0, 10, []uint64{1, 2, 3})
+	check([]common.Address{addr1}, [][]common.Hash{nil, {topic2}}, 0, 10, []uint64{1, 3})
+	check([]common.Address{addr2}, [][]common.Hash{{topic1}}, 0, 10, nil)
+
+	// Unwinding a block removes it from the index, but keeps its entry for re-indexing
+	UnindexLogs(db, hash3, 3)
+	check([]common.Address{addr1}, nil, 0, 10, []uint64{1})
+	UnindexLogs(db, hash2, 2)
+	check([]common.Address{addr2}, nil, 0, 10, nil)
+	if entry := ReadLogIndexEntry(db, hash2, 2); entry == nil {
+		t.Fatalf("log index entry of the unwound block is missing")
+	}
+	IndexLogs(db, hash2, 2)
+	check(nil, [][]common.Hash{{topic2}}, 0, 10, []uint64{1, 2})
+
+	DeleteLogIndexStart(db)
+	if start := ReadLogIndexStart(db); start != nil {
+		t.Fatalf("deleted log index start returned: %d", *start)
+	}
+}
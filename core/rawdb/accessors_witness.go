@@ -0,0 +1,71 @@
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// BlockWitnessEntry is the witness of a block, as produced by the node, together
+// with the keys (in KEY encoding) touched by the block. The keys are kept to be able
+// to produce the witness of the binary trie on demand.
+type BlockWitnessEntry struct {
+	Witness []byte
+	Keys    [][]byte
+}
+
+// ReadBlockWitness retrieves the stored witness of a block.
+func ReadBlockWitness(db DatabaseReader, hash common.Hash, number uint64) *BlockWitnessEntry {
+	data, _ := db.Get(dbutils.BlockWitnessBucket, dbutils.BlockNumHashKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	entry := new(BlockWitnessEntry)
+	if err := rlp.DecodeBytes(data, entry); err != nil {
+		log.Error("Invalid block witness RLP", "hash", hash, "err", err)
+		return nil
+	}
+	return entry
+}
+
+// WriteBlockWitness stores the witness of a block.
+func WriteBlockWitness(db DatabaseWriter, hash common.Hash, number uint64, entry *BlockWitnessEntry) {
+	data, err := rlp.EncodeToBytes(entry)
+	if err != nil {
+		log.Crit("Failed to RLP encode block witness", "err", err)
+	}
+	if err := db.Put(dbutils.BlockWitnessBucket, dbutils.BlockNumHashKey(number, hash), data); err != nil {
+		log.Crit("Failed to store block witness", "err", err)
+	}
+}
+
+// DeleteBlockWitness removes the witness of a block.
+func DeleteBlockWitness(db DatabaseDeleter, hash common.Hash, number uint64) {
+	if err := db.Delete(dbutils.BlockWitnessBucket, dbutils.BlockNumHashKey(number, hash)); err != nil {
+		log.Crit("Failed to delete block witness", "err", err)
+	}
+}
+
+// PruneBlockWitnesses removes the witnesses of all the blocks with numbers up to and including the given one.
+// Only the witnesses already committed to the database are seen, if db is a batch.
+func PruneBlockWitnesses(db ethdb.Database, number uint64) {
+	var keys [][]byte
+	if err := db.Walk(dbutils.BlockWitnessBucket, dbutils.EncodeBlockNumber(0), 0, func(k, _ []byte) (bool, error) {
+		if binary.BigEndian.Uint64(k[:8]) > number {
+			return false, nil
+		}
+		keys = append(keys, common.CopyBytes(k))
+		return true, nil
+	}); err != nil {
+		log.Crit("Failed to iterate block witnesses", "err", err)
+	}
+	for _, k := range keys {
+		if err := db.Delete(dbutils.BlockWitnessBucket, k); err != nil {
+			log.Crit("Failed to delete block witness", "err", err)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+func init() {
+	rand.Seed(time.Now().Unix())
+}
+
+// getChunk returns a chunk of data, filled with the given byte
+func getChunk(size int, b int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(b)
+	}
+	return data
+}
+
+// tempFreezerDir returns a unique directory for the freezer tables of a test
+func tempFreezerDir(name string) string {
+	// #nosec G404
+	return filepath.Join(os.TempDir(), fmt.Sprintf("freezer-%s-%d", name, rand.Uint64()))
+}
+
+// TestFreezerBasics test initializing a freezertable from scratch, writing to the table,
+// and reading it back.
+func TestFreezerBasics(t *testing.T) {
+	t.Parallel()
+	dir := tempFreezerDir("basics")
+	defer os.RemoveAll(dir)
+
+	// set cutoff at 50 bytes
+	f, err := newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Write 15 bytes 255 times, results in 85 files
+	for x := 0; x < 255; x++ {
+		data := getChunk(15, x)
+		if err := f.Append(uint64(x), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for y := 0; y < 255; y++ {
+		exp := getChunk(15, y)
+		got, err := f.Retrieve(uint64(y))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("test %d, got \n%x != \n%x", y, got, exp)
+		}
+	}
+	// Check that we cannot read too far
+	if _, err := f.Retrieve(uint64(255)); err != errOutOfBounds {
+		t.Fatalf("expected out of bounds, got %v", err)
+	}
+	// Check that only the next item can be appended
+	if err := f.Append(uint64(300), getChunk(15, 0)); err == nil {
+		t.Fatalf("out of order item appended")
+	}
+}
+
+// TestFreezerReopen tests that the items are retrievable after the table is reopened,
+// with both compressed and uncompressed data, and that it is appendable.
+func TestFreezerReopen(t *testing.T) {
+	t.Parallel()
+	for _, noCompression := range []bool{false, true} {
+		dir := tempFreezerDir("reopen")
+		defer os.RemoveAll(dir)
+
+		f, err := newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, noCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for x := 0; x < 100; x++ {
+			if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+
+		if f, err = newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, noCompression); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Append(100, getChunk(15, 100)); err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y <= 100; y++ {
+			exp := getChunk(15, y)
+			got, err := f.Retrieve(uint64(y))
+			if err != nil {
+				t.Fatalf("compression %v, test %d: %v", !noCompression, y, err)
+			}
+			if !bytes.Equal(got, exp) {
+				t.Fatalf("compression %v, test %d, got \n%x != \n%x", !noCompression, y, got, exp)
+			}
+		}
+		f.Close()
+	}
+}
+
+// TestFreezerRepairDanglingHead tests that we can recover if index entries are removed
+func TestFreezerRepairDanglingHead(t *testing.T) {
+	t.Parallel()
+	dir := tempFreezerDir("dangling")
+	defer os.RemoveAll(dir)
+
+	{ // Fill table
+		f, err := newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Write 15 bytes 255 times
+		for x := 0; x < 255; x++ {
+			if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// The last item should be there
+		if _, err = f.Retrieve(0xfe); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	// open the index
+	idxFile, err := os.OpenFile(filepath.Join(dir, "test.ridx"), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open index file: %v", err)
+	}
+	// Remove 4 bytes
+	stat, err := idxFile.Stat()
+	if err != nil {
+		t.Fatalf("Failed to stat index file: %v", err)
+	}
+	idxFile.Truncate(stat.Size() - 4)
+	idxFile.Close()
+	// Now open it again
+	{
+		f, err := newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		// The last item should be missing
+		if _, err = f.Retrieve(0xff); err == nil {
+			t.Errorf("Expected error for missing index entry")
+		}
+		// The one before should still be there
+		if _, err = f.Retrieve(0xfd); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+}
+
+// TestFreezerRepairDanglingData tests that the data written beyond the last index
+// entry is discarded on reopening.
+func TestFreezerRepairDanglingData(t *testing.T) {
+	t.Parallel()
+	dir := tempFreezerDir("danglingdata")
+	defer os.RemoveAll(dir)
+
+	f, err := newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 1000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 10; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	// Append some garbage to the data file
+	dataFile, err := os.OpenFile(filepath.Join(dir, "test.0000.rdat"), os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open data file: %v", err)
+	}
+	dataFile.Write(getChunk(7, 0xff))
+	dataFile.Close()
+
+	if f, err = newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 1000, true); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.items != 10 {
+		t.Fatalf("expected %d items, got %d", 10, f.items)
+	}
+	if f.headBytes != 150 {
+		t.Fatalf("expected %d head bytes, got %d", 150, f.headBytes)
+	}
+	if err := f.Append(10, getChunk(15, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := f.Retrieve(10); err != nil || !bytes.Equal(got, getChunk(15, 10)) {
+		t.Fatalf("appended item mismatch: %x, %v", got, err)
+	}
+}
+
+// TestFreezerTruncate tests truncating the table across the data files, and
+// appending after the truncation.
+func TestFreezerTruncate(t *testing.T) {
+	t.Parallel()
+	dir := tempFreezerDir("truncation")
+	defer os.RemoveAll(dir)
+
+	// set cutoff at 50 bytes
+	f, err := newCustomTable(dir, "test", metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Write 15 bytes 30 times, results in 10 files
+	for x := 0; x < 30; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	if f.items != 10 {
+		t.Fatalf("expected %d items, got %d", 10, f.items)
+	}
+	// 45, 45, 15
+	if f.headBytes != 15 {
+		t.Fatalf("expected %d bytes, got %d", 15, f.headBytes)
+	}
+	if _, err := f.Retrieve(10); err != errOutOfBounds {
+		t.Fatalf("expected out of bounds, got %v", err)
+	}
+	// The truncated items are overwritten by the new ones
+	for x := 10; x < 20; x++ {
+		if err := f.Append(uint64(x), getChunk(15, 0xff-x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for y := 0; y < 20; y++ {
+		exp := getChunk(15, y)
+		if y >= 10 {
+			exp = getChunk(15, 0xff-y)
+		}
+		got, err := f.Retrieve(uint64(y))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("test %d, got \n%x != \n%x", y, got, exp)
+		}
+	}
+}
+
+// TestFreezerRepair tests that the tables of a freezer are truncated to the same
+// length, when they go out of sync.
+func TestFreezerRepair(t *testing.T) {
+	t.Parallel()
+	dir := tempFreezerDir("repair")
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 3; x++ {
+		chunk := getChunk(15, x)
+		if err := f.AppendAncient(uint64(x), getChunk(32, x), chunk, chunk, chunk, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.AppendAncient(5, getChunk(32, 5), nil, nil, nil, nil); err != errOutOrderInsertion {
+		t.Fatalf("expected out of order insertion, got %v", err)
+	}
+	// Append one more item to a single table, as if the freezer crashed in the middle of the append
+	if err := f.tables[freezerHashTable].Append(3, getChunk(32, 3)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if f, err = newFreezer(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if frozen, _ := f.Ancients(); frozen != 3 {
+		t.Fatalf("expected %d ancients, got %d", 3, frozen)
+	}
+	if has, _ := f.HasAncient(freezerHashTable, 3); has {
+		t.Fatalf("dangling item is not truncated")
+	}
+	if got, err := f.Ancient(freezerReceiptTable, 2); err != nil || !bytes.Equal(got, getChunk(15, 2)) {
+		t.Fatalf("item mismatch: %x, %v", got, err)
+	}
+}
@@ -31,3 +31,10 @@ type DatabaseWriter interface {
 type DatabaseDeleter interface {
 	Delete(bucket, key []byte) error
 }
+
+// DatabaseReadWriter wraps the read, write and delete methods of a backing data store.
+type DatabaseReadWriter interface {
+	DatabaseReader
+	DatabaseWriter
+	DatabaseDeleter
+}
@@ -0,0 +1,202 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+)
+
+// AccessSet is a set of accounts and storage items, read or written by a transaction.
+type AccessSet struct {
+	accounts map[common.Address]struct{}
+	storage  map[common.Address]map[common.Hash]struct{}
+}
+
+// NewAccessSet creates an empty access set.
+func NewAccessSet() *AccessSet {
+	return &AccessSet{
+		accounts: make(map[common.Address]struct{}),
+		storage:  make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// AddAccount adds the account to the set.
+func (s *AccessSet) AddAccount(addr common.Address) {
+	s.accounts[addr] = struct{}{}
+}
+
+// AddStorage adds the storage item of the account to the set.
+func (s *AccessSet) AddStorage(addr common.Address, key common.Hash) {
+	m, ok := s.storage[addr]
+	if !ok {
+		m = make(map[common.Hash]struct{})
+		s.storage[addr] = m
+	}
+	m[key] = struct{}{}
+}
+
+// RemoveAccount removes the account from the set, keeping its storage items.
+func (s *AccessSet) RemoveAccount(addr common.Address) {
+	delete(s.accounts, addr)
+}
+
+// HasAccount reports whether the account is in the set.
+func (s *AccessSet) HasAccount(addr common.Address) bool {
+	_, ok := s.accounts[addr]
+	return ok
+}
+
+// HasStorage reports whether the set contains any storage items of the account.
+func (s *AccessSet) HasStorage(addr common.Address) bool {
+	return len(s.storage[addr]) > 0
+}
+
+// Merge adds all the accounts and storage items of the other set to this one.
+func (s *AccessSet) Merge(other *AccessSet) {
+	for addr := range other.accounts {
+		s.accounts[addr] = struct{}{}
+	}
+	for addr, m := range other.storage {
+		for key := range m {
+			s.AddStorage(addr, key)
+		}
+	}
+}
+
+// Intersects reports whether the sets have any accounts, or any storage items in common.
+func (s *AccessSet) Intersects(other *AccessSet) bool {
+	small, large := s, other
+	if len(small.accounts) > len(large.accounts) {
+		small, large = large, small
+	}
+	for addr := range small.accounts {
+		if _, ok := large.accounts[addr]; ok {
+			return true
+		}
+	}
+	small, large = s, other
+	if len(small.storage) > len(large.storage) {
+		small, large = large, small
+	}
+	for addr, m := range small.storage {
+		m1, ok := large.storage[addr]
+		if !ok {
+			continue
+		}
+		for key := range m {
+			if _, ok := m1[key]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// List returns the accounts of the set with their storage items, ordered by address and key.
+func (s *AccessSet) List() []types.AccessedAccount {
+	list := make([]types.AccessedAccount, 0, len(s.accounts)+len(s.storage))
+	for addr := range s.accounts {
+		list = append(list, types.AccessedAccount{Address: addr, Account: true})
+	}
+	for addr := range s.storage {
+		if _, ok := s.accounts[addr]; !ok {
+			list = append(list, types.AccessedAccount{Address: addr})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Address[:], list[j].Address[:]) < 0
+	})
+	for i := range list {
+		m := s.storage[list[i].Address]
+		if len(m) == 0 {
+			continue
+		}
+		keys := make([]common.Hash, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		list[i].StorageKeys = keys
+	}
+	return list
+}
+
+// AccessRecorder is a StateReader recording the accounts and storage items read through it.
+// Reading the storage item or the code of an account records the account as well.
+type AccessRecorder struct {
+	reader StateReader
+	reads  *AccessSet
+}
+
+// NewAccessRecorder wraps the given reader into an AccessRecorder.
+func NewAccessRecorder(reader StateReader) *AccessRecorder {
+	return &AccessRecorder{reader: reader, reads: NewAccessSet()}
+}
+
+// Reads returns the accounts and storage items read so far.
+func (r *AccessRecorder) Reads() *AccessSet {
+	return r.reads
+}
+
+func (r *AccessRecorder) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r.reads.AddAccount(address)
+	return r.reader.ReadAccountData(address)
+}
+
+func (r *AccessRecorder) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r.reads.AddAccount(address)
+	r.reads.AddStorage(address, *key)
+	return r.reader.ReadAccountStorage(address, incarnation, key)
+}
+
+func (r *AccessRecorder) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	r.reads.AddAccount(address)
+	return r.reader.ReadAccountCode(address, codeHash)
+}
+
+func (r *AccessRecorder) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	r.reads.AddAccount(address)
+	return r.reader.ReadAccountCodeSize(address, codeHash)
+}
+
+// SyncReader serialises the reads of a StateReader, which is not safe for concurrent use,
+// so that it can be shared between goroutines.
+type SyncReader struct {
+	reader StateReader
+	mu     sync.Mutex
+}
+
+// NewSyncReader wraps the given reader into a SyncReader.
+func NewSyncReader(reader StateReader) *SyncReader {
+	return &SyncReader{reader: reader}
+}
+
+func (r *SyncReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reader.ReadAccountData(address)
+}
+
+func (r *SyncReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reader.ReadAccountStorage(address, incarnation, key)
+}
+
+func (r *SyncReader) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reader.ReadAccountCode(address, codeHash)
+}
+
+func (r *SyncReader) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reader.ReadAccountCodeSize(address, codeHash)
+}
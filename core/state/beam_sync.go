@@ -0,0 +1,130 @@
+package state
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+// StateFetcher retrieves the parts of the state that are not present locally from the network.
+// It makes it possible to execute blocks before the state is downloaded (beam sync).
+// Subtries are identified by their hex prefixes (without the terminator), and the data
+// must be verified against the hash of the subtrie before being written into the database.
+type StateFetcher interface {
+	// FetchAccountRange writes all the accounts of the subtrie as of the given block into the database.
+	// It returns false if the subtrie contains too many accounts to be fetched at once,
+	// in which case the root node of the subtrie needs to be fetched instead.
+	FetchAccountRange(ctx context.Context, db ethdb.Putter, blockNr uint64, hexPrefix []byte, hash []byte) (bool, error)
+	// FetchAccountNode returns the RLP of the root node of the subtrie.
+	FetchAccountNode(ctx context.Context, blockNr uint64, hexPrefix []byte) ([]byte, error)
+	// FetchStorageRange is like FetchAccountRange, but for a subtrie of the contract's storage.
+	FetchStorageRange(ctx context.Context, db ethdb.Putter, blockNr uint64, addrHash common.Hash, incarnation uint64, hexPrefix []byte, hash []byte) (bool, error)
+	// FetchStorageNode is like FetchAccountNode, but for a subtrie of the contract's storage.
+	FetchStorageNode(ctx context.Context, blockNr uint64, addrHash common.Hash, hexPrefix []byte) ([]byte, error)
+	// FetchCode writes the bytecode with the given hash into the database.
+	FetchCode(ctx context.Context, db ethdb.Putter, blockNr uint64, address common.Address, codeHash common.Hash) error
+}
+
+// SetStateFetcher makes the state fetch the accounts, storage items and bytecodes that are missing
+// in the database before reading them. The trie is expected to start as just the root hash.
+func (tds *TrieDbState) SetStateFetcher(f StateFetcher) {
+	tds.tMu.Lock()
+	defer tds.tMu.Unlock()
+	tds.fetcher = f
+	tds.fetched = make(map[string]struct{})
+	tds.fetchCtx = context.Background()
+}
+
+// SetFetchContext sets the context of the fetches made by the state fetcher.
+// Cancelling the context aborts the fetches, and with them the execution of the block.
+func (tds *TrieDbState) SetFetchContext(ctx context.Context) {
+	tds.tMu.Lock()
+	defer tds.tMu.Unlock()
+	tds.fetchCtx = ctx
+}
+
+// isFetched checks whether the subtrie at the hex prefix (or a larger subtrie containing it)
+// has been fetched into the database. Only the prefixes not shorter than minLen are considered.
+func (tds *TrieDbState) isFetched(hexPrefix []byte, minLen int) bool {
+	for i := minLen; i <= len(hexPrefix); i++ {
+		if _, ok := tds.fetched[string(hexPrefix[:i])]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchAccount makes sure that the account can be read from the trie or the database,
+// fetching the subtrie containing it if necessary. Must be called with tMu held.
+func (tds *TrieDbState) fetchAccount(addrHash common.Hash) error {
+	for {
+		hexPrefix, hash, found := tds.t.FirstHashNode(addrHash[:])
+		if !found || tds.isFetched(hexPrefix, 0) {
+			return nil
+		}
+		ok, err := tds.fetcher.FetchAccountRange(tds.fetchCtx, tds.db, tds.getBlockNr(), hexPrefix, hash)
+		if err != nil {
+			return err
+		}
+		if ok {
+			tds.fetched[string(hexPrefix)] = struct{}{}
+			return nil
+		}
+		// Too many accounts in the subtrie, go one level deeper
+		nodeRLP, err := tds.fetcher.FetchAccountNode(tds.fetchCtx, tds.getBlockNr(), hexPrefix)
+		if err != nil {
+			return err
+		}
+		if err := tds.t.HookNodeRLP(hexPrefix, hash, nodeRLP); err != nil {
+			return err
+		}
+	}
+}
+
+// fetchStorage makes sure that the storage item can be read from the trie or the database,
+// fetching the subtrie containing it if necessary. Must be called with tMu held.
+func (tds *TrieDbState) fetchStorage(addrHash common.Hash, seckey common.Hash) error {
+	if err := tds.fetchAccount(addrHash); err != nil {
+		return err
+	}
+	// The storage root of the account is only known once the account is in the trie
+	if need, req := tds.t.NeedResolution(nil, addrHash[:]); need {
+		resolver := trie.NewResolver(0, true, tds.blockNr)
+		resolver.SetHistorical(tds.historical)
+		resolver.AddRequest(req)
+		if err := resolver.ResolveWithDb(tds.db, tds.blockNr); err != nil {
+			return err
+		}
+	}
+	acc, ok := tds.t.GetAccount(addrHash[:])
+	if !ok || acc == nil {
+		return nil
+	}
+	storageKey := dbutils.GenerateCompositeTrieKey(addrHash, seckey)
+	for {
+		hexPrefix, hash, found := tds.t.FirstHashNode(storageKey)
+		if !found || tds.isFetched(hexPrefix, 2*common.HashLength) {
+			return nil
+		}
+		storagePrefix := hexPrefix[2*common.HashLength:]
+		ok, err := tds.fetcher.FetchStorageRange(tds.fetchCtx, tds.db, tds.getBlockNr(), addrHash, acc.Incarnation, storagePrefix, hash)
+		if err != nil {
+			return err
+		}
+		if ok {
+			tds.fetched[string(hexPrefix)] = struct{}{}
+			return nil
+		}
+		// Too many storage items in the subtrie, go one level deeper
+		nodeRLP, err := tds.fetcher.FetchStorageNode(tds.fetchCtx, tds.getBlockNr(), addrHash, storagePrefix)
+		if err != nil {
+			return err
+		}
+		if err := tds.t.HookNodeRLP(hexPrefix, hash, nodeRLP); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+// Limit of the number of the accounts and storage items in the state, from which the binary trie is built.
+// The binary trie is held entirely in memory, so it is meant for the test networks and the small states only.
+var MaxBinaryTrieItems = uint64(4 * 1024 * 1024)
+
+// EnableBinaryTrie makes the TrieDbState maintain the binary state trie alongside the hexary one,
+// applying the same updates to both of them. Unlike the hexary trie, the binary trie is not resolved
+// from the database on demand, and its nodes are never evicted. Instead, it is built from the current
+// state once and kept in memory. It fails if the state has more than MaxBinaryTrieItems items.
+func (tds *TrieDbState) EnableBinaryTrie() error {
+	bt, err := tds.buildBinaryTrie()
+	if err != nil {
+		return err
+	}
+	tds.tMu.Lock()
+	defer tds.tMu.Unlock()
+	tds.binaryTrie = bt
+	return nil
+}
+
+// BinaryRoot returns the root hash of the binary state trie, or false if the binary trie is not maintained.
+func (tds *TrieDbState) BinaryRoot() (common.Hash, bool, error) {
+	tds.tMu.Lock()
+	defer tds.tMu.Unlock()
+	if tds.binaryTrie == nil {
+		return common.Hash{}, false, nil
+	}
+	root, err := tds.binaryTrie.Hash()
+	if err != nil {
+		return common.Hash{}, false, err
+	}
+	return root, true, nil
+}
+
+// buildBinaryTrie inserts all the accounts and the storage items of their current incarnations into the binary trie.
+func (tds *TrieDbState) buildBinaryTrie() (*trie.BinaryTrie, error) {
+	bt := trie.NewBinaryTrie()
+	incarnations := make(map[common.Hash]uint64)
+	var items uint64
+	checkLimit := func() error {
+		if items++; items > MaxBinaryTrieItems {
+			return fmt.Errorf("state is too large for the in-memory binary trie, limit is %d accounts and storage items", MaxBinaryTrieItems)
+		}
+		return nil
+	}
+	if err := tds.db.Walk(dbutils.AccountsBucket, nil, 0, func(k, v []byte) (bool, error) {
+		if len(k) != common.HashLength {
+			return true, nil
+		}
+		if err := checkLimit(); err != nil {
+			return false, err
+		}
+		var acc accounts.Account
+		if err := acc.DecodeForStorage(v); err != nil {
+			return false, err
+		}
+		// The storage root is computed by the binary trie itself
+		acc.Root = trie.EmptyRoot
+		bt.Trie().UpdateAccount(common.CopyBytes(k), &acc)
+		if acc.Incarnation > 0 {
+			incarnations[common.BytesToHash(k)] = acc.Incarnation
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := tds.db.Walk(dbutils.StorageBucket, nil, 0, func(k, v []byte) (bool, error) {
+		if len(k) != common.HashLength+8+common.HashLength {
+			return true, nil
+		}
+		addrHash := common.BytesToHash(k[:common.HashLength])
+		incarnation := binary.BigEndian.Uint64(k[common.HashLength:]) ^ ^uint64(0)
+		if inc, ok := incarnations[addrHash]; !ok || inc != incarnation {
+			return true, nil
+		}
+		if err := checkLimit(); err != nil {
+			return false, err
+		}
+		keyHash := common.BytesToHash(k[common.HashLength+8:])
+		bt.Trie().Update(dbutils.GenerateCompositeTrieKey(addrHash, keyHash), common.CopyBytes(v), 0)
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return bt, nil
+}
+
+// updateBinaryTrie applies the updates of the buffer to the binary trie, the same way as to the hexary one.
+// alreadyCreated prevents repeated clearouts of the storage of the created contracts.
+// When rewinding, the contracts may come back to life after having been self-destructed. Their storage
+// is not part of the changes, so it is reloaded from the database for every restored contract.
+func (tds *TrieDbState) updateBinaryTrie(b *Buffer, alreadyCreated map[common.Hash]struct{}, forward bool) error {
+	for addrHash := range b.created {
+		if _, ok := alreadyCreated[addrHash]; ok {
+			continue
+		}
+		alreadyCreated[addrHash] = struct{}{}
+		tds.binaryTrie.Trie().DeleteSubtree(addrHash[:], tds.blockNr)
+	}
+	for addrHash, account := range b.accountUpdates {
+		if account != nil {
+			// The storage root is computed by the binary trie itself
+			acc := account.SelfCopy()
+			acc.Root = trie.EmptyRoot
+			tds.binaryTrie.Trie().UpdateAccount(addrHash[:], acc)
+			if !forward && acc.Incarnation > 0 {
+				if err := tds.reloadBinaryStorage(addrHash, acc.Incarnation); err != nil {
+					return err
+				}
+			}
+		} else {
+			tds.binaryTrie.Trie().Delete(addrHash[:], tds.blockNr)
+		}
+	}
+	for addrHash, m := range b.storageUpdates {
+		for keyHash, v := range m {
+			cKey := dbutils.GenerateCompositeTrieKey(addrHash, keyHash)
+			if len(v) > 0 {
+				tds.binaryTrie.Trie().Update(cKey, v, tds.blockNr)
+			} else {
+				tds.binaryTrie.Trie().Delete(cKey, tds.blockNr)
+			}
+		}
+	}
+	for addrHash := range b.deleted {
+		if _, ok := b.created[addrHash]; ok {
+			continue
+		}
+		tds.binaryTrie.Trie().DeleteSubtree(addrHash[:], tds.blockNr)
+	}
+	return nil
+}
+
+// reloadBinaryStorage replaces the storage of the account in the binary trie by the one in the database.
+// If the database is a batch, only the committed storage items are seen, so the pending ones have to be
+// applied on top of it.
+func (tds *TrieDbState) reloadBinaryStorage(addrHash common.Hash, incarnation uint64) error {
+	tds.binaryTrie.Trie().DeleteSubtree(addrHash[:], tds.blockNr)
+	prefix := dbutils.GenerateStoragePrefix(addrHash, incarnation)
+	return tds.db.Walk(dbutils.StorageBucket, prefix, uint(8*len(prefix)), func(k, v []byte) (bool, error) {
+		keyHash := common.BytesToHash(k[len(prefix):])
+		tds.binaryTrie.Trie().Update(dbutils.GenerateCompositeTrieKey(addrHash, keyHash), common.CopyBytes(v), tds.blockNr)
+		return true, nil
+	})
+}
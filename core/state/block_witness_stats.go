@@ -75,3 +75,12 @@ func NewBlockWitnessStats(blockNr uint64, witnessSize uint64, tapeStats trie.Wit
 		tapeStats:   tapeStats,
 	}
 }
+
+// BlockWitnessStatsOf reads the stats of the serialised block witness.
+func BlockWitnessStatsOf(blockNr uint64, witness []byte) (*BlockWitnessStats, error) {
+	tapeStats, err := trie.BlockWitnessTapeStats(witness)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlockWitnessStats(blockNr, uint64(len(witness)), tapeStats), nil
+}
@@ -173,8 +173,15 @@ type TrieDbState struct {
 	noHistory       bool
 	resolveReads    bool
 	savePreimages   bool
+	extractWitness  bool             // whether ComputeTrieRoots extracts the witness of the processed block
+	lastWitness     []byte           // witness of the last processed block, if extracted
+	lastWitnessKeys [][]byte         // keys touched by the last processed block, if the witness is extracted
+	binaryTrie      *trie.BinaryTrie // binary state trie maintained alongside the hexary one, if enabled
 	pg              *trie.ProofGenerator
 	tp              *trie.TriePruning
+	fetcher         StateFetcher        // fetches the missing state from the network, if set
+	fetched         map[string]struct{} // hex prefixes of the subtries fetched by the fetcher
+	fetchCtx        context.Context     // context of the fetches, cancelled to abort them
 }
 
 var (
@@ -272,10 +279,33 @@ func (tds *TrieDbState) SetResolveReads(rr bool) {
 	tds.resolveReads = rr
 }
 
+// ResolveReads reports whether the reads are recorded into the buffers, to be resolved
+func (tds *TrieDbState) ResolveReads() bool {
+	return tds.resolveReads
+}
+
 func (tds *TrieDbState) SetNoHistory(nh bool) {
 	tds.noHistory = nh
 }
 
+// SetExtractWitness makes ComputeTrieRoots extract the witness of each processed block,
+// which is then available via LastWitness. The reads have to be resolved for that.
+func (tds *TrieDbState) SetExtractWitness(ew bool) {
+	tds.extractWitness = ew
+}
+
+// LastWitness returns the witness of the last block processed with ComputeTrieRoots,
+// or nil if the witnesses are not extracted.
+func (tds *TrieDbState) LastWitness() []byte {
+	return tds.lastWitness
+}
+
+// LastWitnessKeys returns the account and storage keys (in KEY encoding) touched by the last block
+// processed with ComputeTrieRoots, which the witness of that block was built for.
+func (tds *TrieDbState) LastWitnessKeys() [][]byte {
+	return tds.lastWitnessKeys
+}
+
 func (tds *TrieDbState) Copy() *TrieDbState {
 	tds.tMu.Lock()
 	tcopy := *tds.t
@@ -359,6 +389,17 @@ func (tds *TrieDbState) ComputeTrieRoots() ([]common.Hash, error) {
 	if err := tds.ResolveStateTrie(); err != nil {
 		return nil, err
 	}
+	if tds.extractWitness {
+		// Witness has to be extracted before the state trie is modified
+		touches, storageTouches := tds.pg.ExtractTouches()
+		keys := append(touches, storageTouches...)
+		witness, _, err := tds.buildWitness(keys, tds.pg.ExtractCodeMap(), false, false /* is binary */)
+		if err != nil {
+			return nil, err
+		}
+		tds.lastWitness = witness
+		tds.lastWitnessKeys = keys
+	}
 	return tds.UpdateStateTrie()
 }
 
@@ -435,6 +476,11 @@ func (tds *TrieDbState) buildStorageTouches(withReads bool, withValues bool) (co
 func (tds *TrieDbState) resolveStorageTouches(storageTouches common.StorageKeys) error {
 	var resolver *trie.Resolver
 	for _, storageKey := range storageTouches {
+		if tds.fetcher != nil {
+			if err := tds.fetchStorage(common.BytesToHash(storageKey[:common.HashLength]), common.BytesToHash(storageKey[common.HashLength:])); err != nil {
+				return err
+			}
+		}
 		if need, req := tds.t.NeedResolution(storageKey[:common.HashLength], storageKey[:]); need {
 			if resolver == nil {
 				resolver = trie.NewResolver(0, false, tds.blockNr)
@@ -508,6 +554,11 @@ func (tds *TrieDbState) buildAccountTouches(withReads bool, withValues bool) (co
 func (tds *TrieDbState) resolveAccountTouches(accountTouches common.Hashes) error {
 	var resolver *trie.Resolver
 	for _, addrHash := range accountTouches {
+		if tds.fetcher != nil {
+			if err := tds.fetchAccount(addrHash); err != nil {
+				return err
+			}
+		}
 		if need, req := tds.t.NeedResolution(nil, addrHash[:]); need {
 			if resolver == nil {
 				resolver = trie.NewResolver(0, true, tds.blockNr)
@@ -608,6 +659,7 @@ func (tds *TrieDbState) updateTrieRoots(forward bool) ([]common.Hash, error) {
 	roots := make([]common.Hash, len(tds.buffers))
 	// The following map is to prevent repeated clearouts of the storage
 	alreadyCreated := make(map[common.Hash]struct{})
+	binaryCreated := make(map[common.Hash]struct{})
 	for i, b := range tds.buffers {
 		// New contracts are being created at these addresses. Therefore, we need to clear the storage items
 		// that might be remaining in the trie and figure out the next incarnations
@@ -739,6 +791,11 @@ func (tds *TrieDbState) updateTrieRoots(forward bool) ([]common.Hash, error) {
 			}
 			tds.t.DeleteSubtree(addrHash[:], tds.blockNr)
 		}
+		if tds.binaryTrie != nil {
+			if err := tds.updateBinaryTrie(b, binaryCreated, forward); err != nil {
+				return nil, err
+			}
+		}
 		roots[i] = tds.t.Hash()
 	}
 	return roots, nil
@@ -850,6 +907,14 @@ func (tds *TrieDbState) UnwindTo(blockNr uint64) error {
 }
 
 func (tds *TrieDbState) readAccountDataByHash(addrHash common.Hash) (*accounts.Account, error) {
+	if tds.fetcher != nil {
+		tds.tMu.Lock()
+		err := tds.fetchAccount(addrHash)
+		tds.tMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
 	if acc, ok := tds.GetAccount(addrHash); ok {
 		return acc, nil
 	}
@@ -981,8 +1046,13 @@ func (tds *TrieDbState) ReadAccountStorage(address common.Address, incarnation u
 	}
 
 	tds.tMu.Lock()
-	enc, ok := tds.t.Get(dbutils.GenerateCompositeTrieKey(addrHash, seckey))
 	defer tds.tMu.Unlock()
+	if tds.fetcher != nil {
+		if err := tds.fetchStorage(addrHash, seckey); err != nil {
+			return nil, err
+		}
+	}
+	enc, ok := tds.t.Get(dbutils.GenerateCompositeTrieKey(addrHash, seckey))
 	if !ok {
 		// Not present in the trie, try database
 		if tds.historical {
@@ -1008,6 +1078,11 @@ func (tds *TrieDbState) ReadAccountCode(address common.Address, codeHash common.
 		code, err = cached.([]byte), nil
 	} else {
 		code, err = tds.db.Get(dbutils.CodeBucket, codeHash[:])
+		if err != nil && tds.fetcher != nil {
+			if err = tds.fetcher.FetchCode(tds.fetchCtx, tds.db, tds.getBlockNr(), address, codeHash); err == nil {
+				code, err = tds.db.Get(dbutils.CodeBucket, codeHash[:])
+			}
+		}
 		if err == nil {
 			tds.codeSizeCache.Add(codeHash, len(code))
 			tds.codeCache.Add(codeHash, code)
@@ -1215,29 +1290,56 @@ func (tsw *TrieStateWriter) WriteAccountStorage(_ context.Context, address commo
 
 // ExtractWitness produces block witness for the block just been processed, in a serialised form
 func (tds *TrieDbState) ExtractWitness(trace bool, bin bool) ([]byte, *BlockWitnessStats, error) {
+	touches, storageTouches := tds.pg.ExtractTouches()
+	return tds.buildWitness(append(touches, storageTouches...), tds.pg.ExtractCodeMap(), trace, bin)
+}
+
+func (tds *TrieDbState) buildWitness(keys [][]byte, codeMap map[common.Hash][]byte, trace bool, bin bool) ([]byte, *BlockWitnessStats, error) {
 	bwb := trie.NewBlockWitnessBuilder(trace)
+	if err := tds.makeBlockWitness(bwb, newWitnessResolveSet(keys, bin), codeMap, bin); err != nil {
+		return nil, nil, err
+	}
+	return serialiseBlockWitness(bwb, tds.blockNr)
+}
+
+// BinaryBlockWitness converts the witness of the hexary trie into the witness of the binary trie,
+// given the keys the witness was built for. The witness contains the same leaves and codes as the one
+// built from the state trie, but the subtries not touched by the block are represented by their hexary
+// hashes, the same way as the parts of the state trie which are not loaded in memory.
+func BinaryBlockWitness(blockNr uint64, witness []byte, keys [][]byte) ([]byte, *BlockWitnessStats, error) {
+	if len(keys) == 0 {
+		// Nothing is touched, so the witness consists of the root hash only
+		stats, err := BlockWitnessStatsOf(blockNr, witness)
+		if err != nil {
+			return nil, nil, err
+		}
+		return witness, stats, nil
+	}
+	t, codeMap, err := trie.BlockWitnessToTrie(witness, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	bwb := trie.NewBlockWitnessBuilder(false)
+	if err := bwb.MakeBlockWitnessBin(trie.HexToBin(t), newWitnessResolveSet(keys, true), codeMap); err != nil {
+		return nil, nil, err
+	}
+	return serialiseBlockWitness(bwb, blockNr)
+}
 
+func newWitnessResolveSet(keys [][]byte, bin bool) *trie.ResolveSet {
 	var rs *trie.ResolveSet
 	if bin {
 		rs = trie.NewBinaryResolveSet(0)
 	} else {
 		rs = trie.NewResolveSet(0)
 	}
-
-	touches, storageTouches := tds.pg.ExtractTouches()
-	for _, touch := range touches {
-		rs.AddKey(touch)
-	}
-	for _, touch := range storageTouches {
-		rs.AddKey(touch)
-	}
-	codeMap := tds.pg.ExtractCodeMap()
-
-	err := tds.makeBlockWitness(bwb, rs, codeMap, bin)
-	if err != nil {
-		return nil, nil, err
+	for _, key := range keys {
+		rs.AddKey(key)
 	}
+	return rs
+}
 
+func serialiseBlockWitness(bwb *trie.BlockWitnessBuilder, blockNr uint64) ([]byte, *BlockWitnessStats, error) {
 	var b bytes.Buffer
 
 	stats, err := bwb.WriteTo(&b)
@@ -1246,7 +1348,7 @@ func (tds *TrieDbState) ExtractWitness(trace bool, bin bool) ([]byte, *BlockWitn
 		return nil, nil, err
 	}
 
-	return b.Bytes(), NewBlockWitnessStats(tds.blockNr, uint64(b.Len()), stats), nil
+	return b.Bytes(), NewBlockWitnessStats(blockNr, uint64(b.Len()), stats), nil
 }
 
 func (tds *TrieDbState) makeBlockWitness(bwb *trie.BlockWitnessBuilder, rs *trie.ResolveSet, codeMap map[common.Hash][]byte, bin bool) error {
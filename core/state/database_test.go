@@ -32,6 +32,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/state/contracts"
 	"github.com/ledgerwatch/turbo-geth/core/types"
@@ -39,6 +40,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/trie"
 )
 
 // Create revival problem
@@ -1154,3 +1156,292 @@ func TestWrongIncarnation2(t *testing.T) {
 	}
 
 }
+
+// processWitnessTestBlocks creates the accounts and the storage of a contract in the first block,
+// then reads and modifies some of them in the second block, leaving the second block unfinished.
+func processWitnessTestBlocks(t *testing.T, tds *state.TrieDbState, addresses []common.Address) {
+	ctx := context.Background()
+	tsw := tds.TrieStateWriter()
+	intraBlockState := state.New(tds)
+	tds.StartNewBuffer()
+	for i, address := range addresses {
+		intraBlockState.AddBalance(address, big.NewInt(int64(i+1)))
+	}
+	intraBlockState.SetCode(addresses[0], []byte{byte(vm.PUSH1), 0x01, byte(vm.STOP)})
+	for i := 0; i < 16; i++ {
+		intraBlockState.SetState(addresses[0], common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i+1))))
+	}
+	if err := intraBlockState.FinalizeTx(ctx, tsw); err != nil {
+		t.Fatalf("error finalising 1st block: %v", err)
+	}
+	if _, err := tds.ComputeTrieRoots(); err != nil {
+		t.Fatalf("ComputeTrieRoots failed: %v", err)
+	}
+	// Only the witness of the second block is of interest
+	if _, _, err := tds.ExtractWitness(false, false /* is binary */); err != nil {
+		t.Fatalf("could not extract witness: %v", err)
+	}
+
+	tds.SetBlockNr(1)
+	tds.StartNewBuffer()
+	intraBlockState = state.New(tds)
+	intraBlockState.GetBalance(addresses[1])
+	intraBlockState.AddBalance(addresses[2], big.NewInt(1000))
+	intraBlockState.GetCode(addresses[0])
+	intraBlockState.GetState(addresses[0], common.BigToHash(big.NewInt(3)))
+	intraBlockState.SetState(addresses[0], common.BigToHash(big.NewInt(5)), common.BigToHash(big.NewInt(100)))
+	if err := intraBlockState.FinalizeTx(ctx, tsw); err != nil {
+		t.Fatalf("error finalising 2nd block: %v", err)
+	}
+}
+
+func TestBinaryBlockWitness(t *testing.T) {
+	addresses := make([]common.Address, 64)
+	for i := range addresses {
+		addresses[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+
+	// The witness of the hexary trie is extracted the same way as for the inserted blocks
+	hexTds, err := state.NewTrieDbState(common.Hash{}, ethdb.NewMemDatabase(), 0)
+	if err != nil {
+		t.Fatalf("could not create TrieDbState: %v", err)
+	}
+	hexTds.SetResolveReads(true)
+	hexTds.SetExtractWitness(true)
+	processWitnessTestBlocks(t, hexTds, addresses)
+	if _, err = hexTds.ComputeTrieRoots(); err != nil {
+		t.Fatalf("ComputeTrieRoots failed: %v", err)
+	}
+	if len(hexTds.LastWitness()) == 0 || len(hexTds.LastWitnessKeys()) == 0 {
+		t.Fatalf("witness not extracted")
+	}
+
+	// The witness of the binary trie is built directly from the state trie
+	binTds, err := state.NewTrieDbState(common.Hash{}, ethdb.NewMemDatabase(), 0)
+	if err != nil {
+		t.Fatalf("could not create TrieDbState: %v", err)
+	}
+	binTds.SetResolveReads(true)
+	processWitnessTestBlocks(t, binTds, addresses)
+	if err = binTds.ResolveStateTrie(); err != nil {
+		t.Fatalf("ResolveStateTrie failed: %v", err)
+	}
+	_, expected, err := binTds.ExtractWitness(false, true /* is binary */)
+	if err != nil {
+		t.Fatalf("could not extract binary witness: %v", err)
+	}
+
+	witness, stats, err := state.BinaryBlockWitness(1, hexTds.LastWitness(), hexTds.LastWitnessKeys())
+	if err != nil {
+		t.Fatalf("could not convert witness: %v", err)
+	}
+	// The untouched subtries are represented by their hexary hashes, hiding the binary extensions
+	// within them, but the witnesses consist of the same leaves, codes and number of hashes
+	if stats.LeafKeysSize() != expected.LeafKeysSize() {
+		t.Errorf("leaf keys size mismatch: have %d, want %d", stats.LeafKeysSize(), expected.LeafKeysSize())
+	}
+	if stats.LeafValuesSize() != expected.LeafValuesSize() {
+		t.Errorf("leaf values size mismatch: have %d, want %d", stats.LeafValuesSize(), expected.LeafValuesSize())
+	}
+	if stats.CodesSize() != expected.CodesSize() {
+		t.Errorf("codes size mismatch: have %d, want %d", stats.CodesSize(), expected.CodesSize())
+	}
+	if stats.HashesSize() != expected.HashesSize() {
+		t.Errorf("hashes size mismatch: have %d, want %d", stats.HashesSize(), expected.HashesSize())
+	}
+
+	tr, _, err := trie.BlockWitnessToTrieBin(witness, false, true /* is binary */)
+	if err != nil {
+		t.Fatalf("could not decode binary witness: %v", err)
+	}
+	acc, ok := tr.GetAccount(crypto.Keccak256(addresses[1][:]))
+	if !ok || acc == nil || acc.Balance.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("account %x not found in the binary witness, or wrong: %v", addresses[1], acc)
+	}
+}
+
+// checkBinaryRoot compares the stored binary state root of the current block with the one built from scratch
+func checkBinaryRoot(t *testing.T, db ethdb.Database, blockchain *core.BlockChain) {
+	t.Helper()
+	block := blockchain.CurrentBlock()
+	stored, ok := rawdb.ReadBinaryStateRoot(db, block.Hash(), block.NumberU64())
+	if !ok {
+		t.Fatalf("binary state root of block %d not stored", block.NumberU64())
+	}
+	tds, err := state.NewTrieDbState(block.Root(), db, block.NumberU64())
+	if err != nil {
+		t.Fatalf("could not create TrieDbState: %v", err)
+	}
+	if err = tds.EnableBinaryTrie(); err != nil {
+		t.Fatalf("could not build binary trie: %v", err)
+	}
+	expected, _, err := tds.BinaryRoot()
+	if err != nil {
+		t.Fatalf("could not compute binary state root: %v", err)
+	}
+	if stored != expected {
+		t.Errorf("binary state root mismatch at block %d: have %x, want %x", block.NumberU64(), stored, expected)
+	}
+}
+
+func TestBinaryTrieOverSelfDestruct(t *testing.T) {
+	// Configure and generate a sample block chain
+	var (
+		db      = ethdb.NewMemDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(1000000000)
+		gspec   = &core.Genesis{
+			Config: &params.ChainConfig{
+				ChainID:             big.NewInt(1),
+				HomesteadBlock:      new(big.Int),
+				EIP150Block:         new(big.Int),
+				EIP155Block:         new(big.Int),
+				EIP158Block:         big.NewInt(1),
+				ByzantiumBlock:      big.NewInt(1),
+				ConstantinopleBlock: big.NewInt(1),
+			},
+			Alloc: core.GenesisAlloc{
+				address: {Balance: funds},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+	)
+
+	engine := ethash.NewFaker()
+	blockchain, err := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.EnableBinaryTrie(true)
+
+	contractBackend := backends.NewSimulatedBackendWithConfig(gspec.Alloc, gspec.Config, gspec.GasLimit)
+	transactOpts := bind.NewKeyedTransactor(key)
+	transactOpts.GasLimit = 1000000
+
+	var selfDestruct *contracts.Selfdestruct
+
+	ctx := blockchain.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+	blocks, _ := core.GenerateChain(ctx, gspec.Config, genesis, engine, db.MemCopy(), 2, func(i int, block *core.BlockGen) {
+		var tx *types.Transaction
+
+		switch i {
+		case 0:
+			_, tx, selfDestruct, err = contracts.DeploySelfdestruct(transactOpts, contractBackend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block.AddTx(tx)
+		case 1:
+			tx, err = selfDestruct.Destruct(transactOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block.AddTx(tx)
+		}
+		contractBackend.Commit()
+	})
+
+	// The longer chain reverts the self-destruction of the contract. The storage of the contract is not
+	// modified by the reverted block, so it has to be brought back by the binary trie on its own
+	contractBackendLonger := backends.NewSimulatedBackendWithConfig(gspec.Alloc, gspec.Config, gspec.GasLimit)
+	transactOptsLonger := bind.NewKeyedTransactor(key)
+	transactOptsLonger.GasLimit = 1000000
+
+	longerBlocks, _ := core.GenerateChain(ctx, gspec.Config, genesis, engine, db.MemCopy(), 3, func(i int, block *core.BlockGen) {
+		var tx *types.Transaction
+
+		switch i {
+		case 0:
+			_, tx, _, err = contracts.DeploySelfdestruct(transactOptsLonger, contractBackendLonger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block.AddTx(tx)
+		}
+		contractBackendLonger.Commit()
+	})
+
+	for _, block := range blocks {
+		if _, err = blockchain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatal(err)
+		}
+		checkBinaryRoot(t, db, blockchain)
+	}
+
+	// REORG of block 2, and insert new (empty) BLOCK 2 and 3
+	if _, err = blockchain.InsertChain(types.Blocks{longerBlocks[1], longerBlocks[2]}); err != nil {
+		t.Fatal(err)
+	}
+	checkBinaryRoot(t, db, blockchain)
+}
+
+func TestBinaryTrieSizeLimit(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			common.Address{1}: {Balance: big.NewInt(1)},
+			common.Address{2}: {Balance: big.NewInt(2)},
+			common.Address{3}: {Balance: big.NewInt(3)},
+		},
+	}
+	genesis := gspec.MustCommit(db)
+
+	defer func(limit uint64) { state.MaxBinaryTrieItems = limit }(state.MaxBinaryTrieItems)
+	for _, tt := range []struct {
+		limit   uint64
+		enabled bool
+	}{
+		{3, true},
+		{2, false},
+	} {
+		state.MaxBinaryTrieItems = tt.limit
+		tds, err := state.NewTrieDbState(genesis.Root(), db, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = tds.EnableBinaryTrie(); (err == nil) != tt.enabled {
+			t.Errorf("limit %d: unexpected error %v", tt.limit, err)
+		}
+		if _, ok, _ := tds.BinaryRoot(); ok != tt.enabled {
+			t.Errorf("limit %d: binary trie enabled %t, want %t", tt.limit, ok, tt.enabled)
+		}
+	}
+}
+
+func TestBinaryTrieDisabledOverSizeLimit(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			common.Address{1}: {Balance: big.NewInt(1)},
+			common.Address{2}: {Balance: big.NewInt(2)},
+			common.Address{3}: {Balance: big.NewInt(3)},
+		},
+	}
+	genesis := gspec.MustCommit(db)
+
+	defer func(limit uint64) { state.MaxBinaryTrieItems = limit }(state.MaxBinaryTrieItems)
+	state.MaxBinaryTrieItems = 2
+
+	engine := ethash.NewFaker()
+	blockchain, err := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockchain.Stop()
+	blockchain.EnableBinaryTrie(true)
+
+	ctx := blockchain.WithContext(context.Background(), big.NewInt(genesis.Number().Int64()+1))
+	blocks, _ := core.GenerateChain(ctx, gspec.Config, genesis, engine, db.MemCopy(), 2, nil)
+	// The blocks are imported without the binary trie, which is too large
+	if _, err = blockchain.InsertChain(blocks); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if _, ok := rawdb.ReadBinaryStateRoot(db, block.Hash(), block.NumberU64()); ok {
+			t.Errorf("binary state root of block %d is stored", block.NumberU64())
+		}
+	}
+}
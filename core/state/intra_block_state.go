@@ -97,6 +97,10 @@ type IntraBlockState struct {
 	nextRevisionID int
 	tracer         StateTracer
 	trace          bool
+
+	recordAccesses bool                  // Whether the accesses of the transactions are recorded, see AccessLists
+	txReads        *AccessSet            // Accounts and storage items read by the current transaction, if recorded
+	accessLists    []*types.TxAccessList // Accesses of the transactions finalized so far, if recorded
 }
 
 // Create a new state from a given trie
@@ -124,6 +128,30 @@ func (sdb *IntraBlockState) SetTrace(trace bool) {
 	sdb.trace = trace
 }
 
+// EnableAccessRecording makes the state record the accounts and storage items read and
+// written by each transaction, from its Prepare up to its FinalizeTx, see AccessLists.
+func (sdb *IntraBlockState) EnableAccessRecording() {
+	sdb.Lock()
+	defer sdb.Unlock()
+	sdb.recordAccesses = true
+}
+
+// AccessRecordingEnabled tells whether the accesses of the transactions are recorded.
+func (sdb *IntraBlockState) AccessRecordingEnabled() bool {
+	sdb.Lock()
+	defer sdb.Unlock()
+	return sdb.recordAccesses
+}
+
+// AccessLists returns the access lists of the transactions finalized so far, in order.
+// The changes made before the first transaction of the block (by the DAO hard-fork) are
+// attributed to it, and the ones made after the last one (block rewards) are not recorded.
+func (sdb *IntraBlockState) AccessLists() []*types.TxAccessList {
+	sdb.Lock()
+	defer sdb.Unlock()
+	return sdb.accessLists
+}
+
 // setError remembers the first non-nil error it is called with.
 func (sdb *IntraBlockState) setError(err error) {
 	sdb.Lock()
@@ -241,6 +269,7 @@ func (sdb *IntraBlockState) Exist(addr common.Address) bool {
 			fmt.Println("CaptureAccountRead err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	//fmt.Printf("Checking existence of %s\n", hex.EncodeToString(addr[:]))
 	return sdb.getStateObject(addr) != nil
 }
@@ -257,6 +286,7 @@ func (sdb *IntraBlockState) Empty(addr common.Address) bool {
 			fmt.Println("CaptureAccountRead err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	so := sdb.getStateObject(addr)
 	return so == nil || so.empty()
 }
@@ -273,6 +303,7 @@ func (sdb *IntraBlockState) GetBalance(addr common.Address) *big.Int {
 			fmt.Println("CaptureAccountRead err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Balance()
@@ -291,6 +322,7 @@ func (sdb *IntraBlockState) GetNonce(addr common.Address) uint64 {
 			fmt.Println("CaptureAccountRead err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.Nonce()
@@ -310,6 +342,7 @@ func (sdb *IntraBlockState) GetCode(addr common.Address) []byte {
 			fmt.Println("CaptureAccountRead err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil {
 		if sdb.trace {
@@ -334,6 +367,7 @@ func (sdb *IntraBlockState) GetCodeSize(addr common.Address) int {
 			fmt.Println("CaptureAccountRead err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject == nil {
 		return 0
@@ -359,6 +393,7 @@ func (sdb *IntraBlockState) GetCodeHash(addr common.Address) common.Hash {
 			fmt.Println("CaptureAccountRead err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject == nil {
 		return common.Hash{}
@@ -372,6 +407,9 @@ func (sdb *IntraBlockState) GetState(addr common.Address, hash common.Hash) comm
 	sdb.Lock()
 	defer sdb.Unlock()
 
+	if sdb.txReads != nil {
+		sdb.txReads.AddStorage(addr, hash)
+	}
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.GetState(hash)
@@ -409,6 +447,9 @@ func (sdb *IntraBlockState) GetCommittedState(addr common.Address, hash common.H
 	sdb.Lock()
 	defer sdb.Unlock()
 
+	if sdb.txReads != nil {
+		sdb.txReads.AddStorage(addr, hash)
+	}
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.GetCommittedState(hash)
@@ -438,6 +479,7 @@ func (sdb *IntraBlockState) StorageSize(addr common.Address) (bool, uint64) {
 		}
 
 	}
+	sdb.recordAccountRead(addr)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.StorageSize()
@@ -589,6 +631,7 @@ func (sdb *IntraBlockState) Suicide(addr common.Address) bool {
 			fmt.Println("CaptureAccountWrite err", err)
 		}
 	}
+	sdb.recordAccountRead(addr)
 	stateObject := sdb.getStateObject(addr)
 	if stateObject == nil {
 		return false
@@ -655,6 +698,16 @@ func (sdb *IntraBlockState) changeStorageSize(addr common.Address, sizeDiff int6
 	stateObject.SetStorageSize(size)
 }
 
+// do not lock!!!
+// recordAccountRead records the account as read by the current transaction, if the accesses are recorded.
+// Only the methods returning the data of the account call it, not getStateObject, so that adding to
+// the balance of an account is not a read.
+func (sdb *IntraBlockState) recordAccountRead(addr common.Address) {
+	if sdb.txReads != nil {
+		sdb.txReads.AddAccount(addr)
+	}
+}
+
 // do not lock!!!
 // Retrieve a state object given my the address. Returns nil if not found.
 func (sdb *IntraBlockState) getStateObject(addr common.Address) (stateObject *stateObject) {
@@ -771,6 +824,7 @@ func (sdb *IntraBlockState) CreateAccount(addr common.Address, contractCreation
 
 	var previous *stateObject
 	if contractCreation {
+		sdb.recordAccountRead(addr)
 		previous = sdb.getStateObject(addr)
 	}
 
@@ -836,6 +890,15 @@ func (sdb *IntraBlockState) FinalizeTx(ctx context.Context, stateWriter StateWri
 	sdb.Lock()
 	defer sdb.Unlock()
 
+	if sdb.txReads != nil {
+		sdb.accessLists = append(sdb.accessLists, &types.TxAccessList{
+			TxHash: sdb.thash,
+			Reads:  sdb.txReads.List(),
+			Writes: sdb.txWrites().List(),
+		})
+		sdb.txReads = nil
+	}
+
 	for addr := range sdb.journal.dirties {
 		stateObject, exist := sdb.stateObjects[addr]
 		if !exist {
@@ -944,6 +1007,125 @@ func (sdb *IntraBlockState) Prepare(thash, bhash common.Hash, ti int) {
 	sdb.thash = thash
 	sdb.bhash = bhash
 	sdb.txIndex = ti
+	if sdb.recordAccesses {
+		sdb.txReads = NewAccessSet()
+	}
+}
+
+// journalAccount returns the account changed by the journal entry, if any
+func journalAccount(entry journalEntry) *common.Address {
+	if ch, ok := entry.(resetObjectChange); ok {
+		return &ch.prev.address
+	}
+	return entry.dirtied()
+}
+
+// TxWrites returns the accounts and storage items modified by the current transaction,
+// i.e. since the last FinalizeTx. The changes of the storage items are not recorded as
+// the changes of their accounts, while touching an account is.
+func (sdb *IntraBlockState) TxWrites() *AccessSet {
+	sdb.Lock()
+	defer sdb.Unlock()
+	return sdb.txWrites()
+}
+
+// do not lock
+func (sdb *IntraBlockState) txWrites() *AccessSet {
+	sdb.journal.RLock()
+	defer sdb.journal.RUnlock()
+
+	writes := NewAccessSet()
+	storageChanges := make(map[common.Address]int)
+	for _, entry := range sdb.journal.entries {
+		if ch, ok := entry.(storageChange); ok {
+			writes.AddStorage(*ch.account, ch.key)
+			storageChanges[*ch.account]++
+		} else if addr := journalAccount(entry); addr != nil {
+			writes.AddAccount(*addr)
+		}
+	}
+	// Accounts can also be dirtied without any journal entries, see touch
+	for addr, n := range sdb.journal.dirties {
+		if n > storageChanges[addr] {
+			writes.AddAccount(addr)
+		}
+	}
+	return writes
+}
+
+// MergeTx merges the changes made by the current transaction of the other state into this one,
+// as if the transaction was executed on this state. It is only correct if the other state
+// started from the same state as this one, and no accounts or storage items read by the
+// transaction have been modified here since. The changes made to the accounts in except are
+// not merged. The state objects of the other state are moved over, so it must not be used
+// afterwards.
+func (sdb *IntraBlockState) MergeTx(other *IntraBlockState, except ...common.Address) {
+	sdb.Lock()
+	defer sdb.Unlock()
+	other.Lock()
+	defer other.Unlock()
+
+	skip := make(map[common.Address]struct{}, len(except))
+	for _, addr := range except {
+		skip[addr] = struct{}{}
+	}
+	// Carry the journal over for FinalizeTx, noting the accounts created or reset by the transaction
+	replaced := make(map[common.Address]struct{})
+	appended := make(map[common.Address]int)
+	for _, entry := range other.journal.entries {
+		if addr := journalAccount(entry); addr != nil {
+			if _, ok := skip[*addr]; ok {
+				continue
+			}
+			switch entry.(type) {
+			case createObjectChange, resetObjectChange:
+				replaced[*addr] = struct{}{}
+			}
+		}
+		sdb.journal.append(entry)
+		if addr := entry.dirtied(); addr != nil {
+			appended[*addr]++
+		}
+	}
+	// Accounts can also be dirtied without any journal entries, see touch
+	for addr, n := range other.journal.dirties {
+		if _, ok := skip[addr]; ok {
+			continue
+		}
+		for ; n > appended[addr]; n-- {
+			sdb.journal.dirty(addr)
+		}
+	}
+	for addr, so := range other.stateObjects {
+		if _, ok := skip[addr]; ok {
+			continue
+		}
+		obj, ok := sdb.stateObjects[addr]
+		if _, isReplaced := replaced[addr]; isReplaced || !ok {
+			so.db = sdb
+			sdb.setStateObject(so)
+			continue
+		}
+		obj.mergeTx(so)
+	}
+	for hash, logs := range other.logs {
+		for _, l := range logs {
+			l.Index = sdb.logSize
+			sdb.logs[hash] = append(sdb.logs[hash], l)
+			sdb.logSize++
+		}
+	}
+	for hash, preimage := range other.preimages {
+		if _, ok := sdb.preimages[hash]; !ok {
+			sdb.preimages[hash] = preimage
+		}
+	}
+	if sdb.txReads != nil && other.txReads != nil {
+		sdb.txReads.Merge(other.txReads)
+	}
+	if sdb.dbErr == nil {
+		sdb.dbErr = other.dbErr
+	}
 }
 
 // no not lock
@@ -517,3 +517,72 @@ func TestIntraBlockStateNewContractAccount(t *testing.T) {
 	}
 
 }
+
+func TestAccessLists(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	ctx := context.TODO()
+	tds, _ := NewTrieDbState(common.Hash{}, db, 0)
+	state := New(tds)
+	tds.StartNewBuffer()
+
+	var (
+		a, b, c, d, e = common.Address{1}, common.Address{2}, common.Address{3}, common.Address{4}, common.Address{5}
+		k1, k2        = common.Hash{1}, common.Hash{2}
+		v             = common.Hash{0xff}
+	)
+	// The changes made before enabling the recording are not recorded
+	state.AddBalance(d, big.NewInt(10))
+	if err := state.FinalizeTx(ctx, tds.TrieStateWriter()); err != nil {
+		t.Fatal(err)
+	}
+	state.EnableAccessRecording()
+
+	state.Prepare(common.Hash{0x01}, common.Hash{}, 0)
+	state.GetBalance(a)
+	state.GetState(b, k1) // b does not exist, but its storage is still read
+	state.SetState(c, k2, v)
+	if err := state.FinalizeTx(ctx, tds.TrieStateWriter()); err != nil {
+		t.Fatal(err)
+	}
+	state.Prepare(common.Hash{0x02}, common.Hash{}, 1)
+	snapshot := state.Snapshot()
+	state.SetState(d, k1, v)
+	state.RevertToSnapshot(snapshot)
+	state.SetState(d, k2, v)
+	state.GetCommittedState(d, k1)
+	state.AddBalance(a, big.NewInt(1)) // Adding to the balance is not a read
+	if err := state.FinalizeTx(ctx, tds.TrieStateWriter()); err != nil {
+		t.Fatal(err)
+	}
+	// The changes made after the last transaction are not recorded
+	state.AddBalance(e, big.NewInt(1))
+	if err := state.FinalizeTx(ctx, tds.TrieStateWriter()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*types.TxAccessList{
+		{
+			TxHash: common.Hash{0x01},
+			Reads: []types.AccessedAccount{
+				{Address: a, Account: true},
+				{Address: b, StorageKeys: []common.Hash{k1}},
+			},
+			Writes: []types.AccessedAccount{
+				{Address: c, Account: true, StorageKeys: []common.Hash{k2}},
+			},
+		},
+		{
+			TxHash: common.Hash{0x02},
+			Reads: []types.AccessedAccount{
+				{Address: d, StorageKeys: []common.Hash{k1}},
+			},
+			Writes: []types.AccessedAccount{
+				{Address: a, Account: true},
+				{Address: d, StorageKeys: []common.Hash{k2}},
+			},
+		},
+	}
+	if have := state.AccessLists(); !reflect.DeepEqual(have, want) {
+		t.Errorf("access lists mismatch:\nhave %+v\nwant %+v", have, want)
+	}
+}
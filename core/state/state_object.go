@@ -301,6 +301,32 @@ func (so *stateObject) deepCopy(db *IntraBlockState) *stateObject {
 	return stateObject
 }
 
+// mergeTx merges the changes made to the account by a transaction executed on top of the same
+// state within another IntraBlockState, along with the storage items loaded there.
+func (so *stateObject) mergeTx(other *stateObject) {
+	so.data.Copy(&other.data)
+	if other.code != nil {
+		so.code = other.code
+	}
+	if other.dirtyCode {
+		so.dirtyCode = true
+	}
+	so.suicided = other.suicided
+	for key, value := range other.originStorage {
+		if _, ok := so.originStorage[key]; !ok {
+			so.originStorage[key] = value
+		}
+	}
+	for key, value := range other.blockOriginStorage {
+		if _, ok := so.blockOriginStorage[key]; !ok {
+			so.blockOriginStorage[key] = value
+		}
+	}
+	for key, value := range other.dirtyStorage {
+		so.dirtyStorage[key] = value
+	}
+}
+
 //
 // Attribute accessors
 //
@@ -20,7 +20,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 
@@ -53,12 +53,6 @@ func NewStateless(stateRoot common.Hash, witness []byte, blockNr uint64, trace b
 	}
 	if !isBinary {
 		if t.Hash() != stateRoot {
-			filename := fmt.Sprintf("root_%d.txt", blockNr)
-			f, err := os.Create(filename)
-			if err == nil {
-				defer f.Close()
-				t.Print(f)
-			}
 			return nil, fmt.Errorf("state root mistmatch when creating Stateless2, got %x, expected %x", t.Hash(), stateRoot)
 		}
 	}
@@ -218,8 +212,23 @@ func (s *Stateless) CreateContract(address common.Address) error {
 	return nil
 }
 
-// CheckRoot finalises the execution of a block and computes the resulting state root
+// CheckRoot finalises the execution of a block and checks the resulting state root
 func (s *Stateless) CheckRoot(expected common.Hash) error {
+	if myRoot := s.Finalize(); myRoot != expected {
+		return fmt.Errorf("final root: %x, expected: %x", myRoot, expected)
+	}
+	return nil
+}
+
+// PrintTrie writes the state trie built from the witnesses, for debugging
+func (s *Stateless) PrintTrie(w io.Writer) {
+	s.t.Print(w)
+}
+
+// Finalize applies the updates registered since the previous call to the state trie
+// and returns the resulting state root. Before Byzantium, it is called after every
+// transaction to compute the intermediate state roots for the receipts.
+func (s *Stateless) Finalize() common.Hash {
 	// The following map is to prevent repeated clearouts of the storage
 	alreadyCreated := make(map[common.Hash]struct{})
 	// New contracts are being created at these addresses. Therefore, we need to clear the storage items
@@ -285,19 +294,9 @@ func (s *Stateless) CheckRoot(expected common.Hash) error {
 		}
 		s.t.DeleteSubtree(addrHash[:], s.blockNr)
 	}
-	myRoot := s.t.Hash()
-	if myRoot != expected {
-		filename := fmt.Sprintf("root_%d.txt", s.blockNr)
-		f, err := os.Create(filename)
-		if err == nil {
-			defer f.Close()
-			s.t.Print(f)
-		}
-		return fmt.Errorf("final root: %x, expected: %x", myRoot, expected)
-	}
 	s.storageUpdates = make(map[common.Hash]map[common.Hash][]byte)
 	s.accountUpdates = make(map[common.Hash]*accounts.Account)
 	s.deleted = make(map[common.Hash]struct{})
 	s.created = make(map[common.Hash]struct{})
-	return nil
+	return s.t.Hash()
 }
@@ -44,6 +44,8 @@ type StateProcessor struct {
 	bc          *BlockChain         // Canonical block chain
 	engine      consensus.Engine    // Consensus engine used for block rewards
 	txTraceHash []byte              // Hash of the transaction to trace (or nil if there nothing to trace)
+
+	parallelWorkers int // Number of goroutines executing the transactions speculatively, parallel execution is off if below 2
 }
 
 // NewStateProcessor initialises a new StateProcessor.
@@ -60,6 +62,13 @@ func (p *StateProcessor) SetTxTraceHash(txTraceHash common.Hash) {
 	p.txTraceHash = txTraceHash[:]
 }
 
+// SetParallelWorkers turns the parallel execution of the transactions on, with the given number
+// of goroutines, or off, if it is below 2. The blocks executed with tracing enabled, requiring
+// the reads to be resolved, or applying the DAO hard-fork are still executed sequentially.
+func (p *StateProcessor) SetParallelWorkers(workers int) {
+	p.parallelWorkers = workers
+}
+
 // StructLogRes stores a structured log emitted by the EVM while replaying a
 // transaction in debug mode
 type StructLogRes struct {
@@ -127,8 +136,11 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.IntraBlockSt
 		gp       = new(GasPool).AddGas(block.GasLimit())
 	)
 	// Mutate the block and state according to any hard-fork specs
-	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+	daoFork := p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0
+	if daoFork {
 		misc.ApplyDAOHardFork(statedb)
+	} else if p.parallelWorkers > 1 && len(block.Transactions()) > 1 && !cfg.Debug && p.txTraceHash == nil && !tds.ResolveReads() {
+		return p.processParallel(block, statedb, tds, cfg)
 	}
 	// Iterate over and process the individual transactions
 	tds.StartNewBuffer()
@@ -175,15 +187,20 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.IntraBlockSt
 			tds.StartNewBuffer()
 		}
 	}
-	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	return p.finalize(block, header, statedb, tds, receipts, allLogs, *usedGas)
+}
+
+// finalize finalizes the block after its transactions have been processed, applying any
+// consensus engine specific extras (e.g. block rewards), and computes the state roots.
+func (p *StateProcessor) finalize(block *types.Block, header *types.Header, statedb *state.IntraBlockState, tds *state.TrieDbState, receipts types.Receipts, allLogs []*types.Log, usedGas uint64) (types.Receipts, []*types.Log, uint64, error) {
 	p.engine.Finalize(p.config, header, statedb, block.Transactions(), block.Uncles())
 	ctx := p.config.WithEIPsFlags(context.Background(), header.Number)
 	if err := statedb.FinalizeTx(ctx, tds.TrieStateWriter()); err != nil {
-		return receipts, allLogs, *usedGas, err
+		return receipts, allLogs, usedGas, err
 	}
 	roots, err := tds.ComputeTrieRoots()
 	if err != nil {
-		return receipts, allLogs, *usedGas, err
+		return receipts, allLogs, usedGas, err
 	}
 	if !p.config.IsByzantium(header.Number) {
 		for i, receipt := range receipts {
@@ -191,7 +208,46 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.IntraBlockSt
 		}
 	}
 	header.Root = roots[len(roots)-1]
-	return receipts, allLogs, *usedGas, err
+	return receipts, allLogs, usedGas, err
+}
+
+// ProcessStateless processes the block like Process, but on top of the state built from
+// the block witness, without any access to the database. The resulting state root is
+// checked by the validator.
+func (p *StateProcessor) ProcessStateless(block *types.Block, s *state.Stateless, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	var (
+		receipts types.Receipts
+		usedGas  = new(uint64)
+		header   = block.Header()
+		allLogs  []*types.Log
+		gp       = new(GasPool).AddGas(block.GasLimit())
+		statedb  = state.New(s)
+	)
+	s.SetBlockNr(block.NumberU64())
+	// Mutate the block and state according to any hard-fork specs
+	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	// Iterate over and process the individual transactions
+	for i, tx := range block.Transactions() {
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		receipt, err := ApplyTransaction(p.config, p.bc, nil, gp, statedb, s, header, tx, usedGas, cfg)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if !p.config.IsByzantium(header.Number) {
+			receipt.PostState = s.Finalize().Bytes()
+		}
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	p.engine.Finalize(p.config, header, statedb, block.Transactions(), block.Uncles())
+	ctx := p.config.WithEIPsFlags(context.Background(), header.Number)
+	if err := statedb.FinalizeTx(ctx, s); err != nil {
+		return receipts, allLogs, *usedGas, err
+	}
+	return receipts, allLogs, *usedGas, nil
 }
 
 // ApplyTransaction attempts to apply a transaction to the given state database
@@ -221,17 +277,22 @@ func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *commo
 
 	*usedGas += gas
 
+	return newReceipt(tx, msg, statedb, gas, failed, *usedGas), err
+}
+
+// newReceipt creates the receipt of the transaction executed on the given state.
+func newReceipt(tx *types.Transaction, msg Message, statedb *state.IntraBlockState, gas uint64, failed bool, cumulativeGasUsed uint64) *types.Receipt {
 	// Create a new receipt for the transaction, storing the intermediate root and gas used by the tx
 	// based on the eip phase, we're passing wether the root touch-delete accounts.
-	receipt := types.NewReceipt(failed, *usedGas)
+	receipt := types.NewReceipt(failed, cumulativeGasUsed)
 	receipt.TxHash = tx.Hash()
 	receipt.GasUsed = gas
 	// if the transaction created a contract, store the creation address in the receipt.
 	if msg.To() == nil {
-		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
+		receipt.ContractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
 	}
 	// Set the receipt logs and create a bloom for filtering
 	receipt.Logs = statedb.GetLogs(tx.Hash())
 	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
-	return receipt, err
+	return receipt
 }
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"math/big"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// coinbaseTracer records whether a transaction reads the coinbase account, other than by paying
+// the fees to it. Adding to the balance of an account is not a read, see IntraBlockState.AddBalance.
+type coinbaseTracer struct {
+	coinbase common.Address
+	read     bool
+}
+
+func (t *coinbaseTracer) CaptureAccountRead(account common.Address) error {
+	if account == t.coinbase {
+		t.read = true
+	}
+	return nil
+}
+
+func (t *coinbaseTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
+
+// speculativeTx is the result of executing a transaction on top of the state before the block,
+// instead of the state left by the previous transactions of the block.
+type speculativeTx struct {
+	msg      Message
+	statedb  *state.IntraBlockState
+	reads    *state.AccessSet
+	coinbase common.Address
+	feeOnly  bool // Whether the coinbase is only paid by the transaction, without being read
+	gas      uint64
+	failed   bool
+	err      error
+}
+
+// executeSpeculatively executes the transaction on its own IntraBlockState, on top of the given
+// reader of the state before the block, recording the accounts and storage items read.
+func (p *StateProcessor) executeSpeculatively(reader state.StateReader, header *types.Header, blockHash common.Hash, txIndex int, tx *types.Transaction, cfg vm.Config, recordAccesses bool) *speculativeTx {
+	msg, err := tx.AsMessage(types.MakeSigner(p.config, header.Number))
+	if err != nil {
+		return &speculativeTx{err: err}
+	}
+	recorder := state.NewAccessRecorder(reader)
+	statedb := state.New(recorder)
+	if recordAccesses {
+		statedb.EnableAccessRecording()
+	}
+	statedb.Prepare(tx.Hash(), blockHash, txIndex)
+	context := NewEVMContext(msg, header, p.bc, nil)
+	tracer := &coinbaseTracer{coinbase: context.Coinbase}
+	statedb.SetTracer(tracer)
+	vmenv := vm.NewEVM(context, statedb, p.config, cfg)
+	_, gas, failed, err := ApplyMessage(vmenv, msg, new(GasPool).AddGas(tx.Gas()))
+	if err == nil {
+		err = statedb.Error()
+	}
+	statedb.SetTracer(nil)
+	return &speculativeTx{
+		msg:      msg,
+		statedb:  statedb,
+		reads:    recorder.Reads(),
+		coinbase: context.Coinbase,
+		feeOnly:  !tracer.read && !recorder.Reads().HasStorage(context.Coinbase),
+		gas:      gas,
+		failed:   failed,
+		err:      err,
+	}
+}
+
+// processParallel is the variant of Process executing the transactions concurrently. Each
+// transaction is first executed speculatively, on top of the state before the block. The results
+// are then merged into the state in order, unless the transaction has read any accounts or
+// storage items modified by the previous transactions, in which case it is executed again on
+// top of the current state. The fees paid to the coinbase are added up, so that paying them
+// does not make the transactions conflict.
+func (p *StateProcessor) processParallel(block *types.Block, statedb *state.IntraBlockState, tds *state.TrieDbState, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	var (
+		receipts types.Receipts
+		usedGas  = new(uint64)
+		header   = block.Header()
+		allLogs  []*types.Log
+		gp       = new(GasPool).AddGas(block.GasLimit())
+		txs      = block.Transactions()
+		specs    = make([]*speculativeTx, len(txs))
+		ctx      = p.config.WithEIPsFlags(context.Background(), header.Number)
+	)
+	tds.StartNewBuffer()
+	reader := state.NewSyncReader(tds)
+	recordAccesses := statedb.AccessRecordingEnabled()
+
+	var wg sync.WaitGroup
+	indices := make(chan int, len(txs))
+	for i := range txs {
+		indices <- i
+	}
+	close(indices)
+	workers := p.parallelWorkers
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				specs[i] = p.executeSpeculatively(reader, header, block.Hash(), i, txs[i], cfg, recordAccesses)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var coinbaseBalance *big.Int // Balance of the coinbase before the block, if needed
+	written := state.NewAccessSet()
+	reexecuted := 0
+	for i, tx := range txs {
+		spec := specs[i]
+		specs[i] = nil
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		var (
+			msg    Message
+			gas    uint64
+			failed bool
+		)
+		merged := false
+		if spec.err == nil {
+			if spec.feeOnly {
+				spec.reads.RemoveAccount(spec.coinbase)
+			}
+			if !spec.reads.Intersects(written) && gp.SubGas(tx.Gas()) == nil {
+				gp.AddGas(tx.Gas() - spec.gas)
+				if spec.feeOnly {
+					if coinbaseBalance == nil {
+						account, err := reader.ReadAccountData(spec.coinbase)
+						if err != nil {
+							return nil, nil, 0, err
+						}
+						coinbaseBalance = new(big.Int)
+						if account != nil {
+							coinbaseBalance.Set(&account.Balance)
+						}
+					}
+					statedb.MergeTx(spec.statedb, spec.coinbase)
+					// Read after merging, so that reading the fees is not recorded as a read of the transaction
+					fees := new(big.Int).Sub(spec.statedb.GetBalance(spec.coinbase), coinbaseBalance)
+					// Added even if zero, as paying the fees touches an empty coinbase
+					statedb.AddBalance(spec.coinbase, fees)
+				} else {
+					statedb.MergeTx(spec.statedb)
+				}
+				msg, gas, failed = spec.msg, spec.gas, spec.failed
+				merged = true
+			}
+		}
+		if !merged {
+			// Conflicting or invalid, execute again on top of the current state
+			reexecuted++
+			var err error
+			if msg, err = tx.AsMessage(types.MakeSigner(p.config, header.Number)); err != nil {
+				return nil, nil, 0, err
+			}
+			vmenv := vm.NewEVM(NewEVMContext(msg, header, p.bc, nil), statedb, p.config, cfg)
+			if _, gas, failed, err = ApplyMessage(vmenv, msg, gp); err != nil {
+				return nil, nil, 0, err
+			}
+		}
+		written.Merge(statedb.TxWrites())
+		if err := statedb.FinalizeTx(ctx, tds.TrieStateWriter()); err != nil {
+			return nil, nil, 0, err
+		}
+		*usedGas += gas
+		receipt := newReceipt(tx, msg, statedb, gas, failed, *usedGas)
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+		if !p.config.IsByzantium(header.Number) {
+			tds.StartNewBuffer()
+		}
+	}
+	log.Debug("Executed block transactions in parallel", "number", block.Number(), "txs", len(txs), "reexecuted", reexecuted)
+	return p.finalize(block, header, statedb, tds, receipts, allLogs, *usedGas)
+}
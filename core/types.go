@@ -19,6 +19,7 @@ package core
 import (
 	"context"
 
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
@@ -34,6 +35,10 @@ type Validator interface {
 	// ValidateState validates the given statedb and optionally the receipts and
 	// gas used.
 	ValidateState(block, parent *types.Block, state *state.IntraBlockState, tds *state.TrieDbState, receipts types.Receipts, usedGas uint64) error
+
+	// ValidateStatelessState validates the state built from the block witness after
+	// the block execution, and optionally the receipts and gas used.
+	ValidateStatelessState(block *types.Block, s *state.Stateless, receipts types.Receipts, usedGas uint64) error
 }
 
 // Prefetcher is an interface for pre-caching transaction signatures and state.
@@ -47,4 +52,15 @@ type Prefetcher interface {
 // Processor is an interface for processing blocks using a given initial state.
 type Processor interface {
 	Process(block *types.Block, statedb *state.IntraBlockState, tds *state.TrieDbState, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error)
+
+	// ProcessStateless processes the block using the state built from its witness.
+	ProcessStateless(block *types.Block, s *state.Stateless, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error)
+}
+
+// WitnessFetcher is an interface for retrieving the block witnesses from the network,
+// which makes it possible to validate the blocks without keeping the state locally.
+type WitnessFetcher interface {
+	// FetchBlockWitness retrieves the witness of the block and builds the state needed
+	// to execute it, checking that it matches the state root of the parent block.
+	FetchBlockWitness(block *types.Block, parentRoot common.Hash) (*state.Stateless, error)
 }
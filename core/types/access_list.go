@@ -0,0 +1,23 @@
+package types
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// AccessedAccount is an account accessed by a transaction, together with its accessed storage items.
+// An account can have its storage items written without being written itself.
+type AccessedAccount struct {
+	Address     common.Address `json:"address"`
+	Account     bool           `json:"account"` // Whether the account itself (balance, nonce, code) was accessed
+	StorageKeys []common.Hash  `json:"storageKeys,omitempty"`
+}
+
+// TxAccessList lists the accounts and storage items read by a transaction, and the ones
+// written by it. Only the values the transaction depends on are reads, so the writes are not
+// necessarily read, for example adding the fees to the balance of the coinbase is not a read.
+// Both lists are ordered by address and storage key.
+type TxAccessList struct {
+	TxHash common.Hash       `json:"txHash"`
+	Reads  []AccessedAccount `json:"reads"`
+	Writes []AccessedAccount `json:"writes"`
+}
@@ -0,0 +1,210 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// CallFrame is a call or a contract creation made during the execution of a transaction,
+// together with the calls it made in turn. Self-destructs are recorded as frames without
+// the calls, sending the balance of the destructed contract to the beneficiary.
+type CallFrame struct {
+	Type    OpCode         // CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2 or SELFDESTRUCT
+	From    common.Address // Caller, or the destructed contract
+	To      common.Address // Callee (the code address for CALLCODE and DELEGATECALL), created contract, or the beneficiary
+	Value   *big.Int
+	Gas     uint64
+	GasUsed uint64
+	Input   []byte // Call data, or the init code of the creations
+	Output  []byte // Returned data, or the code of the created contract
+	Err     error
+	Calls   []*CallFrame
+}
+
+// ErrorString returns the error of the frame in the form used by the Parity traces,
+// or an empty string if the frame has not failed.
+func (f *CallFrame) ErrorString() string {
+	switch f.Err {
+	case nil:
+		return ""
+	case errExecutionReverted:
+		return "Reverted"
+	case ErrOutOfGas, ErrCodeStoreOutOfGas, errMaxCodeSizeExceeded:
+		return "Out of gas"
+	case errInvalidJump:
+		return "Bad jump destination"
+	case errWriteProtection:
+		return "Mutable Call In Static Context"
+	case errReturnDataOutOfBounds:
+		return "Out of bounds"
+	default:
+		return f.Err.Error()
+	}
+}
+
+// CallTracer is a native tracer, which collects the tree of the calls made by the transactions.
+// It also keeps the addresses of the callers and the callees of all the calls traced so far, and,
+// when attached to the IntraBlockState too, the accounts read and written by the transactions.
+type CallTracer struct {
+	root   *CallFrame
+	frames []*CallFrame // Calls being executed, the innermost one on the top
+	lastOp OpCode       // Last instruction executed, which is the one making the call when CaptureStart is invoked
+
+	froms   map[common.Address]struct{}
+	tos     map[common.Address]struct{}
+	reads   map[common.Address]struct{}
+	writes  map[common.Address]struct{}
+	storage map[common.Address]map[common.Hash]struct{}
+}
+
+// NewCallTracer creates a new call tracer
+func NewCallTracer() *CallTracer {
+	return &CallTracer{
+		froms:   make(map[common.Address]struct{}),
+		tos:     make(map[common.Address]struct{}),
+		reads:   make(map[common.Address]struct{}),
+		writes:  make(map[common.Address]struct{}),
+		storage: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// Root returns the top level call of the last transaction traced
+func (ct *CallTracer) Root() *CallFrame {
+	return ct.root
+}
+
+// Froms returns the sorted addresses of the callers and the destructed contracts
+func (ct *CallTracer) Froms() []common.Address {
+	return sortedAddresses(ct.froms)
+}
+
+// Tos returns the sorted addresses of the callees, the created contracts and the beneficiaries of the self-destructs
+func (ct *CallTracer) Tos() []common.Address {
+	return sortedAddresses(ct.tos)
+}
+
+// AccountsRead returns the accounts read through the IntraBlockState
+func (ct *CallTracer) AccountsRead() map[common.Address]struct{} {
+	return ct.reads
+}
+
+// AccountsWritten returns the accounts modified through the IntraBlockState
+func (ct *CallTracer) AccountsWritten() map[common.Address]struct{} {
+	return ct.writes
+}
+
+// StorageWritten returns the storage items modified by SSTORE, per contract
+func (ct *CallTracer) StorageWritten() map[common.Address]map[common.Hash]struct{} {
+	return ct.storage
+}
+
+func sortedAddresses(set map[common.Address]struct{}) []common.Address {
+	addresses := make([]common.Address, 0, len(set))
+	for addr := range set {
+		addresses = append(addresses, addr)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return bytes.Compare(addresses[i][:], addresses[j][:]) < 0 })
+	return addresses
+}
+
+// CaptureStart implements the Tracer interface to open a new call frame
+func (ct *CallTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	frame := &CallFrame{
+		Type:  CALL,
+		From:  from,
+		To:    to,
+		Gas:   gas,
+		Input: common.CopyBytes(input),
+		Value: new(big.Int),
+	}
+	if create {
+		frame.Type = CREATE
+	}
+	if value != nil {
+		frame.Value.Set(value)
+	}
+	if depth == 0 {
+		ct.root = frame
+		ct.frames = ct.frames[:0]
+	} else if len(ct.frames) > 0 {
+		switch ct.lastOp {
+		case CALLCODE, DELEGATECALL, STATICCALL, CREATE2:
+			frame.Type = ct.lastOp
+		}
+		parent := ct.frames[len(ct.frames)-1]
+		parent.Calls = append(parent.Calls, frame)
+	}
+	ct.frames = append(ct.frames, frame)
+	ct.froms[from] = struct{}{}
+	ct.tos[to] = struct{}{}
+	return nil
+}
+
+// CaptureState implements the Tracer interface to remember the instruction making the calls,
+// and to record the self-destructs and the storage modifications
+func (ct *CallTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	ct.lastOp = op
+	switch op {
+	case SELFDESTRUCT:
+		if stack.len() < 1 || len(ct.frames) == 0 {
+			return nil
+		}
+		frame := &CallFrame{
+			Type:  SELFDESTRUCT,
+			From:  contract.Address(),
+			To:    common.BigToAddress(stack.Back(0)),
+			Value: new(big.Int).Set(env.IntraBlockState.GetBalance(contract.Address())),
+		}
+		parent := ct.frames[len(ct.frames)-1]
+		parent.Calls = append(parent.Calls, frame)
+		ct.froms[frame.From] = struct{}{}
+		ct.tos[frame.To] = struct{}{}
+	case SSTORE:
+		if stack.len() < 1 {
+			return nil
+		}
+		keys, ok := ct.storage[contract.Address()]
+		if !ok {
+			keys = make(map[common.Hash]struct{})
+			ct.storage[contract.Address()] = keys
+		}
+		keys[common.BigToHash(stack.Back(0))] = struct{}{}
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface. The failure is reported by CaptureEnd.
+func (ct *CallTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface to close the innermost call frame
+func (ct *CallTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, t time.Duration, err error) error {
+	if len(ct.frames) == 0 {
+		return nil
+	}
+	frame := ct.frames[len(ct.frames)-1]
+	ct.frames = ct.frames[:len(ct.frames)-1]
+	frame.Output = common.CopyBytes(output)
+	frame.GasUsed = gasUsed
+	frame.Err = err
+	return nil
+}
+
+func (ct *CallTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (ct *CallTracer) CaptureAccountRead(account common.Address) error {
+	ct.reads[account] = struct{}{}
+	return nil
+}
+
+func (ct *CallTracer) CaptureAccountWrite(account common.Address) error {
+	ct.writes[account] = struct{}{}
+	return nil
+}
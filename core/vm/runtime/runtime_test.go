@@ -119,6 +119,101 @@ func TestCall(t *testing.T) {
 	}
 }
 
+// tracedCallState deploys a contract, which delegate-calls and static-calls a contract returning 1,
+// calls a reverting contract with value and self-destructs
+func tracedCallState() (*state.IntraBlockState, common.Address) {
+	db := ethdb.NewMemDatabase()
+	tds, _ := state.NewTrieDbState(common.Hash{}, db, 0)
+	statedb := state.New(tds)
+	statedb.SetCode(common.HexToAddress("0x0b"), []byte{
+		byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.MSTORE),
+		byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN),
+	})
+	statedb.SetCode(common.HexToAddress("0x0c"), []byte{
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.REVERT),
+	})
+	address := common.HexToAddress("0x0a")
+	statedb.SetCode(address, []byte{
+		byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0x0b, byte(vm.GAS), byte(vm.DELEGATECALL), byte(vm.POP),
+		byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0x0b, byte(vm.GAS), byte(vm.STATICCALL), byte(vm.POP),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 5, byte(vm.PUSH1), 0x0c, byte(vm.GAS), byte(vm.CALL), byte(vm.POP),
+		byte(vm.PUSH1), 0x0d, byte(vm.SELFDESTRUCT),
+	})
+	statedb.AddBalance(address, big.NewInt(100))
+	return statedb, address
+}
+
+func TestCallTracer(t *testing.T) {
+	statedb, address := tracedCallState()
+	tracer := vm.NewCallTracer()
+	if _, _, err := Call(address, nil, &Config{State: statedb, ChainConfig: params.AllEthashProtocolChanges, EVMConfig: vm.Config{Debug: true, Tracer: tracer}}); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	root := tracer.Root()
+	if root == nil || root.Type != vm.CALL || root.To != address || len(root.Calls) != 4 {
+		t.Fatalf("unexpected top level call: %+v", root)
+	}
+	expected := []struct {
+		typ   vm.OpCode
+		from  common.Address
+		to    common.Address
+		value int64
+		err   string
+	}{
+		{vm.DELEGATECALL, address, common.HexToAddress("0x0b"), 0, ""},
+		{vm.STATICCALL, address, common.HexToAddress("0x0b"), 0, ""},
+		{vm.CALL, address, common.HexToAddress("0x0c"), 5, "Reverted"},
+		{vm.SELFDESTRUCT, address, common.HexToAddress("0x0d"), 100, ""},
+	}
+	for i, exp := range expected {
+		call := root.Calls[i]
+		if call.Type != exp.typ || call.From != exp.from || call.To != exp.to || call.Value.Int64() != exp.value || call.ErrorString() != exp.err {
+			t.Errorf("call %d: expected %v %x->%x %d %q, got %v %x->%x %d %q", i, exp.typ, exp.from, exp.to, exp.value, exp.err,
+				call.Type, call.From, call.To, call.Value, call.ErrorString())
+		}
+	}
+	if output := root.Calls[0].Output; len(output) != 32 || output[31] != 1 {
+		t.Errorf("unexpected output of the delegate call: %x", output)
+	}
+	if tos := tracer.Tos(); len(tos) != 4 {
+		t.Errorf("unexpected callees: %x", tos)
+	}
+}
+
+func TestVMTracer(t *testing.T) {
+	statedb, address := tracedCallState()
+	tracer := vm.NewVMTracer()
+	if _, _, err := Call(address, nil, &Config{State: statedb, ChainConfig: params.AllEthashProtocolChanges, EVMConfig: vm.Config{Debug: true, Tracer: tracer}}); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	trace := tracer.Trace()
+	if trace == nil || len(trace.Ops) != 27 {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	if push := trace.Ops[0].Ex.Push; len(push) != 1 || push[0].ToInt().Int64() != 32 {
+		t.Errorf("unexpected push of the first instruction: %v", push)
+	}
+	delegateCall := trace.Ops[6]
+	if delegateCall.Pc != 11 || delegateCall.Sub == nil || len(delegateCall.Sub.Ops) != 6 {
+		t.Fatalf("unexpected delegate call: %+v", delegateCall)
+	}
+	if push := delegateCall.Ex.Push; len(push) != 1 || push[0].ToInt().Int64() != 1 {
+		t.Errorf("unexpected result of the delegate call: %v", push)
+	}
+	if mem := delegateCall.Ex.Mem; mem == nil || mem.Off != 0 || len(mem.Data) != 32 || mem.Data[31] != 1 {
+		t.Errorf("unexpected memory written by the delegate call: %+v", mem)
+	}
+	if mstore := delegateCall.Sub.Ops[2]; mstore.Ex.Mem == nil || len(mstore.Ex.Mem.Data) != 32 || len(mstore.Ex.Push) != 0 {
+		t.Errorf("unexpected effects of MSTORE: %+v", mstore.Ex)
+	}
+	if used := trace.Ops[1].Ex.Used; used != trace.Ops[0].Ex.Used-3 {
+		t.Errorf("unexpected gas left: %d after %d", used, trace.Ops[0].Ex.Used)
+	}
+	if revert := trace.Ops[23].Sub; revert == nil || len(revert.Ops) != 3 {
+		t.Errorf("unexpected trace of the reverted call: %+v", revert)
+	}
+}
+
 func BenchmarkCall(b *testing.B) {
 	var definition = `[{"constant":true,"inputs":[],"name":"seller","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"abort","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"value","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[],"name":"refund","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"buyer","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmReceived","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmPurchase","outputs":[],"type":"function"},{"inputs":[],"type":"constructor"},{"anonymous":false,"inputs":[],"name":"Aborted","type":"event"},{"anonymous":false,"inputs":[],"name":"PurchaseConfirmed","type":"event"},{"anonymous":false,"inputs":[],"name":"ItemReceived","type":"event"},{"anonymous":false,"inputs":[],"name":"Refunded","type":"event"}]`
 
@@ -0,0 +1,193 @@
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// VMTrace is the trace of the instructions executed in a call frame, in the format of the Parity vmTrace
+type VMTrace struct {
+	Code hexutil.Bytes `json:"code"`
+	Ops  []*VMTraceOp  `json:"ops"`
+}
+
+// VMTraceOp is an instruction executed, together with the trace of the call frame it has created, if any
+type VMTraceOp struct {
+	Cost uint64     `json:"cost"`
+	Ex   *VMTraceEx `json:"ex"`
+	Pc   uint64     `json:"pc"`
+	Sub  *VMTrace   `json:"sub"`
+}
+
+// VMTraceEx is the effect of an executed instruction
+type VMTraceEx struct {
+	Mem   *VMTraceMem    `json:"mem"`   // Memory written, if any
+	Push  []*hexutil.Big `json:"push"`  // Items pushed onto the stack, the top one last
+	Store *VMTraceStore  `json:"store"` // Storage item written, if any
+	Used  uint64         `json:"used"`  // Gas left after the instruction
+}
+
+// VMTraceMem is the memory region written by an instruction
+type VMTraceMem struct {
+	Data hexutil.Bytes `json:"data"`
+	Off  uint64        `json:"off"`
+}
+
+// VMTraceStore is the storage item written by SSTORE
+type VMTraceStore struct {
+	Key *hexutil.Big `json:"key"`
+	Val *hexutil.Big `json:"val"`
+}
+
+// vmTraceFrame keeps the last instruction of a call frame, which effects are only known
+// when the next instruction of the same frame is about to be executed
+type vmTraceFrame struct {
+	trace   *VMTrace
+	last    *VMTraceOp
+	pushes  int    // Number of the items pushed by the last instruction
+	memOff  uint64 // Memory region written by the last instruction
+	memSize uint64
+	gasLeft uint64 // Gas left after the last instruction, unless it is a call
+}
+
+// VMTracer is a native tracer, which collects the Parity vmTrace of a transaction
+type VMTracer struct {
+	root   *VMTrace
+	frames []*vmTraceFrame
+}
+
+// NewVMTracer creates a new vmTrace tracer
+func NewVMTracer() *VMTracer {
+	return &VMTracer{}
+}
+
+// Trace returns the trace of the last transaction traced
+func (vt *VMTracer) Trace() *VMTrace {
+	return vt.root
+}
+
+// pushCount returns the number of the items pushed onto the stack by the instruction
+func pushCount(op OpCode) int {
+	operation := istanbulInstructionSet[op]
+	if !operation.valid {
+		return 0
+	}
+	return int(params.StackLimit) + operation.minStack - operation.maxStack
+}
+
+// finish fills in the effects of the last instruction of the frame
+func (f *vmTraceFrame) finish(stack *Stack, memory *Memory, gas uint64) {
+	if f.last == nil {
+		return
+	}
+	f.last.Ex.Used = gas
+	if stack != nil && f.pushes <= stack.len() {
+		for i := f.pushes - 1; i >= 0; i-- {
+			f.last.Ex.Push = append(f.last.Ex.Push, (*hexutil.Big)(new(big.Int).Set(stack.Back(i))))
+		}
+	}
+	if memory != nil && f.memSize > 0 && f.memOff+f.memSize <= uint64(memory.Len()) {
+		f.last.Ex.Mem = &VMTraceMem{Data: memory.GetCopy(int64(f.memOff), int64(f.memSize)), Off: f.memOff}
+	}
+	f.last = nil
+}
+
+// CaptureStart implements the Tracer interface to open a new call frame
+func (vt *VMTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	trace := &VMTrace{Ops: []*VMTraceOp{}}
+	if create {
+		trace.Code = common.CopyBytes(input)
+	}
+	if depth == 0 {
+		vt.root = trace
+		vt.frames = vt.frames[:0]
+	} else if len(vt.frames) > 0 {
+		if parent := vt.frames[len(vt.frames)-1]; parent.last != nil {
+			parent.last.Sub = trace
+		}
+	}
+	vt.frames = append(vt.frames, &vmTraceFrame{trace: trace})
+	return nil
+}
+
+// CaptureState implements the Tracer interface to record the instruction, and the effects of the previous one
+func (vt *VMTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if len(vt.frames) == 0 {
+		return nil
+	}
+	f := vt.frames[len(vt.frames)-1]
+	if f.trace.Code == nil && len(f.trace.Ops) == 0 {
+		f.trace.Code = common.CopyBytes(contract.Code)
+	}
+	f.finish(stack, memory, gas)
+
+	f.last = &VMTraceOp{Cost: cost, Ex: &VMTraceEx{Push: []*hexutil.Big{}}, Pc: pc}
+	f.pushes = pushCount(op)
+	f.memOff, f.memSize = 0, 0
+	if cost <= gas {
+		f.gasLeft = gas - cost
+	}
+	back := func(n int) *big.Int {
+		if n < stack.len() {
+			return stack.Back(n)
+		}
+		return new(big.Int)
+	}
+	region := func(off, size *big.Int) {
+		if off.IsUint64() && size.IsUint64() {
+			f.memOff, f.memSize = off.Uint64(), size.Uint64()
+		}
+	}
+	switch op {
+	case MSTORE:
+		region(back(0), big.NewInt(32))
+	case MSTORE8:
+		region(back(0), big.NewInt(1))
+	case CALLDATACOPY, CODECOPY, RETURNDATACOPY:
+		region(back(0), back(2))
+	case EXTCODECOPY:
+		region(back(1), back(3))
+	case CALL, CALLCODE:
+		region(back(5), back(6))
+	case DELEGATECALL, STATICCALL:
+		region(back(4), back(5))
+	case SSTORE:
+		f.last.Ex.Store = &VMTraceStore{Key: (*hexutil.Big)(new(big.Int).Set(back(0))), Val: (*hexutil.Big)(new(big.Int).Set(back(1)))}
+	}
+	f.trace.Ops = append(f.trace.Ops, f.last)
+	return nil
+}
+
+// CaptureFault implements the Tracer interface. The failing instruction is not recorded.
+func (vt *VMTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface to close the innermost call frame
+func (vt *VMTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, t time.Duration, err error) error {
+	if len(vt.frames) == 0 {
+		return nil
+	}
+	f := vt.frames[len(vt.frames)-1]
+	vt.frames = vt.frames[:len(vt.frames)-1]
+	// The instructions terminating the frame do not push anything
+	f.pushes, f.memSize = 0, 0
+	f.finish(nil, nil, f.gasLeft)
+	return nil
+}
+
+func (vt *VMTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (vt *VMTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (vt *VMTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
@@ -19,6 +19,7 @@ package eth
 import (
 	"compress/gzip"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -29,11 +30,15 @@ import (
 	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
 	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/ethapi"
 	"github.com/ledgerwatch/turbo-geth/rlp"
@@ -507,3 +512,378 @@ func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Bloc
 	dirty, err := ethdb.GetModifiedAccounts(api.eth.blockchain.ChainDb(), startNum, endNum)
 	return dirty, err
 }
+
+// AccountHistoryValue is the state of an account before or after a change.
+type AccountHistoryValue struct {
+	Nonce       hexutil.Uint64 `json:"nonce"`
+	Balance     *hexutil.Big   `json:"balance"`
+	CodeHash    common.Hash    `json:"codeHash"`
+	Incarnation hexutil.Uint64 `json:"incarnation"`
+}
+
+// AccountChange is a change of an account made by a block, as returned by
+// debug_getAccountHistory. Before and After are nil if the account did not exist.
+type AccountChange struct {
+	Block  hexutil.Uint64       `json:"block"`
+	Before *AccountHistoryValue `json:"before"`
+	After  *AccountHistoryValue `json:"after"`
+}
+
+// StorageChange is a change of a storage slot made by a block, as returned by
+// debug_getStorageHistory.
+type StorageChange struct {
+	Block  hexutil.Uint64 `json:"block"`
+	Before common.Hash    `json:"before"`
+	After  common.Hash    `json:"after"`
+}
+
+// GetAccountHistory returns the blocks between fromBlock and toBlock (inclusive)
+// which changed the account, along with the account before and after each change.
+// Only the blocks with the history kept (not pruned) are returned.
+func (api *PrivateDebugAPI) GetAccountHistory(ctx context.Context, address common.Address, fromBlock, toBlock rpc.BlockNumber) ([]AccountChange, error) {
+	from, to, err := api.historyRange(fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	return AccountHistory(api.eth.ChainDb(), address, from, to)
+}
+
+// GetStorageHistory returns the blocks between fromBlock and toBlock (inclusive)
+// which changed the storage slot, along with the values before and after each change.
+// The slot is looked up in the incarnation of the contract existing at toBlock.
+func (api *PrivateDebugAPI) GetStorageHistory(ctx context.Context, address common.Address, key common.Hash, fromBlock, toBlock rpc.BlockNumber) ([]StorageChange, error) {
+	from, to, err := api.historyRange(fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	account, err := state.NewDbState(api.eth.ChainDb(), to).ReadAccountData(address)
+	if err != nil {
+		return nil, fmt.Errorf("error reading account %x: %v", address, err)
+	}
+	if account == nil {
+		return nil, fmt.Errorf("account %x doesn't exist at block %d", address, to)
+	}
+	return StorageHistory(api.eth.ChainDb(), address, account.Incarnation, key, from, to)
+}
+
+// historyRange resolves the blocks of a history query, the latest and pending
+// blocks being the current head.
+func (api *PrivateDebugAPI) historyRange(fromBlock, toBlock rpc.BlockNumber) (uint64, uint64, error) {
+	head := api.eth.blockchain.CurrentBlock().NumberU64()
+	from, to := head, head
+	if fromBlock >= 0 {
+		from = uint64(fromBlock)
+	}
+	if toBlock >= 0 {
+		to = uint64(toBlock)
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("start block height (%d) must not be greater than end block height (%d)", from, to)
+	}
+	return from, to, nil
+}
+
+// AccountHistory returns the changes of the account made by the blocks between
+// fromBlock and toBlock (inclusive), decoded from the change sets.
+func AccountHistory(db ethdb.Getter, address common.Address, fromBlock, toBlock uint64) ([]AccountChange, error) {
+	addrHash := crypto.Keccak256Hash(address[:])
+	changes, err := ethdb.GetHistoryChanges(db, dbutils.AccountsBucket, dbutils.AccountsHistoryBucket, addrHash[:], fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]AccountChange, len(changes))
+	for i, change := range changes {
+		result[i].Block = hexutil.Uint64(change.BlockNum)
+		if result[i].Before, err = decodeHistoryAccount(db, addrHash, change.Before); err != nil {
+			return nil, err
+		}
+		if result[i].After, err = decodeHistoryAccount(db, addrHash, change.After); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// decodeHistoryAccount decodes an account encoded for storage, returning nil for
+// a non-existent account.
+func decodeHistoryAccount(db ethdb.Getter, addrHash common.Hash, enc []byte) (*AccountHistoryValue, error) {
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(enc); err != nil {
+		return nil, err
+	}
+	// The thin history doesn't keep the code hash of the contracts in the change sets
+	if debug.IsThinHistory() && acc.IsEmptyCodeHash() && acc.Incarnation > 0 {
+		if codeHash, err := db.Get(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(addrHash, acc.Incarnation)); err == nil {
+			acc.CodeHash = common.BytesToHash(codeHash)
+		}
+	}
+	return &AccountHistoryValue{
+		Nonce:       hexutil.Uint64(acc.Nonce),
+		Balance:     (*hexutil.Big)(&acc.Balance),
+		CodeHash:    acc.CodeHash,
+		Incarnation: hexutil.Uint64(acc.Incarnation),
+	}, nil
+}
+
+// StorageHistory returns the changes of the storage slot of the given incarnation
+// of the contract made by the blocks between fromBlock and toBlock (inclusive),
+// decoded from the change sets.
+func StorageHistory(db ethdb.Getter, address common.Address, incarnation uint64, key common.Hash, fromBlock, toBlock uint64) ([]StorageChange, error) {
+	compositeKey := dbutils.GenerateCompositeStorageKey(crypto.Keccak256Hash(address[:]), incarnation, crypto.Keccak256Hash(key[:]))
+	changes, err := ethdb.GetHistoryChanges(db, dbutils.StorageBucket, dbutils.StorageHistoryBucket, compositeKey, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]StorageChange, len(changes))
+	for i, change := range changes {
+		result[i] = StorageChange{
+			Block:  hexutil.Uint64(change.BlockNum),
+			Before: common.BytesToHash(change.Before),
+			After:  common.BytesToHash(change.After),
+		}
+	}
+	return result, nil
+}
+
+// StateDiffResult is the result of a debug_stateDiff API call. The accounts are
+// keyed by the hash of their addresses.
+type StateDiffResult map[common.Hash]*AccountDiff
+
+// AccountDiff is a change of an account made by a block. Before and After are
+// nil if the account did not exist.
+type AccountDiff struct {
+	Address *common.Address              `json:"address"` // nil if the preimage of the address hash is unknown
+	Before  *AccountHistoryValue         `json:"before"`
+	After   *AccountHistoryValue         `json:"after"`
+	Storage map[common.Hash]*StorageDiff `json:"storage"` // keyed by the hash of the storage key
+}
+
+// StorageDiff is a change of a storage slot made by a block.
+type StorageDiff struct {
+	Key         *common.Hash   `json:"key"` // nil if the preimage of the storage key hash is unknown
+	Incarnation hexutil.Uint64 `json:"incarnation"`
+	Before      common.Hash    `json:"before"`
+	After       common.Hash    `json:"after"`
+}
+
+// StateDiff returns the accounts and storage slots modified by the block, with
+// the values before and after the block.
+func (api *PrivateDebugAPI) StateDiff(ctx context.Context, blockNr rpc.BlockNumber) (StateDiffResult, error) {
+	number := api.eth.blockchain.CurrentBlock().NumberU64()
+	if blockNr >= 0 {
+		number = uint64(blockNr)
+	}
+	if number > api.eth.blockchain.CurrentBlock().NumberU64() {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return StateDiff(api.eth.ChainDb(), number)
+}
+
+// StateDiff computes the changes made by the block from its change sets, without
+// re-executing it. The values before the block are taken from the change sets,
+// and the values after the block are read as of the next block.
+func StateDiff(db ethdb.Getter, blockNr uint64) (StateDiffResult, error) {
+	result := make(StateDiffResult)
+	encodedTS := dbutils.EncodeTimestamp(blockNr)
+
+	accountChanges, err := readChangeSet(db, dbutils.CompositeChangeSetKey(encodedTS, dbutils.AccountsHistoryBucket))
+	if err != nil {
+		return nil, err
+	}
+	if err = accountChanges.Walk(func(k, v []byte) error {
+		addrHash := common.BytesToHash(k)
+		diff, err := newAccountDiff(db, addrHash)
+		if err != nil {
+			return err
+		}
+		if diff.Before, err = decodeHistoryAccount(db, addrHash, v); err != nil {
+			return err
+		}
+		if diff.After, err = accountAsOf(db, addrHash, blockNr+1); err != nil {
+			return err
+		}
+		result[addrHash] = diff
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	storageChanges, err := readChangeSet(db, dbutils.CompositeChangeSetKey(encodedTS, dbutils.StorageHistoryBucket))
+	if err != nil {
+		return nil, err
+	}
+	if err = storageChanges.Walk(func(k, v []byte) error {
+		if len(k) != common.HashLength+8+common.HashLength {
+			return fmt.Errorf("invalid storage change key %x", k)
+		}
+		addrHash := common.BytesToHash(k[:common.HashLength])
+		seckey := common.BytesToHash(k[common.HashLength+8:])
+		diff, ok := result[addrHash]
+		if !ok {
+			// The account itself is not changed, only its storage
+			if diff, err = newAccountDiff(db, addrHash); err != nil {
+				return err
+			}
+			if diff.After, err = accountAsOf(db, addrHash, blockNr+1); err != nil {
+				return err
+			}
+			diff.Before = diff.After
+			result[addrHash] = diff
+		}
+		after, err := db.GetAsOf(dbutils.StorageBucket, dbutils.StorageHistoryBucket, k, blockNr+1)
+		if err != nil && err != ethdb.ErrKeyNotFound {
+			return err
+		}
+		storageDiff := &StorageDiff{
+			Incarnation: hexutil.Uint64(^binary.BigEndian.Uint64(k[common.HashLength : common.HashLength+8])),
+			Before:      common.BytesToHash(v),
+			After:       common.BytesToHash(after),
+		}
+		if preimage, err := db.Get(dbutils.PreimagePrefix, seckey[:]); err == nil && len(preimage) == common.HashLength {
+			key := common.BytesToHash(preimage)
+			storageDiff.Key = &key
+		}
+		diff.Storage[seckey] = storageDiff
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readChangeSet reads the change set stored under the given key, returning an
+// empty change set if there is none.
+func readChangeSet(db ethdb.Getter, key []byte) (*dbutils.ChangeSet, error) {
+	enc, err := db.Get(dbutils.ChangeSetBucket, key)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return nil, err
+	}
+	return dbutils.DecodeChangeSet(enc)
+}
+
+// newAccountDiff creates an empty diff of the account, resolving its address from the preimage.
+func newAccountDiff(db ethdb.Getter, addrHash common.Hash) (*AccountDiff, error) {
+	diff := &AccountDiff{Storage: make(map[common.Hash]*StorageDiff)}
+	preimage, err := db.Get(dbutils.PreimagePrefix, addrHash[:])
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return nil, err
+	}
+	if len(preimage) == common.AddressLength {
+		address := common.BytesToAddress(preimage)
+		diff.Address = &address
+	}
+	return diff, nil
+}
+
+// accountAsOf reads the account as of the beginning of the given block.
+func accountAsOf(db ethdb.Getter, addrHash common.Hash, timestamp uint64) (*AccountHistoryValue, error) {
+	enc, err := db.GetAsOf(dbutils.AccountsBucket, dbutils.AccountsHistoryBucket, addrHash[:], timestamp)
+	if err != nil && err != ethdb.ErrKeyNotFound {
+		return nil, err
+	}
+	return decodeHistoryAccount(db, addrHash, enc)
+}
+
+// BlockWitnessStatsResult is the result of a debug_getBlockWitnessStats API call.
+// All the sizes are in bytes.
+type BlockWitnessStatsResult struct {
+	BlockNumber    hexutil.Uint64 `json:"blockNumber"`
+	BlockHash      common.Hash    `json:"blockHash"`
+	WitnessSize    hexutil.Uint64 `json:"witnessSize"`
+	CodesSize      hexutil.Uint64 `json:"codesSize"`
+	LeafKeysSize   hexutil.Uint64 `json:"leafKeysSize"`
+	LeafValuesSize hexutil.Uint64 `json:"leafValuesSize"`
+	MasksSize      hexutil.Uint64 `json:"masksSize"`
+	HashesSize     hexutil.Uint64 `json:"hashesSize"`
+}
+
+// GetBlockWitness returns the serialised witness the node produced for the canonical block.
+// The witnesses are only available for the recent blocks and only if the node stores them.
+// If binary is set, the witness is converted into the witness of the binary trie.
+func (api *PrivateDebugAPI) GetBlockWitness(ctx context.Context, blockNr rpc.BlockNumber, binary bool) (hexutil.Bytes, error) {
+	_, witness, _, err := api.blockWitness(blockNr, binary)
+	if err != nil {
+		return nil, err
+	}
+	return witness, nil
+}
+
+// GetBlockWitnessStats returns the sizes of the parts of the witness of the canonical block.
+func (api *PrivateDebugAPI) GetBlockWitnessStats(ctx context.Context, blockNr rpc.BlockNumber, binary bool) (*BlockWitnessStatsResult, error) {
+	hash, _, stats, err := api.blockWitness(blockNr, binary)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockWitnessStatsResult{
+		BlockNumber:    hexutil.Uint64(stats.BlockNumber()),
+		BlockHash:      hash,
+		WitnessSize:    hexutil.Uint64(stats.BlockWitnessSize()),
+		CodesSize:      hexutil.Uint64(stats.CodesSize()),
+		LeafKeysSize:   hexutil.Uint64(stats.LeafKeysSize()),
+		LeafValuesSize: hexutil.Uint64(stats.LeafValuesSize()),
+		MasksSize:      hexutil.Uint64(stats.MasksSize()),
+		HashesSize:     hexutil.Uint64(stats.HashesSize()),
+	}, nil
+}
+
+// StateRootsResult is the result of a debug_getStateRoots API call.
+type StateRootsResult struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	StateRoot   common.Hash    `json:"stateRoot"`
+	BinaryRoot  *common.Hash   `json:"binaryRoot"`
+}
+
+// GetStateRoots returns the roots of the hexary and the binary state tries after the canonical block.
+// The binary root is only known for the blocks inserted while the binary trie was maintained.
+func (api *PrivateDebugAPI) GetStateRoots(ctx context.Context, blockNr rpc.BlockNumber) (*StateRootsResult, error) {
+	number := api.eth.blockchain.CurrentBlock().NumberU64()
+	if blockNr >= 0 {
+		number = uint64(blockNr)
+	}
+	header := api.eth.blockchain.GetHeaderByNumber(number)
+	if header == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	result := &StateRootsResult{
+		BlockNumber: hexutil.Uint64(number),
+		BlockHash:   header.Hash(),
+		StateRoot:   header.Root,
+	}
+	if root, ok := rawdb.ReadBinaryStateRoot(api.eth.ChainDb(), result.BlockHash, number); ok {
+		result.BinaryRoot = &root
+	}
+	return result, nil
+}
+
+// blockWitness reads the stored witness of the canonical block, converting it if necessary.
+func (api *PrivateDebugAPI) blockWitness(blockNr rpc.BlockNumber, binary bool) (common.Hash, []byte, *state.BlockWitnessStats, error) {
+	number := api.eth.blockchain.CurrentBlock().NumberU64()
+	if blockNr >= 0 {
+		number = uint64(blockNr)
+	}
+	db := api.eth.ChainDb()
+	hash := rawdb.ReadCanonicalHash(db, number)
+	if hash == (common.Hash{}) {
+		return common.Hash{}, nil, nil, fmt.Errorf("block #%d not found", number)
+	}
+	entry := rawdb.ReadBlockWitness(db, hash, number)
+	if entry == nil {
+		return common.Hash{}, nil, nil, fmt.Errorf("witness of block #%d not found", number)
+	}
+	if binary {
+		witness, stats, err := state.BinaryBlockWitness(number, entry.Witness, entry.Keys)
+		if err != nil {
+			return common.Hash{}, nil, nil, err
+		}
+		return hash, witness, stats, nil
+	}
+	stats, err := state.BlockWitnessStatsOf(number, entry.Witness)
+	if err != nil {
+		return common.Hash{}, nil, nil, err
+	}
+	return hash, entry.Witness, stats, nil
+}
@@ -0,0 +1,103 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// AccessList returns the accounts and storage items read and written by the transaction.
+func (api *PrivateDebugAPI) AccessList(ctx context.Context, hash common.Hash) (*types.TxAccessList, error) {
+	tx, blockHash, _, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	block := api.eth.blockchain.GetBlockByHash(blockHash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", blockHash)
+	}
+	lists, err := api.accessLists(ctx, block, int(index))
+	if err != nil {
+		return nil, err
+	}
+	return lists[index], nil
+}
+
+// AccessListBlockByNumber returns the accounts and storage items read and written by
+// each transaction of the block.
+func (api *PrivateDebugAPI) AccessListBlockByNumber(ctx context.Context, number rpc.BlockNumber) ([]*types.TxAccessList, error) {
+	var block *types.Block
+
+	switch number {
+	case rpc.PendingBlockNumber:
+		block = api.eth.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return api.accessLists(ctx, block, len(block.Transactions())-1)
+}
+
+// AccessListBlockByHash returns the accounts and storage items read and written by
+// each transaction of the block.
+func (api *PrivateDebugAPI) AccessListBlockByHash(ctx context.Context, hash common.Hash) ([]*types.TxAccessList, error) {
+	block := api.eth.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", hash)
+	}
+	return api.accessLists(ctx, block, len(block.Transactions())-1)
+}
+
+// accessLists returns the access lists of the transactions of the block, up to and including
+// the one with the given index. The lists stored at the insertion of the block are used if
+// available, otherwise the transactions are re-executed on top of the state of its parent.
+func (api *PrivateDebugAPI) accessLists(ctx context.Context, block *types.Block, last int) ([]*types.TxAccessList, error) {
+	if lists := rawdb.ReadBlockAccessLists(api.eth.ChainDb(), block.Hash(), block.NumberU64()); len(lists) == len(block.Transactions()) && len(lists) > 0 {
+		return lists[:last+1], nil
+	}
+	if last < 0 {
+		return []*types.TxAccessList{}, nil
+	}
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	var (
+		chainConfig      = api.eth.blockchain.Config()
+		statedb, dbstate = ComputeIntraBlockState(api.eth.ChainDb(), parent)
+		signer           = types.MakeSigner(chainConfig, block.Number())
+		eipCtx           = chainConfig.WithEIPsFlags(context.Background(), block.Number())
+	)
+	statedb.EnableAccessRecording()
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	for i, tx := range block.Transactions()[:last+1] {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		msg, _ := tx.AsMessage(signer)
+		vmenv := vm.NewEVM(core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil), statedb, chainConfig, vm.Config{})
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+			return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+		if err := statedb.FinalizeTx(eipCtx, dbstate); err != nil {
+			return nil, err
+		}
+	}
+	return statedb.AccessLists(), nil
+}
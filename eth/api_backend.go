@@ -182,26 +182,7 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 }
 
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
-	if number := rawdb.ReadHeaderNumber(b.eth.chainDb, hash); number != nil {
-		block := rawdb.ReadBlock(b.eth.chainDb, hash, *number)
-		dbstate := state.NewDbState(b.eth.chainDb, *number-1)
-		statedb := state.New(dbstate)
-		header := block.Header()
-		var receipts types.Receipts
-		var usedGas = new(uint64)
-		var gp = new(core.GasPool).AddGas(block.GasLimit())
-		vmConfig := vm.Config{}
-		for i, tx := range block.Transactions() {
-			statedb.Prepare(tx.Hash(), block.Hash(), i)
-			receipt, err := core.ApplyTransaction(b.ChainConfig(), b.eth.blockchain, nil, gp, statedb, dbstate, header, tx, usedGas, vmConfig)
-			if err != nil {
-				return nil, err
-			}
-			receipts = append(receipts, receipt)
-		}
-		return receipts, nil
-	}
-	return nil, nil
+	return b.eth.blockchain.GetReceiptsByHash(hash), nil
 }
 
 func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
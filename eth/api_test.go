@@ -29,6 +29,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
@@ -263,3 +264,140 @@ func TestStorageRangeAt(t *testing.T) {
 		})
 	}
 }
+
+func TestAccountAndStorageHistory(t *testing.T) {
+	var (
+		db     = ethdb.NewMemDatabase()
+		tds, _ = state.NewTrieDbState(common.Hash{}, db, 0)
+		addr   = common.Address{0x01}
+		key    = common.Hash{0x02}
+	)
+	// The balance changes in every block, the storage slot in the blocks 1 and 3
+	for blockNr := uint64(1); blockNr <= 4; blockNr++ {
+		tds.StartNewBuffer()
+		statedb := state.New(tds)
+		statedb.SetBalance(addr, new(big.Int).SetUint64(blockNr*10))
+		if blockNr == 1 {
+			statedb.SetIncarnation(addr, state.FirstContractIncarnation)
+		}
+		if blockNr == 1 || blockNr == 3 {
+			statedb.SetState(addr, key, common.Hash{byte(blockNr)})
+		}
+		if err := statedb.FinalizeTx(context.Background(), tds.TrieStateWriter()); err != nil {
+			t.Fatal("error while finalising state", err)
+		}
+		if _, err := tds.ComputeTrieRoots(); err != nil {
+			t.Fatal("error while computing trie roots of the state", err)
+		}
+		tds.SetBlockNr(blockNr)
+		if err := statedb.CommitBlock(context.Background(), tds.DbStateWriter()); err != nil {
+			t.Fatal("error while committing state", err)
+		}
+	}
+
+	accountChanges, err := AccountHistory(db, addr, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accountChanges) != 2 {
+		t.Fatalf("expected 2 account changes, got %s", dumper.Sdump(accountChanges))
+	}
+	if accountChanges[0].Block != 1 || accountChanges[0].Before != nil || accountChanges[0].After.Balance.ToInt().Uint64() != 10 {
+		t.Errorf("wrong account creation: %s", dumper.Sdump(accountChanges[0]))
+	}
+	if accountChanges[1].Block != 2 || accountChanges[1].Before.Balance.ToInt().Uint64() != 10 || accountChanges[1].After.Balance.ToInt().Uint64() != 20 {
+		t.Errorf("wrong account change: %s", dumper.Sdump(accountChanges[1]))
+	}
+	if uint64(accountChanges[1].After.Incarnation) != state.FirstContractIncarnation {
+		t.Errorf("wrong incarnation: %d", accountChanges[1].After.Incarnation)
+	}
+	// The last change takes the value after it from the current state
+	if accountChanges, err = AccountHistory(db, addr, 4, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(accountChanges) != 1 || accountChanges[0].After.Balance.ToInt().Uint64() != 40 {
+		t.Errorf("wrong latest account change: %s", dumper.Sdump(accountChanges))
+	}
+
+	storageChanges, err := StorageHistory(db, addr, state.FirstContractIncarnation, key, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []StorageChange{
+		{Block: 1, Before: common.Hash{}, After: common.Hash{0x01}},
+		{Block: 3, Before: common.Hash{0x01}, After: common.Hash{0x03}},
+	}
+	if !reflect.DeepEqual(storageChanges, expected) {
+		t.Errorf("wrong storage changes: got %s, want %s", dumper.Sdump(storageChanges), dumper.Sdump(expected))
+	}
+	if storageChanges, err = StorageHistory(db, addr, state.FirstContractIncarnation, key, 2, 2); err != nil || len(storageChanges) != 0 {
+		t.Errorf("expected no storage changes, got %s, %v", dumper.Sdump(storageChanges), err)
+	}
+}
+
+func TestStateDiff(t *testing.T) {
+	var (
+		db     = ethdb.NewMemDatabase()
+		tds, _ = state.NewTrieDbState(common.Hash{}, db, 0)
+		addr1  = common.Address{0x01}
+		addr2  = common.Address{0x02}
+		key    = common.Hash{0x03}
+	)
+	tds.EnablePreimages(true)
+	// Block 1 creates the contract with a storage slot, block 2 changes
+	// the slot and creates another account
+	for blockNr := uint64(1); blockNr <= 2; blockNr++ {
+		tds.StartNewBuffer()
+		statedb := state.New(tds)
+		if blockNr == 1 {
+			statedb.SetBalance(addr1, big.NewInt(10))
+			statedb.SetIncarnation(addr1, state.FirstContractIncarnation)
+		} else {
+			statedb.SetBalance(addr2, big.NewInt(20))
+		}
+		statedb.SetState(addr1, key, common.Hash{byte(blockNr)})
+		if err := statedb.FinalizeTx(context.Background(), tds.TrieStateWriter()); err != nil {
+			t.Fatal("error while finalising state", err)
+		}
+		if _, err := tds.ComputeTrieRoots(); err != nil {
+			t.Fatal("error while computing trie roots of the state", err)
+		}
+		tds.SetBlockNr(blockNr)
+		if err := statedb.CommitBlock(context.Background(), tds.DbStateWriter()); err != nil {
+			t.Fatal("error while committing state", err)
+		}
+	}
+
+	result, err := StateDiff(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected 2 modified accounts, got %s", dumper.Sdump(result))
+	}
+	diff1 := result[crypto.Keccak256Hash(addr1[:])]
+	if diff1 == nil || diff1.Address == nil || *diff1.Address != addr1 {
+		t.Fatalf("wrong diff of the contract: %s", dumper.Sdump(diff1))
+	}
+	if diff1.Before == nil || !reflect.DeepEqual(diff1.Before, diff1.After) || diff1.After.Balance.ToInt().Int64() != 10 {
+		t.Errorf("contract account must be unchanged: %s", dumper.Sdump(diff1))
+	}
+	expected := map[common.Hash]*StorageDiff{
+		crypto.Keccak256Hash(key[:]): {Key: &key, Incarnation: hexutil.Uint64(state.FirstContractIncarnation), Before: common.Hash{0x01}, After: common.Hash{0x02}},
+	}
+	if !reflect.DeepEqual(diff1.Storage, expected) {
+		t.Errorf("wrong storage diff: got %s, want %s", dumper.Sdump(diff1.Storage), dumper.Sdump(expected))
+	}
+	diff2 := result[crypto.Keccak256Hash(addr2[:])]
+	if diff2 == nil || diff2.Before != nil || diff2.After == nil || diff2.After.Balance.ToInt().Int64() != 20 || len(diff2.Storage) != 0 {
+		t.Errorf("wrong diff of the created account: %s", dumper.Sdump(diff2))
+	}
+
+	// The first block creates the contract
+	if result, err = StateDiff(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if diff := result[crypto.Keccak256Hash(addr1[:])]; diff == nil || diff.Before != nil || diff.After == nil || diff.Storage[crypto.Keccak256Hash(key[:])].After != (common.Hash{0x01}) {
+		t.Errorf("wrong diff of the contract creation: %s", dumper.Sdump(result))
+	}
+}
@@ -0,0 +1,638 @@
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/rpc"
+)
+
+// PrivateTraceAPI is the collection of the Parity compatible trace_* APIs. The transactions
+// are re-executed with the native call tracer, and trace_filter uses the call trace index
+// for the blocks it covers.
+type PrivateTraceAPI struct {
+	eth *Ethereum
+}
+
+// NewPrivateTraceAPI creates a new API definition for the trace methods of the Ethereum service.
+func NewPrivateTraceAPI(eth *Ethereum) *PrivateTraceAPI {
+	return &PrivateTraceAPI{eth: eth}
+}
+
+// ParityTrace is a call, a contract creation, a self-destruct or a block reward, in the format
+// of the Parity traces. The block and the transaction fields are omitted in the replays.
+type ParityTrace struct {
+	Action              interface{}  `json:"action"`
+	BlockHash           *common.Hash `json:"blockHash,omitempty"`
+	BlockNumber         *uint64      `json:"blockNumber,omitempty"`
+	Error               string       `json:"error,omitempty"`
+	Result              interface{}  `json:"result"`
+	Subtraces           int          `json:"subtraces"`
+	TraceAddress        []int        `json:"traceAddress"`
+	TransactionHash     *common.Hash `json:"transactionHash,omitempty"`
+	TransactionPosition *uint64      `json:"transactionPosition,omitempty"`
+	Type                string       `json:"type"`
+
+	from *common.Address // nil for the rewards, which never match the from addresses of the filters
+	to   common.Address
+}
+
+// TraceCallAction is the action of the "call" traces
+type TraceCallAction struct {
+	CallType string         `json:"callType"`
+	From     common.Address `json:"from"`
+	Gas      hexutil.Uint64 `json:"gas"`
+	Input    hexutil.Bytes  `json:"input"`
+	To       common.Address `json:"to"`
+	Value    *hexutil.Big   `json:"value"`
+}
+
+// TraceCallResult is the result of the successful "call" traces
+type TraceCallResult struct {
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Output  hexutil.Bytes  `json:"output"`
+}
+
+// TraceCreateAction is the action of the "create" traces
+type TraceCreateAction struct {
+	From  common.Address `json:"from"`
+	Gas   hexutil.Uint64 `json:"gas"`
+	Init  hexutil.Bytes  `json:"init"`
+	Value *hexutil.Big   `json:"value"`
+}
+
+// TraceCreateResult is the result of the successful "create" traces
+type TraceCreateResult struct {
+	Address common.Address `json:"address"`
+	Code    hexutil.Bytes  `json:"code"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+}
+
+// TraceSuicideAction is the action of the "suicide" traces
+type TraceSuicideAction struct {
+	Address       common.Address `json:"address"`
+	Balance       *hexutil.Big   `json:"balance"`
+	RefundAddress common.Address `json:"refundAddress"`
+}
+
+// TraceRewardAction is the action of the "reward" traces
+type TraceRewardAction struct {
+	Author     common.Address `json:"author"`
+	RewardType string         `json:"rewardType"`
+	Value      *hexutil.Big   `json:"value"`
+}
+
+// TraceResults is the result of a transaction replay, with the kinds of the traces requested
+type TraceResults struct {
+	Output          hexutil.Bytes                        `json:"output"`
+	StateDiff       map[common.Address]*TraceAccountDiff `json:"stateDiff"`
+	Trace           []*ParityTrace                       `json:"trace"`
+	VMTrace         *vm.VMTrace                          `json:"vmTrace"`
+	TransactionHash common.Hash                          `json:"transactionHash"`
+}
+
+// TraceAccountDiff is the change of an account made by a transaction, in the format of the Parity
+// stateDiff. Each field is either "=" if it has not changed, or a map from "+" (the account is born),
+// "-" (the account has died) or "*" (the value has changed) to the values. Only the storage items
+// written by the transaction are listed.
+type TraceAccountDiff struct {
+	Balance interface{}                 `json:"balance"`
+	Code    interface{}                 `json:"code"`
+	Nonce   interface{}                 `json:"nonce"`
+	Storage map[common.Hash]interface{} `json:"storage"`
+}
+
+// TraceValueChange is the value of a field changed by a transaction
+type TraceValueChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// TraceFilterRequest is the criteria of trace_filter. The traces match if they are made from any of
+// the from addresses and to any of the to addresses, empty lists matching all the addresses.
+type TraceFilterRequest struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"`
+	Count       *uint64          `json:"count"`
+}
+
+// traceTypes are the kinds of the traces collected by the replays
+type traceTypes struct {
+	trace     bool
+	vmTrace   bool
+	stateDiff bool
+}
+
+// Block returns the traces of the calls made by the transactions of the block, followed by the block rewards.
+func (api *PrivateTraceAPI) Block(ctx context.Context, blockNr rpc.BlockNumber) ([]*ParityTrace, error) {
+	block, err := api.blockByNumber(blockNr)
+	if err != nil {
+		return nil, err
+	}
+	return api.blockTraces(ctx, block)
+}
+
+// Transaction returns the traces of the calls made by the transaction.
+func (api *PrivateTraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*ParityTrace, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(api.eth.ChainDb(), hash)
+	if tx == nil {
+		return nil, fmt.Errorf("transaction %#x not found", hash)
+	}
+	block := api.eth.blockchain.GetBlock(blockHash, blockNumber)
+	if block == nil {
+		return nil, fmt.Errorf("block %#x not found", blockHash)
+	}
+	results, err := api.replayTransactions(ctx, block, int(index), traceTypes{trace: true})
+	if err != nil {
+		return nil, err
+	}
+	traces := results[0].Trace
+	for _, trace := range traces {
+		setTraceLocation(trace, block, hash, index)
+	}
+	return traces, nil
+}
+
+// ReplayBlockTransactions re-executes the transactions of the block and returns the requested kinds
+// of their traces: "trace", "vmTrace" and "stateDiff".
+func (api *PrivateTraceAPI) ReplayBlockTransactions(ctx context.Context, blockNr rpc.BlockNumber, types []string) ([]*TraceResults, error) {
+	var tt traceTypes
+	for _, t := range types {
+		switch t {
+		case "trace":
+			tt.trace = true
+		case "vmTrace":
+			tt.vmTrace = true
+		case "stateDiff":
+			tt.stateDiff = true
+		default:
+			return nil, fmt.Errorf("unknown trace type %q", t)
+		}
+	}
+	block, err := api.blockByNumber(blockNr)
+	if err != nil {
+		return nil, err
+	}
+	return api.replayTransactions(ctx, block, -1, tt)
+}
+
+// Filter returns the traces of the blocks within the range matching the from and to addresses.
+// The blocks covered by the call trace index are only re-executed if they may contain matching traces.
+func (api *PrivateTraceAPI) Filter(ctx context.Context, req TraceFilterRequest) ([]*ParityTrace, error) {
+	head := api.eth.blockchain.CurrentBlock().NumberU64()
+	begin, end := head, head
+	if req.FromBlock != nil && *req.FromBlock >= 0 {
+		begin = uint64(*req.FromBlock)
+	}
+	if req.ToBlock != nil && *req.ToBlock >= 0 {
+		end = uint64(*req.ToBlock)
+	}
+	if end > head {
+		end = head
+	}
+	if begin > end {
+		return nil, fmt.Errorf("invalid block range #%d - #%d", begin, end)
+	}
+	var blocks []uint64
+	indexed := begin
+	if start := rawdb.ReadCallTraceIndexStart(api.eth.ChainDb()); start != nil && (len(req.FromAddress) > 0 || len(req.ToAddress) > 0) {
+		if *start > indexed {
+			indexed = *start
+		}
+	} else {
+		indexed = end + 1
+	}
+	for number := begin; number < indexed && number <= end; number++ {
+		blocks = append(blocks, number)
+	}
+	if indexed <= end {
+		found, err := rawdb.FindCallTraceBlocks(api.eth.ChainDb(), req.FromAddress, req.ToAddress, indexed, end)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, found...)
+	}
+	var (
+		traces  []*ParityTrace
+		skipped uint64
+	)
+	for _, number := range blocks {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		block := api.eth.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		blockTraces, err := api.blockTraces(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range blockTraces {
+			if !req.matches(trace) {
+				continue
+			}
+			if req.After != nil && skipped < *req.After {
+				skipped++
+				continue
+			}
+			traces = append(traces, trace)
+			if req.Count != nil && uint64(len(traces)) >= *req.Count {
+				return traces, nil
+			}
+		}
+	}
+	return traces, nil
+}
+
+// matches checks whether the trace is made from and to the addresses of the filter
+func (req *TraceFilterRequest) matches(trace *ParityTrace) bool {
+	if len(req.FromAddress) > 0 {
+		if trace.from == nil || !containsAddress(req.FromAddress, *trace.from) {
+			return false
+		}
+	}
+	return len(req.ToAddress) == 0 || containsAddress(req.ToAddress, trace.to)
+}
+
+func containsAddress(addresses []common.Address, addr common.Address) bool {
+	for _, a := range addresses {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *PrivateTraceAPI) blockByNumber(number rpc.BlockNumber) (*types.Block, error) {
+	var block *types.Block
+	switch number {
+	case rpc.PendingBlockNumber:
+		block = api.eth.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return block, nil
+}
+
+// blockTraces returns the call traces of all the transactions of the block, followed by the block rewards
+func (api *PrivateTraceAPI) blockTraces(ctx context.Context, block *types.Block) ([]*ParityTrace, error) {
+	var traces []*ParityTrace
+	if block.NumberU64() > 0 {
+		results, err := api.replayTransactions(ctx, block, -1, traceTypes{trace: true})
+		if err != nil {
+			return nil, err
+		}
+		for i, result := range results {
+			for _, trace := range result.Trace {
+				setTraceLocation(trace, block, result.TransactionHash, uint64(i))
+				traces = append(traces, trace)
+			}
+		}
+	}
+	return append(traces, api.rewardTraces(block)...), nil
+}
+
+// rewardTraces returns the traces of the rewards of the miner and the uncle miners, which are only paid by ethash
+func (api *PrivateTraceAPI) rewardTraces(block *types.Block) []*ParityTrace {
+	if _, ok := api.eth.engine.(*ethash.Ethash); !ok || block.NumberU64() == 0 {
+		return nil
+	}
+	minerReward, uncleRewards := ethash.AccumulateRewards(api.eth.blockchain.Config(), block.Header(), block.Uncles())
+	reward := func(author common.Address, rewardType string, value *big.Int) *ParityTrace {
+		hash, number := block.Hash(), block.NumberU64()
+		return &ParityTrace{
+			Action:       &TraceRewardAction{Author: author, RewardType: rewardType, Value: (*hexutil.Big)(value)},
+			BlockHash:    &hash,
+			BlockNumber:  &number,
+			TraceAddress: []int{},
+			Type:         "reward",
+			to:           author,
+		}
+	}
+	traces := []*ParityTrace{reward(block.Coinbase(), "block", minerReward)}
+	for i, uncle := range block.Uncles() {
+		traces = append(traces, reward(uncle.Coinbase, "uncle", uncleRewards[i]))
+	}
+	return traces
+}
+
+func setTraceLocation(trace *ParityTrace, block *types.Block, txHash common.Hash, txIndex uint64) {
+	hash, number := block.Hash(), block.NumberU64()
+	trace.BlockHash = &hash
+	trace.BlockNumber = &number
+	trace.TransactionHash = &txHash
+	trace.TransactionPosition = &txIndex
+}
+
+// replayTransactions re-executes the transactions of the block on top of the state of its parent,
+// and collects the requested kinds of the traces. If the index is not negative, only the
+// transactions up to the indexed one are executed, and only the indexed one is traced.
+func (api *PrivateTraceAPI) replayTransactions(ctx context.Context, block *types.Block, index int, tt traceTypes) ([]*TraceResults, error) {
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	var (
+		chainConfig      = api.eth.blockchain.Config()
+		statedb, dbstate = ComputeIntraBlockState(api.eth.ChainDb(), parent)
+		signer           = types.MakeSigner(chainConfig, block.Number())
+		eip158           = chainConfig.IsEIP158(block.Number())
+		results          []*TraceResults
+	)
+	for i, tx := range block.Transactions() {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if index >= 0 && i > index {
+			break
+		}
+		msg, _ := tx.AsMessage(signer)
+		vmctx := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+
+		if index >= 0 && i < index {
+			vmenv := vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{})
+			if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+				return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+			}
+			_ = statedb.FinalizeTx(chainConfig.WithEIPsFlags(context.Background(), block.Number()), dbstate)
+			continue
+		}
+		result, err := traceTransaction(statedb, msg, vmctx, chainConfig, tt, eip158)
+		if err != nil {
+			return nil, fmt.Errorf("tracing transaction %#x failed: %v", tx.Hash(), err)
+		}
+		result.TransactionHash = tx.Hash()
+		results = append(results, result)
+		_ = statedb.FinalizeTx(chainConfig.WithEIPsFlags(context.Background(), block.Number()), dbstate)
+	}
+	if index >= 0 && len(results) == 0 {
+		return nil, fmt.Errorf("transaction index %d out of range for block %#x", index, block.Hash())
+	}
+	return results, nil
+}
+
+// traceTransaction executes the message with the tracers collecting the requested kinds of the traces.
+// To compute the state diff, the message is executed twice: the state after the first execution is
+// compared with the state reverted to the snapshot taken before it.
+func traceTransaction(statedb *state.IntraBlockState, msg core.Message, vmctx vm.Context, chainConfig *params.ChainConfig, tt traceTypes, eip158 bool) (*TraceResults, error) {
+	callTracer := vm.NewCallTracer()
+	tracers := multiTracer{callTracer}
+	var vmTracer *vm.VMTracer
+	if tt.vmTrace {
+		vmTracer = vm.NewVMTracer()
+		tracers = append(tracers, vmTracer)
+	}
+	snapshot := statedb.Snapshot()
+	if tt.stateDiff {
+		statedb.SetTracer(callTracer)
+	}
+	vmenv := vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{Debug: true, Tracer: tracers})
+	ret, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+	statedb.SetTracer(nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &TraceResults{Output: ret, Trace: []*ParityTrace{}}
+	if tt.trace && callTracer.Root() != nil {
+		result.Trace = flattenCallFrame(callTracer.Root(), []int{}, nil)
+	}
+	if tt.vmTrace {
+		result.VMTrace = vmTracer.Trace()
+	}
+	if tt.stateDiff {
+		storage := callTracer.StorageWritten()
+		accounts := make(map[common.Address]struct{})
+		for addr := range callTracer.AccountsWritten() {
+			accounts[addr] = struct{}{}
+		}
+		for addr := range storage {
+			accounts[addr] = struct{}{}
+		}
+		after := make(map[common.Address]*accountState, len(accounts))
+		for addr := range accounts {
+			after[addr] = readAccountState(statedb, addr, storage[addr], true, eip158)
+		}
+		statedb.RevertToSnapshot(snapshot)
+		result.StateDiff = make(map[common.Address]*TraceAccountDiff)
+		for addr := range accounts {
+			if diff := diffAccount(readAccountState(statedb, addr, storage[addr], false, eip158), after[addr]); diff != nil {
+				result.StateDiff[addr] = diff
+			}
+		}
+		// Re-execute the message to restore the state after it
+		vmenv = vm.NewEVM(vmctx, statedb, chainConfig, vm.Config{})
+		if _, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas())); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// flattenCallFrame appends the traces of the call frame and of its sub-calls, in the depth-first order
+func flattenCallFrame(frame *vm.CallFrame, traceAddress []int, traces []*ParityTrace) []*ParityTrace {
+	from := frame.From
+	trace := &ParityTrace{
+		Error:        frame.ErrorString(),
+		Subtraces:    len(frame.Calls),
+		TraceAddress: traceAddress,
+		from:         &from,
+		to:           frame.To,
+	}
+	switch frame.Type {
+	case vm.CREATE, vm.CREATE2:
+		trace.Type = "create"
+		trace.Action = &TraceCreateAction{From: frame.From, Gas: hexutil.Uint64(frame.Gas), Init: frame.Input, Value: (*hexutil.Big)(frame.Value)}
+		if frame.Err == nil {
+			trace.Result = &TraceCreateResult{Address: frame.To, Code: frame.Output, GasUsed: hexutil.Uint64(frame.GasUsed)}
+		}
+	case vm.SELFDESTRUCT:
+		trace.Type = "suicide"
+		trace.Action = &TraceSuicideAction{Address: frame.From, Balance: (*hexutil.Big)(frame.Value), RefundAddress: frame.To}
+	default:
+		trace.Type = "call"
+		trace.Action = &TraceCallAction{
+			CallType: strings.ToLower(frame.Type.String()),
+			From:     frame.From,
+			Gas:      hexutil.Uint64(frame.Gas),
+			Input:    frame.Input,
+			To:       frame.To,
+			Value:    (*hexutil.Big)(frame.Value),
+		}
+		if frame.Err == nil {
+			trace.Result = &TraceCallResult{GasUsed: hexutil.Uint64(frame.GasUsed), Output: frame.Output}
+		}
+	}
+	traces = append(traces, trace)
+	for i, call := range frame.Calls {
+		subAddress := make([]int, len(traceAddress)+1)
+		copy(subAddress, traceAddress)
+		subAddress[len(traceAddress)] = i
+		traces = flattenCallFrame(call, subAddress, traces)
+	}
+	return traces
+}
+
+// accountState is the state of an account compared by the state diffs
+type accountState struct {
+	exists  bool
+	balance *big.Int
+	nonce   uint64
+	code    []byte
+	storage map[common.Hash]common.Hash
+}
+
+// readAccountState reads the account and the given storage items. After the transaction, the accounts
+// self-destructed and, since EIP-158, the empty ones, are considered not to exist.
+func readAccountState(statedb *state.IntraBlockState, addr common.Address, keys map[common.Hash]struct{}, after bool, eip158 bool) *accountState {
+	s := &accountState{balance: new(big.Int), storage: make(map[common.Hash]common.Hash)}
+	s.exists = statedb.Exist(addr)
+	if after && s.exists && (statedb.HasSuicided(addr) || (eip158 && statedb.Empty(addr))) {
+		s.exists = false
+	}
+	if !s.exists {
+		return s
+	}
+	s.balance.Set(statedb.GetBalance(addr))
+	s.nonce = statedb.GetNonce(addr)
+	s.code = common.CopyBytes(statedb.GetCode(addr))
+	for key := range keys {
+		s.storage[key] = statedb.GetState(addr, key)
+	}
+	return s
+}
+
+// diffAccount compares the states of the account before and after the transaction, returning nil if it has not changed
+func diffAccount(before, after *accountState) *TraceAccountDiff {
+	if !before.exists && !after.exists {
+		return nil
+	}
+	diff := &TraceAccountDiff{Storage: make(map[common.Hash]interface{})}
+	switch {
+	case !before.exists || !after.exists:
+		marker, s := "+", after
+		if before.exists {
+			marker, s = "-", before
+		}
+		diff.Balance = map[string]interface{}{marker: (*hexutil.Big)(s.balance)}
+		diff.Nonce = map[string]interface{}{marker: hexutil.Uint64(s.nonce)}
+		diff.Code = map[string]interface{}{marker: hexutil.Bytes(s.code)}
+		for key, value := range s.storage {
+			if value != (common.Hash{}) {
+				diff.Storage[key] = map[string]interface{}{marker: value}
+			}
+		}
+		return diff
+	}
+	changed := false
+	field := func(equal bool, from, to interface{}) interface{} {
+		if equal {
+			return "="
+		}
+		changed = true
+		return map[string]*TraceValueChange{"*": {From: from, To: to}}
+	}
+	diff.Balance = field(before.balance.Cmp(after.balance) == 0, (*hexutil.Big)(before.balance), (*hexutil.Big)(after.balance))
+	diff.Nonce = field(before.nonce == after.nonce, hexutil.Uint64(before.nonce), hexutil.Uint64(after.nonce))
+	diff.Code = field(string(before.code) == string(after.code), hexutil.Bytes(before.code), hexutil.Bytes(after.code))
+	for key, value := range after.storage {
+		if before.storage[key] != value {
+			diff.Storage[key] = field(false, before.storage[key], value)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return diff
+}
+
+// multiTracer passes the events of the EVM to several tracers
+type multiTracer []vm.Tracer
+
+func (mt multiTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	for _, t := range mt {
+		if err := t.CaptureStart(depth, from, to, create, input, gas, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt multiTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	for _, t := range mt {
+		if err := t.CaptureState(env, pc, op, gas, cost, memory, stack, contract, depth, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt multiTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	for _, t := range mt {
+		if err := t.CaptureFault(env, pc, op, gas, cost, memory, stack, contract, depth, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt multiTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	for _, t := range mt {
+		if err := t.CaptureEnd(depth, output, gasUsed, d, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt multiTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	for _, t := range mt {
+		if err := t.CaptureCreate(creator, creation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt multiTracer) CaptureAccountRead(account common.Address) error {
+	for _, t := range mt {
+		if err := t.CaptureAccountRead(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt multiTracer) CaptureAccountWrite(account common.Address) error {
+	for _, t := range mt {
+		if err := t.CaptureAccountWrite(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
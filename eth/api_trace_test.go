@@ -0,0 +1,92 @@
+package eth
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// Tests that the call frames are flattened in the depth-first order with their trace addresses.
+func TestFlattenCallFrame(t *testing.T) {
+	var (
+		addrA = common.HexToAddress("0x0a")
+		addrB = common.HexToAddress("0x0b")
+		addrC = common.HexToAddress("0x0c")
+	)
+	root := &vm.CallFrame{Type: vm.CALL, From: addrA, To: addrB, Value: new(big.Int), Calls: []*vm.CallFrame{
+		{Type: vm.DELEGATECALL, From: addrB, To: addrC, Value: new(big.Int), Calls: []*vm.CallFrame{
+			{Type: vm.CREATE2, From: addrB, To: addrA, Value: new(big.Int)},
+		}},
+		{Type: vm.STATICCALL, From: addrB, To: addrC, Value: new(big.Int), Err: vm.ErrOutOfGas},
+		{Type: vm.SELFDESTRUCT, From: addrB, To: addrA, Value: big.NewInt(7)},
+	}}
+	traces := flattenCallFrame(root, []int{}, nil)
+
+	want := []struct {
+		typ          string
+		traceAddress []int
+		subtraces    int
+		err          string
+	}{
+		{"call", []int{}, 3, ""},
+		{"call", []int{0}, 1, ""},
+		{"create", []int{0, 0}, 0, ""},
+		{"call", []int{1}, 0, "Out of gas"},
+		{"suicide", []int{2}, 0, ""},
+	}
+	if len(traces) != len(want) {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), len(want))
+	}
+	for i, w := range want {
+		trace := traces[i]
+		if trace.Type != w.typ || !reflect.DeepEqual(trace.TraceAddress, w.traceAddress) || trace.Subtraces != w.subtraces || trace.Error != w.err {
+			t.Errorf("trace %d mismatch: have %s %v %d %q, want %s %v %d %q", i, trace.Type, trace.TraceAddress, trace.Subtraces, trace.Error, w.typ, w.traceAddress, w.subtraces, w.err)
+		}
+	}
+	if action := traces[1].Action.(*TraceCallAction); action.CallType != "delegatecall" {
+		t.Errorf("call type mismatch: have %s, want delegatecall", action.CallType)
+	}
+	if traces[3].Result != nil {
+		t.Errorf("failed call has a result: %v", traces[3].Result)
+	}
+	if action := traces[4].Action.(*TraceSuicideAction); action.RefundAddress != addrA || action.Balance.ToInt().Int64() != 7 {
+		t.Errorf("suicide action mismatch: %+v", action)
+	}
+}
+
+// Tests the state diffs of the accounts born, died and changed.
+func TestDiffAccount(t *testing.T) {
+	key := common.HexToHash("0x01")
+	missing := &accountState{balance: new(big.Int), storage: map[common.Hash]common.Hash{}}
+	existing := &accountState{exists: true, balance: big.NewInt(10), nonce: 1, storage: map[common.Hash]common.Hash{key: common.HexToHash("0x05")}}
+	changed := &accountState{exists: true, balance: big.NewInt(8), nonce: 1, storage: map[common.Hash]common.Hash{key: common.HexToHash("0x06")}}
+
+	if diff := diffAccount(missing, missing); diff != nil {
+		t.Errorf("diff of a missing account: %+v", diff)
+	}
+	if diff := diffAccount(existing, existing); diff != nil {
+		t.Errorf("diff of an unchanged account: %+v", diff)
+	}
+	born := diffAccount(missing, existing)
+	if born == nil || !reflect.DeepEqual(born.Nonce, map[string]interface{}{"+": hexutil.Uint64(1)}) || len(born.Storage) != 1 {
+		t.Errorf("diff of a born account mismatch: %+v", born)
+	}
+	died := diffAccount(existing, missing)
+	if died == nil || !reflect.DeepEqual(died.Balance, map[string]interface{}{"-": (*hexutil.Big)(big.NewInt(10))}) {
+		t.Errorf("diff of a died account mismatch: %+v", died)
+	}
+	diff := diffAccount(existing, changed)
+	if diff == nil || diff.Nonce != "=" || diff.Code != "=" {
+		t.Fatalf("diff of a changed account mismatch: %+v", diff)
+	}
+	if balance := diff.Balance.(map[string]*TraceValueChange)["*"]; balance.From.(*hexutil.Big).ToInt().Int64() != 10 || balance.To.(*hexutil.Big).ToInt().Int64() != 8 {
+		t.Errorf("balance change mismatch: %+v", balance)
+	}
+	if _, ok := diff.Storage[key]; !ok {
+		t.Errorf("storage change missing: %+v", diff.Storage)
+	}
+}
@@ -189,6 +189,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 			DownloadOnly:        config.DownloadOnly,
 			NoHistory:           !config.StorageMode.History,
 			ArchiveSyncInterval: uint64(config.ArchiveSyncInterval),
+			RetentionPolicy:     retentionPolicy(config),
 		}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve)
@@ -199,6 +200,13 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	eth.blockchain.EnableReceipts(config.StorageMode.Receipts)
 	eth.blockchain.EnableTxLookupIndex(config.StorageMode.TxIndex)
 	eth.blockchain.EnablePreimages(config.StorageMode.Preimages)
+	eth.blockchain.EnableLogIndex(config.StorageMode.LogIndex)
+	eth.blockchain.EnableCallTraceIndex(config.StorageMode.CallTraceIndex)
+	eth.blockchain.EnableAccessLists(config.StorageMode.AccessLists)
+	eth.blockchain.EnableWitnessCache(config.ServeWitnesses)
+	eth.blockchain.SetWitnessRetention(config.WitnessRetention)
+	eth.blockchain.EnableBinaryTrie(config.BinaryTrie)
+	eth.blockchain.SetParallelExecution(config.ParallelExecution)
 
 	// Rewind the chain in case of an incompatible config upgrade.
 	if compat, ok := genesisErr.(*params.ConfigCompatError); ok {
@@ -252,6 +260,24 @@ func makeExtraData(extra []byte) []byte {
 	return extra
 }
 
+// retentionPolicy returns the parts of the history, which the pruner keeps, or nil if it keeps none.
+func retentionPolicy(config *Config) core.RetentionPolicy {
+	var policies core.RetentionPolicies
+	if len(config.PruningWatchAddresses) > 0 {
+		policies = append(policies, core.NewWatchedAddressesPolicy(config.PruningWatchAddresses...))
+	}
+	if config.PruningCheckpoints > 0 {
+		policies = append(policies, core.CheckpointPolicy(config.PruningCheckpoints))
+	}
+	if config.PruningKeepAbove > 0 {
+		policies = append(policies, core.KeepAbovePolicy(config.PruningKeepAbove))
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	return policies
+}
+
 // CreateDB creates the chain database.
 func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Database, error) {
 	db, err := ctx.OpenDatabase(name)
@@ -349,6 +375,10 @@ func (s *Ethereum) APIs() []rpc.API {
 			Namespace: "debug",
 			Version:   "1.0",
 			Service:   NewPrivateDebugAPI(s),
+		}, {
+			Namespace: "trace",
+			Version:   "1.0",
+			Service:   NewPrivateTraceAPI(s),
 		}, {
 			Namespace: "net",
 			Version:   "1.0",
@@ -535,6 +565,8 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 
 	// Firehose
 	protos = append(protos, s.protocolManager.makeFirehoseProtocol())
+	// Witness
+	protos = append(protos, s.protocolManager.makeWitnessProtocol())
 
 	if s.lesServer != nil {
 		protos = append(protos, s.lesServer.Protocols()...)
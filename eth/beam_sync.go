@@ -0,0 +1,180 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+var errNoFirehosePeers = errors.New("no firehose peers to fetch the state from")
+
+// beamFetchTimeout is the time allowance for fetching one part of the state from all of the firehose peers.
+var beamFetchTimeout = time.Minute
+
+// beamFetcher implements state.StateFetcher by requesting the missing parts
+// of the state from the firehose peers. It is used in beam sync mode.
+type beamFetcher struct {
+	peers     *firehosePeerSet
+	getHeader func(number uint64) *types.Header // retrieves the canonical header by number
+}
+
+func newBeamFetcher(pm *ProtocolManager) *beamFetcher {
+	return &beamFetcher{
+		peers:     pm.firehosePeers,
+		getHeader: pm.blockchain.GetHeaderByNumber,
+	}
+}
+
+// blockHash returns the hash of the canonical block, as of which the state is requested.
+func (f *beamFetcher) blockHash(blockNr uint64) (common.Hash, error) {
+	header := f.getHeader(blockNr)
+	if header == nil {
+		return common.Hash{}, fmt.Errorf("unknown canonical block %d", blockNr)
+	}
+	return header.Hash(), nil
+}
+
+// request sends the request to the firehose peers one by one, until the response
+// from one of them is processed successfully, the context is cancelled or beamFetchTimeout passes.
+func (f *beamFetcher) request(ctx context.Context, send func(*firehosePeer) (*firehoseRequest, error), process func(interface{}) error) error {
+	peers := f.peers.Peers()
+	if len(peers) == 0 {
+		return errNoFirehosePeers
+	}
+	ctx, cancel := context.WithTimeout(ctx, beamFetchTimeout)
+	defer cancel()
+	var err error
+	for _, p := range peers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var req *firehoseRequest
+		if req, err = send(p); err != nil {
+			log.Debug("Beam sync request failed", "peer", p.id, "err", err)
+			continue
+		}
+		var response interface{}
+		if response, err = p.wait(ctx, req); err != nil {
+			log.Debug("Beam sync request failed", "peer", p.id, "err", err)
+			continue
+		}
+		if err = process(response); err != nil {
+			log.Debug("Beam sync response rejected", "peer", p.id, "err", err)
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+func (f *beamFetcher) FetchAccountRange(ctx context.Context, db ethdb.Putter, blockNr uint64, hexPrefix []byte, hash []byte) (bool, error) {
+	block, err := f.blockHash(blockNr)
+	if err != nil {
+		return false, err
+	}
+	task := firehoseTask{hex: hexPrefix, ref: hash}
+	var complete bool
+	err = f.request(ctx, func(p *firehosePeer) (*firehoseRequest, error) {
+		return p.RequestStateRanges(block, []trie.Keybytes{hexToKeybytes(hexPrefix)})
+	}, func(response interface{}) error {
+		entry := response.(*stateRangesMsg).Entries[0]
+		switch entry.Status {
+		case OK:
+			if err := processAccountRange(db, task, entry.Leaves); err != nil {
+				return err
+			}
+			complete = true
+			return nil
+		case TooManyLeaves:
+			return nil
+		default:
+			return errFirehoseNoData
+		}
+	})
+	return complete, err
+}
+
+func (f *beamFetcher) FetchAccountNode(ctx context.Context, blockNr uint64, hexPrefix []byte) ([]byte, error) {
+	block, err := f.blockHash(blockNr)
+	if err != nil {
+		return nil, err
+	}
+	var node []byte
+	err = f.request(ctx, func(p *firehosePeer) (*firehoseRequest, error) {
+		return p.RequestStateNodes(block, []trie.Keybytes{hexToKeybytes(hexPrefix)})
+	}, func(response interface{}) error {
+		if node = response.(*stateNodesMsg).Nodes[0]; len(node) == 0 {
+			return errFirehoseNoData
+		}
+		return nil
+	})
+	return node, err
+}
+
+func (f *beamFetcher) FetchStorageRange(ctx context.Context, db ethdb.Putter, blockNr uint64, addrHash common.Hash, incarnation uint64, hexPrefix []byte, hash []byte) (bool, error) {
+	block, err := f.blockHash(blockNr)
+	if err != nil {
+		return false, err
+	}
+	task := firehoseTask{addrHash: addrHash, hex: hexPrefix, ref: hash}
+	requests, _ := storageRequests([]firehoseTask{task})
+	var complete bool
+	err = f.request(ctx, func(p *firehosePeer) (*firehoseRequest, error) {
+		return p.RequestStorageRanges(block, requests)
+	}, func(response interface{}) error {
+		entry := response.(*storageRangesMsg).Entries[0][0]
+		switch entry.Status {
+		case OK:
+			if err := processStorageRange(db, task, incarnation, entry.Leaves); err != nil {
+				return err
+			}
+			complete = true
+			return nil
+		case TooManyLeaves:
+			return nil
+		default:
+			return errFirehoseNoData
+		}
+	})
+	return complete, err
+}
+
+func (f *beamFetcher) FetchStorageNode(ctx context.Context, blockNr uint64, addrHash common.Hash, hexPrefix []byte) ([]byte, error) {
+	block, err := f.blockHash(blockNr)
+	if err != nil {
+		return nil, err
+	}
+	requests, _ := storageRequests([]firehoseTask{{addrHash: addrHash, hex: hexPrefix}})
+	var node []byte
+	err = f.request(ctx, func(p *firehosePeer) (*firehoseRequest, error) {
+		return p.RequestStorageNodes(block, requests)
+	}, func(response interface{}) error {
+		if node = response.(*storageNodesMsg).Nodes[0][0]; len(node) == 0 {
+			return errFirehoseNoData
+		}
+		return nil
+	})
+	return node, err
+}
+
+func (f *beamFetcher) FetchCode(ctx context.Context, db ethdb.Putter, _ uint64, address common.Address, codeHash common.Hash) error {
+	refs := []bytecodeRef{{Account: common.CopyBytes(address[:]), CodeHash: codeHash}}
+	return f.request(ctx, func(p *firehosePeer) (*firehoseRequest, error) {
+		return p.RequestBytecode(refs)
+	}, func(response interface{}) error {
+		code := response.(*bytecodeMsg).Code
+		if len(code) == 0 || len(code[0]) == 0 {
+			return errFirehoseNoData
+		}
+		// The hash of the bytecode is verified when the response is delivered
+		return db.Put(dbutils.CodeBucket, codeHash[:], code[0])
+	})
+}
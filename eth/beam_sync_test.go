@@ -0,0 +1,127 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/downloader"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/p2p/enode"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// executeBeamBlock executes the head block of the server's chain without any local state,
+// fetching the state from the server on demand.
+func executeBeamBlock(t *testing.T, pm *ProtocolManager) ethdb.Database {
+	clientPeer, disconnect := connectFirehose(t, pm)
+	defer disconnect()
+	peers := newFirehosePeerSet()
+	require.NoError(t, peers.Register(clientPeer))
+	fetcher := &beamFetcher{peers: peers, getHeader: pm.blockchain.GetHeaderByNumber}
+
+	block := pm.blockchain.CurrentBlock()
+	parent := pm.blockchain.GetBlockByHash(block.ParentHash())
+	db := ethdb.NewMemDatabase()
+	tds, err := state.NewTrieDbState(parent.Root(), db, parent.NumberU64())
+	require.NoError(t, err)
+	tds.SetStateFetcher(fetcher)
+
+	statedb := state.New(tds)
+	receipts, _, usedGas, err := pm.blockchain.Processor().Process(block, statedb, tds, vm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, pm.blockchain.Validator().ValidateState(block, parent, statedb, tds, receipts, usedGas))
+	return db
+}
+
+func TestBeamSyncAccounts(t *testing.T) {
+	pm, peer := setUpDummyAccountsForFirehose(t)
+	peer.close()
+
+	db := executeBeamBlock(t, pm)
+	// The state of the parent block has been fetched
+	enc, err := db.Get(dbutils.AccountsBucket, addrHash[3][:])
+	require.NoError(t, err)
+	var acc accounts.Account
+	require.NoError(t, acc.DecodeForStorage(enc))
+	assert.Equal(t, frhsAmnt, &acc.Balance)
+}
+
+func TestBeamSyncStorage(t *testing.T) {
+	for _, setUp := range []func(*testing.T) (*ProtocolManager, *testFirehosePeer, common.Address){
+		setUpStorageContractForFirehoseA,
+		setUpStorageContractForFirehoseB,
+	} {
+		pm, peer, addr := setUp(t)
+		peer.close()
+		code, err := pm.blockchain.ByteCode(addr)
+		require.NoError(t, err)
+
+		db := executeBeamBlock(t, pm)
+		// The code of the called contract has been fetched
+		fetched, err := db.Get(dbutils.CodeBucket, crypto.Keccak256(code))
+		require.NoError(t, err)
+		assert.Equal(t, code, fetched)
+	}
+}
+
+func TestBeamSyncTooManyLeaves(t *testing.T) {
+	signer := types.HomesteadSigner{}
+	amount := big.NewInt(10)
+	generator := func(i int, block *core.BlockGen) {
+		var rndAddr common.Address
+		// #nosec G404
+		rand.Read(rndAddr[:])
+
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(testBank), rndAddr, amount, params.TxGas, nil, nil), signer, testBankKey)
+		assert.NoError(t, err)
+		block.AddTx(tx)
+	}
+
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, MaxLeavesPerPrefix, generator, nil)
+	// The accounts trie is too large to be fetched as a single range, so the nodes are fetched first
+	executeBeamBlock(t, pm)
+}
+
+func TestBeamSyncFetchCancelled(t *testing.T) {
+	// The peer reads the requests, but never replies
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+	go func() {
+		for {
+			msg, err := net.ReadMsg()
+			if err != nil {
+				return
+			}
+			msg.Discard()
+		}
+	}()
+	peers := newFirehosePeerSet()
+	require.NoError(t, peers.Register(newFirehosePeer(p2p.NewPeer(enode.ID{1}, "silent", nil), app)))
+	fetcher := &beamFetcher{peers: peers, getHeader: func(uint64) *types.Header { return &types.Header{} }}
+
+	// Cancelled insertion aborts the fetch
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := fetcher.FetchAccountNode(ctx, 1, []byte{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The total time of the fetch is bounded even if the insertion isn't cancelled
+	defer func(timeout time.Duration) { beamFetchTimeout = timeout }(beamFetchTimeout)
+	beamFetchTimeout = 50 * time.Millisecond
+	_, err = fetcher.FetchAccountNode(context.Background(), 1, []byte{})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
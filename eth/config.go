@@ -87,19 +87,31 @@ func init() {
 }
 
 type StorageMode struct {
-	History   bool
-	Receipts  bool
-	TxIndex   bool
-	Preimages bool
+	History        bool
+	Receipts       bool
+	TxIndex        bool
+	Preimages      bool
+	LogIndex       bool
+	CallTraceIndex bool
+	AccessLists    bool
 }
 
 var DefaultStorageMode = StorageMode{History: true, Receipts: false, TxIndex: true, Preimages: true}
 
 func (m StorageMode) ToString() string {
 	modeString := ""
+	if m.AccessLists {
+		modeString += "a"
+	}
+	if m.CallTraceIndex {
+		modeString += "c"
+	}
 	if m.History {
 		modeString += "h"
 	}
+	if m.LogIndex {
+		modeString += "l"
+	}
 	if m.Preimages {
 		modeString += "p"
 	}
@@ -124,6 +136,12 @@ func StorageModeFromString(flags string) (StorageMode, error) {
 			mode.TxIndex = true
 		case 'p':
 			mode.Preimages = true
+		case 'l':
+			mode.LogIndex = true
+		case 'c':
+			mode.CallTraceIndex = true
+		case 'a':
+			mode.AccessLists = true
 		default:
 			return mode, fmt.Errorf("unexpected flag found: %c", flag)
 		}
@@ -156,6 +174,30 @@ type Config struct {
 	BlocksToPrune       uint64
 	PruningTimeout      time.Duration
 
+	// PruningWatchAddresses are the accounts, which history is never pruned
+	PruningWatchAddresses []common.Address
+	// PruningCheckpoints keeps the state as of every Nth block readable, 0 disables it
+	PruningCheckpoints uint64
+	// PruningKeepAbove is the block, above which the history is never pruned, 0 disables it
+	PruningKeepAbove uint64
+
+	// ServeWitnesses makes the node extract the witnesses of the inserted blocks
+	// and serve the ones of the recent blocks to the stateless peers
+	ServeWitnesses bool
+
+	// WitnessRetention is the number of the most recent blocks which witnesses
+	// are stored in the database and served via RPC, 0 disables the storing
+	WitnessRetention uint64
+
+	// BinaryTrie makes the node maintain the binary state trie alongside the hexary one
+	// and store its root for each inserted block. The binary trie is held in memory,
+	// so it is disabled if the state has more than state.MaxBinaryTrieItems items
+	BinaryTrie bool
+
+	// ParallelExecution is the number of goroutines executing the transactions of the
+	// inserted blocks concurrently, values below 2 keep the execution sequential
+	ParallelExecution int
+
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
@@ -17,6 +17,7 @@
 package downloader
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
@@ -466,6 +467,7 @@ func TestCanonicalSynchronisation64Full(t *testing.T) { testCanonicalSynchronisa
 
 //func TestCanonicalSynchronisation64Fast(t *testing.T)  { testCanonicalSynchronisation(t, 64, FastSync) }
 func TestCanonicalSynchronisation64Light(t *testing.T) { testCanonicalSynchronisation(t, 64, LightSync) }
+func TestCanonicalSynchronisation64Beam(t *testing.T)  { testCanonicalSynchronisation(t, 64, BeamSync) }
 
 func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	t.Parallel()
@@ -484,6 +486,33 @@ func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnChain(t, tester, chain.len())
 }
 
+// Tests that firehose sync downloads the state of the pivot block before executing the blocks after it.
+func TestFirehoseSynchronisation(t *testing.T) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	var synced []*types.Header
+	tester.downloader.SetStateSync(func(ctx context.Context, header *types.Header) error {
+		synced = append(synced, header)
+		return nil
+	})
+	chain := testChainBase.shorten(blockCacheItems - 15)
+	tester.newPeer("peer", 64, chain)
+
+	if err := tester.sync("peer", nil, FirehoseSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	assertOwnChain(t, tester, chain.len())
+	if len(synced) != 1 {
+		t.Fatalf("pivot state synced %d times, want 1", len(synced))
+	}
+	if have, want := synced[0].Number.Uint64(), uint64(chain.len()-1-fsMinFullBlocks); have != want {
+		t.Fatalf("pivot state block mismatch: have %d, want %d", have, want)
+	}
+}
+
 // Tests that if a large batch of blocks are being downloaded, it is throttled
 // until the cached blocks are retrieved.
 func TestThrottling62(t *testing.T)     { testThrottling(t, 62, FullSync) }
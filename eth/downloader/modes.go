@@ -22,13 +22,21 @@ import "fmt"
 type SyncMode int
 
 const (
-	FullSync  SyncMode = iota // Synchronise the entire blockchain history from full blocks
-	FastSync                  // Quickly download the headers, full sync only at the chain head
-	LightSync                 // Download only the headers and terminate afterwards
+	FullSync      SyncMode = iota // Synchronise the entire blockchain history from full blocks
+	FastSync                      // Quickly download the headers, full sync only at the chain head
+	LightSync                     // Download only the headers and terminate afterwards
+	BeamSync                      // Download the blocks like fast sync, but fetch the state on demand while executing them
+	StatelessSync                 // Download the blocks like full sync, but execute them on top of the block witnesses without keeping the state
+	FirehoseSync                  // Download the blocks like fast sync, and the state of the pivot block from the firehose peers
 )
 
 func (mode SyncMode) IsValid() bool {
-	return mode >= FullSync && mode <= LightSync
+	return mode >= FullSync && mode <= FirehoseSync
+}
+
+// hasPivot reports whether the blocks before the pivot are stored together with their receipts instead of being executed.
+func (mode SyncMode) hasPivot() bool {
+	return mode == FastSync || mode == BeamSync || mode == FirehoseSync
 }
 
 // String implements the stringer interface.
@@ -40,6 +48,12 @@ func (mode SyncMode) String() string {
 		return "fast"
 	case LightSync:
 		return "light"
+	case BeamSync:
+		return "beam"
+	case StatelessSync:
+		return "stateless"
+	case FirehoseSync:
+		return "firehose"
 	default:
 		return "unknown"
 	}
@@ -53,6 +67,12 @@ func (mode SyncMode) MarshalText() ([]byte, error) {
 		return []byte("fast"), nil
 	case LightSync:
 		return []byte("light"), nil
+	case BeamSync:
+		return []byte("beam"), nil
+	case StatelessSync:
+		return []byte("stateless"), nil
+	case FirehoseSync:
+		return []byte("firehose"), nil
 	default:
 		return nil, fmt.Errorf("unknown sync mode %d", mode)
 	}
@@ -66,8 +86,14 @@ func (mode *SyncMode) UnmarshalText(text []byte) error {
 		*mode = FastSync
 	case "light":
 		*mode = LightSync
+	case "beam":
+		*mode = BeamSync
+	case "stateless":
+		*mode = StatelessSync
+	case "firehose":
+		*mode = FirehoseSync
 	default:
-		return fmt.Errorf(`unknown sync mode %q, want "full", "fast" or "light"`, text)
+		return fmt.Errorf(`unknown sync mode %q, want "full", "fast", "light", "beam", "stateless" or "firehose"`, text)
 	}
 	return nil
 }
@@ -24,6 +24,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/bloombits"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/event"
@@ -142,6 +143,26 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	if f.end == -1 {
 		end = head
 	}
+	// Use the exact log index for the blocks it covers, if the filter has criteria
+	if start := f.logIndexStart(); start != nil && *start <= end {
+		var logs []*types.Log
+		if uint64(f.begin) < *start {
+			found, err := f.bloomLogs(ctx, *start-1)
+			if err != nil {
+				return found, err
+			}
+			logs = found
+		}
+		rest, err := f.logIndexLogs(ctx, end)
+		logs = append(logs, rest...)
+		return logs, err
+	}
+	return f.bloomLogs(ctx, end)
+}
+
+// bloomLogs returns the logs matching the filter criteria up to the given block,
+// using the bloom bits indexed sections and finishing with the non indexed blocks.
+func (f *Filter) bloomLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
 	// Gather all indexed logs, and finish with non indexed ones
 	var (
 		logs []*types.Log
@@ -210,6 +231,55 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 	}
 }
 
+// logIndexStart returns the first block covered by the log address and topic
+// index, or nil if the index is not maintained or the filter has no criteria.
+func (f *Filter) logIndexStart() *uint64 {
+	if f.db == nil {
+		return nil
+	}
+	criteria := len(f.addresses) > 0
+	for _, sub := range f.topics {
+		if len(sub) > 0 {
+			criteria = true
+		}
+	}
+	if !criteria {
+		return nil
+	}
+	return rawdb.ReadLogIndexStart(f.db)
+}
+
+// logIndexLogs returns the logs matching the filter criteria based on the log
+// address and topic index, which lists exactly the blocks with such logs.
+func (f *Filter) logIndexLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	blocks, err := rawdb.FindLogIndexBlocks(f.db, f.addresses, f.topics, uint64(f.begin), end)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for _, number := range blocks {
+		select {
+		case <-ctx.Done():
+			return logs, ctx.Err()
+		default:
+		}
+		f.begin = int64(number) + 1
+
+		// Retrieve the indexed block and pull the logs matching all criteria
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if header == nil || err != nil {
+			return logs, err
+		}
+		found, err := f.checkMatches(ctx, header)
+		if err != nil {
+			return logs, err
+		}
+		logs = append(logs, found...)
+	}
+	f.begin = int64(end) + 1
+	return logs, nil
+}
+
 // indexedLogs returns the logs matching the filter criteria based on raw block
 // iteration and bloom matching.
 func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/ledgerwatch/turbo-geth/common"
@@ -229,3 +230,87 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+func TestLogIndexFilters(t *testing.T) {
+	var (
+		db         = ethdb.NewMemDatabase()
+		mux        = new(event.TypeMux)
+		txFeed     = new(event.Feed)
+		rmLogsFeed = new(event.Feed)
+		logsFeed   = new(event.Feed)
+		chainFeed  = new(event.Feed)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr       = crypto.PubkeyToAddress(key1.PublicKey)
+		addr2      = common.BytesToAddress([]byte("jeff"))
+
+		hash1 = common.BytesToHash([]byte("topic1"))
+		hash2 = common.BytesToHash([]byte("topic2"))
+		hash3 = common.BytesToHash([]byte("topic3"))
+	)
+	defer db.Close()
+
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(context.Background(), params.TestChainConfig, genesis, ethash.NewFaker(), db, 100, func(i int, gen *core.BlockGen) {
+		var logs []*types.Log
+		switch i {
+		case 10:
+			logs = []*types.Log{{Address: addr, Topics: []common.Hash{hash1}}}
+		case 60:
+			logs = []*types.Log{{Address: addr, Topics: []common.Hash{hash2}}}
+		case 70:
+			logs = []*types.Log{{Address: addr2, Topics: []common.Hash{hash1, hash3}}}
+		case 80:
+			logs = []*types.Log{{Address: addr, Topics: []common.Hash{hash3, hash1}}}
+		default:
+			return
+		}
+		receipt := types.NewReceipt(false, 0)
+		receipt.Logs = logs
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.HexToAddress("0x1"), big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	// Only the blocks starting from #50 are covered by the log index
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+		if block.NumberU64() >= 50 {
+			var logs []*types.Log
+			for _, receipt := range receipts[i] {
+				logs = append(logs, receipt.Logs...)
+			}
+			rawdb.WriteLogIndex(db, block.Hash(), block.NumberU64(), logs)
+		}
+	}
+	rawdb.WriteLogIndexStart(db, 50)
+
+	for i, tt := range []struct {
+		begin, end int64
+		addresses  []common.Address
+		topics     [][]common.Hash
+		blocks     []uint64
+	}{
+		{0, -1, []common.Address{addr}, nil, []uint64{11, 61, 81}},
+		{0, -1, nil, [][]common.Hash{{hash1}}, []uint64{11, 71}},
+		{55, 75, nil, [][]common.Hash{{hash1}}, []uint64{71}},
+		{0, -1, []common.Address{addr}, [][]common.Hash{{hash3}}, []uint64{81}},
+		{0, -1, nil, [][]common.Hash{{hash1}, {hash3}}, []uint64{71}},
+		{0, -1, []common.Address{addr, addr2}, [][]common.Hash{nil, {hash1}}, []uint64{81}},
+		{0, 80, []common.Address{addr2}, [][]common.Hash{{hash2}}, nil},
+	} {
+		logs, err := NewRangeFilter(backend, tt.begin, tt.end, tt.addresses, tt.topics).Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		var blocks []uint64
+		for _, log := range logs {
+			blocks = append(blocks, log.BlockNumber)
+		}
+		if !reflect.DeepEqual(blocks, tt.blocks) {
+			t.Errorf("test %d: log blocks mismatch: have %v, want %v", i, blocks, tt.blocks)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package eth
 
 import (
+	"fmt"
 	"math/big"
+	"sync"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/p2p"
 	"github.com/ledgerwatch/turbo-geth/trie"
 )
@@ -55,6 +58,34 @@ const (
 type firehosePeer struct {
 	*p2p.Peer
 	rw p2p.MsgReadWriter
+	id string
+
+	lock    sync.Mutex
+	nextID  uint64
+	pending map[uint64]*firehoseRequest // requests sent to the peer and not answered yet
+	closed  chan struct{}               // closed when the peer disconnects
+}
+
+func newFirehosePeer(p *p2p.Peer, rw p2p.MsgReadWriter) *firehosePeer {
+	id := p.ID()
+	return &firehosePeer{
+		Peer:    p,
+		rw:      rw,
+		id:      fmt.Sprintf("%x", id[:8]),
+		pending: make(map[uint64]*firehoseRequest),
+		closed:  make(chan struct{}),
+	}
+}
+
+// firehoseRequest is a request sent to a firehose peer and awaiting the response.
+type firehoseRequest struct {
+	id       uint64
+	code     uint64                    // code of the expected response
+	block    common.Hash               // block as of which the data is requested
+	prefixes []trie.Keybytes           // for state requests
+	requests []storageReqForOneAccount // for storage requests
+	refs     []bytecodeRef             // for bytecode requests
+	response chan interface{}          // receives the validated response
 }
 
 type accountLeaf struct {
@@ -138,3 +169,255 @@ func (p *firehosePeer) SendByteCode(id uint64, data [][]byte) error {
 	msg := bytecodeMsg{ID: id, Code: data}
 	return p2p.Send(p.rw, BytecodeCode, msg)
 }
+
+// RequestStateRanges sends a GetStateRangesCode message.
+func (p *firehosePeer) RequestStateRanges(block common.Hash, prefixes []trie.Keybytes) (*firehoseRequest, error) {
+	req := p.track(StateRangesCode, block, prefixes, nil)
+	msg := getStateRangesOrNodes{ID: req.id, Block: block, Prefixes: prefixes}
+	if err := p2p.Send(p.rw, GetStateRangesCode, msg); err != nil {
+		p.untrack(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// RequestStorageRanges sends a GetStorageRangesCode message.
+func (p *firehosePeer) RequestStorageRanges(block common.Hash, requests []storageReqForOneAccount) (*firehoseRequest, error) {
+	req := p.track(StorageRangesCode, block, nil, requests)
+	msg := getStorageRangesOrNodes{ID: req.id, Block: block, Requests: requests}
+	if err := p2p.Send(p.rw, GetStorageRangesCode, msg); err != nil {
+		p.untrack(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// RequestStateNodes sends a GetStateNodesCode message.
+func (p *firehosePeer) RequestStateNodes(block common.Hash, prefixes []trie.Keybytes) (*firehoseRequest, error) {
+	req := p.track(StateNodesCode, block, prefixes, nil)
+	msg := getStateRangesOrNodes{ID: req.id, Block: block, Prefixes: prefixes}
+	if err := p2p.Send(p.rw, GetStateNodesCode, msg); err != nil {
+		p.untrack(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// RequestStorageNodes sends a GetStorageNodesCode message.
+func (p *firehosePeer) RequestStorageNodes(block common.Hash, requests []storageReqForOneAccount) (*firehoseRequest, error) {
+	req := p.track(StorageNodesCode, block, nil, requests)
+	msg := getStorageRangesOrNodes{ID: req.id, Block: block, Requests: requests}
+	if err := p2p.Send(p.rw, GetStorageNodesCode, msg); err != nil {
+		p.untrack(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// RequestBytecode sends a GetBytecodeCode message.
+func (p *firehosePeer) RequestBytecode(refs []bytecodeRef) (*firehoseRequest, error) {
+	req := p.track(BytecodeCode, common.Hash{}, nil, nil)
+	req.refs = refs
+	msg := getBytecodeMsg{ID: req.id, Ref: refs}
+	if err := p2p.Send(p.rw, GetBytecodeCode, msg); err != nil {
+		p.untrack(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// track allocates a new request ID and registers the request as pending.
+func (p *firehosePeer) track(code uint64, block common.Hash, prefixes []trie.Keybytes, requests []storageReqForOneAccount) *firehoseRequest {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	req := &firehoseRequest{
+		id:       p.nextID,
+		code:     code,
+		block:    block,
+		prefixes: prefixes,
+		requests: requests,
+		response: make(chan interface{}, 1),
+	}
+	p.nextID++
+	p.pending[req.id] = req
+	return req
+}
+
+// untrack forgets about the request, e.g. when it has timed out.
+// A late response to an untracked request is treated as unexpected.
+func (p *firehosePeer) untrack(req *firehoseRequest) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.pending, req.id)
+}
+
+// deliver matches the response against a pending request and hands it over to the requester.
+// An error is returned if the response was not requested or its shape doesn't match the request.
+func (p *firehosePeer) deliver(code uint64, id uint64, response interface{}) error {
+	p.lock.Lock()
+	req, ok := p.pending[id]
+	if ok && req.code == code {
+		delete(p.pending, id)
+	}
+	p.lock.Unlock()
+
+	if !ok {
+		return errResp(ErrUnexpectedResponse, "unknown request id %d", id)
+	}
+	if req.code != code {
+		return errResp(ErrUnexpectedResponse, "request id %d: response code %d, expected %d", id, code, req.code)
+	}
+	if err := req.validate(response); err != nil {
+		return errResp(ErrUnexpectedResponse, "request id %d: %v", id, err)
+	}
+	req.response <- response
+	return nil
+}
+
+// close notifies the requesters waiting for responses that the peer is gone.
+func (p *firehosePeer) close() {
+	close(p.closed)
+}
+
+// validate checks that the shape of the response matches the request.
+// Whether the data match the state root of the requested block is checked by the requester.
+func (req *firehoseRequest) validate(response interface{}) error {
+	switch r := response.(type) {
+	case *stateRangesMsg:
+		if len(r.Entries) != len(req.prefixes) {
+			return fmt.Errorf("%d entries for %d prefixes", len(r.Entries), len(req.prefixes))
+		}
+		for i, entry := range r.Entries {
+			if entry.Status == OK {
+				for _, leaf := range entry.Leaves {
+					if !hasKeybytesPrefix(leaf.Key[:], req.prefixes[i]) {
+						return fmt.Errorf("key %x doesn't match prefix %x", leaf.Key, req.prefixes[i].ToCompact())
+					}
+				}
+			} else if len(entry.Leaves) != 0 {
+				return fmt.Errorf("leaves returned with status %d", entry.Status)
+			}
+		}
+	case *storageRangesMsg:
+		if len(r.Entries) != len(req.requests) {
+			return fmt.Errorf("%d entries for %d accounts", len(r.Entries), len(req.requests))
+		}
+		for j, entries := range r.Entries {
+			prefixes := req.requests[j].Prefixes
+			if len(entries) != len(prefixes) {
+				return fmt.Errorf("%d entries for %d prefixes", len(entries), len(prefixes))
+			}
+			for i, entry := range entries {
+				if entry.Status == OK {
+					for _, leaf := range entry.Leaves {
+						if !hasKeybytesPrefix(leaf.Key[:], prefixes[i]) {
+							return fmt.Errorf("key %x doesn't match prefix %x", leaf.Key, prefixes[i].ToCompact())
+						}
+					}
+				} else if len(entry.Leaves) != 0 {
+					return fmt.Errorf("leaves returned with status %d", entry.Status)
+				}
+			}
+		}
+	case *stateNodesMsg:
+		if len(r.Nodes) != len(req.prefixes) {
+			return fmt.Errorf("%d nodes for %d prefixes", len(r.Nodes), len(req.prefixes))
+		}
+	case *storageNodesMsg:
+		if len(r.Nodes) != len(req.requests) {
+			return fmt.Errorf("%d entries for %d accounts", len(r.Nodes), len(req.requests))
+		}
+		for j, nodes := range r.Nodes {
+			if len(nodes) != len(req.requests[j].Prefixes) {
+				return fmt.Errorf("%d nodes for %d prefixes", len(nodes), len(req.requests[j].Prefixes))
+			}
+		}
+	case *bytecodeMsg:
+		// The peer may return fewer bytecodes than requested if the response gets too large
+		if len(r.Code) > len(req.refs) {
+			return fmt.Errorf("%d bytecodes for %d requested", len(r.Code), len(req.refs))
+		}
+		for i, code := range r.Code {
+			if len(code) > 0 && crypto.Keccak256Hash(code) != req.refs[i].CodeHash {
+				return fmt.Errorf("bytecode %d hash mismatch, expected %x", i, req.refs[i].CodeHash)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown response type %T", response)
+	}
+	return nil
+}
+
+// hasKeybytesPrefix checks whether the key starts with the (possibly odd-length) prefix.
+func hasKeybytesPrefix(key []byte, prefix trie.Keybytes) bool {
+	n := prefix.Nibbles()
+	if len(key)*2 < n {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		if nibble(key, i) != nibble(prefix.Data, i) {
+			return false
+		}
+	}
+	return true
+}
+
+func nibble(data []byte, i int) byte {
+	if i%2 == 0 {
+		return data[i/2] >> 4
+	}
+	return data[i/2] & 0x0f
+}
+
+// firehosePeerSet represents the collection of active firehose peers.
+type firehosePeerSet struct {
+	peers map[string]*firehosePeer
+	lock  sync.RWMutex
+}
+
+func newFirehosePeerSet() *firehosePeerSet {
+	return &firehosePeerSet{
+		peers: make(map[string]*firehosePeer),
+	}
+}
+
+// Register injects a new peer into the working set, or returns an error if the
+// peer is already known.
+func (ps *firehosePeerSet) Register(p *firehosePeer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if _, ok := ps.peers[p.id]; ok {
+		return errAlreadyRegistered
+	}
+	ps.peers[p.id] = p
+	return nil
+}
+
+// Unregister removes a remote peer from the active set.
+func (ps *firehosePeerSet) Unregister(id string) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if _, ok := ps.peers[id]; !ok {
+		return errNotRegistered
+	}
+	delete(ps.peers, id)
+	return nil
+}
+
+// Peer retrieves the registered peer with the given id.
+func (ps *firehosePeerSet) Peer(id string) *firehosePeer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	return ps.peers[id]
+}
+
+// Peers retrieves all the registered peers.
+func (ps *firehosePeerSet) Peers() []*firehosePeer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	list := make([]*firehosePeer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		list = append(list, p)
+	}
+	return list
+}
@@ -0,0 +1,553 @@
+package eth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+// firehoseSyncBatch is the maximum number of prefixes requested from a peer in one message.
+const firehoseSyncBatch = 64
+
+// firehoseRequestTimeout is the time allowance for a firehose peer to reply to a request.
+var firehoseRequestTimeout = 20 * time.Second
+
+var (
+	errFirehoseNoData  = errors.New("firehose peer has no state for the requested block")
+	errFirehoseTimeout = errors.New("firehose request timed out")
+	errFirehoseDropped = errors.New("firehose peer dropped")
+	errFirehoseStalled = errors.New("firehose peer returned nothing for the request")
+)
+
+// firehoseTask is a subtrie that has to be downloaded.
+type firehoseTask struct {
+	addrHash common.Hash // hash of the contract address for storage subtries
+	hex      []byte      // hex prefix of the subtrie, without the terminator
+	ref      []byte      // expected reference to the root of the subtrie: its hash, or its RLP if shorter than 32 bytes
+}
+
+// firehoseStateSync downloads the state as of a given block from a firehose peer,
+// verifies it against the state root of the block and writes it into the AT & ST buckets.
+// Subtries are requested as ranges of leaves first. If there are too many leaves in a subtrie,
+// its root node is requested instead, and the children of the node become new tasks.
+type firehoseStateSync struct {
+	peer  *firehosePeer
+	db    ethdb.Database
+	block common.Hash
+	root  common.Hash
+
+	accountRanges []firehoseTask
+	accountNodes  []firehoseTask
+	storageRanges []firehoseTask
+	storageNodes  []firehoseTask
+	codes         []bytecodeRef
+	knownCodes    map[common.Hash]struct{} // code hashes already queued, to download each bytecode once
+}
+
+func newFirehoseStateSync(peer *firehosePeer, db ethdb.Database, header *types.Header) *firehoseStateSync {
+	s := &firehoseStateSync{
+		peer:       peer,
+		db:         db,
+		block:      header.Hash(),
+		root:       header.Root,
+		knownCodes: make(map[common.Hash]struct{}),
+	}
+	if s.root != trie.EmptyRoot {
+		s.accountRanges = []firehoseTask{{hex: []byte{}, ref: common.CopyBytes(s.root[:])}}
+	}
+	return s
+}
+
+// syncFirehoseState downloads the whole state as of the given block from a firehose peer.
+func (pm *ProtocolManager) syncFirehoseState(ctx context.Context, p *firehosePeer, header *types.Header) error {
+	log.Info("Firehose state sync started", "peer", p.id, "number", header.Number, "root", header.Root)
+	start := time.Now()
+	if err := newFirehoseStateSync(p, pm.blockchain.ChainDb(), header).run(ctx); err != nil {
+		return err
+	}
+	log.Info("Firehose state sync finished", "peer", p.id, "number", header.Number, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// syncFirehosePivotState downloads the state of the fast sync pivot block from one of the firehose peers.
+func (pm *ProtocolManager) syncFirehosePivotState(ctx context.Context, header *types.Header) error {
+	peers := pm.firehosePeers.Peers()
+	if len(peers) == 0 {
+		return errNoFirehosePeers
+	}
+	var err error
+	for _, p := range peers {
+		if err = pm.syncFirehoseState(ctx, p, header); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warn("Firehose state sync failed", "peer", p.id, "err", err)
+	}
+	return err
+}
+
+// run processes the tasks until all of the state is downloaded.
+func (s *firehoseStateSync) run(ctx context.Context) error {
+	for {
+		var err error
+		switch {
+		case len(s.accountNodes) > 0:
+			err = s.syncAccountNodes(ctx)
+		case len(s.accountRanges) > 0:
+			err = s.syncAccountRanges(ctx)
+		case len(s.storageNodes) > 0:
+			err = s.syncStorageNodes(ctx)
+		case len(s.storageRanges) > 0:
+			err = s.syncStorageRanges(ctx)
+		case len(s.codes) > 0:
+			err = s.syncBytecode(ctx)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// nextBatch takes up to firehoseSyncBatch tasks from the queue.
+func nextBatch(queue *[]firehoseTask) []firehoseTask {
+	batch := *queue
+	if len(batch) > firehoseSyncBatch {
+		batch = batch[:firehoseSyncBatch]
+	}
+	*queue = (*queue)[len(batch):]
+	return batch
+}
+
+// wait blocks until the response to the request arrives.
+func (p *firehosePeer) wait(ctx context.Context, req *firehoseRequest) (interface{}, error) {
+	timer := time.NewTimer(firehoseRequestTimeout)
+	defer timer.Stop()
+	select {
+	case response := <-req.response:
+		return response, nil
+	case <-p.closed:
+		return nil, errFirehoseDropped
+	case <-timer.C:
+		p.untrack(req)
+		return nil, errFirehoseTimeout
+	case <-ctx.Done():
+		p.untrack(req)
+		return nil, ctx.Err()
+	}
+}
+
+func (s *firehoseStateSync) syncAccountRanges(ctx context.Context) error {
+	tasks := nextBatch(&s.accountRanges)
+	prefixes := make([]trie.Keybytes, len(tasks))
+	for i, task := range tasks {
+		prefixes[i] = hexToKeybytes(task.hex)
+	}
+	req, err := s.peer.RequestStateRanges(s.block, prefixes)
+	if err != nil {
+		return err
+	}
+	response, err := s.peer.wait(ctx, req)
+	if err != nil {
+		return err
+	}
+	reply := response.(*stateRangesMsg)
+
+	batch := s.db.NewBatch()
+	processed := 0
+	for i, entry := range reply.Entries {
+		switch entry.Status {
+		case OK:
+			if err := processAccountRange(batch, tasks[i], entry.Leaves); err != nil {
+				return err
+			}
+			for _, leaf := range entry.Leaves {
+				if leaf.Val.Root != trie.EmptyRoot && leaf.Val.Root != (common.Hash{}) {
+					s.storageRanges = append(s.storageRanges, firehoseTask{addrHash: leaf.Key, hex: []byte{}, ref: common.CopyBytes(leaf.Val.Root[:])})
+				}
+				if !leaf.Val.IsEmptyCodeHash() {
+					s.addCode(leaf.Key, leaf.Val.CodeHash)
+				}
+			}
+			processed++
+		case TooManyLeaves:
+			s.accountNodes = append(s.accountNodes, tasks[i])
+			processed++
+		default:
+			if len(reply.AvailableBlocks) > 0 {
+				return errFirehoseNoData
+			}
+			// The peer has reached its response limit, try again later
+			s.accountRanges = append(s.accountRanges, tasks[i])
+		}
+	}
+	if _, err := batch.Commit(); err != nil {
+		return err
+	}
+	if processed == 0 {
+		return errFirehoseStalled
+	}
+	return nil
+}
+
+// processAccountRange verifies the leaves of the subtrie against the expected reference
+// and writes the accounts into the database.
+func processAccountRange(db ethdb.Putter, task firehoseTask, leaves []accountLeaf) error {
+	t := trie.New(common.Hash{})
+	for _, leaf := range leaves {
+		t.UpdateAccount(leaf.Key[:], leaf.Val)
+	}
+	if err := verifySubtrie(t, task); err != nil {
+		return err
+	}
+	for _, leaf := range leaves {
+		acc := leaf.Val
+		if !acc.IsEmptyCodeHash() {
+			// TODO [Issue 99] support incarnations
+			acc.Incarnation = state.FirstContractIncarnation
+			if debug.IsThinHistory() {
+				if err := db.Put(dbutils.ContractCodeBucket, dbutils.GenerateStoragePrefix(leaf.Key, acc.Incarnation), acc.CodeHash[:]); err != nil {
+					return err
+				}
+			}
+		}
+		data := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(data)
+		if err := db.Put(dbutils.AccountsBucket, common.CopyBytes(leaf.Key[:]), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *firehoseStateSync) syncAccountNodes(ctx context.Context) error {
+	tasks := nextBatch(&s.accountNodes)
+	prefixes := make([]trie.Keybytes, len(tasks))
+	for i, task := range tasks {
+		prefixes[i] = hexToKeybytes(task.hex)
+	}
+	req, err := s.peer.RequestStateNodes(s.block, prefixes)
+	if err != nil {
+		return err
+	}
+	response, err := s.peer.wait(ctx, req)
+	if err != nil {
+		return err
+	}
+	reply := response.(*stateNodesMsg)
+
+	processed := 0
+	for i, node := range reply.Nodes {
+		if len(node) == 0 {
+			if len(reply.AvailableBlocks) > 0 {
+				return errFirehoseNoData
+			}
+			// The peer has reached its response limit, try again later
+			s.accountNodes = append(s.accountNodes, tasks[i])
+			continue
+		}
+		children, err := expandNode(tasks[i], node)
+		if err != nil {
+			return err
+		}
+		s.accountRanges = append(s.accountRanges, children...)
+		processed++
+	}
+	if processed == 0 {
+		return errFirehoseStalled
+	}
+	return nil
+}
+
+// storageRequests groups the storage tasks by account.
+// It also returns the tasks in the order of the requested prefixes.
+func storageRequests(tasks []firehoseTask) ([]storageReqForOneAccount, [][]firehoseTask) {
+	var requests []storageReqForOneAccount
+	var grouped [][]firehoseTask
+	index := make(map[common.Hash]int)
+	for _, task := range tasks {
+		j, ok := index[task.addrHash]
+		if !ok {
+			j = len(requests)
+			index[task.addrHash] = j
+			requests = append(requests, storageReqForOneAccount{Account: common.CopyBytes(task.addrHash[:])})
+			grouped = append(grouped, nil)
+		}
+		requests[j].Prefixes = append(requests[j].Prefixes, hexToKeybytes(task.hex))
+		grouped[j] = append(grouped[j], task)
+	}
+	return requests, grouped
+}
+
+func (s *firehoseStateSync) syncStorageRanges(ctx context.Context) error {
+	requests, tasks := storageRequests(nextBatch(&s.storageRanges))
+	req, err := s.peer.RequestStorageRanges(s.block, requests)
+	if err != nil {
+		return err
+	}
+	response, err := s.peer.wait(ctx, req)
+	if err != nil {
+		return err
+	}
+	reply := response.(*storageRangesMsg)
+
+	batch := s.db.NewBatch()
+	processed := 0
+	for j, entries := range reply.Entries {
+		for i, entry := range entries {
+			switch entry.Status {
+			case OK:
+				// TODO [Issue 99] support incarnations
+				if err := processStorageRange(batch, tasks[j][i], state.FirstContractIncarnation, entry.Leaves); err != nil {
+					return err
+				}
+				processed++
+			case TooManyLeaves:
+				s.storageNodes = append(s.storageNodes, tasks[j][i])
+				processed++
+			default:
+				if len(reply.AvailableBlocks) > 0 {
+					return errFirehoseNoData
+				}
+				// The peer has reached its response limit, try again later
+				s.storageRanges = append(s.storageRanges, tasks[j][i])
+			}
+		}
+	}
+	if _, err := batch.Commit(); err != nil {
+		return err
+	}
+	if processed == 0 {
+		return errFirehoseStalled
+	}
+	return nil
+}
+
+// processStorageRange verifies the leaves of the storage subtrie against the expected reference
+// and writes the storage items of the given incarnation of the contract into the database.
+func processStorageRange(db ethdb.Putter, task firehoseTask, incarnation uint64, leaves []storageLeaf) error {
+	t := trie.New(common.Hash{})
+	for _, leaf := range leaves {
+		t.Update(leaf.Key[:], leaf.Val.Bytes(), 0)
+	}
+	if err := verifySubtrie(t, task); err != nil {
+		return err
+	}
+	for _, leaf := range leaves {
+		compositeKey := dbutils.GenerateCompositeStorageKey(task.addrHash, incarnation, leaf.Key)
+		if err := db.Put(dbutils.StorageBucket, compositeKey, leaf.Val.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *firehoseStateSync) syncStorageNodes(ctx context.Context) error {
+	requests, tasks := storageRequests(nextBatch(&s.storageNodes))
+	req, err := s.peer.RequestStorageNodes(s.block, requests)
+	if err != nil {
+		return err
+	}
+	response, err := s.peer.wait(ctx, req)
+	if err != nil {
+		return err
+	}
+	reply := response.(*storageNodesMsg)
+
+	processed := 0
+	for j, nodes := range reply.Nodes {
+		for i, node := range nodes {
+			if len(node) == 0 {
+				if len(reply.AvailableBlocks) > 0 {
+					return errFirehoseNoData
+				}
+				// The peer has reached its response limit, try again later
+				s.storageNodes = append(s.storageNodes, tasks[j][i])
+				continue
+			}
+			children, err := expandNode(tasks[j][i], node)
+			if err != nil {
+				return err
+			}
+			s.storageRanges = append(s.storageRanges, children...)
+			processed++
+		}
+	}
+	if processed == 0 {
+		return errFirehoseStalled
+	}
+	return nil
+}
+
+// addCode queues the download of the bytecode, unless it is queued already.
+func (s *firehoseStateSync) addCode(addrHash common.Hash, codeHash common.Hash) {
+	if _, ok := s.knownCodes[codeHash]; ok {
+		return
+	}
+	s.knownCodes[codeHash] = struct{}{}
+	s.codes = append(s.codes, bytecodeRef{Account: common.CopyBytes(addrHash[:]), CodeHash: codeHash})
+}
+
+func (s *firehoseStateSync) syncBytecode(ctx context.Context) error {
+	refs := s.codes
+	if len(refs) > firehoseSyncBatch {
+		refs = refs[:firehoseSyncBatch]
+	}
+	s.codes = s.codes[len(refs):]
+	req, err := s.peer.RequestBytecode(refs)
+	if err != nil {
+		return err
+	}
+	response, err := s.peer.wait(ctx, req)
+	if err != nil {
+		return err
+	}
+	// The hashes of the bytecodes are verified when the response is delivered
+	code := response.(*bytecodeMsg).Code
+
+	batch := s.db.NewBatch()
+	processed := 0
+	for i, ref := range refs {
+		if i >= len(code) || len(code[i]) == 0 {
+			// The peer has reached its response limit, try again later
+			s.codes = append(s.codes, ref)
+			continue
+		}
+		if err := batch.Put(dbutils.CodeBucket, common.CopyBytes(ref.CodeHash[:]), code[i]); err != nil {
+			return err
+		}
+		processed++
+	}
+	if _, err := batch.Commit(); err != nil {
+		return err
+	}
+	if processed == 0 {
+		return errFirehoseStalled
+	}
+	return nil
+}
+
+// verifySubtrie checks that the node at the task's prefix in a trie built from the downloaded
+// leaves matches the expected reference.
+func verifySubtrie(t *trie.Trie, task firehoseTask) error {
+	ref, found, err := t.NodeRefAtHexPrefix(task.hex)
+	if err != nil {
+		return err
+	}
+	if !found {
+		if len(task.hex) == 0 && bytes.Equal(task.ref, trie.EmptyRoot[:]) {
+			return nil
+		}
+		return fmt.Errorf("no leaves for subtrie %x, expected %x", task.hex, task.ref)
+	}
+	if !bytes.Equal(ref, task.ref) {
+		return fmt.Errorf("subtrie %x mismatch: got %x, expected %x", task.hex, ref, task.ref)
+	}
+	return nil
+}
+
+// expandNode verifies the node RLP against the task's reference and returns
+// the tasks for the children of the node. The node must be a branch or an extension node,
+// since leaves are downloaded as ranges.
+func expandNode(task firehoseTask, nodeRLP []byte) ([]firehoseTask, error) {
+	if len(task.ref) == common.HashLength {
+		if !bytes.Equal(crypto.Keccak256(nodeRLP), task.ref) {
+			return nil, fmt.Errorf("node %x hash mismatch, expected %x", task.hex, task.ref)
+		}
+	} else if !bytes.Equal(nodeRLP, task.ref) {
+		return nil, fmt.Errorf("node %x mismatch: got %x, expected %x", task.hex, nodeRLP, task.ref)
+	}
+	elems, _, err := rlp.SplitList(nodeRLP)
+	if err != nil {
+		return nil, fmt.Errorf("node %x: %w", task.hex, err)
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return nil, fmt.Errorf("node %x: %w", task.hex, err)
+	}
+	var children []firehoseTask
+	switch count {
+	case 17:
+		for i := 0; i < 16; i++ {
+			ref, rest, err := splitNodeRef(elems)
+			if err != nil {
+				return nil, fmt.Errorf("node %x, child %d: %w", task.hex, i, err)
+			}
+			elems = rest
+			if ref == nil {
+				continue
+			}
+			hex := make([]byte, len(task.hex)+1)
+			copy(hex, task.hex)
+			hex[len(task.hex)] = byte(i)
+			children = append(children, firehoseTask{addrHash: task.addrHash, hex: hex, ref: ref})
+		}
+	case 2:
+		compact, rest, err := rlp.SplitString(elems)
+		if err != nil || len(compact) == 0 {
+			return nil, fmt.Errorf("node %x: invalid key", task.hex)
+		}
+		key := trie.CompactToKeybytes(compact)
+		if key.Terminating {
+			return nil, fmt.Errorf("node %x: unexpected leaf node", task.hex)
+		}
+		ref, _, err := splitNodeRef(rest)
+		if err != nil || ref == nil {
+			return nil, fmt.Errorf("node %x: invalid extension", task.hex)
+		}
+		hex := append(common.CopyBytes(task.hex), key.ToHex()...)
+		children = append(children, firehoseTask{addrHash: task.addrHash, hex: hex, ref: ref})
+	default:
+		return nil, fmt.Errorf("node %x: invalid number of elements %d", task.hex, count)
+	}
+	return children, nil
+}
+
+// splitNodeRef extracts the reference to a child node: either a hash or an embedded node RLP.
+// Nil is returned for an empty reference.
+func splitNodeRef(elems []byte) ([]byte, []byte, error) {
+	kind, content, rest, err := rlp.Split(elems)
+	if err != nil {
+		return nil, nil, err
+	}
+	if kind == rlp.List {
+		return common.CopyBytes(elems[:len(elems)-len(rest)]), rest, nil
+	}
+	switch len(content) {
+	case 0:
+		return nil, rest, nil
+	case common.HashLength:
+		return common.CopyBytes(content), rest, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid reference length %d", len(content))
+	}
+}
+
+// hexToKeybytes converts a hex prefix (without the terminator) into the KEYBYTES encoding.
+func hexToKeybytes(hex []byte) trie.Keybytes {
+	k := trie.Keybytes{Data: make([]byte, (len(hex)+1)/2), Odd: len(hex)%2 == 1}
+	for i, nibble := range hex {
+		if i%2 == 0 {
+			k.Data[i/2] = nibble << 4
+		} else {
+			k.Data[i/2] |= nibble
+		}
+	}
+	return k
+}
@@ -0,0 +1,176 @@
+package eth
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/downloader"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/p2p/enode"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectFirehose connects a client protocol manager to the server one
+// and returns the client's view of the server peer, as well as the function to disconnect them.
+func connectFirehose(t *testing.T, server *ProtocolManager) (*firehosePeer, func()) {
+	client, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	app, net := p2p.MsgPipe()
+
+	var serverID, clientID enode.ID
+	// #nosec G404
+	rand.Read(serverID[:])
+	// #nosec G404
+	rand.Read(clientID[:])
+	serverPeer := newFirehosePeer(p2p.NewPeer(clientID, "client", nil), net)
+	clientPeer := newFirehosePeer(p2p.NewPeer(serverID, "server", nil), app)
+	go func() { _ = server.handleFirehose(serverPeer) }()
+	go func() { _ = client.handleFirehose(clientPeer) }()
+	return clientPeer, func() {
+		app.Close()
+		client.Stop()
+		server.Stop()
+	}
+}
+
+func TestFirehoseSyncAccounts(t *testing.T) {
+	pm, peer := setUpDummyAccountsForFirehose(t)
+	peer.close()
+	clientPeer, disconnect := connectFirehose(t, pm)
+	defer disconnect()
+
+	block := pm.blockchain.GetBlockByNumber(4)
+	db := ethdb.NewMemDatabase()
+	require.NoError(t, newFirehoseStateSync(clientPeer, db, block.Header()).run(context.Background()))
+
+	// The downloaded state must produce the state root of the block
+	require.NoError(t, trie.New(block.Root()).Rebuild(db, 0))
+
+	for i := 1; i < len(addrHash); i++ {
+		enc, err := db.Get(dbutils.AccountsBucket, addrHash[i][:])
+		require.NoError(t, err)
+		var acc accounts.Account
+		require.NoError(t, acc.DecodeForStorage(enc))
+		assert.Equal(t, frhsAmnt, &acc.Balance, "account %d", i)
+	}
+}
+
+func TestFirehoseSyncStorage(t *testing.T) {
+	for _, setUp := range []func(*testing.T) (*ProtocolManager, *testFirehosePeer, common.Address){
+		setUpStorageContractForFirehoseA,
+		setUpStorageContractForFirehoseB,
+	} {
+		pm, peer, addr := setUp(t)
+		peer.close()
+		clientPeer, disconnect := connectFirehose(t, pm)
+
+		block := pm.blockchain.CurrentBlock()
+		db := ethdb.NewMemDatabase()
+		require.NoError(t, newFirehoseStateSync(clientPeer, db, block.Header()).run(context.Background()))
+		require.NoError(t, trie.New(block.Root()).Rebuild(db, 0))
+
+		// Storage is verified against the storage root of the contract while being downloaded
+		var items int
+		contractPrefix := dbutils.GenerateStoragePrefix(crypto.Keccak256Hash(addr[:]), 1)
+		err := db.Walk(dbutils.StorageBucket, contractPrefix, 8*uint(len(contractPrefix)), func(k, v []byte) (bool, error) {
+			items++
+			return true, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, items)
+
+		// The bytecode of the contract is downloaded too
+		enc, err := db.Get(dbutils.AccountsBucket, crypto.Keccak256(addr[:]))
+		require.NoError(t, err)
+		var acc accounts.Account
+		require.NoError(t, acc.DecodeForStorage(enc))
+		code, err := db.Get(dbutils.CodeBucket, acc.CodeHash[:])
+		require.NoError(t, err)
+		assert.NotEmpty(t, code)
+		assert.Equal(t, acc.CodeHash, crypto.Keccak256Hash(code))
+		disconnect()
+	}
+}
+
+func TestFirehoseSyncTooManyLeaves(t *testing.T) {
+	signer := types.HomesteadSigner{}
+	amount := big.NewInt(10)
+	generator := func(i int, block *core.BlockGen) {
+		var rndAddr common.Address
+		// #nosec G404
+		rand.Read(rndAddr[:])
+
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(testBank), rndAddr, amount, params.TxGas, nil, nil), signer, testBankKey)
+		assert.NoError(t, err)
+		block.AddTx(tx)
+	}
+
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, MaxLeavesPerPrefix, generator, nil)
+	clientPeer, disconnect := connectFirehose(t, pm)
+	defer disconnect()
+
+	block := pm.blockchain.CurrentBlock()
+	db := ethdb.NewMemDatabase()
+	s := newFirehoseStateSync(clientPeer, db, block.Header())
+	require.NoError(t, s.syncAccountRanges(context.Background()))
+	// The whole state doesn't fit into a single range, so the root node is requested next
+	assert.Equal(t, 1, len(s.accountNodes))
+
+	require.NoError(t, s.run(context.Background()))
+	require.NoError(t, trie.New(block.Root()).Rebuild(db, 0))
+}
+
+func TestFirehoseSyncWrongRoot(t *testing.T) {
+	pm, peer := setUpDummyAccountsForFirehose(t)
+	peer.close()
+	clientPeer, disconnect := connectFirehose(t, pm)
+	defer disconnect()
+
+	header := types.CopyHeader(pm.blockchain.GetBlockByNumber(4).Header())
+	header.Root = pm.blockchain.GetBlockByNumber(3).Root()
+	err := newFirehoseStateSync(clientPeer, ethdb.NewMemDatabase(), header).run(context.Background())
+	assert.Error(t, err)
+
+	nonexistent := types.CopyHeader(header)
+	nonexistent.Extra = []byte("nonexistent")
+	err = newFirehoseStateSync(clientPeer, ethdb.NewMemDatabase(), nonexistent).run(context.Background())
+	assert.Equal(t, errFirehoseNoData, err)
+}
+
+func TestFirehoseUnexpectedResponse(t *testing.T) {
+	pm, peer := setUpDummyAccountsForFirehose(t)
+	defer peer.close()
+
+	fp := newFirehosePeer(p2p.NewPeer(enode.ID{}, "peer", nil), nil)
+	prefixes := []trie.Keybytes{{Data: common.FromHex("40"), Odd: true}}
+	req := fp.track(StateRangesCode, pm.blockchain.CurrentBlock().Hash(), prefixes, nil)
+
+	// Unknown request ID
+	assert.Error(t, fp.deliver(StateRangesCode, req.id+1, &stateRangesMsg{ID: req.id + 1}))
+	// Wrong response code
+	assert.Error(t, fp.deliver(StateNodesCode, req.id, &stateNodesMsg{ID: req.id, Nodes: [][]byte{nil}}))
+	// Leaf outside of the requested prefix
+	account := accounts.NewAccount()
+	bad := &stateRangesMsg{ID: req.id, Entries: []firehoseAccountRange{
+		{Status: OK, Leaves: []accountLeaf{{addrHash[1], &account}}},
+	}}
+	assert.Error(t, fp.deliver(StateRangesCode, req.id, bad))
+
+	req = fp.track(StateRangesCode, pm.blockchain.CurrentBlock().Hash(), prefixes, nil)
+	good := &stateRangesMsg{ID: req.id, Entries: []firehoseAccountRange{
+		{Status: OK, Leaves: []accountLeaf{{addrHash[4], &account}}},
+	}}
+	assert.NoError(t, fp.deliver(StateRangesCode, req.id, good))
+	assert.Equal(t, good, <-req.response)
+}
@@ -28,6 +28,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		LightEgress             int                    `toml:",omitempty"`
 		StorageMode             string
 		ArchiveSyncInterval     int
+		ServeWitnesses          bool
+		WitnessRetention        uint64
+		BinaryTrie              bool
+		ParallelExecution       int
 		LightServ               int `toml:",omitempty"`
 		LightPeers              int `toml:",omitempty"`
 		OnlyAnnounce            bool
@@ -59,6 +63,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Whitelist = c.Whitelist
 	enc.StorageMode = c.StorageMode.ToString()
 	enc.ArchiveSyncInterval = c.ArchiveSyncInterval
+	enc.ServeWitnesses = c.ServeWitnesses
+	enc.WitnessRetention = c.WitnessRetention
+	enc.BinaryTrie = c.BinaryTrie
+	enc.ParallelExecution = c.ParallelExecution
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
 	enc.LightEgress = c.LightEgress
@@ -97,6 +105,10 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		LightEgress             *int                   `toml:",omitempty"`
 		Mode                    *string
 		ArchiveSyncInterval     *int
+		ServeWitnesses          *bool
+		WitnessRetention        *uint64
+		BinaryTrie              *bool
+		ParallelExecution       *int
 		LightServ               *int `toml:",omitempty"`
 		LightPeers              *int `toml:",omitempty"`
 		OnlyAnnounce            *bool
@@ -151,6 +163,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.ArchiveSyncInterval != nil {
 		c.ArchiveSyncInterval = *dec.ArchiveSyncInterval
 	}
+	if dec.ServeWitnesses != nil {
+		c.ServeWitnesses = *dec.ServeWitnesses
+	}
+	if dec.WitnessRetention != nil {
+		c.WitnessRetention = *dec.WitnessRetention
+	}
+	if dec.BinaryTrie != nil {
+		c.BinaryTrie = *dec.BinaryTrie
+	}
+	if dec.ParallelExecution != nil {
+		c.ParallelExecution = *dec.ParallelExecution
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
@@ -71,8 +71,10 @@ type ProtocolManager struct {
 	networkID  uint64
 	forkFilter forkid.Filter // Fork ID filter, constant across the lifetime of the node
 
-	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
-	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
+	fastSync     uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	acceptTxs    uint32 // Flag whether we're considered synchronised (enables transaction processing)
+	beamSync     bool   // Whether the state is fetched on demand instead of being downloaded during fast sync
+	firehoseSync bool   // Whether the state of the fast sync pivot block is downloaded from the firehose peers
 
 	checkpointNumber uint64      // Block number for the sync progress validator to cross reference
 	checkpointHash   common.Hash // Block hash for the sync progress validator to cross reference
@@ -85,6 +87,9 @@ type ProtocolManager struct {
 	fetcher    *fetcher.Fetcher
 	peers      *peerSet
 
+	firehosePeers *firehosePeerSet
+	witnessPeers  *witnessPeerSet
+
 	eventMux      *event.TypeMux
 	txsCh         chan core.NewTxsEvent
 	txsSub        event.Subscription
@@ -108,17 +113,19 @@ type ProtocolManager struct {
 func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCheckpoint, mode downloader.SyncMode, networkID uint64, mux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain *core.BlockChain, chaindb ethdb.Database, whitelist map[uint64]common.Hash) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
-		networkID:   networkID,
-		forkFilter:  forkid.NewFilter(blockchain),
-		eventMux:    mux,
-		txpool:      txpool,
-		blockchain:  blockchain,
-		peers:       newPeerSet(),
-		whitelist:   whitelist,
-		newPeerCh:   make(chan *peer),
-		noMorePeers: make(chan struct{}),
-		txsyncCh:    make(chan *txsync),
-		quitSync:    make(chan struct{}),
+		networkID:     networkID,
+		forkFilter:    forkid.NewFilter(blockchain),
+		eventMux:      mux,
+		txpool:        txpool,
+		blockchain:    blockchain,
+		peers:         newPeerSet(),
+		firehosePeers: newFirehosePeerSet(),
+		witnessPeers:  newWitnessPeerSet(),
+		whitelist:     whitelist,
+		newPeerCh:     make(chan *peer),
+		noMorePeers:   make(chan struct{}),
+		txsyncCh:      make(chan *txsync),
+		quitSync:      make(chan struct{}),
 	}
 	if mode == downloader.FullSync {
 		// The database seems empty as the current block is the genesis. Yet the fast
@@ -134,7 +141,7 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 			manager.fastSync = uint32(1)
 			log.Warn("Switch sync mode from full sync to fast sync")
 		}
-	} else {
+	} else if mode != downloader.StatelessSync {
 		if blockchain.CurrentBlock().NumberU64() > 0 {
 			// Print warning log if database is not empty to run fast sync.
 			log.Warn("Switch sync mode from fast sync to full sync")
@@ -143,6 +150,15 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 			manager.fastSync = uint32(1)
 		}
 	}
+	if mode == downloader.BeamSync {
+		// Blocks are executed without the state, which is fetched from the firehose peers as needed
+		manager.beamSync = true
+		blockchain.SetStateFetcher(newBeamFetcher(manager))
+	}
+	if mode == downloader.StatelessSync {
+		// Blocks are downloaded like in full sync, but executed on top of the witnesses fetched from the witness peers
+		blockchain.SetWitnessFetcher(newWitnessFetcher(manager))
+	}
 	// If we have trusted checkpoints, enforce them on the chain
 	if checkpoint != nil {
 		manager.checkpointNumber = (checkpoint.SectionIndex+1)*params.CHTFrequency - 1
@@ -151,6 +167,11 @@ func NewProtocolManager(config *params.ChainConfig, checkpoint *params.TrustedCh
 
 	// Construct the different synchronisation mechanisms
 	manager.downloader = downloader.New(manager.checkpointNumber, chaindb, nil /*stateBloom */, manager.eventMux, blockchain, nil, manager.removePeer)
+	if mode == downloader.FirehoseSync {
+		// Blocks before the pivot are downloaded like in fast sync, and the state of the pivot block from the firehose peers
+		manager.firehoseSync = true
+		manager.downloader.SetStateSync(manager.syncFirehosePivotState)
+	}
 
 	// Construct the fetcher (short sync)
 	validator := func(header *types.Header) error {
@@ -201,7 +222,7 @@ func (pm *ProtocolManager) makeFirehoseProtocol() p2p.Protocol {
 		Version: FirehoseVersions[0],
 		Length:  FirehoseLengths[0],
 		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
-			peer := &firehosePeer{Peer: p, rw: rw}
+			peer := newFirehosePeer(p, rw)
 			select {
 			case <-pm.quitSync:
 				return p2p.DiscQuitting
@@ -223,6 +244,35 @@ func (pm *ProtocolManager) makeFirehoseProtocol() p2p.Protocol {
 	}
 }
 
+func (pm *ProtocolManager) makeWitnessProtocol() p2p.Protocol {
+	log.Info("Initialising Witness protocol", "versions", WitnessVersions)
+	return p2p.Protocol{
+		Name:    WitnessName,
+		Version: WitnessVersions[0],
+		Length:  WitnessLengths[0],
+		Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+			peer := newWitnessPeer(p, rw)
+			select {
+			case <-pm.quitSync:
+				return p2p.DiscQuitting
+			default:
+				pm.wg.Add(1)
+				defer pm.wg.Done()
+				return pm.handleWitness(peer)
+			}
+		},
+		NodeInfo: func() interface{} {
+			return pm.NodeInfo()
+		},
+		PeerInfo: func(id enode.ID) interface{} {
+			if p := pm.peers.Peer(fmt.Sprintf("%x", id[:8])); p != nil {
+				return p.Info()
+			}
+			return nil
+		},
+	}
+}
+
 func (pm *ProtocolManager) makeProtocol(version uint) p2p.Protocol {
 	length, ok := ProtocolLengths[version]
 	if !ok {
@@ -395,6 +445,17 @@ func (pm *ProtocolManager) handle(p *peer) error {
 }
 
 func (pm *ProtocolManager) handleFirehose(p *firehosePeer) error {
+	if err := pm.firehosePeers.Register(p); err != nil {
+		p.Log().Error("Firehose peer registration failed", "err", err)
+		return err
+	}
+	defer func() {
+		if err := pm.firehosePeers.Unregister(p.id); err != nil {
+			p.Log().Error("Firehose peer removal failed", "err", err)
+		}
+		p.close()
+	}()
+
 	for {
 		if err := pm.handleFirehoseMsg(p); err != nil {
 			p.Log().Debug("Firehose message handling failed", "err", err)
@@ -403,6 +464,26 @@ func (pm *ProtocolManager) handleFirehose(p *firehosePeer) error {
 	}
 }
 
+func (pm *ProtocolManager) handleWitness(p *witnessPeer) error {
+	if err := pm.witnessPeers.Register(p); err != nil {
+		p.Log().Error("Witness peer registration failed", "err", err)
+		return err
+	}
+	defer func() {
+		if err := pm.witnessPeers.Unregister(p.id); err != nil {
+			p.Log().Error("Witness peer removal failed", "err", err)
+		}
+		p.close()
+	}()
+
+	for {
+		if err := pm.handleWitnessMsg(p); err != nil {
+			p.Log().Debug("Witness message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
 // handleMsg is invoked whenever an inbound message is received from a remote
 // peer. The remote connection is torn down upon returning any error.
 func (pm *ProtocolManager) handleMsg(p *peer) error {
@@ -799,7 +880,7 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 				var leaves []accountLeaf
 				allTraversed, err := dbstate.WalkRangeOfAccounts(request.Prefixes[i], MaxLeavesPerPrefix,
 					func(key common.Hash, value *accounts.Account) {
-						leaves = append(leaves, accountLeaf{key, value})
+						leaves = append(leaves, accountLeaf{key, value.SelfCopy()})
 					},
 				)
 				if err != nil {
@@ -820,7 +901,12 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 		return p2p.Send(p.rw, StateRangesCode, response)
 
 	case StateRangesCode:
-		return errResp(ErrNotImplemented, "Not implemented yet")
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var response stateRangesMsg
+		if err := msgStream.Decode(&response); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.deliver(StateRangesCode, response.ID, &response)
 
 	case GetStorageRangesCode:
 		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
@@ -882,7 +968,12 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 		return p2p.Send(p.rw, StorageRangesCode, response)
 
 	case StorageRangesCode:
-		return errResp(ErrNotImplemented, "Not implemented yet")
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var response storageRangesMsg
+		if err := msgStream.Decode(&response); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.deliver(StorageRangesCode, response.ID, &response)
 
 	case GetStateNodesCode:
 		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
@@ -926,7 +1017,12 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 		return p2p.Send(p.rw, StateNodesCode, response)
 
 	case StateNodesCode:
-		return errResp(ErrNotImplemented, "Not implemented yet")
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var response stateNodesMsg
+		if err := msgStream.Decode(&response); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.deliver(StateNodesCode, response.ID, &response)
 
 	case GetStorageNodesCode:
 		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
@@ -987,7 +1083,12 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 		return p2p.Send(p.rw, StorageNodesCode, response)
 
 	case StorageNodesCode:
-		return errResp(ErrNotImplemented, "Not implemented yet")
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var response storageNodesMsg
+		if err := msgStream.Decode(&response); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.deliver(StorageNodesCode, response.ID, &response)
 
 	case GetBytecodeCode:
 		// Decode the retrieval message
@@ -1041,7 +1142,12 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 		return p.SendByteCode(reqID, code)
 
 	case BytecodeCode:
-		return errResp(ErrNotImplemented, "Not implemented yet")
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var response bytecodeMsg
+		if err := msgStream.Decode(&response); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.deliver(BytecodeCode, response.ID, &response)
 
 	case GetStorageSizesCode:
 		return errResp(ErrNotImplemented, "Not implemented yet")
@@ -1054,6 +1160,39 @@ func (pm *ProtocolManager) handleFirehoseMsg(p *firehosePeer) error {
 	}
 }
 
+func (pm *ProtocolManager) handleWitnessMsg(p *witnessPeer) error {
+	msg, readErr := p.rw.ReadMsg()
+	if readErr != nil {
+		return readErr
+	}
+	if msg.Size > WitnessMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, WitnessMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	switch msg.Code {
+	case GetBlockWitnessCode:
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var request getBlockWitnessMsg
+		if err := msgStream.Decode(&request); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		// Only the witnesses of the recently inserted blocks are available
+		return p.SendBlockWitness(request.ID, pm.blockchain.GetBlockWitness(request.Block))
+
+	case BlockWitnessCode:
+		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
+		var response blockWitnessMsg
+		if err := msgStream.Decode(&response); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		return p.deliver(response.ID, response.Witness)
+
+	default:
+		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+	}
+}
+
 // BroadcastBlock will either propagate a block to a subset of it's peers, or
 // will only announce it's availability (depending what's requested).
 func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
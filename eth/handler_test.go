@@ -1317,3 +1317,60 @@ func TestFirehoseBytecode(t *testing.T) {
 		t.Errorf("unexpected Bytecode response: %v", err)
 	}
 }
+
+// setUpWitnessCache creates a protocol manager which caches the witnesses
+// of the given number of inserted blocks.
+func setUpWitnessCache(t *testing.T, n int) (*ProtocolManager, []*types.Block) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 0, nil, nil)
+	pm.blockchain.EnableWitnessCache(true)
+
+	// Regenerate the genesis of the test protocol manager to build the chain on top of it
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{testBank: {Balance: big.NewInt(1000000)}},
+	}
+	dbGen := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(dbGen)
+	signer := types.HomesteadSigner{}
+	generator := func(i int, block *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(testBank), common.Address{byte(i + 1)}, big.NewInt(10), params.TxGas, nil, nil), signer, testBankKey)
+		assert.NoError(t, err)
+		block.AddTx(tx)
+	}
+	ctx := pm.blockchain.WithContext(context.Background(), big.NewInt(1))
+	blocks, _ := core.GenerateChain(ctx, gspec.Config, genesis, ethash.NewFaker(), dbGen, n, generator)
+	if _, err := pm.blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return pm, blocks
+}
+
+func TestWitnessBlockWitness(t *testing.T) {
+	pm, blocks := setUpWitnessCache(t, 4)
+	peer, _ := newWitnessTestPeer("peer", pm)
+	defer peer.close()
+
+	for i, block := range blocks {
+		witness := pm.blockchain.GetBlockWitness(block.Hash())
+		if len(witness) == 0 {
+			t.Fatalf("block %d: witness is not cached", block.NumberU64())
+		}
+		// The witness must be sufficient to rebuild the state trie of the parent block
+		parent := pm.blockchain.GetBlockByNumber(block.NumberU64() - 1)
+		if _, err := state.NewStateless(parent.Root(), witness, parent.NumberU64(), false, false); err != nil {
+			t.Fatalf("block %d: invalid witness: %v", block.NumberU64(), err)
+		}
+
+		assert.NoError(t, p2p.Send(peer.app, GetBlockWitnessCode, getBlockWitnessMsg{ID: uint64(i), Block: block.Hash()}))
+		if err := p2p.ExpectMsg(peer.app, BlockWitnessCode, blockWitnessMsg{ID: uint64(i), Witness: witness}); err != nil {
+			t.Errorf("block %d: unexpected BlockWitness response: %v", block.NumberU64(), err)
+		}
+	}
+
+	// The witnesses of unknown blocks are not available
+	unknown := common.HexToHash("4444444444444444444444444444444444444444444444444444444444444444")
+	assert.NoError(t, p2p.Send(peer.app, GetBlockWitnessCode, getBlockWitnessMsg{ID: 100, Block: unknown}))
+	if err := p2p.ExpectMsg(peer.app, BlockWitnessCode, blockWitnessMsg{ID: 100, Witness: []byte{}}); err != nil {
+		t.Errorf("unexpected BlockWitness response: %v", err)
+	}
+}
@@ -165,6 +165,12 @@ type testFirehosePeer struct {
 	peer *firehosePeer
 }
 
+type testWitnessPeer struct {
+	net  p2p.MsgReadWriter // Network layer reader/writer to simulate remote messaging
+	app  *p2p.MsgPipeRW    // Application layer reader/writer to simulate the local side
+	peer *witnessPeer
+}
+
 // newTestPeer creates a new peer registered at the given protocol manager.
 func newTestPeer(name string, version int, pm *ProtocolManager, shake bool) (*testPeer, <-chan error) {
 	// Create a message pipe to communicate through
@@ -210,7 +216,7 @@ func newFirehoseTestPeer(name string, pm *ProtocolManager) (*testFirehosePeer, <
 		log.Fatal(err)
 	}
 
-	peer := &firehosePeer{Peer: p2p.NewPeer(id, name, nil), rw: net}
+	peer := newFirehosePeer(p2p.NewPeer(id, name, nil), net)
 
 	// Start the peer on a new thread
 	errc := make(chan error, 1)
@@ -227,6 +233,34 @@ func newFirehoseTestPeer(name string, pm *ProtocolManager) (*testFirehosePeer, <
 	return tp, errc
 }
 
+func newWitnessTestPeer(name string, pm *ProtocolManager) (*testWitnessPeer, <-chan error) {
+	// Create a message pipe to communicate through
+	app, net := p2p.MsgPipe()
+
+	// Generate a random id and create the peer
+	var id enode.ID
+	// #nosec G404
+	if _, err := rand.Read(id[:]); err != nil {
+		log.Fatal(err)
+	}
+
+	peer := newWitnessPeer(p2p.NewPeer(id, name, nil), net)
+
+	// Start the peer on a new thread
+	errc := make(chan error, 1)
+	go func() {
+		select {
+		case <-pm.quitSync:
+			errc <- p2p.DiscQuitting
+		default:
+			errc <- pm.handleWitness(peer)
+		}
+	}()
+
+	tp := &testWitnessPeer{app: app, net: net, peer: peer}
+	return tp, errc
+}
+
 // handshake simulates a trivial handshake that expects the same state from the
 // remote side as we are simulating locally.
 func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID, forkFilter forkid.Filter) {
@@ -269,3 +303,7 @@ func (p *testPeer) close() {
 func (p *testFirehosePeer) close() {
 	p.app.Close()
 }
+
+func (p *testWitnessPeer) close() {
+	p.app.Close()
+}
@@ -76,6 +76,7 @@ const (
 	ErrNoStatusMsg
 	ErrExtraStatusMsg
 	ErrNotImplemented
+	ErrUnexpectedResponse
 )
 
 func (e errCode) String() string {
@@ -94,6 +95,7 @@ var errorToString = map[int]string{
 	ErrNoStatusMsg:             "No status message",
 	ErrExtraStatusMsg:          "Extra status message",
 	ErrNotImplemented:          "Not implemented yet",
+	ErrUnexpectedResponse:      "Unexpected response",
 }
 
 type txPool interface {
@@ -0,0 +1,104 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+var (
+	errNoWitnessPeers     = errors.New("no witness peers to fetch the witness from")
+	errWitnessNotFound    = errors.New("witness not available from any peer")
+	errWitnessPeerDrop    = errors.New("witness peer dropped")
+	errWitnessReqTimeout  = errors.New("witness request timed out")
+	errCancelWitnessFetch = errors.New("witness fetching canceled (requested)")
+)
+
+var (
+	// witnessRequestTimeout is the time allowance for a witness peer to reply to a request.
+	witnessRequestTimeout = 10 * time.Second
+	// witnessFetchAttempts is the number of times the witness peers are asked for the witness.
+	// The block may reach us before the peers have inserted it and extracted the witness.
+	witnessFetchAttempts = 3
+	// witnessRetryDelay is the time to wait before asking the witness peers again.
+	witnessRetryDelay = time.Second
+)
+
+// wait blocks until the response to the request arrives.
+func (p *witnessPeer) wait(ctx context.Context, req *witnessRequest) ([]byte, error) {
+	timer := time.NewTimer(witnessRequestTimeout)
+	defer timer.Stop()
+	select {
+	case witness := <-req.response:
+		return witness, nil
+	case <-p.closed:
+		return nil, errWitnessPeerDrop
+	case <-timer.C:
+		p.untrack(req)
+		return nil, errWitnessReqTimeout
+	case <-ctx.Done():
+		p.untrack(req)
+		return nil, ctx.Err()
+	}
+}
+
+// witnessFetcher implements core.WitnessFetcher by requesting the block witnesses
+// from the witness peers. It is used in stateless sync mode.
+type witnessFetcher struct {
+	peers *witnessPeerSet
+	quit  chan struct{}
+}
+
+func newWitnessFetcher(pm *ProtocolManager) *witnessFetcher {
+	return &witnessFetcher{
+		peers: pm.witnessPeers,
+		quit:  pm.quitSync,
+	}
+}
+
+// FetchBlockWitness asks the witness peers one by one for the witness of the block,
+// until one of them returns the witness matching the state root of the parent block.
+func (f *witnessFetcher) FetchBlockWitness(block *types.Block, parentRoot common.Hash) (*state.Stateless, error) {
+	for attempt := 0; attempt < witnessFetchAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(witnessRetryDelay):
+			case <-f.quit:
+				return nil, errCancelWitnessFetch
+			}
+		}
+		peers := f.peers.Peers()
+		if len(peers) == 0 {
+			return nil, errNoWitnessPeers
+		}
+		for _, p := range peers {
+			s, err := f.fetchFrom(p, block, parentRoot)
+			if err != nil {
+				log.Debug("Witness request failed", "peer", p.id, "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+				continue
+			}
+			if s != nil {
+				return s, nil
+			}
+		}
+	}
+	return nil, errWitnessNotFound
+}
+
+// fetchFrom requests the witness of the block from the peer. It returns nil if the peer doesn't have it.
+func (f *witnessFetcher) fetchFrom(p *witnessPeer, block *types.Block, parentRoot common.Hash) (*state.Stateless, error) {
+	req, err := p.RequestBlockWitness(block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	witness, err := p.wait(context.Background(), req)
+	if err != nil || len(witness) == 0 {
+		return nil, err
+	}
+	return state.NewStateless(parentRoot, witness, block.NumberU64()-1, false, false /* is binary */)
+}
@@ -0,0 +1,60 @@
+package eth
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/eth/downloader"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+	"github.com/ledgerwatch/turbo-geth/p2p/enode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectWitness connects the client protocol manager to the server one over the witness protocol
+// and returns the function to disconnect them.
+func connectWitness(t *testing.T, client, server *ProtocolManager) func() {
+	app, net := p2p.MsgPipe()
+
+	var serverID, clientID enode.ID
+	// #nosec G404
+	rand.Read(serverID[:])
+	// #nosec G404
+	rand.Read(clientID[:])
+	serverPeer := newWitnessPeer(p2p.NewPeer(clientID, "client", nil), net)
+	clientPeer := newWitnessPeer(p2p.NewPeer(serverID, "server", nil), app)
+	go func() { _ = server.handleWitness(serverPeer) }()
+	go func() { _ = client.handleWitness(clientPeer) }()
+	for len(client.witnessPeers.Peers()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return func() {
+		app.Close()
+		client.Stop()
+		server.Stop()
+	}
+}
+
+func TestStatelessSync(t *testing.T) {
+	server, blocks := setUpWitnessCache(t, 4)
+	client, db := newTestProtocolManagerMust(t, downloader.StatelessSync, 0, nil, nil)
+
+	// The blocks can't be validated without the witnesses
+	_, err := client.blockchain.InsertChain(blocks)
+	assert.Error(t, err)
+	assert.Equal(t, uint64(0), client.blockchain.CurrentBlock().NumberU64())
+
+	disconnect := connectWitness(t, client, server)
+	defer disconnect()
+	_, err = client.blockchain.InsertChain(blocks)
+	require.NoError(t, err)
+	assert.Equal(t, blocks[len(blocks)-1].Hash(), client.blockchain.CurrentBlock().Hash())
+
+	// The state of the executed blocks is not kept
+	acc, err := state.NewDbState(db, uint64(len(blocks))).ReadAccountData(common.Address{1})
+	require.NoError(t, err)
+	assert.Nil(t, acc)
+}
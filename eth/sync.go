@@ -179,8 +179,14 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 	if atomic.LoadUint32(&pm.fastSync) == 1 {
 		// Fast sync was explicitly requested, and explicitly granted
 		mode = downloader.FastSync
+		if pm.beamSync {
+			mode = downloader.BeamSync
+		}
+		if pm.firehoseSync {
+			mode = downloader.FirehoseSync
+		}
 	}
-	if mode == downloader.FastSync {
+	if mode == downloader.FastSync || mode == downloader.BeamSync || mode == downloader.FirehoseSync {
 		// Make sure the peer's total difficulty we are synchronizing is higher.
 		if pm.blockchain.GetTdByHash(pm.blockchain.CurrentFastBlock().Hash()).Cmp(pTd) >= 0 {
 			return
@@ -0,0 +1,341 @@
+package tracers
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// ResultTracer is a transaction tracer collecting a JSON result, implemented either by
+// the JavaScript Tracer or by the native versions of the built-in JavaScript tracers.
+type ResultTracer interface {
+	vm.Tracer
+
+	// GetResult returns the result of the tracing, or the error it has failed with
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates the tracing at the first opportune moment
+	Stop(err error)
+}
+
+// native contains the Go implementations of the built-in JavaScript tracers by name.
+// They are run instead of the JavaScript ones, and produce the same results.
+var native = map[string]func() ResultTracer{
+	"4byteTracer":    func() ResultTracer { return newFourByteTracer() },
+	"bigramTracer":   func() ResultTracer { return newBigramTracer() },
+	"callTracer":     func() ResultTracer { return newCallTracer() },
+	"evmdisTracer":   func() ResultTracer { return newEvmdisTracer() },
+	"noopTracer":     func() ResultTracer { return new(noopTracer) },
+	"opcountTracer":  func() ResultTracer { return new(opcountTracer) },
+	"prestateTracer": func() ResultTracer { return newPrestateTracer() },
+	"trigramTracer":  func() ResultTracer { return newTrigramTracer() },
+	"unigramTracer":  func() ResultTracer { return newUnigramTracer() },
+}
+
+// NewNative creates the native version of a built-in JavaScript tracer by name,
+// returning false if there is none.
+func NewNative(name string) (ResultTracer, bool) {
+	if create, ok := native[name]; ok {
+		return create(), true
+	}
+	return nil, false
+}
+
+// nativeTracer implements the interruption of the native tracers, and the parts of
+// the vm.Tracer interface they are not interested in.
+type nativeTracer struct {
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+	err       error  // Error, if one has occurred
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (nt *nativeTracer) Stop(err error) {
+	nt.reason = err
+	atomic.StoreUint32(&nt.interrupt, 1)
+}
+
+// stopped checks whether the tracing has been interrupted, recording the reason
+// as the error of the tracing.
+func (nt *nativeTracer) stopped() bool {
+	if nt.err != nil {
+		return true
+	}
+	if atomic.LoadUint32(&nt.interrupt) > 0 {
+		nt.err = nt.reason
+		return true
+	}
+	return false
+}
+
+// result encodes the result of the tracing, unless it has failed.
+func (nt *nativeTracer) result(v interface{}) (json.RawMessage, error) {
+	if nt.err != nil {
+		return nil, nt.err
+	}
+	return json.Marshal(v)
+}
+
+func (nt *nativeTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (nt *nativeTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (nt *nativeTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
+
+func (nt *nativeTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (nt *nativeTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (nt *nativeTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
+
+// The helpers below reproduce the conversions made by the JavaScript tracers, so that
+// the native ones can produce exactly the same results.
+
+// peek returns the nth-from-the-top element of the stack, or zero if there is none.
+func peek(stack *vm.Stack, n int) *big.Int {
+	return (&stackWrapper{stack: stack}).peek(n)
+}
+
+// peekNumber returns the nth-from-the-top element of the stack as a JavaScript number.
+func peekNumber(stack *vm.Stack, n int) float64 {
+	f, _ := new(big.Float).SetInt(peek(stack, n)).Float64()
+	return f
+}
+
+// memorySlice returns the memory within [begin, end), or nil if it is out of bounds. The
+// offsets are JavaScript numbers, which are clamped to the int range by duktape.
+func memorySlice(memory *vm.Memory, begin, end float64) []byte {
+	b, e := clampInt(begin), clampInt(end)
+	if b < 0 || b > e {
+		return nil
+	}
+	return (&memoryWrapper{memory: memory}).slice(b, e)
+}
+
+func clampInt(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f > math.MaxInt32:
+		return math.MaxInt32
+	case f < math.MinInt32:
+		return math.MinInt32
+	}
+	return int64(f)
+}
+
+// toHex encodes the bytes as the toHex builtin of the JavaScript tracers.
+func toHex(b []byte) string {
+	return hexutil.Encode(b)
+}
+
+// hexNumber encodes the integer as '0x' + bigInt(n).toString(16) of the JavaScript tracers.
+func hexNumber(n int64) string {
+	return "0x" + strconv.FormatInt(n, 16)
+}
+
+// jsNumber formats the number as JavaScript does.
+func jsNumber(f float64) string {
+	blob, _ := json.Marshal(f)
+	return string(blob)
+}
+
+// isPrecompiled checks whether the address is a precompiled contract, as the isPrecompiled
+// builtin of the JavaScript tracers.
+func isPrecompiled(addr common.Address) bool {
+	_, ok := vm.PrecompiledContractsIstanbul[addr]
+	return ok
+}
+
+// noopTracer is the native version of noop_tracer.js.
+type noopTracer struct {
+	nativeTracer
+}
+
+func (t *noopTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	t.stopped()
+	return nil
+}
+
+func (t *noopTracer) GetResult() (json.RawMessage, error) {
+	return t.result(struct{}{})
+}
+
+// opcountTracer is the native version of opcount_tracer.js, counting the instructions executed.
+type opcountTracer struct {
+	nativeTracer
+	count uint64
+}
+
+func (t *opcountTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if !t.stopped() {
+		t.count++
+	}
+	return nil
+}
+
+func (t *opcountTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.count)
+}
+
+// unigramTracer is the native version of unigram_tracer.js, counting the instructions executed by opcode.
+type unigramTracer struct {
+	nativeTracer
+	hist map[string]uint64
+	nops uint64
+}
+
+func newUnigramTracer() *unigramTracer {
+	return &unigramTracer{hist: make(map[string]uint64)}
+}
+
+func (t *unigramTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if !t.stopped() {
+		t.hist[op.String()]++
+		t.nops++
+	}
+	return nil
+}
+
+func (t *unigramTracer) GetResult() (json.RawMessage, error) {
+	if t.nops == 0 {
+		// The JavaScript tracer returns undefined
+		return t.result(nil)
+	}
+	return t.result(t.hist)
+}
+
+// bigramTracer is the native version of bigram_tracer.js, counting the pairs of the consecutive
+// instructions executed in the same call frame.
+type bigramTracer struct {
+	nativeTracer
+	hist      map[string]uint64
+	lastOp    string
+	lastDepth int
+}
+
+func newBigramTracer() *bigramTracer {
+	return &bigramTracer{hist: make(map[string]uint64)}
+}
+
+func (t *bigramTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	if depth == t.lastDepth {
+		t.hist[t.lastOp+"-"+op.String()]++
+	}
+	t.lastOp, t.lastDepth = op.String(), depth
+	return nil
+}
+
+func (t *bigramTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.hist)
+}
+
+// trigramTracer is the native version of trigram_tracer.js, counting the triples of the consecutive
+// instructions executed in the same call frame.
+type trigramTracer struct {
+	nativeTracer
+	hist      map[string]uint64
+	lastOps   [2]string
+	lastDepth int
+}
+
+func newTrigramTracer() *trigramTracer {
+	return &trigramTracer{hist: make(map[string]uint64)}
+}
+
+func (t *trigramTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	if depth != t.lastDepth {
+		t.lastOps = [2]string{}
+		t.lastDepth = depth
+		return nil
+	}
+	t.hist[t.lastOps[0]+"-"+t.lastOps[1]+"-"+op.String()]++
+	t.lastOps[0], t.lastOps[1] = t.lastOps[1], op.String()
+	return nil
+}
+
+func (t *trigramTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.hist)
+}
+
+// fourByteTracer is the native version of 4byte_tracer.js, collecting the method identifiers
+// of the calls along with the sizes of their arguments.
+type fourByteTracer struct {
+	nativeTracer
+	ids   map[string]uint64
+	input []byte
+}
+
+func newFourByteTracer() *fourByteTracer {
+	return &fourByteTracer{ids: make(map[string]uint64)}
+}
+
+// store saves the given identifier and data size.
+func (t *fourByteTracer) store(id []byte, size float64) {
+	t.ids[toHex(id)+"-"+jsNumber(size)]++
+}
+
+func (t *fourByteTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if depth == 0 {
+		t.input = common.CopyBytes(input)
+	}
+	return nil
+}
+
+func (t *fourByteTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	// Skip any opcodes that are not internal calls, and locate the input on the stack
+	var in int
+	switch op {
+	case vm.CALL, vm.CALLCODE:
+		in = 3
+	case vm.DELEGATECALL, vm.STATICCALL:
+		in = 2
+	default:
+		return nil
+	}
+	// Skip any pre-compile invocations, those are just fancy opcodes
+	if isPrecompiled(common.BigToAddress(peek(stack, 1))) {
+		return nil
+	}
+	if size := peekNumber(stack, in+1); size >= 4 {
+		off := peekNumber(stack, in)
+		t.store(memorySlice(memory, off, off+4), size-4)
+	}
+	return nil
+}
+
+func (t *fourByteTracer) GetResult() (json.RawMessage, error) {
+	// Save the outer calldata also
+	if len(t.input) >= 4 {
+		t.store(t.input[:4], float64(len(t.input)-4))
+	}
+	return t.result(t.ids)
+}
@@ -0,0 +1,250 @@
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// callFrame is a call reported by the callTracer. The empty fields are the ones left
+// undefined by call_tracer.js, the unexported ones are the ones it deletes.
+type callFrame struct {
+	Type    string       `json:"type,omitempty"`
+	From    string       `json:"from,omitempty"`
+	To      string       `json:"to,omitempty"`
+	Value   string       `json:"value,omitempty"`
+	Gas     string       `json:"gas,omitempty"`
+	GasUsed string       `json:"gasUsed,omitempty"`
+	Input   string       `json:"input,omitempty"`
+	Output  string       `json:"output,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Time    string       `json:"time,omitempty"`
+	Calls   []*callFrame `json:"calls,omitempty"`
+
+	gas     *uint64 // Gas available within the call, if known
+	gasIn   uint64  // Gas available before the call
+	gasCost uint64  // Cost of the calling instruction
+	outOff  float64 // Memory region of the returned data
+	outLen  float64
+}
+
+// callTracer is the native version of call_tracer.js, reporting the tree of the calls
+// made by a transaction.
+type callTracer struct {
+	nativeTracer
+
+	callstack []*callFrame // Current recursive call stack of the EVM execution
+	descended bool         // Whether the execution has just descended into an inner call
+
+	// Transaction context
+	create  bool
+	from    common.Address
+	to      common.Address
+	input   []byte
+	gas     uint64
+	value   *big.Int
+	output  []byte
+	gasUsed uint64
+	time    string
+	failure string
+}
+
+func newCallTracer() *callTracer {
+	return &callTracer{callstack: []*callFrame{{}}, value: new(big.Int)}
+}
+
+func (t *callTracer) top() *callFrame {
+	return t.callstack[len(t.callstack)-1]
+}
+
+func (t *callTracer) pop() *callFrame {
+	call := t.top()
+	t.callstack = t.callstack[:len(t.callstack)-1]
+	return call
+}
+
+func (t *callTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if depth != 0 {
+		return nil
+	}
+	t.create, t.from, t.to, t.gas = create, from, to, gas
+	t.input = common.CopyBytes(input)
+	t.value = new(big.Int)
+	if value != nil {
+		t.value.Set(value)
+	}
+	return nil
+}
+
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	// Capture any errors immediately
+	if err != nil {
+		t.fault(err)
+		return nil
+	}
+	switch op {
+	case vm.CREATE, vm.CREATE2:
+		// If a new contract is being created, add to the call stack
+		inOff := peekNumber(stack, 1)
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    toHex(contract.Address().Bytes()),
+			Input:   toHex(memorySlice(memory, inOff, inOff+peekNumber(stack, 2))),
+			Value:   "0x" + peek(stack, 0).Text(16),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return nil
+
+	case vm.SELFDESTRUCT:
+		// If a contract is being self destructed, gather that as a subcall too
+		t.top().Calls = append(t.top().Calls, &callFrame{Type: op.String()})
+		return nil
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		// Skip any pre-compile invocations, those are just fancy opcodes
+		to := common.BigToAddress(peek(stack, 1))
+		if isPrecompiled(to) {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		inOff := peekNumber(stack, 2+off)
+		call := &callFrame{
+			Type:    op.String(),
+			From:    toHex(contract.Address().Bytes()),
+			To:      toHex(to.Bytes()),
+			Input:   toHex(memorySlice(memory, inOff, inOff+peekNumber(stack, 3+off))),
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  peekNumber(stack, 4+off),
+			outLen:  peekNumber(stack, 5+off),
+		}
+		if off == 1 {
+			call.Value = "0x" + peek(stack, 2).Text(16)
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return nil
+	}
+	// If we've just descended into an inner call, retrieve its true allowance. Calls to
+	// plain accounts do not execute any code, so their allowance remains unknown.
+	if t.descended {
+		if depth >= len(t.callstack) {
+			allowance := gas
+			t.top().gas = &allowance
+		}
+		t.descended = false
+	}
+	// If an existing call is returning, pop off the call stack
+	if op == vm.REVERT {
+		t.top().Error = "execution reverted"
+		return nil
+	}
+	if depth == len(t.callstack)-1 {
+		// Pop off the last call and get the execution results
+		call := t.pop()
+		if call.Type == vm.CREATE.String() || call.Type == vm.CREATE2.String() {
+			// If the call was a CREATE, retrieve the contract address and output code
+			call.GasUsed = hexNumber(int64(call.gasIn) - int64(call.gasCost) - int64(gas))
+			if ret := peek(stack, 0); ret.Sign() != 0 {
+				created := common.BigToAddress(ret)
+				call.To = toHex(created.Bytes())
+				call.Output = toHex(env.IntraBlockState.GetCode(created))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		} else if call.gas != nil {
+			// If the call was a contract call, retrieve the gas usage and output
+			call.GasUsed = hexNumber(int64(call.gasIn) - int64(call.gasCost) + int64(*call.gas) - int64(gas))
+			if ret := peek(stack, 0); ret.Sign() != 0 {
+				call.Output = toHex(memorySlice(memory, call.outOff, call.outOff+call.outLen))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		}
+		if call.gas != nil {
+			call.Gas = hexNumber(int64(*call.gas))
+		}
+		// Inject the call into the previous one
+		t.top().Calls = append(t.top().Calls, call)
+	}
+	return nil
+}
+
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err == nil {
+		t.fault(err)
+	}
+	return nil
+}
+
+// fault handles a failure of the current call
+func (t *callTracer) fault(err error) {
+	// If the topmost call already reverted, don't handle the additional fault again
+	if t.top().Error != "" {
+		return
+	}
+	// Pop off the just failed call, consuming all available gas
+	call := t.pop()
+	call.Error = err.Error()
+	if call.gas != nil {
+		call.Gas = hexNumber(int64(*call.gas))
+		call.GasUsed = call.Gas
+	}
+	// Flatten the failed call into its parent, unless it is the last one
+	if len(t.callstack) > 0 {
+		t.top().Calls = append(t.top().Calls, call)
+		return
+	}
+	t.callstack = append(t.callstack, call)
+}
+
+func (t *callTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if depth != 0 {
+		return nil
+	}
+	t.output = common.CopyBytes(output)
+	t.gasUsed = gasUsed
+	t.time = d.String()
+	if err != nil {
+		t.failure = err.Error()
+	}
+	return nil
+}
+
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	result := &callFrame{
+		Type:    vm.CALL.String(),
+		From:    toHex(t.from.Bytes()),
+		To:      toHex(t.to.Bytes()),
+		Value:   "0x" + t.value.Text(16),
+		Gas:     hexNumber(int64(t.gas)),
+		GasUsed: hexNumber(int64(t.gasUsed)),
+		Input:   toHex(t.input),
+		Output:  toHex(t.output),
+		Time:    t.time,
+		Calls:   t.callstack[0].Calls,
+	}
+	if t.create {
+		result.Type = vm.CREATE.String()
+	}
+	if t.callstack[0].Error != "" {
+		result.Error = t.callstack[0].Error
+	} else if t.failure != "" {
+		result.Error = t.failure
+	}
+	if result.Error != "" {
+		result.Output = ""
+	}
+	return t.result(result)
+}
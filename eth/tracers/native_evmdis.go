@@ -0,0 +1,190 @@
+package tracers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// evmdisPushes is the number of the items pushed onto the stack by the instructions, as
+// listed by evmdis_tracer.js. The results of the instructions missing are not reported.
+var evmdisPushes = map[vm.OpCode]int{
+	0: 0, 1: 1, 2: 1, 3: 1, 4: 1, 5: 1, 6: 1, 7: 1, 8: 1, 9: 1, 10: 1, 11: 1, 16: 1, 17: 1, 18: 1, 19: 1, 20: 1,
+	21: 1, 22: 1, 23: 1, 24: 1, 25: 1, 26: 1, 32: 1, 48: 1, 49: 1, 50: 1, 51: 1, 52: 1, 53: 1, 54: 1, 55: 0, 56: 1,
+	57: 0, 58: 1, 59: 1, 60: 0, 64: 1, 65: 1, 66: 1, 67: 1, 68: 1, 69: 1, 80: 0, 81: 1, 82: 0, 83: 0, 84: 1, 85: 0,
+	86: 0, 87: 0, 88: 1, 89: 1, 90: 1, 91: 0, 96: 1, 97: 1, 98: 1, 99: 1, 100: 1, 101: 1, 102: 1, 103: 1, 104: 1,
+	105: 1, 106: 1, 107: 1, 108: 1, 109: 1, 110: 1, 111: 1, 112: 1, 113: 1, 114: 1, 115: 1, 116: 1, 117: 1, 118: 1,
+	119: 1, 120: 1, 121: 1, 122: 1, 123: 1, 124: 1, 125: 1, 126: 1, 127: 1, 128: 2, 129: 3, 130: 4, 131: 5, 132: 6,
+	133: 7, 134: 8, 135: 9, 136: 10, 137: 11, 138: 12, 139: 13, 140: 14, 141: 15, 142: 16, 143: 17, 144: 2, 145: 3,
+	146: 4, 147: 5, 148: 6, 149: 7, 150: 8, 151: 9, 152: 10, 153: 11, 154: 12, 155: 13, 156: 14, 157: 15, 158: 16,
+	159: 17, 160: 0, 161: 0, 162: 0, 163: 0, 164: 0, 240: 1, 241: 1, 242: 1, 243: 0, 244: 0, 255: 0,
+}
+
+// jsBuffer is a byte slice encoded as a duktape buffer, an object keyed by the indices of the bytes.
+type jsBuffer []byte
+
+func (b jsBuffer) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range b {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`"` + strconv.Itoa(i) + `":` + strconv.Itoa(int(c)))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// evmdisOp is an instruction reported by the evmdisTracer. The calls are also the frames
+// of the instructions executed by them.
+type evmdisOp struct {
+	op     vm.OpCode
+	depth  int
+	result []string
+	call   bool
+	gas    float64
+	to     string
+	value  string
+	input  jsBuffer
+	error  *string
+	ret    jsBuffer
+	ops    []*evmdisOp
+	pc     *uint64
+	length *int
+}
+
+// MarshalJSON encodes the instruction with the fields in the order set by evmdis_tracer.js.
+func (o *evmdisOp) MarshalJSON() ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	field := func(key string, value interface{}) {
+		if err != nil {
+			return
+		}
+		var blob []byte
+		if blob, err = json.Marshal(value); err != nil {
+			return
+		}
+		if buf.Len() == 0 {
+			buf.WriteByte('{')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.Quote(key) + ":")
+		buf.Write(blob)
+	}
+	if o.call && (o.op == vm.DELEGATECALL || o.op == vm.STATICCALL) {
+		field("op", o.op.String())
+	} else {
+		field("op", int(o.op))
+	}
+	field("depth", o.depth)
+	field("result", o.result)
+	if o.call {
+		field("gas", o.gas)
+		field("to", o.to)
+		if o.op == vm.CALL || o.op == vm.CALLCODE {
+			field("value", o.value)
+		}
+		field("input", o.input)
+		field("error", o.error)
+		if o.ret == nil {
+			field("return", nil)
+		} else {
+			field("return", o.ret)
+		}
+		field("ops", o.ops)
+	}
+	if o.pc != nil {
+		field("pc", *o.pc)
+	}
+	if o.length != nil {
+		field("len", *o.length)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), err
+}
+
+// evmdisTracer is the native version of evmdis_tracer.js, returning sufficient information
+// from a trace to perform evmdis-style disassembly.
+type evmdisTracer struct {
+	nativeTracer
+	stack []*evmdisOp
+}
+
+func newEvmdisTracer() *evmdisTracer {
+	return &evmdisTracer{stack: []*evmdisOp{{ops: []*evmdisOp{}}}}
+}
+
+func (t *evmdisTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	frame := t.stack[len(t.stack)-1]
+	switch {
+	case err != nil:
+		msg := err.Error()
+		frame.error = &msg
+
+	case depth == len(t.stack):
+		info := &evmdisOp{op: op, depth: depth, result: []string{}}
+		if len(frame.ops) > 0 {
+			// Record the results of the previous instruction, unless it has been
+			// relabelled by name as the JavaScript tracer does for some calls
+			prev := frame.ops[len(frame.ops)-1]
+			if !prev.call || (prev.op != vm.DELEGATECALL && prev.op != vm.STATICCALL) {
+				for i := 0; i < evmdisPushes[prev.op]; i++ {
+					prev.result = append(prev.result, peek(stack, i).Text(16))
+				}
+			}
+		}
+		switch op {
+		case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+			in := 2
+			if op == vm.CALL || op == vm.CALLCODE {
+				in = 3
+				info.value = peek(stack, 2).String()
+			}
+			inStart := peekNumber(stack, in)
+			info.call = true
+			info.gas = peekNumber(stack, 0)
+			info.to = peek(stack, 1).Text(16)
+			info.input = memorySlice(memory, inStart, inStart+peekNumber(stack, in+1))
+			if info.input == nil {
+				info.input = jsBuffer{}
+			}
+			info.ops = []*evmdisOp{}
+			t.stack = append(t.stack, info)
+		case vm.RETURN:
+			out := peekNumber(stack, 0)
+			frame.ret = memorySlice(memory, out, out+peekNumber(stack, 1))
+			if frame.ret == nil {
+				frame.ret = jsBuffer{}
+			}
+		case vm.STOP:
+			frame.ret = jsBuffer{}
+		case vm.JUMPDEST:
+			info.pc = &pc
+		}
+		if op.IsPush() {
+			length := int(op) - 0x5e
+			info.length = &length
+		}
+		frame.ops = append(frame.ops, info)
+
+	default:
+		if depth < len(t.stack) {
+			t.stack = t.stack[:depth]
+		}
+	}
+	return nil
+}
+
+func (t *evmdisTracer) GetResult() (json.RawMessage, error) {
+	return t.result(t.stack[0].ops)
+}
@@ -0,0 +1,128 @@
+package tracers
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+// prestateAccount is an account of the prestate, in the genesis alloc format.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   int64                       `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// prestateTracer is the native version of prestate_tracer.js, reporting the state accessed
+// by a transaction as it was before the transaction.
+type prestateTracer struct {
+	nativeTracer
+
+	prestate map[common.Address]*prestateAccount
+	db       vm.IntraBlockState
+
+	// Transaction context
+	create bool
+	from   common.Address
+	to     common.Address
+	value  *big.Int
+}
+
+func newPrestateTracer() *prestateTracer {
+	return &prestateTracer{value: new(big.Int)}
+}
+
+// lookupAccount injects the specified account into the prestate.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	t.prestate[addr] = &prestateAccount{
+		Balance: (*hexutil.Big)(new(big.Int).Set(t.db.GetBalance(addr))),
+		Nonce:   int64(t.db.GetNonce(addr)),
+		Code:    common.CopyBytes(t.db.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage injects the specified storage entry of the given account into the prestate.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	t.lookupAccount(addr)
+	if _, ok := t.prestate[addr].Storage[key]; !ok {
+		t.prestate[addr].Storage[key] = t.db.GetState(addr, key)
+	}
+}
+
+func (t *prestateTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if depth != 0 {
+		return nil
+	}
+	t.create, t.from, t.to = create, from, to
+	if value != nil {
+		t.value.Set(value)
+	}
+	return nil
+}
+
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.stopped() {
+		return nil
+	}
+	t.db = env.IntraBlockState
+
+	// Add the current account if we just started tracing. Its balance will potentially be
+	// wrong, since it includes the value sent along with the message. It is fixed in GetResult.
+	if t.prestate == nil {
+		t.prestate = make(map[common.Address]*prestateAccount)
+		t.lookupAccount(contract.Address())
+	}
+	// Whenever new state is accessed, add it to the prestate
+	switch op {
+	case vm.EXTCODECOPY, vm.EXTCODESIZE, vm.BALANCE:
+		t.lookupAccount(common.BigToAddress(peek(stack, 0)))
+	case vm.CREATE:
+		from := contract.Address()
+		t.lookupAccount(crypto.CreateAddress(from, t.db.GetNonce(from)))
+	case vm.CREATE2:
+		offset := peekNumber(stack, 1)
+		code := memorySlice(memory, offset, offset+peekNumber(stack, 2))
+		t.lookupAccount(crypto.CreateAddress2(contract.Address(), common.BigToHash(peek(stack, 3)), crypto.Keccak256(code)))
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.lookupAccount(common.BigToAddress(peek(stack, 1)))
+	case vm.SSTORE, vm.SLOAD:
+		t.lookupStorage(contract.Address(), common.BigToHash(peek(stack, 0)))
+	}
+	return nil
+}
+
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	if t.prestate == nil {
+		// The JavaScript tracer fails the same way, as no state can be read without executing any code
+		return nil, errors.New("no code executed to read the prestate from")
+	}
+	// At this point, we need to deduct the value from the outer transaction, and move it back to the origin
+	t.lookupAccount(t.from)
+	t.lookupAccount(t.to)
+
+	to, from := t.prestate[t.to], t.prestate[t.from]
+	to.Balance = (*hexutil.Big)(new(big.Int).Sub(to.Balance.ToInt(), t.value))
+	from.Balance = (*hexutil.Big)(new(big.Int).Add(from.Balance.ToInt(), t.value))
+
+	// Decrement the caller's nonce, and remove empty create targets
+	from.Nonce--
+	if t.create {
+		// The contract prestate can be deleted blindly, as any existing state would
+		// have caused the transaction to be rejected as invalid in the first place.
+		delete(t.prestate, t.to)
+	}
+	return t.result(t.prestate)
+}
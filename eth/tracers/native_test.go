@@ -0,0 +1,171 @@
+package tracers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+	"github.com/ledgerwatch/turbo-geth/tests"
+)
+
+// loadCallTracerTests reads the call tracer test cases from the test harness.
+func loadCallTracerTests(t testing.TB) map[string]*callTracerTest {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	cases := make(map[string]*callTracerTest)
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+		if err != nil {
+			t.Fatalf("failed to read testcase: %v", err)
+		}
+		test := new(callTracerTest)
+		if err := json.Unmarshal(blob, test); err != nil {
+			t.Fatalf("failed to parse testcase: %v", err)
+		}
+		cases[camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json"))] = test
+	}
+	return cases
+}
+
+// runTracerTest executes the transaction of the test case on top of its prestate with the given tracer.
+func runTracerTest(t testing.TB, test *callTracerTest, tracer ResultTracer) (json.RawMessage, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+
+	evmContext := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      origin,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+		GasPrice:    tx.GasPrice(),
+	}
+	ctx := test.Genesis.Config.WithEIPsFlags(context.Background(), big.NewInt(1))
+	statedb, _, err := tests.MakePreState(ctx, ethdb.NewMemDatabase(), test.Genesis.Alloc, 0)
+	if err != nil {
+		t.Fatalf("failed to make prestate: %v", err)
+	}
+	evm := vm.NewEVM(evmContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, _, _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	return tracer.GetResult()
+}
+
+// Tests that the native callTracer produces the expected results of the test harness.
+func TestNativeCallTracer(t *testing.T) {
+	for name, test := range loadCallTracerTests(t) {
+		tracer, ok := NewNative("callTracer")
+		if !ok {
+			t.Fatalf("native callTracer missing")
+		}
+		res, err := runTracerTest(t, test, tracer)
+		if err != nil {
+			t.Fatalf("%s: failed to retrieve trace result: %v", name, err)
+		}
+		ret := new(callTrace)
+		if err := json.Unmarshal(res, ret); err != nil {
+			t.Fatalf("%s: failed to unmarshal trace result: %v", name, err)
+		}
+		if !reflect.DeepEqual(ret, test.Result) {
+			t.Errorf("%s: trace mismatch: \nhave %+v\nwant %+v", name, ret, test.Result)
+		}
+	}
+}
+
+// Tests that all the native tracers produce the same results as their JavaScript versions.
+func TestNativeTracersMatchJavaScript(t *testing.T) {
+	var names []string
+	for name := range native {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) != len(all) {
+		t.Errorf("native tracer count mismatch: have %d, want %d", len(names), len(all))
+	}
+	cases := loadCallTracerTests(t)
+	for _, name := range names {
+		for testName, test := range cases {
+			jsTracer, err := New(name)
+			if err != nil {
+				t.Fatalf("failed to create %s: %v", name, err)
+			}
+			jsRes, jsErr := runTracerTest(t, test, jsTracer)
+			nativeTracer, _ := NewNative(name)
+			nativeRes, nativeErr := runTracerTest(t, test, nativeTracer)
+			if (jsErr != nil) != (nativeErr != nil) {
+				t.Errorf("%s/%s: error mismatch: have %v, want %v", name, testName, nativeErr, jsErr)
+				continue
+			}
+			var want, have interface{}
+			if err := json.Unmarshal(jsRes, &want); err != nil {
+				t.Fatalf("%s/%s: failed to unmarshal JavaScript result %s: %v", name, testName, jsRes, err)
+			}
+			if err := json.Unmarshal(nativeRes, &have); err != nil {
+				t.Fatalf("%s/%s: failed to unmarshal native result %s: %v", name, testName, nativeRes, err)
+			}
+			// The execution time differs between the runs
+			if m, ok := want.(map[string]interface{}); ok && name == "callTracer" {
+				delete(m, "time")
+				delete(have.(map[string]interface{}), "time")
+			}
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("%s/%s: result mismatch:\nhave %s\nwant %s", name, testName, nativeRes, jsRes)
+			}
+		}
+	}
+}
+
+func benchmarkTracer(b *testing.B, create func() ResultTracer) {
+	test := loadCallTracerTests(b)["deepCalls"]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := runTracerTest(b, test, create()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNativeCallTracer(b *testing.B) {
+	benchmarkTracer(b, func() ResultTracer { return newCallTracer() })
+}
+
+func BenchmarkJavaScriptCallTracer(b *testing.B) {
+	benchmarkTracer(b, func() ResultTracer {
+		tracer, err := New("callTracer")
+		if err != nil {
+			b.Fatal(err)
+		}
+		return tracer
+	})
+}
@@ -0,0 +1,180 @@
+package eth
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/p2p"
+)
+
+// WitnessName is the official short name of the protocol used during capability negotiation.
+var WitnessName = "witness"
+
+// WitnessVersions are the supported versions of the Witness protocol.
+var WitnessVersions = []uint{1}
+
+// WitnessLengths are the number of implemented message corresponding to different protocol versions.
+var WitnessLengths = []uint64{2}
+
+// WitnessMaxMsgSize is the maximum cap on the size of a message.
+const WitnessMaxMsgSize = 10 * 1024 * 1024
+
+// Witness protocol message codes
+const (
+	GetBlockWitnessCode = 0x00
+	BlockWitnessCode    = 0x01
+)
+
+type getBlockWitnessMsg struct {
+	ID    uint64
+	Block common.Hash
+}
+
+// blockWitnessMsg carries the serialised witness of the requested block.
+// The witness is empty if the peer doesn't have it, e.g. because the block is not recent.
+type blockWitnessMsg struct {
+	ID      uint64
+	Witness []byte
+}
+
+type witnessPeer struct {
+	*p2p.Peer
+	rw p2p.MsgReadWriter
+	id string
+
+	lock    sync.Mutex
+	nextID  uint64
+	pending map[uint64]*witnessRequest // requests sent to the peer and not answered yet
+	closed  chan struct{}              // closed when the peer disconnects
+}
+
+func newWitnessPeer(p *p2p.Peer, rw p2p.MsgReadWriter) *witnessPeer {
+	id := p.ID()
+	return &witnessPeer{
+		Peer:    p,
+		rw:      rw,
+		id:      fmt.Sprintf("%x", id[:8]),
+		pending: make(map[uint64]*witnessRequest),
+		closed:  make(chan struct{}),
+	}
+}
+
+// witnessRequest is a request sent to a witness peer and awaiting the response.
+type witnessRequest struct {
+	id       uint64
+	block    common.Hash // block which witness is requested
+	response chan []byte // receives the witness, empty if the peer doesn't have it
+}
+
+// SendBlockWitness sends a BlockWitnessCode message.
+func (p *witnessPeer) SendBlockWitness(id uint64, witness []byte) error {
+	msg := blockWitnessMsg{ID: id, Witness: witness}
+	return p2p.Send(p.rw, BlockWitnessCode, msg)
+}
+
+// RequestBlockWitness sends a GetBlockWitnessCode message.
+func (p *witnessPeer) RequestBlockWitness(block common.Hash) (*witnessRequest, error) {
+	req := p.track(block)
+	msg := getBlockWitnessMsg{ID: req.id, Block: block}
+	if err := p2p.Send(p.rw, GetBlockWitnessCode, msg); err != nil {
+		p.untrack(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// track allocates a new request ID and registers the request as pending.
+func (p *witnessPeer) track(block common.Hash) *witnessRequest {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	req := &witnessRequest{
+		id:       p.nextID,
+		block:    block,
+		response: make(chan []byte, 1),
+	}
+	p.nextID++
+	p.pending[req.id] = req
+	return req
+}
+
+// untrack forgets about the request, e.g. when it has timed out.
+// A late response to an untracked request is treated as unexpected.
+func (p *witnessPeer) untrack(req *witnessRequest) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.pending, req.id)
+}
+
+// deliver matches the response against a pending request and hands it over to the requester.
+// Whether the witness matches the state root of the requested block is checked by the requester.
+func (p *witnessPeer) deliver(id uint64, witness []byte) error {
+	p.lock.Lock()
+	req, ok := p.pending[id]
+	delete(p.pending, id)
+	p.lock.Unlock()
+
+	if !ok {
+		return errResp(ErrUnexpectedResponse, "unknown request id %d", id)
+	}
+	req.response <- witness
+	return nil
+}
+
+// close notifies the requesters waiting for responses that the peer is gone.
+func (p *witnessPeer) close() {
+	close(p.closed)
+}
+
+// witnessPeerSet represents the collection of active witness peers.
+type witnessPeerSet struct {
+	peers map[string]*witnessPeer
+	lock  sync.RWMutex
+}
+
+func newWitnessPeerSet() *witnessPeerSet {
+	return &witnessPeerSet{
+		peers: make(map[string]*witnessPeer),
+	}
+}
+
+// Register injects a new peer into the working set, or returns an error if the
+// peer is already known.
+func (ps *witnessPeerSet) Register(p *witnessPeer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if _, ok := ps.peers[p.id]; ok {
+		return errAlreadyRegistered
+	}
+	ps.peers[p.id] = p
+	return nil
+}
+
+// Unregister removes a remote peer from the active set.
+func (ps *witnessPeerSet) Unregister(id string) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if _, ok := ps.peers[id]; !ok {
+		return errNotRegistered
+	}
+	delete(ps.peers, id)
+	return nil
+}
+
+// Peer retrieves the registered peer with the given id.
+func (ps *witnessPeerSet) Peer(id string) *witnessPeer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	return ps.peers[id]
+}
+
+// Peers retrieves all the registered peers.
+func (ps *witnessPeerSet) Peers() []*witnessPeer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	list := make([]*witnessPeer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		list = append(list, p)
+	}
+	return list
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/dgraph-io/badger"
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/log"
 )
@@ -185,7 +186,7 @@ func (db *BadgerDatabase) PutS(hBucket, key, value []byte, timestamp uint64, cha
 			return err
 		}
 
-		var sh *dbutils.ChangeSet
+		sh := dbutils.NewChangeSet()
 		if err == nil {
 			err = changeSetItem.Value(func(val []byte) error {
 				var err2 error
@@ -489,14 +490,109 @@ func (db *BadgerDatabase) MemCopy() Database {
 	return newDb
 }
 
-// TODO [Issue 144] Implement the methods
-
+// WalkAsOf is similar to Walk, but iterates over the values valid as of a given timestamp.
 func (db *BadgerDatabase) WalkAsOf(bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func([]byte, []byte) (bool, error)) error {
-	panic("Not implemented")
+	return db.db.View(func(tx *badger.Txn) error {
+		return badgerWalkAsOf(tx, bucket, hBucket, startkey, fixedbits, timestamp, walker)
+	})
 }
 
+// MultiWalkAsOf is similar to multiple WalkAsOf calls folded into one.
 func (db *BadgerDatabase) MultiWalkAsOf(bucket, hBucket []byte, startkeys [][]byte, fixedbits []uint, timestamp uint64, walker func(int, []byte, []byte) error) error {
-	panic("Not implemented")
+	return db.db.View(func(tx *badger.Txn) error {
+		for i := range startkeys {
+			keyIdx := i
+			err := badgerWalkAsOf(tx, bucket, hBucket, startkeys[keyIdx], fixedbits[keyIdx], timestamp, func(k, v []byte) (bool, error) {
+				if err := walker(keyIdx, k, v); err != nil {
+					return false, err
+				}
+				return true, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func badgerWalkAsOf(tx *badger.Txn, bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func([]byte, []byte) (bool, error)) error {
+	fixedbytes, mask := Bytesmask(fixedbits)
+	encodedTS := dbutils.EncodeTimestamp(timestamp)
+	l := len(startkey)
+	fits := func(k []byte) bool {
+		if k == nil {
+			return false
+		}
+		if fixedbits == 0 {
+			return true
+		}
+		return len(k) >= fixedbytes && bytes.Equal(k[:fixedbytes-1], startkey[:fixedbytes-1]) && (k[fixedbytes-1]&mask) == (startkey[fixedbytes-1]&mask)
+	}
+
+	mainIt := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer mainIt.Close()
+	historyIt := tx.NewIterator(badger.DefaultIteratorOptions)
+	defer historyIt.Close()
+
+	mainIt.Seek(bucketKey(bucket, startkey))
+	historyIt.Seek(bucketKey(hBucket, startkey))
+	for {
+		var k, hK []byte
+		if mainIt.Valid() {
+			k = keyWithoutBucket(mainIt.Item().KeyCopy(nil), bucket)
+		}
+		if historyIt.Valid() {
+			hK = keyWithoutBucket(historyIt.Item().KeyCopy(nil), hBucket)
+		}
+		if !fits(k) {
+			k = nil
+		}
+		if !fits(hK) || len(hK) <= l {
+			hK = nil
+		}
+
+		// historical key points to an old block
+		if hK != nil && bytes.Compare(hK[l:], encodedTS) < 0 {
+			historyIt.Seek(bucketKey(hBucket, append(hK[:l], encodedTS...)))
+			continue
+		}
+
+		var cmp int
+		if k == nil {
+			if hK == nil {
+				return nil
+			}
+			cmp = 1
+		} else if hK == nil {
+			cmp = -1
+		} else {
+			cmp = bytes.Compare(k, hK[:l])
+		}
+
+		var key []byte
+		var item *badger.Item
+		if cmp < 0 {
+			key, item = k, mainIt.Item()
+		} else {
+			key, item = hK[:l], historyIt.Item()
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		goOn, err := walker(key, v)
+		if err != nil || !goOn {
+			return err
+		}
+
+		if cmp <= 0 {
+			mainIt.Next()
+		}
+		if cmp >= 0 {
+			historyIt.Seek(bucketKey(hBucket, append(common.CopyBytes(hK[:l]), EndSuffix...)))
+		}
+	}
 }
 
 func (db *BadgerDatabase) Keys() ([][]byte, error) {
@@ -372,8 +372,10 @@ func (db *BoltDatabase) MultiWalk(bucket []byte, startkeys [][]byte, fixedbits [
 }
 
 func (db *BoltDatabase) WalkAsOf(bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func(k []byte, v []byte) (bool, error)) error {
-	if debug.IsThinHistory() {
-		panic("WalkAsOf")
+	if debug.IsThinHistory() && bytes.Equal(hBucket, dbutils.AccountsHistoryBucket) {
+		return db.db.View(func(tx *bolt.Tx) error {
+			return boltWalkAsOfThin(tx, bucket, hBucket, startkey, fixedbits, timestamp, walker)
+		})
 	}
 
 	fixedbytes, mask := Bytesmask(fixedbits)
@@ -456,8 +458,10 @@ func (db *BoltDatabase) WalkAsOf(bucket, hBucket, startkey []byte, fixedbits uin
 }
 
 func (db *BoltDatabase) MultiWalkAsOf(bucket, hBucket []byte, startkeys [][]byte, fixedbits []uint, timestamp uint64, walker func(int, []byte, []byte) error) error {
-	if debug.IsThinHistory() {
-		panic("MultiWalkAsOf")
+	if debug.IsThinHistory() && bytes.Equal(hBucket, dbutils.AccountsHistoryBucket) {
+		return db.db.View(func(tx *bolt.Tx) error {
+			return boltMultiWalkAsOfThin(tx, bucket, hBucket, startkeys, fixedbits, timestamp, walker)
+		})
 	}
 
 	if len(startkeys) == 0 {
@@ -702,7 +706,7 @@ func (db *BoltDatabase) IdealBatchSize() int {
 	return 100 * 1024
 }
 
-// [TURBO-GETH] Freezer support (not implemented yet)
+// [TURBO-GETH] Freezer support (see rawdb.NewDatabaseWithFreezer)
 // Ancients returns an error as we don't have a backing chain freezer.
 func (db *BoltDatabase) Ancients() (uint64, error) {
 	return 0, errNotSupported
@@ -722,8 +726,3 @@ func InspectDatabase(db Database) error {
 	// see https://github.com/ethereum/go-ethereum/blob/f5d89cdb72c1e82e9deb54754bef8dd20bf12591/core/rawdb/database.go#L224
 	return errNotSupported
 }
-
-func NewDatabaseWithFreezer(db Database, dir, suffix string) (Database, error) {
-	// FIXME: implement freezer in Turbo-Geth
-	return db, nil
-}
@@ -1,6 +1,7 @@
 package ethdb
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/ledgerwatch/turbo-geth/common"
@@ -330,3 +331,55 @@ func TestBoltDB_MultiWalkAsOf(t *testing.T) {
 		t.Fatal("block6")
 	}
 }
+
+func TestGetHistoryChanges(t *testing.T) {
+	db := NewMemDatabase()
+
+	for _, bucket := range [][]byte{dbutils.AccountsHistoryBucket, dbutils.StorageHistoryBucket} {
+		key := common.Hash{1}.Bytes()
+		other := common.Hash{2}.Bytes()
+		if bytes.Equal(bucket, dbutils.StorageHistoryBucket) {
+			key = dbutils.GenerateCompositeStorageKey(common.Hash{1}, 1, common.Hash{1})
+			other = dbutils.GenerateCompositeStorageKey(common.Hash{1}, 1, common.Hash{2})
+		}
+		// The key is created in block 2 and changed in blocks 5 and 9
+		for _, blockNum := range []uint64{2, 5, 9} {
+			if err := db.PutS(bucket, key, []byte("before "+strconv.Itoa(int(blockNum))), blockNum, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.PutS(bucket, other, []byte("other"), blockNum+1, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		current := dbutils.AccountsBucket
+		if bytes.Equal(bucket, dbutils.StorageHistoryBucket) {
+			current = dbutils.StorageBucket
+		}
+		if err := db.Put(current, key, []byte("current")); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, tt := range []struct {
+			start, end uint64
+			expected   []HistoryChange
+		}{
+			{0, 10, []HistoryChange{
+				{2, []byte("before 2"), []byte("before 5")},
+				{5, []byte("before 5"), []byte("before 9")},
+				{9, []byte("before 9"), []byte("current")},
+			}},
+			{3, 5, []HistoryChange{{5, []byte("before 5"), []byte("before 9")}}},
+			{9, 9, []HistoryChange{{9, []byte("before 9"), []byte("current")}}},
+			{6, 8, nil},
+			{10, 20, nil},
+		} {
+			changes, err := GetHistoryChanges(db, current, bucket, key, tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("%s test %d: %v", bucket, i, err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Errorf("%s test %d: changes mismatch: have %s, want %s", bucket, i, spew.Sdump(changes), spew.Sdump(tt.expected))
+			}
+		}
+	}
+}
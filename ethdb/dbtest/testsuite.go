@@ -18,10 +18,13 @@ package dbtest
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
 
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
@@ -249,6 +252,84 @@ func TestDatabaseSuite(t *testing.T, New func() dataStore) {
 	})
 }
 
+// TestHistorySuite runs a suite of tests of the historical (AsOf) queries
+// against a database implementation.
+func TestHistorySuite(t *testing.T, New func() dataStore) {
+	t.Run("WalkAsOf", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		// Current state: keys 1..4
+		for i := byte(1); i <= 4; i++ {
+			if err := db.Put(dbutils.AccountsBucket, historyTestKey(i), []byte(fmt.Sprintf("state %d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Keys 1..7 were changed by block 3, keys 3..7 - by block 5
+		for i := byte(1); i <= 7; i++ {
+			if err := db.PutS(dbutils.AccountsHistoryBucket, historyTestKey(i), []byte(fmt.Sprintf("block 3 %d", i)), 3, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := byte(3); i <= 7; i++ {
+			if err := db.PutS(dbutils.AccountsHistoryBucket, historyTestKey(i), []byte(fmt.Sprintf("block 5 %d", i)), 5, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			startkey  []byte
+			fixedbits uint
+			timestamp uint64
+			want      []string
+		}{
+			{historyTestKey(0), 0, 2, []string{"block 3 1", "block 3 2", "block 3 3", "block 3 4", "block 3 5", "block 3 6", "block 3 7"}},
+			{historyTestKey(0), 0, 3, []string{"block 3 1", "block 3 2", "block 3 3", "block 3 4", "block 3 5", "block 3 6", "block 3 7"}},
+			{historyTestKey(0), 0, 4, []string{"state 1", "state 2", "block 5 3", "block 5 4", "block 5 5", "block 5 6", "block 5 7"}},
+			{historyTestKey(0), 0, 6, []string{"state 1", "state 2", "state 3", "state 4"}},
+			{historyTestKey(3), 0, 6, []string{"state 3", "state 4"}},
+			{historyTestKey(3), 8, 4, []string{"block 5 3"}},
+			{historyTestKey(6), 8, 6, nil},
+		}
+		for i, tt := range tests {
+			var got []string
+			err := db.WalkAsOf(dbutils.AccountsBucket, dbutils.AccountsHistoryBucket, tt.startkey, tt.fixedbits, tt.timestamp, func(k, v []byte) (bool, error) {
+				if len(v) > 0 {
+					got = append(got, string(v))
+				}
+				return true, nil
+			})
+			if err != nil {
+				t.Fatalf("test %d: WalkAsOf failed: %v", i, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("test %d: WalkAsOf(%x, %d, %d): got %q; want %q", i, tt.startkey, tt.fixedbits, tt.timestamp, got, tt.want)
+			}
+		}
+
+		var got []string
+		startkeys := [][]byte{historyTestKey(1), historyTestKey(5), historyTestKey(8)}
+		fixedbits := []uint{8, 8, 8}
+		err := db.MultiWalkAsOf(dbutils.AccountsBucket, dbutils.AccountsHistoryBucket, startkeys, fixedbits, 4, func(idx int, k, v []byte) error {
+			if len(v) > 0 {
+				got = append(got, fmt.Sprintf("%d:%s", idx, v))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("MultiWalkAsOf failed: %v", err)
+		}
+		if want := []string{"0:state 1", "1:block 5 5"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("MultiWalkAsOf: got %q; want %q", got, want)
+		}
+	})
+}
+
+// historyTestKey generates an address hash sized key starting with the given byte.
+func historyTestKey(b byte) []byte {
+	return common.Hash{b}.Bytes()
+}
+
 func iterateKeys(db ethdb.Database) []string {
 	return iterateKeysFromKey(db, []byte{})
 }
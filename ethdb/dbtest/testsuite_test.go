@@ -0,0 +1,60 @@
+// Copyright 2019 The turbo-geth authors
+// This file is part of the turbo-geth library.
+//
+// The turbo-geth library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The turbo-geth library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the turbo-geth library. If not, see <http://www.gnu.org/licenses/>.
+
+package dbtest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestMemoryHistorySuite(t *testing.T) {
+	TestHistorySuite(t, func() dataStore {
+		return ethdb.NewMemDatabase()
+	})
+}
+
+func TestBoltHistorySuite(t *testing.T) {
+	dirname, err := ioutil.TempDir(os.TempDir(), "dbtest_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dirname)
+
+	i := 0
+	TestHistorySuite(t, func() dataStore {
+		i++
+		db, err := ethdb.NewBoltDatabase(path.Join(dirname, "db", string(rune('a'+i))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestBadgerHistorySuite(t *testing.T) {
+	TestHistorySuite(t, func() dataStore {
+		db, err := ethdb.NewEphemeralBadger()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
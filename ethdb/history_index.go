@@ -1,6 +1,8 @@
 package ethdb
 
 import (
+	"bytes"
+
 	"github.com/ledgerwatch/bolt"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/rlp"
@@ -97,9 +99,15 @@ func BoltDBFindByHistory(tx *bolt.Tx, hBucket []byte, key []byte, timestamp uint
 		return nil, ErrKeyNotFound
 	}
 	v, _ := hB.Get(key)
-	index := new(HistoryIndex)
+	return boltFindByIndex(tx, hBucket, key, v, timestamp)
+}
 
-	err := index.Decode(v)
+// boltFindByIndex looks up the value of the key as of the given timestamp,
+// using already fetched encoded HistoryIndex of that key.
+// ErrKeyNotFound is returned if the key hasn't been changed since the timestamp.
+func boltFindByIndex(tx *bolt.Tx, hBucket []byte, key []byte, indexBytes []byte, timestamp uint64) ([]byte, error) {
+	index := new(HistoryIndex)
+	err := index.Decode(indexBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -125,5 +133,97 @@ func BoltDBFindByHistory(tx *bolt.Tx, hBucket []byte, key []byte, timestamp uint
 		return nil, ErrKeyNotFound
 	}
 	return data, nil
+}
+
+// boltWalkAsOfThin implements WalkAsOf for the thin history layout,
+// where hBucket holds a HistoryIndex per key and the historical values live in the ChangeSet bucket.
+// The current bucket and the history index are merged in key order,
+// with the historical value taking precedence whenever the key has been changed since the timestamp.
+func boltWalkAsOfThin(tx *bolt.Tx, bucket, hBucket, startkey []byte, fixedbits uint, timestamp uint64, walker func(k []byte, v []byte) (bool, error)) error {
+	fixedbytes, mask := Bytesmask(fixedbits)
+	fits := func(k []byte) bool {
+		if k == nil {
+			return false
+		}
+		if fixedbits == 0 {
+			return true
+		}
+		return len(k) >= fixedbytes && bytes.Equal(k[:fixedbytes-1], startkey[:fixedbytes-1]) && (k[fixedbytes-1]&mask) == (startkey[fixedbytes-1]&mask)
+	}
+
+	var mainCursor, historyCursor *bolt.Cursor
+	var k, v, hK, hV []byte
+	if b := tx.Bucket(bucket); b != nil {
+		mainCursor = b.Cursor()
+		k, v = mainCursor.Seek(startkey)
+	}
+	if hB := tx.Bucket(hBucket); hB != nil {
+		historyCursor = hB.Cursor()
+		hK, hV = historyCursor.Seek(startkey)
+	}
+	for {
+		if !fits(k) {
+			k = nil
+		}
+		if !fits(hK) {
+			hK = nil
+		}
 
+		var cmp int
+		if k == nil {
+			if hK == nil {
+				return nil
+			}
+			cmp = 1
+		} else if hK == nil {
+			cmp = -1
+		} else {
+			cmp = bytes.Compare(k, hK)
+		}
+
+		var key, val []byte
+		if cmp < 0 {
+			key, val = k, v
+		} else {
+			hVal, err := boltFindByIndex(tx, hBucket, hK, hV, timestamp)
+			if err == nil {
+				key, val = hK, hVal
+			} else if err != ErrKeyNotFound {
+				return err
+			} else if cmp == 0 {
+				// not changed since the timestamp, so the current value is still valid
+				key, val = k, v
+			}
+		}
+		if key != nil {
+			goOn, err := walker(key, val)
+			if err != nil || !goOn {
+				return err
+			}
+		}
+
+		if cmp <= 0 {
+			k, v = mainCursor.Next()
+		}
+		if cmp >= 0 {
+			hK, hV = historyCursor.Next()
+		}
+	}
+}
+
+// boltMultiWalkAsOfThin implements MultiWalkAsOf for the thin history layout.
+func boltMultiWalkAsOfThin(tx *bolt.Tx, bucket, hBucket []byte, startkeys [][]byte, fixedbits []uint, timestamp uint64, walker func(int, []byte, []byte) error) error {
+	for i := range startkeys {
+		keyIdx := i
+		err := boltWalkAsOfThin(tx, bucket, hBucket, startkeys[keyIdx], fixedbits[keyIdx], timestamp, func(k, v []byte) (bool, error) {
+			if err := walker(keyIdx, k, v); err != nil {
+				return false, err
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
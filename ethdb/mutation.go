@@ -437,8 +437,14 @@ func (m *mutation) Close() {
 }
 
 func (m *mutation) NewBatch() DbWithPendingMutations {
+	return NewBatch(m)
+}
+
+// NewBatch creates a mutation on top of the given database. It is used by the
+// database wrappers, which need the pending mutations to go through the wrapper.
+func NewBatch(db Database) DbWithPendingMutations {
 	mm := &mutation{
-		db:               m,
+		db:               db,
 		puts:             newPuts(),
 		changeSetByBlock: make(map[uint64]map[string]*dbutils.ChangeSet),
 	}
@@ -460,14 +466,50 @@ func (m *mutation) ID() uint64 {
 	return m.db.ID()
 }
 
-// [TURBO-GETH] Freezer support (not implemented yet)
-// Ancients returns an error as we don't have a backing chain freezer.
+// [TURBO-GETH] Freezer support
+// The ancient data is not buffered by the mutation, all the calls go straight
+// to the chain freezer of the underlying database (if it has one).
+
 func (m *mutation) Ancients() (uint64, error) {
-	return 0, errNotSupported
+	return m.db.Ancients()
 }
 
-// TruncateAncients returns an error as we don't have a backing chain freezer.
 func (m *mutation) TruncateAncients(items uint64) error {
+	return m.db.TruncateAncients(items)
+}
+
+func (m *mutation) HasAncient(kind string, number uint64) (bool, error) {
+	if reader, ok := m.db.(AncientReader); ok {
+		return reader.HasAncient(kind, number)
+	}
+	return false, errNotSupported
+}
+
+func (m *mutation) Ancient(kind string, number uint64) ([]byte, error) {
+	if reader, ok := m.db.(AncientReader); ok {
+		return reader.Ancient(kind, number)
+	}
+	return nil, errNotSupported
+}
+
+func (m *mutation) AncientSize(kind string) (uint64, error) {
+	if reader, ok := m.db.(AncientReader); ok {
+		return reader.AncientSize(kind)
+	}
+	return 0, errNotSupported
+}
+
+func (m *mutation) AppendAncient(number uint64, hash, header, body, receipt, td []byte) error {
+	if writer, ok := m.db.(AncientWriter); ok {
+		return writer.AppendAncient(number, hash, header, body, receipt, td)
+	}
+	return errNotSupported
+}
+
+func (m *mutation) Sync() error {
+	if writer, ok := m.db.(AncientWriter); ok {
+		return writer.Sync()
+	}
 	return errNotSupported
 }
 
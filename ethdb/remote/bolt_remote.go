@@ -17,7 +17,10 @@
 package remote
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -27,6 +30,7 @@ import (
 	"time"
 
 	"github.com/ledgerwatch/bolt"
+	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ugorji/go/codec"
@@ -34,7 +38,7 @@ import (
 
 // Version is the current version of the remote db protocol. If the protocol changes in a non backwards compatible way,
 // this constant needs to be increased
-const Version uint64 = 2
+const Version uint64 = 5
 
 // Command is the type of command in the boltdb remote protocol
 type Command uint8
@@ -50,16 +54,18 @@ const (
 )
 
 const (
-	// CmdVersion : version
+	// CmdVersion (token): version
 	// is sent from client to server to ask about the version of protocol the server supports
 	// it is also to be used to be sent periodically to make sure the connection stays open
+	// If the server is configured with a token, CmdVersion with the matching token must be the first
+	// command on the connection, otherwise the server responds with an error and closes the connection
 	CmdVersion Command = iota
 	// CmdBeginTx
 	// request starting a new transaction (read-only). It returns transaction's handle (uint64), or 0
 	// if there was an error. If 0 is returned, the corresponding
 	CmdBeginTx
 	// CmdEndTx ()
-	// request the end of the transaction (rollback)
+	// request the end of the transaction (rollback). Writes of the read-write transaction are discarded
 	CmdEndTx
 	// CmdBucket (name): bucketHandle
 	// requests opening a bucket with given name. It returns bucket's handle (uint64)
@@ -94,6 +100,26 @@ const (
 	// Moves given cursor over the next given number of keys and streams back the (key, valueIsEmpty) pairs
 	// Pair with key == nil signifies the end of the stream
 	CmdCursorNextKey
+	// CmdBeginRwTx
+	// request starting a new read-write transaction. Reads inside of it are served like in CmdBeginTx
+	// and do not see the writes of the same transaction. Writes are buffered by the server and
+	// applied atomically (as one bolt Update) on CmdCommit. Only accepted by writable servers
+	CmdBeginRwTx
+	// CmdPut (bucketName, key, value)
+	// requests writing the key into the bucket (created if it does not exist), as part of the read-write transaction
+	CmdPut
+	// CmdDelete (bucketName, key)
+	// requests deleting the key from the bucket, as part of the read-write transaction
+	CmdDelete
+	// CmdCommit ()
+	// requests applying the writes of the read-write transaction and ends the transaction
+	CmdCommit
+	// CmdCursorSeekRange (cursorHandle, seekKey, fixedbits, endKey): (key, value)
+	// Limits given cursor to the range of keys which have the same first fixedbits bits as seekKey (if fixedbits > 0)
+	// and are less than endKey (if endKey is not empty), and moves the cursor to the seekKey, or to the next key after seekKey.
+	// Until the next CmdCursorSeekRange, all the cursor commands return nil key (end of the stream) instead of the keys
+	// outside of the range, so the server does not send anything past the range end
+	CmdCursorSeekRange
 )
 
 const DefaultCursorBatchSize uint64 = 1
@@ -101,6 +127,9 @@ const CursorMaxBatchSize uint64 = 1 * 1000 * 1000
 const ServerMaxConnections uint64 = 2048
 const ClientMaxConnections uint64 = 128
 
+// ServerMaxTxSize is the maximum total size of the keys and values a read-write transaction can write
+const ServerMaxTxSize uint64 = 64 * 1024 * 1024
+
 // tracing enable by evn GODEBUG=remotedb.debug=1
 var tracing bool
 
@@ -236,7 +265,113 @@ func decodeErr(decoder *codec.Decoder, responseCode ResponseCode) error {
 // It runs while the connection is active and keep the entire connection's context
 // in the local variables
 // For tests, bytes.Buffer can be used for both `in` and `out`
+// Server is read-only, it does not accept CmdBeginRwTx
 func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, closer io.Closer) error {
+	return server(ctx, db, ListenerOpts{}, in, out, closer)
+}
+
+// cursorRange is the range of keys set by CmdCursorSeekRange, with the same semantics as in ethdb.Walk
+type cursorRange struct {
+	startKey   []byte
+	fixedbytes int
+	mask       byte
+	endKey     []byte
+}
+
+func newCursorRange(startKey []byte, fixedbits uint, endKey []byte) (*cursorRange, error) {
+	fixedbytes, mask := ethdb.Bytesmask(fixedbits)
+	if len(startKey) < fixedbytes {
+		return nil, fmt.Errorf("seekKey is shorter than fixedbits: %d < %d", len(startKey)*8, fixedbits)
+	}
+	if fixedbytes == 0 && len(endKey) == 0 {
+		return nil, nil
+	}
+	return &cursorRange{
+		startKey:   common.CopyBytes(startKey),
+		fixedbytes: fixedbytes,
+		mask:       mask,
+		endKey:     common.CopyBytes(endKey),
+	}, nil
+}
+
+// contains checks whether the key is within the range. nil range contains all keys
+func (r *cursorRange) contains(k []byte) bool {
+	if r == nil {
+		return true
+	}
+	if r.fixedbytes > 0 {
+		if len(k) < r.fixedbytes {
+			return false
+		}
+		if !bytes.Equal(k[:r.fixedbytes-1], r.startKey[:r.fixedbytes-1]) {
+			return false
+		}
+		if (k[r.fixedbytes-1] & r.mask) != (r.startKey[r.fixedbytes-1] & r.mask) {
+			return false
+		}
+	}
+	return len(r.endKey) == 0 || bytes.Compare(k, r.endKey) < 0
+}
+
+// sendCursorBatch sends up to numberOfKeys pairs with send, starting with (k, v) and moving the cursor forward.
+// A key outside of the range r is sent as nil, and nil key ends the batch
+func sendCursorBatch(ctx context.Context, cursor *bolt.Cursor, r *cursorRange, k, v []byte, numberOfKeys uint64, send func(k, v []byte) error) error {
+	for ; numberOfKeys > 0; k, v = cursor.Next() {
+		select {
+		default:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !r.contains(k) {
+			k, v = nil, nil
+		}
+		if err := send(k, v); err != nil {
+			return err
+		}
+		numberOfKeys--
+		// break before the loop's post statement moves the cursor past the last sent key
+		if k == nil || numberOfKeys == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// write is a Put (value != nil) or Delete (value == nil) buffered by the read-write transaction
+type write struct {
+	bucket []byte
+	key    []byte
+	value  []byte
+}
+
+// applyWrites applies the buffered writes within the bolt read-write transaction
+func applyWrites(tx *bolt.Tx, writes []write) error {
+	for _, w := range writes {
+		if w.value == nil {
+			b := tx.Bucket(w.bucket)
+			if b == nil {
+				continue
+			}
+			if err := b.Delete(w.key); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := tx.CreateBucketIfNotExists(w.bucket, false)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(w.key, w.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// server is the same as Server, but if opts.Token is not empty, it requires the client to
+// authenticate itself with this token in CmdVersion before issuing any other commands,
+// and if opts.Writable is set, it accepts read-write transactions writing into opts.WritableBuckets
+func server(ctx context.Context, db *bolt.DB, opts ListenerOpts, in io.Reader, out io.Writer, closer io.Closer) error {
 	defer func() {
 		if err1 := closer.Close(); err1 != nil {
 			log.Error("Could not close connection", "err", err1)
@@ -252,8 +387,13 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 	// Read-only transactions opened by the client
 	var tx *bolt.Tx
 
-	// We do Rollback and never Commit, because the remote transactions are always read-only, and must never change
-	// anything
+	// Writes of the read-write transaction, nil if the current transaction is read-only
+	var writes []write
+	var writesSize uint64
+
+	// We do Rollback and never Commit, because the bolt transactions are always read-only, and must never change
+	// anything. Writes of the read-write transactions are applied in separate bolt transactions on CmdCommit,
+	// and are discarded if the client goes away before that
 	defer func() {
 		if tx != nil {
 			if rollbackErr := tx.Rollback(); rollbackErr != nil {
@@ -271,6 +411,8 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 	cursors := make(map[uint64]*bolt.Cursor, 2)
 	// List of cursors opened in each bucket
 	cursorsByBucket := make(map[uint64][]uint64, 2)
+	// Ranges of the cursors, set by CmdCursorSeekRange
+	cursorRanges := make(map[uint64]*cursorRange, 2)
 
 	var c Command
 	var bucketHandle uint64
@@ -279,6 +421,33 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 	var name []byte
 	var seekKey []byte
 
+	var key, value []byte
+
+	// endTx forgets the buckets and cursors of the current transaction and rolls it back
+	endTx := func() error {
+		for bucketHandle := range buckets {
+			if cursorHandles, ok2 := cursorsByBucket[bucketHandle]; ok2 {
+				for _, cursorHandle := range cursorHandles {
+					delete(cursors, cursorHandle)
+					delete(cursorRanges, cursorHandle)
+				}
+				delete(cursorsByBucket, bucketHandle)
+			}
+			delete(buckets, bucketHandle)
+		}
+		writes, writesSize = nil, 0
+
+		if tx != nil {
+			if err := tx.Rollback(); err != nil {
+				return err
+			}
+			tx = nil
+		}
+		return nil
+	}
+
+	authenticated := opts.Token == ""
+
 	for {
 		// Make sure we are not blocking the resizing of the memory map
 		if tx != nil {
@@ -292,8 +461,24 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 			}
 			return fmt.Errorf("could not decode command: %w", err)
 		}
+		if !authenticated && c != CmdVersion {
+			err := fmt.Errorf("command %d before authentication", c)
+			encodeErr(encoder, err)
+			return err
+		}
 		switch c {
 		case CmdVersion:
+			var clientToken string
+			if err := decoder.Decode(&clientToken); err != nil {
+				return fmt.Errorf("could not decode token for CmdVersion: %w", err)
+			}
+			if opts.Token != "" && subtle.ConstantTimeCompare([]byte(clientToken), []byte(opts.Token)) != 1 {
+				err := fmt.Errorf("invalid token")
+				encodeErr(encoder, err)
+				return err
+			}
+			authenticated = true
+
 			if err := encoder.Encode(ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response code to CmdVersion: %w", err)
 			}
@@ -301,6 +486,7 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				return fmt.Errorf("could not encode response to CmdVersion: %w", err)
 			}
 		case CmdBeginTx:
+			writes, writesSize = nil, 0
 			var err error
 			tx, err = db.Begin(false)
 			if err != nil {
@@ -313,26 +499,97 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				return fmt.Errorf("could not encode response to CmdBeginTx: %w", err)
 			}
 		case CmdEndTx:
-			// Remove all the buckets
-			for bucketHandle := range buckets {
-				if cursorHandles, ok2 := cursorsByBucket[bucketHandle]; ok2 {
-					for _, cursorHandle := range cursorHandles {
-						delete(cursors, cursorHandle)
-					}
-					delete(cursorsByBucket, bucketHandle)
-				}
-				delete(buckets, bucketHandle)
+			// Remove all the buckets and discard the writes
+			if err := endTx(); err != nil {
+				return fmt.Errorf("could not end transaction: %w", err)
 			}
 
-			if tx != nil {
-				if err := tx.Rollback(); err != nil {
-					return fmt.Errorf("could not end transaction: %w", err)
+			if err := encoder.Encode(ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response to CmdEndTx: %w", err)
+			}
+		case CmdBeginRwTx:
+			if !opts.Writable {
+				encodeErr(encoder, fmt.Errorf("remote db is read-only"))
+				continue
+			}
+			if err := endTx(); err != nil {
+				return fmt.Errorf("could not end previous transaction for CmdBeginRwTx: %w", err)
+			}
+			var err error
+			tx, err = db.Begin(false)
+			if err != nil {
+				err2 := fmt.Errorf("could not start transaction for CmdBeginRwTx: %w", err)
+				encodeErr(encoder, err2)
+				return err2
+			}
+			writes = []write{}
+
+			if err := encoder.Encode(ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response to CmdBeginRwTx: %w", err)
+			}
+		case CmdPut, CmdDelete:
+			if err := decoder.Decode(&name); err != nil {
+				return fmt.Errorf("could not decode name for command %d: %w", c, err)
+			}
+			if err := decoder.Decode(&key); err != nil {
+				return fmt.Errorf("could not decode key for command %d: %w", c, err)
+			}
+			value = nil
+			if c == CmdPut {
+				if err := decoder.Decode(&value); err != nil {
+					return fmt.Errorf("could not decode value for CmdPut: %w", err)
 				}
-				tx = nil
+				if value == nil {
+					value = []byte{}
+				}
+			}
+
+			if writes == nil {
+				encodeErr(encoder, fmt.Errorf("send command %d within CmdBeginRwTx", c))
+				continue
+			}
+			if len(name) == 0 {
+				encodeErr(encoder, fmt.Errorf("bucket name required"))
+				continue
+			}
+			if !opts.isWritable(name) {
+				encodeErr(encoder, fmt.Errorf("bucket %s is not writable", name))
+				continue
 			}
+			if len(key) == 0 || len(key) > bolt.MaxKeySize {
+				encodeErr(encoder, fmt.Errorf("invalid key size: %d", len(key)))
+				continue
+			}
+			size := uint64(len(name) + len(key) + len(value))
+			if writesSize+size > ServerMaxTxSize {
+				encodeErr(encoder, fmt.Errorf("transaction is too large, limit is %d bytes", ServerMaxTxSize))
+				continue
+			}
+			writesSize += size
+			writes = append(writes, write{bucket: common.CopyBytes(name), key: common.CopyBytes(key), value: common.CopyBytes(value)})
 
 			if err := encoder.Encode(ResponseOk); err != nil {
-				return fmt.Errorf("could not encode response to CmdEndTx: %w", err)
+				return fmt.Errorf("could not encode response to command %d: %w", c, err)
+			}
+		case CmdCommit:
+			if writes == nil {
+				encodeErr(encoder, fmt.Errorf("send CmdCommit within CmdBeginRwTx"))
+				continue
+			}
+			toApply := writes
+			// Read-only transaction has to be closed before the update, otherwise bolt can't remap the file
+			if err := endTx(); err != nil {
+				return fmt.Errorf("could not end transaction for CmdCommit: %w", err)
+			}
+			if err := db.Update(func(tx *bolt.Tx) error {
+				return applyWrites(tx, toApply)
+			}); err != nil {
+				encodeErr(encoder, fmt.Errorf("could not commit: %w", err))
+				continue
+			}
+
+			if err := encoder.Encode(ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response to CmdCommit: %w", err)
 			}
 		case CmdBucket:
 			// Read the name of the bucket
@@ -431,6 +688,9 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				continue
 			}
 			k, v = cursor.Seek(seekKey)
+			if !cursorRanges[cursorHandle].contains(k) {
+				k, v = nil, nil
+			}
 			if err := encoder.Encode(ResponseOk); err != nil {
 				return fmt.Errorf("could not encode (key,value) for CmdCursorSeek: %w", err)
 			}
@@ -453,6 +713,9 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 			}
 
 			k, v = cursor.SeekTo(seekKey)
+			if !cursorRanges[cursorHandle].contains(k) {
+				k, v = nil, nil
+			}
 
 			if err := encoder.Encode(ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response to CmdCursorSeek: %w", err)
@@ -462,9 +725,6 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				return fmt.Errorf("could not encode (key,value) in response to CmdCursorSeekTo: %w", err)
 			}
 		case CmdCursorNext:
-			var k = &[]byte{}
-			var v = &[]byte{}
-
 			if err := decoder.Decode(&cursorHandle); err != nil {
 				return fmt.Errorf("could not decode cursorHandle for CmdCursorNext: %w", err)
 			}
@@ -483,32 +743,23 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				encodeErr(encoder, fmt.Errorf("cursor not found: %d", cursorHandle))
 				continue
 			}
+			r := cursorRanges[cursorHandle]
 
 			if err := encoder.Encode(ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response to CmdCursorNext: %w", err)
 			}
 
-			for *k, *v = cursor.Next(); numberOfKeys > 0; *k, *v = cursor.Next() {
-				select {
-				default:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-
-				if err := encodeKeyValue(encoder, k, v); err != nil {
+			k, v := cursor.Next()
+			if err := sendCursorBatch(ctx, cursor, r, k, v, numberOfKeys, func(k, v []byte) error {
+				if err := encodeKeyValue(encoder, &k, &v); err != nil {
 					return fmt.Errorf("could not encode (key,value) in response to CmdCursorNext: %w", err)
 				}
-
-				numberOfKeys--
-				if *k == nil {
-					break
-				}
+				return nil
+			}); err != nil {
+				return err
 			}
 
 		case CmdCursorFirst:
-			var k = &[]byte{}
-			var v = &[]byte{}
-
 			if err := decoder.Decode(&cursorHandle); err != nil {
 				return fmt.Errorf("could not decode cursorHandle for CmdCursorFirst: %w", err)
 			}
@@ -521,31 +772,22 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				encodeErr(encoder, fmt.Errorf("cursor not found: %d", cursorHandle))
 				continue
 			}
+			r := cursorRanges[cursorHandle]
 
 			if err := encoder.Encode(ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response code for CmdCursorFirst: %w", err)
 			}
 
-			for *k, *v = cursor.First(); numberOfKeys > 0; *k, *v = cursor.Next() {
-				select {
-				default:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-
-				if err := encodeKeyValue(encoder, k, v); err != nil {
+			k, v := cursor.First()
+			if err := sendCursorBatch(ctx, cursor, r, k, v, numberOfKeys, func(k, v []byte) error {
+				if err := encodeKeyValue(encoder, &k, &v); err != nil {
 					return fmt.Errorf("could not encode (key,value) for CmdCursorFirst: %w", err)
 				}
-
-				numberOfKeys--
-				if *k == nil {
-					break
-				}
+				return nil
+			}); err != nil {
+				return err
 			}
 		case CmdCursorNextKey:
-			var k = &[]byte{}
-			var v = &[]byte{}
-
 			if err := decoder.Decode(&cursorHandle); err != nil {
 				return fmt.Errorf("could not decode cursorHandle for CmdCursorNextKey: %w", err)
 			}
@@ -564,31 +806,22 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				encodeErr(encoder, fmt.Errorf("cursor not found: %d", cursorHandle))
 				continue
 			}
+			r := cursorRanges[cursorHandle]
 
 			if err := encoder.Encode(ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response to CmdCursorNextKey: %w", err)
 			}
 
-			for *k, *v = cursor.Next(); numberOfKeys > 0; *k, *v = cursor.Next() {
-				select {
-				default:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-
-				if err := encodeKey(encoder, k, len(*v) == 0); err != nil {
+			k, v := cursor.Next()
+			if err := sendCursorBatch(ctx, cursor, r, k, v, numberOfKeys, func(k, v []byte) error {
+				if err := encodeKey(encoder, &k, len(v) == 0); err != nil {
 					return fmt.Errorf("could not encode (key,valueIsEmpty) in response to CmdCursorNextKey: %w", err)
 				}
-
-				numberOfKeys--
-				if *k == nil {
-					break
-				}
+				return nil
+			}); err != nil {
+				return err
 			}
 		case CmdCursorFirstKey:
-			var k = &[]byte{}
-			var v = &[]byte{}
-
 			if err := decoder.Decode(&cursorHandle); err != nil {
 				return fmt.Errorf("could not decode cursorHandle for CmdCursorFirstKey: %w", err)
 			}
@@ -601,26 +834,58 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 				encodeErr(encoder, fmt.Errorf("cursor not found: %d", cursorHandle))
 				continue
 			}
+			r := cursorRanges[cursorHandle]
 
 			if err := encoder.Encode(ResponseOk); err != nil {
 				return fmt.Errorf("could not encode response code for CmdCursorFirstKey: %w", err)
 			}
 
-			for *k, *v = cursor.First(); numberOfKeys > 0; *k, *v = cursor.Next() {
-				select {
-				default:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-
-				if err := encodeKey(encoder, k, len(*v) == 0); err != nil {
+			k, v := cursor.First()
+			if err := sendCursorBatch(ctx, cursor, r, k, v, numberOfKeys, func(k, v []byte) error {
+				if err := encodeKey(encoder, &k, len(v) == 0); err != nil {
 					return fmt.Errorf("could not encode (key,valueIsEmpty) for CmdCursorFirstKey: %w", err)
 				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		case CmdCursorSeekRange:
+			var k, v, endKey []byte
+			var fixedbits uint64
 
-				numberOfKeys--
-				if k == nil {
-					break
-				}
+			if err := decoder.Decode(&cursorHandle); err != nil {
+				return fmt.Errorf("could not decode cursorHandle for CmdCursorSeekRange: %w", err)
+			}
+			if err := decoder.Decode(&seekKey); err != nil {
+				return fmt.Errorf("could not decode seekKey for CmdCursorSeekRange: %w", err)
+			}
+			if err := decoder.Decode(&fixedbits); err != nil {
+				return fmt.Errorf("could not decode fixedbits for CmdCursorSeekRange: %w", err)
+			}
+			if err := decoder.Decode(&endKey); err != nil {
+				return fmt.Errorf("could not decode endKey for CmdCursorSeekRange: %w", err)
+			}
+			cursor, ok := cursors[cursorHandle]
+			if !ok {
+				encodeErr(encoder, fmt.Errorf("cursor not found: %d", cursorHandle))
+				continue
+			}
+			r, err := newCursorRange(seekKey, uint(fixedbits), endKey)
+			if err != nil {
+				encodeErr(encoder, err)
+				continue
+			}
+			cursorRanges[cursorHandle] = r
+
+			k, v = cursor.Seek(seekKey)
+			if !r.contains(k) {
+				k, v = nil, nil
+			}
+			if err := encoder.Encode(ResponseOk); err != nil {
+				return fmt.Errorf("could not encode response to CmdCursorSeekRange: %w", err)
+			}
+			if err := encodeKeyValue(encoder, &k, &v); err != nil {
+				return fmt.Errorf("could not encode (key,value) in response to CmdCursorSeekRange: %w", err)
 			}
 		case CmdGetAsOf:
 			var bucket, hBucket, key, v []byte
@@ -662,21 +927,46 @@ func Server(ctx context.Context, db *bolt.DB, in io.Reader, out io.Writer, close
 	return nil
 }
 
+// ListenerOpts holds optional security settings of the Listener
+type ListenerOpts struct {
+	// TLS, if not nil, makes the listener accept only TLS connections.
+	// Use ServerTLSConfig with non-empty caFile to also require client certificates
+	TLS *tls.Config
+	// Token, if not empty, has to be presented by the clients in CmdVersion before any other command
+	Token string
+	// Writable allows the clients to write into the database with CmdBeginRwTx
+	Writable bool
+	// WritableBuckets are the only buckets the clients may write into with CmdPut and CmdDelete
+	WritableBuckets [][]byte
+}
+
+func (opts ListenerOpts) isWritable(bucket []byte) bool {
+	for _, b := range opts.WritableBuckets {
+		if bytes.Equal(b, bucket) {
+			return true
+		}
+	}
+	return false
+}
+
 // Listener starts listener that for each incoming connection
 // spawn a go-routine invoking Server
-func Listener(ctx context.Context, db *bolt.DB, address string) {
+func Listener(ctx context.Context, db *bolt.DB, address string, opts ListenerOpts) {
 	var lc net.ListenConfig
 	ln, err := lc.Listen(ctx, "tcp", address)
 	if err != nil {
 		log.Error("Could not create listener", "address", address, "err", err)
 		return
 	}
+	if opts.TLS != nil {
+		ln = tls.NewListener(ln, opts.TLS)
+	}
 	defer func() {
 		if err = ln.Close(); err != nil {
 			log.Error("Could not close listener", "err", err)
 		}
 	}()
-	log.Info("Remote DB interface listening on", "address", address)
+	log.Info("Remote DB interface listening on", "address", address, "tls", opts.TLS != nil, "token", opts.Token != "", "writable", opts.Writable)
 
 	ch := make(chan bool, ServerMaxConnections)
 	defer close(ch)
@@ -711,7 +1001,7 @@ func Listener(ctx context.Context, db *bolt.DB, address string) {
 			}()
 
 			//nolint:errcheck
-			err := Server(ctx, db, conn, conn, conn)
+			err := server(ctx, db, opts, conn, conn, conn)
 			if err != nil {
 				log.Warn("remote db server error", "err", err)
 			}
@@ -729,6 +1019,7 @@ type conn struct {
 // but it works via a pair (Reader, Writer)
 type DB struct {
 	dialFunc       DialFunc
+	token          string
 	connectionPool chan *conn
 	dialTimeout    time.Duration
 	pingTimeout    time.Duration
@@ -773,6 +1064,11 @@ func (db *DB) ping(ctx context.Context) (err error) {
 		db.returnConn(ctx, in, out, closer)
 	}()
 
+	return db.handshake(in, out)
+}
+
+// handshake sends CmdVersion with the token over the connection and checks the version of the server
+func (db *DB) handshake(in io.Reader, out io.Writer) error {
 	decoder := newDecoder(in)
 	defer returnDecoderToPool(decoder)
 	encoder := newEncoder(out)
@@ -782,6 +1078,9 @@ func (db *DB) ping(ctx context.Context) (err error) {
 	if err := encoder.Encode(CmdVersion); err != nil {
 		return fmt.Errorf("could not encode CmdVersion: %w", err)
 	}
+	if err := encoder.Encode(db.token); err != nil {
+		return fmt.Errorf("could not encode token for CmdVersion: %w", err)
+	}
 
 	var responseCode ResponseCode
 	if err := decoder.Decode(&responseCode); err != nil {
@@ -818,9 +1117,11 @@ func (closer notifyOnClose) Close() error {
 }
 
 // NewDB creates a new instance of DB
-func NewDB(parentCtx context.Context, dialFunc DialFunc) (*DB, error) {
+// If token is not empty, it is presented to the server on every new connection
+func NewDB(parentCtx context.Context, dialFunc DialFunc, token string) (*DB, error) {
 	db := &DB{
 		dialFunc:       dialFunc,
+		token:          token,
 		connectionPool: make(chan *conn, ClientMaxConnections),
 		doDial:         make(chan struct{}, ClientMaxConnections),
 		dialTimeout:    3 * time.Second,
@@ -871,6 +1172,17 @@ func (db *DB) autoReconnect(ctx context.Context) {
 		}
 
 		notifyCloser := notifyOnClose{notifyCh: db.doDial, internal: newCloser}
+		if db.token != "" {
+			// server does not accept any other commands before the token is presented
+			if err = db.handshake(newIn, newOut); err != nil {
+				log.Warn("remote db: handshake failed", "err", err)
+				if closeErr := notifyCloser.Close(); closeErr != nil {
+					log.Error("remote db: can't close connection", "err", closeErr)
+				}
+				time.Sleep(db.retryDialAfter)
+				return
+			}
+		}
 		db.returnConn(ctx, newIn, newOut, notifyCloser)
 	case <-db.doPing:
 		if tracing {
@@ -989,9 +1301,42 @@ func (db *DB) CmdGetAsOf(ctx context.Context, bucket, hBucket, key []byte, times
 	return val, nil
 }
 
+func (db *DB) commit(ctx context.Context, encoder *codec.Encoder, decoder *codec.Decoder) error {
+	// Cancelled transaction is not committed, the server discards its writes when the connection is closed
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var responseCode ResponseCode
+
+	if err := encoder.Encode(CmdCommit); err != nil {
+		return fmt.Errorf("could not encode CmdCommit: %w", err)
+	}
+
+	if err := decoder.Decode(&responseCode); err != nil {
+		return fmt.Errorf("could not decode ResponseCode for CmdCommit: %w", err)
+	}
+
+	if responseCode != ResponseOk {
+		return decodeErr(decoder, responseCode)
+	}
+	return nil
+}
+
 // View performs read-only transaction on the remote database
 // NOTE: not thread-safe
 func (db *DB) View(ctx context.Context, f func(tx *Tx) error) (err error) {
+	return db.tx(ctx, CmdBeginTx, f)
+}
+
+// Update performs read-write transaction on the remote database.
+// The writes made with tx.Put and tx.Delete are applied atomically if f returns nil,
+// and discarded otherwise. Reads within f do not see the writes made in the same transaction
+// NOTE: not thread-safe
+func (db *DB) Update(ctx context.Context, f func(tx *Tx) error) (err error) {
+	return db.tx(ctx, CmdBeginRwTx, f)
+}
+
+func (db *DB) tx(ctx context.Context, beginCmd Command, f func(tx *Tx) error) (err error) {
 	var opErr error
 	var endTxErr error
 
@@ -1017,12 +1362,12 @@ func (db *DB) View(ctx context.Context, f func(tx *Tx) error) (err error) {
 	encoder := newEncoder(out)
 	defer returnEncoderToPool(encoder)
 
-	if err = encoder.Encode(CmdBeginTx); err != nil {
-		return fmt.Errorf("could not encode CmdBeginTx: %w", err)
+	if err = encoder.Encode(beginCmd); err != nil {
+		return fmt.Errorf("could not encode command %d: %w", beginCmd, err)
 	}
 
 	if err = decoder.Decode(&responseCode); err != nil {
-		return fmt.Errorf("could not decode response code of CmdBeginTx: %w", err)
+		return fmt.Errorf("could not decode response code of command %d: %w", beginCmd, err)
 	}
 
 	if responseCode != ResponseOk {
@@ -1032,6 +1377,12 @@ func (db *DB) View(ctx context.Context, f func(tx *Tx) error) (err error) {
 	tx := &Tx{ctx: ctx, in: in, out: out}
 	opErr = f(tx)
 
+	if opErr == nil && beginCmd == CmdBeginRwTx {
+		// CmdCommit ends the transaction on the server side
+		endTxErr = db.commit(ctx, encoder, decoder)
+		return endTxErr
+	}
+
 	endTxErr = db.endTx(ctx, encoder, decoder)
 	if endTxErr != nil {
 		log.Warn("remote db: could not finish tx", "err", err)
@@ -1105,6 +1456,56 @@ func (tx *Tx) Bucket(name []byte) (*Bucket, error) {
 	return bucket, nil
 }
 
+// Put writes the key into the bucket, creating the bucket if it does not exist.
+// Only allowed within Update, the write is applied when the transaction commits
+func (tx *Tx) Put(bucket, key, value []byte) error {
+	return tx.write(CmdPut, bucket, key, value)
+}
+
+// Delete deletes the key from the bucket.
+// Only allowed within Update, the write is applied when the transaction commits
+func (tx *Tx) Delete(bucket, key []byte) error {
+	return tx.write(CmdDelete, bucket, key, nil)
+}
+
+func (tx *Tx) write(cmd Command, bucket, key, value []byte) error {
+	select {
+	default:
+	case <-tx.ctx.Done():
+		return tx.ctx.Err()
+	}
+
+	decoder := newDecoder(tx.in)
+	defer returnDecoderToPool(decoder)
+	encoder := newEncoder(tx.out)
+	defer returnEncoderToPool(encoder)
+
+	if err := encoder.Encode(cmd); err != nil {
+		return fmt.Errorf("could not encode command %d: %w", cmd, err)
+	}
+	if err := encoder.Encode(&bucket); err != nil {
+		return fmt.Errorf("could not encode name for command %d: %w", cmd, err)
+	}
+	if err := encoder.Encode(&key); err != nil {
+		return fmt.Errorf("could not encode key for command %d: %w", cmd, err)
+	}
+	if cmd == CmdPut {
+		if err := encoder.Encode(&value); err != nil {
+			return fmt.Errorf("could not encode value for CmdPut: %w", err)
+		}
+	}
+
+	var responseCode ResponseCode
+	if err := decoder.Decode(&responseCode); err != nil {
+		return fmt.Errorf("could not decode ResponseCode for command %d: %w", cmd, err)
+	}
+
+	if responseCode != ResponseOk {
+		return decodeErr(decoder, responseCode)
+	}
+	return nil
+}
+
 // Get reads a value corresponding to the given key, from the bucket
 // return nil if they key is not present
 func (b *Bucket) Get(key []byte) ([]byte, error) {
@@ -1290,6 +1691,56 @@ func (c *Cursor) Seek(seek []byte) (key []byte, value []byte, err error) {
 	return key, value, nil
 }
 
+// SeekRange moves the cursor to the seek key, or to the next key after it, and limits the cursor to the keys
+// which have the same first fixedbits bits as seek (if fixedbits > 0) and are less than endKey (if endKey is not empty).
+// Next returns nil key after the last key of the range, so nothing past the range is sent over the network.
+// The range stays in effect until the next SeekRange call, SeekRange(seek, 0, nil) removes it
+func (c *Cursor) SeekRange(seek []byte, fixedbits uint, endKey []byte) (key []byte, value []byte, err error) {
+	c.cacheLastIdx = 0 // .Next() cache is invalid after .Seek() and .SeekTo() calls
+
+	select {
+	default:
+	case <-c.ctx.Done():
+		return nil, nil, c.ctx.Err()
+	}
+
+	decoder := newDecoder(c.in)
+	defer returnDecoderToPool(decoder)
+	encoder := newEncoder(c.out)
+	defer returnEncoderToPool(encoder)
+
+	if err := encoder.Encode(CmdCursorSeekRange); err != nil {
+		return nil, nil, fmt.Errorf("could not encode CmdCursorSeekRange: %w", err)
+	}
+	if err := encoder.Encode(c.cursorHandle); err != nil {
+		return nil, nil, fmt.Errorf("could not encode cursorHandle for CmdCursorSeekRange: %w", err)
+	}
+	if err := encoder.Encode(&seek); err != nil {
+		return nil, nil, fmt.Errorf("could not encode key for CmdCursorSeekRange: %w", err)
+	}
+	if err := encoder.Encode(uint64(fixedbits)); err != nil {
+		return nil, nil, fmt.Errorf("could not encode fixedbits for CmdCursorSeekRange: %w", err)
+	}
+	if err := encoder.Encode(&endKey); err != nil {
+		return nil, nil, fmt.Errorf("could not encode endKey for CmdCursorSeekRange: %w", err)
+	}
+
+	var responseCode ResponseCode
+	if err := decoder.Decode(&responseCode); err != nil {
+		return nil, nil, fmt.Errorf("could not decode ResponseCode for CmdCursorSeekRange: %w", err)
+	}
+
+	if responseCode != ResponseOk {
+		return nil, nil, decodeErr(decoder, responseCode)
+	}
+
+	if err := decodeKeyValue(decoder, &key, &value); err != nil {
+		return nil, nil, fmt.Errorf("could not decode (key, value) for CmdCursorSeekRange: %w", err)
+	}
+
+	return key, value, nil
+}
+
 func (c *Cursor) SeekTo(seek []byte) (key []byte, value []byte, err error) {
 	c.cacheLastIdx = 0 // .Next() cache is invalid after .Seek() and .SeekTo() calls
 
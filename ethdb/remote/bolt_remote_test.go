@@ -20,12 +20,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/ledgerwatch/bolt"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -65,6 +68,7 @@ func TestCmdVersion(t *testing.T) {
 	defer returnDecoderToPool(decoder)
 	// ---------- End of boilerplate code
 	assert.Nil(t, encoder.Encode(CmdVersion), "Could not encode CmdVersion")
+	assert.Nil(t, encoder.Encode(""), "Could not encode token for CmdVersion")
 
 	if err = Server(ctx, db, &inBuf, &outBuf, closer); err != nil {
 		t.Errorf("Error while calling Server: %v", err)
@@ -78,6 +82,60 @@ func TestCmdVersion(t *testing.T) {
 	assert.Equal(t, Version, v)
 }
 
+func TestCmdVersionToken(t *testing.T) {
+	ctx := context.Background()
+
+	// ---------- Start of boilerplate code
+	db, err := bolt.Open("in-memory", 0600, &bolt.Options{MemOnly: true})
+	if err != nil {
+		t.Errorf("Could not create database: %v", err)
+	}
+	var inBuf bytes.Buffer
+	encoder := newEncoder(&inBuf)
+	defer returnEncoderToPool(encoder)
+	// output buffer to receive the result of the command
+	var outBuf bytes.Buffer
+	decoder := newDecoder(&outBuf)
+	defer returnDecoderToPool(decoder)
+	// ---------- End of boilerplate code
+
+	var responseCode ResponseCode
+	var errorMessage string
+
+	// Commands are not accepted before the token is presented
+	assert.Nil(t, encoder.Encode(CmdBeginTx), "Could not encode CmdBeginTx")
+	assert.NotNil(t, server(ctx, db, ListenerOpts{Token: "secret"}, &inBuf, &outBuf, closer))
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+	assert.Equal(t, ResponseErr, responseCode)
+	assert.Nil(t, decoder.Decode(&errorMessage), "Could not decode errorMessage returned by CmdBeginTx")
+
+	// Wrong token
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(t, encoder.Encode(CmdVersion), "Could not encode CmdVersion")
+	assert.Nil(t, encoder.Encode("wrong"), "Could not encode token for CmdVersion")
+	assert.NotNil(t, server(ctx, db, ListenerOpts{Token: "secret"}, &inBuf, &outBuf, closer))
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdVersion")
+	assert.Equal(t, ResponseErr, responseCode)
+	assert.Nil(t, decoder.Decode(&errorMessage), "Could not decode errorMessage returned by CmdVersion")
+	assert.Equal(t, "invalid token", errorMessage)
+
+	// Correct token unlocks the other commands
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(t, encoder.Encode(CmdVersion), "Could not encode CmdVersion")
+	assert.Nil(t, encoder.Encode("secret"), "Could not encode token for CmdVersion")
+	assert.Nil(t, encoder.Encode(CmdBeginTx), "Could not encode CmdBeginTx")
+	assert.Nil(t, server(ctx, db, ListenerOpts{Token: "secret"}, &inBuf, &outBuf, closer))
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdVersion")
+	assert.Equal(t, ResponseOk, responseCode)
+	var v uint64
+	assert.Nil(t, decoder.Decode(&v), "Could not decode version returned by CmdVersion")
+	assert.Equal(t, Version, v)
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+	assert.Equal(t, ResponseOk, responseCode)
+}
+
 func TestCmdBeginEndError(t *testing.T) {
 	ctx := context.Background()
 	// ---------- Start of boilerplate code
@@ -457,6 +515,307 @@ func TestCursorOperations(t *testing.T) {
 	assert.Nil(t, encoder.Encode(&name), "Could not encode name for CmdBucket")
 }
 
+func TestCmdPutCommit(t *testing.T) {
+	ctx := context.Background()
+
+	// ---------- Start of boilerplate code
+	db, err := bolt.Open("in-memory", 0600, &bolt.Options{MemOnly: true})
+	if err != nil {
+		t.Errorf("Could not create database: %v", err)
+	}
+	var inBuf bytes.Buffer
+	encoder := newEncoder(&inBuf)
+	defer returnEncoderToPool(encoder)
+	// output buffer to receive the result of the command
+	var outBuf bytes.Buffer
+	decoder := newDecoder(&outBuf)
+	defer returnDecoderToPool(decoder)
+	// ---------- End of boilerplate code
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err1 := tx.CreateBucket([]byte("bucket"), false)
+		if err1 != nil {
+			return err1
+		}
+		return b.Put([]byte(key1), []byte(value1))
+	})
+	assert.Nil(t, err, "Could not create bucket")
+
+	var name = []byte("bucket")
+	var newName = []byte("newbucket")
+	var lockedName = []byte("lockedbucket")
+	var k1, k2, v2, k3, v3 = []byte(key1), []byte(key2), []byte(value2), []byte(key3), []byte(value3)
+	var bigKey = make([]byte, bolt.MaxKeySize+1)
+	assert.Nil(t, encoder.Encode(CmdBeginRwTx), "Could not encode CmdBeginRwTx")
+	assert.Nil(t, encoder.Encode(CmdPut), "Could not encode CmdPut")
+	assert.Nil(t, encoder.Encode(&name), "Could not encode name for CmdPut")
+	assert.Nil(t, encoder.Encode(&k2), "Could not encode key for CmdPut")
+	assert.Nil(t, encoder.Encode(&v2), "Could not encode value for CmdPut")
+	assert.Nil(t, encoder.Encode(CmdDelete), "Could not encode CmdDelete")
+	assert.Nil(t, encoder.Encode(&name), "Could not encode name for CmdDelete")
+	assert.Nil(t, encoder.Encode(&k1), "Could not encode key for CmdDelete")
+	assert.Nil(t, encoder.Encode(CmdPut), "Could not encode CmdPut")
+	assert.Nil(t, encoder.Encode(&newName), "Could not encode name for CmdPut")
+	assert.Nil(t, encoder.Encode(&k3), "Could not encode key for CmdPut")
+	assert.Nil(t, encoder.Encode(&v3), "Could not encode value for CmdPut")
+	// Writes are not visible before the commit
+	assert.Nil(t, encoder.Encode(CmdBucket), "Could not encode CmdBucket")
+	assert.Nil(t, encoder.Encode(&name), "Could not encode name for CmdBucket")
+	assert.Nil(t, encoder.Encode(CmdGet), "Could not encode CmdGet")
+	assert.Nil(t, encoder.Encode(uint64(1)), "Could not encode bucketHandle for CmdGet")
+	assert.Nil(t, encoder.Encode(&k2), "Could not encode key for CmdGet")
+	// Too large write is rejected, but does not break the transaction
+	assert.Nil(t, encoder.Encode(CmdPut), "Could not encode CmdPut")
+	assert.Nil(t, encoder.Encode(&name), "Could not encode name for CmdPut")
+	assert.Nil(t, encoder.Encode(&bigKey), "Could not encode key for CmdPut")
+	assert.Nil(t, encoder.Encode(&v3), "Could not encode value for CmdPut")
+	// Write into a bucket outside of the allowlist is rejected
+	assert.Nil(t, encoder.Encode(CmdPut), "Could not encode CmdPut")
+	assert.Nil(t, encoder.Encode(&lockedName), "Could not encode name for CmdPut")
+	assert.Nil(t, encoder.Encode(&k3), "Could not encode key for CmdPut")
+	assert.Nil(t, encoder.Encode(&v3), "Could not encode value for CmdPut")
+	assert.Nil(t, encoder.Encode(CmdCommit), "Could not encode CmdCommit")
+	// Writes outside of read-write transaction are rejected
+	assert.Nil(t, encoder.Encode(CmdBeginTx), "Could not encode CmdBeginTx")
+	assert.Nil(t, encoder.Encode(CmdPut), "Could not encode CmdPut")
+	assert.Nil(t, encoder.Encode(&name), "Could not encode name for CmdPut")
+	assert.Nil(t, encoder.Encode(&k3), "Could not encode key for CmdPut")
+	assert.Nil(t, encoder.Encode(&v3), "Could not encode value for CmdPut")
+	assert.Nil(t, encoder.Encode(CmdEndTx), "Could not encode CmdEndTx")
+
+	if err = server(ctx, db, ListenerOpts{Writable: true, WritableBuckets: [][]byte{name, newName}}, &inBuf, &outBuf, closer); err != nil {
+		t.Errorf("Error while calling Server: %v", err)
+	}
+
+	var responseCode ResponseCode
+	var v []byte
+	var errorMessage string
+	for i := 0; i < 4; i++ { // CmdBeginRwTx, CmdPut, CmdDelete, CmdPut
+		assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode")
+		assert.Equal(t, ResponseOk, responseCode)
+	}
+	var bucketHandle uint64
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBucket")
+	assert.Equal(t, ResponseOk, responseCode)
+	assert.Nil(t, decoder.Decode(&bucketHandle), "Could not decode response from CmdBucket")
+	assert.Equal(t, uint64(1), bucketHandle)
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdGet")
+	assert.Equal(t, ResponseOk, responseCode)
+	assert.Nil(t, decoder.Decode(&v), "Could not decode response from CmdGet")
+	assert.Nil(t, v)
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdPut")
+	assert.Equal(t, ResponseErr, responseCode)
+	assert.Nil(t, decoder.Decode(&errorMessage), "Could not decode errorMessage returned by CmdPut")
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdPut")
+	assert.Equal(t, ResponseErr, responseCode)
+	assert.Nil(t, decoder.Decode(&errorMessage), "Could not decode errorMessage returned by CmdPut")
+	assert.Equal(t, "bucket lockedbucket is not writable", errorMessage)
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdCommit")
+	assert.Equal(t, ResponseOk, responseCode)
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginTx")
+	assert.Equal(t, ResponseOk, responseCode)
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdPut")
+	assert.Equal(t, ResponseErr, responseCode)
+	assert.Nil(t, decoder.Decode(&errorMessage), "Could not decode errorMessage returned by CmdPut")
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdEndTx")
+	assert.Equal(t, ResponseOk, responseCode)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(name)
+		v, _ := b.Get(k1)
+		assert.Nil(t, v)
+		v, _ = b.Get(k2)
+		assert.Equal(t, value2, string(v))
+		v, _ = b.Get(k3)
+		assert.Nil(t, v)
+		b = tx.Bucket(newName)
+		assert.NotNil(t, b)
+		v, _ = b.Get(k3)
+		assert.Equal(t, value3, string(v))
+		assert.Nil(t, tx.Bucket(lockedName))
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// Read-only server rejects read-write transactions
+	inBuf.Reset()
+	outBuf.Reset()
+	assert.Nil(t, encoder.Encode(CmdBeginRwTx), "Could not encode CmdBeginRwTx")
+	assert.Nil(t, Server(ctx, db, &inBuf, &outBuf, closer))
+	assert.Nil(t, decoder.Decode(&responseCode), "Could not decode ResponseCode returned by CmdBeginRwTx")
+	assert.Equal(t, ResponseErr, responseCode)
+	assert.Nil(t, decoder.Decode(&errorMessage), "Could not decode errorMessage returned by CmdBeginRwTx")
+	assert.Equal(t, "remote db is read-only", errorMessage)
+}
+
+// newPipeDB creates DB connected to the server over in-memory pipes
+func newPipeDB(ctx context.Context, db *bolt.DB, opts ListenerOpts) (*DB, error) {
+	return NewDB(ctx, func(dialCtx context.Context) (in io.Reader, out io.Writer, closer io.Closer, err error) {
+		c1, c2 := net.Pipe()
+		go func() {
+			// dialCtx is cancelled after the dial, the server has to live longer
+			_ = server(ctx, db, opts, c2, c2, c2)
+		}()
+		return c1, c1, c1, nil
+	}, "")
+}
+
+func TestUpdate(t *testing.T) {
+	db, err := bolt.Open("in-memory", 0600, &bolt.Options{MemOnly: true})
+	if err != nil {
+		t.Errorf("Could not create database: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	remoteDb, err := newPipeDB(ctx, db, ListenerOpts{Writable: true, WritableBuckets: [][]byte{[]byte("bucket")}})
+	assert.Nil(t, err)
+
+	// Failed transaction leaves no trace
+	errFailed := errors.New("failed")
+	err = remoteDb.Update(ctx, func(tx *Tx) error {
+		if err1 := tx.Put([]byte("bucket"), []byte(key1), []byte(value1)); err1 != nil {
+			return err1
+		}
+		return errFailed
+	})
+	assert.Equal(t, errFailed, err)
+	assert.Nil(t, db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("bucket")))
+		return nil
+	}))
+
+	err = remoteDb.Update(ctx, func(tx *Tx) error {
+		if err1 := tx.Put([]byte("bucket"), []byte(key1), []byte(value1)); err1 != nil {
+			return err1
+		}
+		return tx.Put([]byte("bucket"), []byte(key2), []byte(value2))
+	})
+	assert.Nil(t, err)
+
+	var v1, v2 []byte
+	err = remoteDb.View(ctx, func(tx *Tx) error {
+		b, err1 := tx.Bucket([]byte("bucket"))
+		if err1 != nil {
+			return err1
+		}
+		if v1, err1 = b.Get([]byte(key1)); err1 != nil {
+			return err1
+		}
+		v2, err1 = b.Get([]byte(key2))
+		return err1
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, value1, string(v1))
+	assert.Equal(t, value2, string(v2))
+
+	// Cancelled transaction is not committed
+	txCtx, txCancel := context.WithCancel(ctx)
+	err = remoteDb.Update(txCtx, func(tx *Tx) error {
+		txCancel()
+		return tx.Put([]byte("bucket"), []byte(key3), []byte(value3))
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, db.View(func(tx *bolt.Tx) error {
+		v, _ := tx.Bucket([]byte("bucket")).Get([]byte(key3))
+		assert.Nil(t, v)
+		return nil
+	}))
+
+	// Writes are rejected in read-only transactions
+	err = remoteDb.View(ctx, func(tx *Tx) error {
+		return tx.Delete([]byte("bucket"), []byte(key1))
+	})
+	assert.NotNil(t, err)
+}
+
+func TestCursorSeekRange(t *testing.T) {
+	db, err := bolt.Open("in-memory", 0600, &bolt.Options{MemOnly: true})
+	if err != nil {
+		t.Errorf("Could not create database: %v", err)
+	}
+	bucket := []byte("bucket")
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err1 := tx.CreateBucket(bucket, false)
+		if err1 != nil {
+			return err1
+		}
+		for _, k := range []string{"\x00\x01", "\x01\x00", "\x01\x05", "\x01\xff", "\x02\x00", "\x03\x00", "\x03\x10", "\x03\x20", "\x04\x00"} {
+			if err1 = b.Put([]byte(k), []byte("v"+k)); err1 != nil {
+				return err1
+			}
+		}
+		return b.Put([]byte("\x03\x30"), []byte{})
+	})
+	assert.Nil(t, err, "Could not fill the bucket")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	remoteDb, err := newPipeDB(ctx, db, ListenerOpts{})
+	assert.Nil(t, err)
+
+	// Cursor stops at the end of the range, also when the range ends within a batch
+	var keys []string
+	err = remoteDb.View(ctx, func(tx *Tx) error {
+		b, err1 := tx.Bucket(bucket)
+		if err1 != nil {
+			return err1
+		}
+		c, err1 := b.BatchCursor(2)
+		if err1 != nil {
+			return err1
+		}
+		for k, _, err1 := c.SeekRange([]byte{0x01, 0x03}, 8, nil); k != nil || err1 != nil; k, _, err1 = c.Next() {
+			if err1 != nil {
+				return err1
+			}
+			keys = append(keys, string(k))
+		}
+		for k, _, err1 := c.SeekRange([]byte{0x01, 0x05}, 0, []byte{0x03, 0x10}); k != nil || err1 != nil; k, _, err1 = c.Next() {
+			if err1 != nil {
+				return err1
+			}
+			keys = append(keys, string(k))
+		}
+		k, _, err1 := c.SeekRange([]byte{0x02, 0x01}, 8, nil)
+		if err1 != nil {
+			return err1
+		}
+		assert.Nil(t, k)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"\x01\x05", "\x01\xff", "\x01\x05", "\x01\xff", "\x02\x00", "\x03\x00"}, keys)
+
+	// Walk and MultiWalk return the same as the local database
+	local := ethdb.NewWrapperBoltDatabase(db)
+	remote := NewRemoteBoltDatabase(remoteDb)
+	for _, fixedbits := range []uint{0, 4, 7, 8, 12, 16} {
+		var localKeys, remoteKeys []string
+		assert.Nil(t, local.Walk(bucket, []byte{0x03, 0x00}, fixedbits, func(k, v []byte) (bool, error) {
+			localKeys = append(localKeys, string(k))
+			return true, nil
+		}))
+		assert.Nil(t, remote.Walk(bucket, []byte{0x03, 0x00}, fixedbits, func(k, v []byte) (bool, error) {
+			remoteKeys = append(remoteKeys, string(k))
+			return true, nil
+		}))
+		assert.Equal(t, localKeys, remoteKeys, "fixedbits %d", fixedbits)
+	}
+	startkeys := [][]byte{{0x00, 0x00}, {0x01, 0xf0}, {0x03, 0x00}, {0x04, 0x00}}
+	fixedbits := []uint{8, 12, 8, 16}
+	var localKeys, remoteKeys []string
+	assert.Nil(t, local.MultiWalk(bucket, startkeys, fixedbits, func(i int, k, v []byte) error {
+		localKeys = append(localKeys, fmt.Sprintf("%d:%x", i, k))
+		return nil
+	}))
+	assert.Nil(t, remote.MultiWalk(bucket, startkeys, fixedbits, func(i int, k, v []byte) error {
+		remoteKeys = append(remoteKeys, fmt.Sprintf("%d:%x", i, k))
+		return nil
+	}))
+	assert.Equal(t, localKeys, remoteKeys)
+	assert.Equal(t, []string{"0:0001", "1:01ff", "2:0300", "2:0310", "2:0320", "3:0400"}, remoteKeys)
+}
+
 func TestTxYield(t *testing.T) {
 	db, err := bolt.Open("in-memory", 0600, &bolt.Options{MemOnly: true})
 	assert.Nil(t, err, "Could not create database")
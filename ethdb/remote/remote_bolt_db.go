@@ -107,8 +107,11 @@ func (db *BoltDatabase) GetAsOf(bucket, hBucket, key []byte, timestamp uint64) (
 	return db.db.CmdGetAsOf(context.Background(), bucket, hBucket, key, timestamp)
 }
 
+// walkBatchSize is the number of keys fetched at once by Walk and MultiWalk. The server stops at the range end,
+// so the batch never includes the keys past the range
+const walkBatchSize uint64 = 1000
+
 func (db *BoltDatabase) Walk(bucket, startkey []byte, fixedbits uint, walker func(k, v []byte) (bool, error)) error {
-	fixedbytes, mask := ethdb.Bytesmask(fixedbits)
 	err := db.db.View(context.Background(), func(tx *Tx) error {
 		b, err := tx.Bucket(bucket)
 		if err != nil {
@@ -118,16 +121,16 @@ func (db *BoltDatabase) Walk(bucket, startkey []byte, fixedbits uint, walker fun
 		if b == nil {
 			return nil
 		}
-		c, err := b.Cursor()
+		c, err := b.BatchCursor(walkBatchSize)
 		if err != nil {
 			return err
 		}
-		k, v, err := c.Seek(startkey)
+		k, v, err := c.SeekRange(startkey, fixedbits, nil)
 		if err != nil {
 			return err
 		}
 
-		for k != nil && (fixedbits == 0 || bytes.Equal(k[:fixedbytes-1], startkey[:fixedbytes-1]) && (k[fixedbytes-1]&mask) == (startkey[fixedbytes-1]&mask)) {
+		for k != nil {
 			goOn, err := walker(k, v)
 			if err != nil {
 				return err
@@ -149,9 +152,6 @@ func (db *BoltDatabase) MultiWalk(bucket []byte, startkeys [][]byte, fixedbits [
 	if len(startkeys) == 0 {
 		return nil
 	}
-	rangeIdx := 0 // What is the current range we are extracting
-	fixedbytes, mask := ethdb.Bytesmask(fixedbits[rangeIdx])
-	startkey := startkeys[rangeIdx]
 	err := db.db.View(context.Background(), func(tx *Tx) error {
 		b, err := tx.Bucket(bucket)
 		if err != nil {
@@ -161,57 +161,30 @@ func (db *BoltDatabase) MultiWalk(bucket []byte, startkeys [][]byte, fixedbits [
 		if b == nil {
 			return nil
 		}
-		c, err := b.Cursor()
+		c, err := b.BatchCursor(walkBatchSize)
 		if err != nil {
 			return err
 		}
 
-		k, v, err := c.Seek(startkey)
-		if err != nil {
-			return err
-		}
-
-		for k != nil {
-			// Adjust rangeIdx if needed
-			if fixedbytes > 0 {
-				cmp := int(-1)
-				for cmp != 0 {
-					cmp = bytes.Compare(k[:fixedbytes-1], startkey[:fixedbytes-1])
-					if cmp == 0 {
-						k1 := k[fixedbytes-1] & mask
-						k2 := startkey[fixedbytes-1] & mask
-						if k1 < k2 {
-							cmp = -1
-						} else if k1 > k2 {
-							cmp = 1
-						}
-					}
-					if cmp < 0 {
-						k, v, err = c.SeekTo(startkey)
-						if err != nil {
-							return err
-						}
-						if k == nil {
-							return nil
-						}
-					} else if cmp > 0 {
-						rangeIdx++
-						if rangeIdx == len(startkeys) {
-							return nil
-						}
-						fixedbytes, mask = ethdb.Bytesmask(fixedbits[rangeIdx])
-						startkey = startkeys[rangeIdx]
+		for rangeIdx, startkey := range startkeys {
+			k, v, err := c.SeekRange(startkey, fixedbits[rangeIdx], nil)
+			if err != nil {
+				return err
+			}
+			for k != nil {
+				if len(v) > 0 {
+					if err := walker(rangeIdx, k, v); err != nil {
+						return err
 					}
 				}
-			}
-			if len(v) > 0 {
-				if err := walker(rangeIdx, k, v); err != nil {
+				k, v, err = c.Next()
+				if err != nil {
 					return err
 				}
 			}
-			k, v, err = c.Next()
-			if err != nil {
-				return err
+			if fixedbits[rangeIdx] == 0 {
+				// Unbounded range runs till the end of the bucket
+				return nil
 			}
 		}
 		return nil
@@ -0,0 +1,146 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package remote
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCert creates a certificate signed by the parent (self-signed if parent is nil)
+// and writes it together with its key into dir
+func writeTestCert(t *testing.T, dir, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestMutualTLSAndToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeTestCert(t, dir, "ca", true, nil, nil)
+	writeTestCert(t, dir, "server", false, ca, caKey)
+	writeTestCert(t, dir, "client", false, ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	db, err := bolt.Open("in-memory", 0600, &bolt.Options{MemOnly: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err1 := tx.CreateBucket([]byte("bucket"), false)
+		if err1 != nil {
+			return err1
+		}
+		return b.Put([]byte(key1), []byte(value1))
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	serverTLS, err := ServerTLSConfig(file("server.crt"), file("server.key"), file("ca.crt"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Listener(ctx, db, address, ListenerOpts{TLS: serverTLS, Token: "secret"})
+
+	// Client without certificate is rejected by the server
+	noCertTLS, err := ClientTLSConfig("", "", file("ca.crt"))
+	require.NoError(t, err)
+	dialCtx, dialCancel := context.WithTimeout(ctx, 3*time.Second)
+	defer dialCancel()
+	require.Eventually(t, func() bool {
+		conn, err1 := net.Dial("tcp", address)
+		if err1 != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 3*time.Second, 10*time.Millisecond)
+	in, out, c, err := TCPDialFunc(address, noCertTLS)(dialCtx)
+	if err == nil {
+		// in TLS 1.3 the client certificate is verified after the client's handshake completes
+		remoteDb := &DB{token: "secret"}
+		err = remoteDb.handshake(in, out)
+		c.Close()
+	}
+	assert.Error(t, err)
+
+	clientTLS, err := ClientTLSConfig(file("client.crt"), file("client.key"), file("ca.crt"))
+	require.NoError(t, err)
+
+	// Client with certificate, but wrong token
+	in, out, c, err = TCPDialFunc(address, clientTLS)(dialCtx)
+	require.NoError(t, err)
+	assert.EqualError(t, (&DB{token: "wrong"}).handshake(in, out), "invalid token")
+	c.Close()
+
+	// Client with certificate and correct token
+	remoteDb, err := NewDB(ctx, TCPDialFunc(address, clientTLS), "secret")
+	require.NoError(t, err)
+	var v []byte
+	err = remoteDb.View(ctx, func(tx *Tx) error {
+		b, err1 := tx.Bucket([]byte("bucket"))
+		if err1 != nil {
+			return err1
+		}
+		v, err1 = b.Get([]byte(key1))
+		return err1
+	})
+	require.NoError(t, err)
+	assert.Equal(t, value1, string(v))
+}
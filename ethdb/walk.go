@@ -22,6 +22,7 @@ import (
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/debug"
 )
 
 var EndSuffix = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
@@ -123,3 +124,112 @@ func GetModifiedAccounts(db Getter, startTimestamp, endTimestamp uint64) ([]comm
 	}
 	return accounts, nil
 }
+
+// HistoryChange is a change of a key made by a block.
+// Before and After are empty if the key did not exist.
+type HistoryChange struct {
+	BlockNum uint64
+	Before   []byte
+	After    []byte
+}
+
+// GetHistoryChanges returns the changes of the key made by the blocks between startTimestamp
+// and endTimestamp (inclusive), in the ascending order. The blocks are taken from the history
+// bucket, and the values before the changes from the ChangeSet. The value after a change is
+// the value before the next change, or the current value in the bucket if there is none.
+func GetHistoryChanges(db Getter, bucket, hBucket, key []byte, startTimestamp, endTimestamp uint64) ([]HistoryChange, error) {
+	blocks, next, err := findChangeBlocks(db, hBucket, key, startTimestamp, endTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	changes := make([]HistoryChange, len(blocks))
+	for i, blockNum := range blocks {
+		before, err := getChangeSetValue(db, hBucket, key, blockNum)
+		if err != nil {
+			return nil, err
+		}
+		changes[i] = HistoryChange{BlockNum: blockNum, Before: before}
+		if i > 0 {
+			changes[i-1].After = before
+		}
+	}
+	var after []byte
+	if next != nil {
+		after, err = getChangeSetValue(db, hBucket, key, *next)
+	} else {
+		after, err = db.Get(bucket, key)
+		if err == ErrKeyNotFound {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	changes[len(changes)-1].After = after
+	return changes, nil
+}
+
+// findChangeBlocks returns the blocks between startTimestamp and endTimestamp which changed the key,
+// and the first block after endTimestamp which changed it, if any.
+func findChangeBlocks(db Getter, hBucket, key []byte, startTimestamp, endTimestamp uint64) ([]uint64, *uint64, error) {
+	var (
+		blocks []uint64
+		next   *uint64
+	)
+	if debug.IsThinHistory() && bytes.Equal(hBucket, dbutils.AccountsHistoryBucket) {
+		v, err := db.Get(hBucket, key)
+		if err != nil && err != ErrKeyNotFound {
+			return nil, nil, err
+		}
+		index := new(HistoryIndex)
+		if err := index.Decode(v); err != nil {
+			return nil, nil, err
+		}
+		for _, blockNum := range *index {
+			if blockNum < startTimestamp || (len(blocks) > 0 && blocks[len(blocks)-1] == blockNum) {
+				continue
+			}
+			if blockNum > endTimestamp {
+				next = &blockNum
+				break
+			}
+			blocks = append(blocks, blockNum)
+		}
+		return blocks, next, nil
+	}
+	startkey, _ := dbutils.CompositeKeySuffix(key, startTimestamp)
+	err := db.Walk(hBucket, startkey, uint(8*len(key)), func(k, _ []byte) (bool, error) {
+		// Skip the index of the key, which is stored along with the values by the thin history
+		if len(k) == len(key) {
+			return true, nil
+		}
+		blockNum, _ := dbutils.DecodeTimestamp(k[len(key):])
+		if blockNum > endTimestamp {
+			next = &blockNum
+			return false, nil
+		}
+		blocks = append(blocks, blockNum)
+		return true, nil
+	})
+	return blocks, next, err
+}
+
+// getChangeSetValue returns the value of the key before it was changed by the block.
+func getChangeSetValue(db Getter, hBucket, key []byte, blockNum uint64) ([]byte, error) {
+	v, err := db.Get(dbutils.ChangeSetBucket, dbutils.CompositeChangeSetKey(dbutils.EncodeTimestamp(blockNum), hBucket))
+	if err != nil && err != ErrKeyNotFound {
+		return nil, err
+	}
+	cs, err := dbutils.DecodeChangeSet(v)
+	if err != nil {
+		return nil, err
+	}
+	value, err := cs.FindLast(key)
+	if err != nil {
+		return nil, fmt.Errorf("change of %x is missing in the change set of block %d", key, blockNum)
+	}
+	return value, nil
+}
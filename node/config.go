@@ -32,7 +32,9 @@ import (
 	"github.com/ledgerwatch/turbo-geth/accounts/scwallet"
 	"github.com/ledgerwatch/turbo-geth/accounts/usbwallet"
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
 	"github.com/ledgerwatch/turbo-geth/log"
 	"github.com/ledgerwatch/turbo-geth/p2p"
 	"github.com/ledgerwatch/turbo-geth/p2p/enode"
@@ -195,6 +197,26 @@ type Config struct {
 	// empty string means not to start the listener
 	RemoteDbListenAddress string
 
+	// TLS certificate and key files of the remote database listener.
+	// If set, the listener accepts only TLS connections
+	RemoteDbTLSCert string
+	RemoteDbTLSKey  string
+
+	// CA certificate file to verify client certificates of the remote database
+	// listener with. If set, clients without a valid certificate are rejected
+	RemoteDbTLSCA string
+
+	// Shared token the remote database clients need to present before
+	// issuing any commands. Empty string means no token is required
+	RemoteDbToken string
+
+	// Allows the remote database clients to write into the database
+	RemoteDbWritable bool
+
+	// Buckets the remote database clients may write into if RemoteDbWritable is set.
+	// The buckets of the state and its history can not be made writable
+	RemoteDbWritableBuckets []string
+
 	staticNodesWarning     bool
 	trustedNodesWarning    bool
 	oldGethResourceWarning bool
@@ -527,3 +549,44 @@ func (c *Config) warnOnce(w *bool, format string, args ...interface{}) {
 	l.Warn(fmt.Sprintf(format, args...))
 	*w = true
 }
+
+// protectedRemoteDbBuckets hold the state and its history, which only the node itself writes
+var protectedRemoteDbBuckets = [][]byte{
+	dbutils.AccountsBucket,
+	dbutils.StorageBucket,
+	dbutils.AccountsHistoryBucket,
+	dbutils.StorageHistoryBucket,
+	dbutils.ChangeSetBucket,
+	dbutils.CodeBucket,
+	dbutils.ContractCodeBucket,
+}
+
+// remoteDbListenerOpts creates the security settings of the remote database listener
+func (c *Config) remoteDbListenerOpts() (remote.ListenerOpts, error) {
+	opts := remote.ListenerOpts{Token: c.RemoteDbToken, Writable: c.RemoteDbWritable}
+	if c.RemoteDbWritable {
+		if len(c.RemoteDbWritableBuckets) == 0 {
+			return opts, fmt.Errorf("remote db is writable, but no writable buckets are set")
+		}
+		for _, name := range c.RemoteDbWritableBuckets {
+			for _, protected := range protectedRemoteDbBuckets {
+				if name == string(protected) {
+					return opts, fmt.Errorf("bucket %s can not be writable by remote db clients", name)
+				}
+			}
+			opts.WritableBuckets = append(opts.WritableBuckets, []byte(name))
+		}
+	}
+	if c.RemoteDbTLSCert == "" {
+		if c.RemoteDbTLSCA != "" {
+			return opts, fmt.Errorf("remote db TLS CA is set without the server certificate")
+		}
+		return opts, nil
+	}
+	tlsConfig, err := remote.ServerTLSConfig(c.RemoteDbTLSCert, c.RemoteDbTLSKey, c.RemoteDbTLSCA)
+	if err != nil {
+		return opts, err
+	}
+	opts.TLS = tlsConfig
+	return opts, nil
+}
@@ -160,3 +160,30 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that only the allowed buckets become writable by the remote database clients.
+func TestRemoteDbWritableBuckets(t *testing.T) {
+	var tests = []struct {
+		Writable bool
+		Buckets  []string
+		Allowed  int
+		Fails    bool
+	}{
+		{false, nil, 0, false},
+		{false, []string{"lAI"}, 0, false},
+		{true, nil, 0, true},
+		{true, []string{"lAI", "lTI"}, 2, false},
+		{true, []string{"lAI", "AT"}, 0, true},
+		{true, []string{"hST"}, 0, true},
+	}
+	for i, test := range tests {
+		opts, err := (&Config{RemoteDbWritable: test.Writable, RemoteDbWritableBuckets: test.Buckets}).remoteDbListenerOpts()
+		if (err != nil) != test.Fails {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !test.Fails && len(opts.WritableBuckets) != test.Allowed {
+			t.Errorf("test %d: writable buckets mismatch: have %d, want %d", i, len(opts.WritableBuckets), test.Allowed)
+		}
+	}
+}
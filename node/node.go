@@ -635,6 +635,10 @@ func (n *Node) OpenDatabase(name string) (ethdb.Database, error) {
 		return nil, err
 	}
 	if n.config.RemoteDbListenAddress != "" {
+		opts, err := n.config.remoteDbListenerOpts()
+		if err != nil {
+			return nil, err
+		}
 		// TODO: implement node.Service, then Stop() will called on SIGINT | SIGTERM and we can call cancel() there
 		tcpCtx, cancel := context.WithCancel(context.Background())
 		go func() {
@@ -651,7 +655,7 @@ func (n *Node) OpenDatabase(name string) (ethdb.Database, error) {
 			cancel()
 		}()
 
-		go remote.Listener(tcpCtx, boltDb.DB(), n.config.RemoteDbListenAddress)
+		go remote.Listener(tcpCtx, boltDb.DB(), n.config.RemoteDbListenAddress, opts)
 
 	}
 	return boltDb, nil
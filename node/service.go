@@ -20,10 +20,12 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"reflect"
 	"syscall"
 
 	"github.com/ledgerwatch/turbo-geth/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
 	"github.com/ledgerwatch/turbo-geth/event"
@@ -42,10 +44,26 @@ type ServiceContext struct {
 	AccountManager *accounts.Manager        // Account manager created by the node.
 }
 
-// OpenDatabaseWithFreezer
-// FIXME: implement the functionality
+// OpenDatabaseWithFreezer opens an existing database with the given name (or
+// creates one if no previous can be found) from within the node's data directory,
+// also attaching a chain freezer to it that moves ancient chain data from the
+// database to immutable append-only files. The freezer is only attached if its
+// directory is specified, otherwise all the chain data is kept in the database.
+// If the node is an ephemeral one, a memory database is returned.
 func (ctx *ServiceContext) OpenDatabaseWithFreezer(name string, freezer string) (ethdb.Database, error) {
-	return ctx.OpenDatabase(name)
+	db, err := ctx.OpenDatabase(name)
+	if err != nil || ctx.config.DataDir == "" || freezer == "" {
+		return db, err
+	}
+	if !filepath.IsAbs(freezer) {
+		freezer = ctx.config.ResolvePath(freezer)
+	}
+	frdb, err := rawdb.NewDatabaseWithFreezer(db, freezer, "eth/db/"+name+"/")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return frdb, nil
 }
 
 // OpenDatabase opens an existing database with the given name (or creates one
@@ -67,6 +85,10 @@ func (ctx *ServiceContext) OpenDatabase(name string) (ethdb.Database, error) {
 		return nil, err
 	}
 	if ctx.config.RemoteDbListenAddress != "" {
+		opts, err := ctx.config.remoteDbListenerOpts()
+		if err != nil {
+			return nil, err
+		}
 		// TODO: implement node.Service, then Stop() will called on SIGINT | SIGTERM and we can call cancel() there
 		tcpCtx, cancel := context.WithCancel(context.Background())
 		go func() {
@@ -83,24 +105,9 @@ func (ctx *ServiceContext) OpenDatabase(name string) (ethdb.Database, error) {
 			cancel()
 		}()
 
-		go remote.Listener(tcpCtx, boltDb.DB(), ctx.config.RemoteDbListenAddress)
+		go remote.Listener(tcpCtx, boltDb.DB(), ctx.config.RemoteDbListenAddress, opts)
 	}
 	return boltDb, nil
-	/*
-		if err != nil {
-			return nil, err
-		}
-		root := ctx.config.ResolvePath(name)
-
-			FIXME: restore and move to OpenDatabaseWithFreezer
-			switch {
-			case freezer == "":
-				freezer = filepath.Join(root, "ancient")
-			case !filepath.IsAbs(freezer):
-				freezer = ctx.config.ResolvePath(freezer)
-			}
-		return ethdb.NewBoltDatabase(root)
-	*/
 }
 
 // ResolvePath resolves a user path into the data directory if that was relative
@@ -131,7 +131,7 @@ func TestBasisAccountPruning(t *testing.T) {
 	}
 
 	//Prune database history up to HEAD-1
-	err = core.Prune(db, 0, uint64(numBlocks)-1)
+	err = core.Prune(db, 0, uint64(numBlocks)-1, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -156,7 +156,7 @@ func TestBasisAccountPruning(t *testing.T) {
 	}
 
 	//Prune database history up to HEAD
-	err = core.Prune(db, uint64(numBlocks)-1, uint64(numBlocks))
+	err = core.Prune(db, uint64(numBlocks)-1, uint64(numBlocks), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -287,7 +287,7 @@ func TestBasisAccountPruningNoHistory(t *testing.T) {
 		t.Fatal("Not equal")
 	}
 
-	err = core.Prune(db, 0, uint64(numBlocks)-1)
+	err = core.Prune(db, 0, uint64(numBlocks)-1, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -311,7 +311,7 @@ func TestBasisAccountPruningNoHistory(t *testing.T) {
 	}
 
 	//Prune database history up to HEAD
-	err = core.Prune(db, uint64(numBlocks)-1, uint64(numBlocks))
+	err = core.Prune(db, uint64(numBlocks)-1, uint64(numBlocks), nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -504,7 +504,7 @@ func TestStoragePruning(t *testing.T) {
 		t.Fatal("not equals")
 	}
 
-	err = core.Prune(db, 0, uint64(blockNum-1))
+	err = core.Prune(db, 0, uint64(blockNum-1), nil)
 	assertNil(t, err)
 	res, err = getStat(db)
 	assertNil(t, err)
@@ -0,0 +1,172 @@
+package trie
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/pool"
+	"golang.org/x/crypto/sha3"
+)
+
+// EmptyBinaryRoot is the root hash of an empty binary trie, and the storage root
+// of the accounts without storage in the binary trie.
+var EmptyBinaryRoot = common.Hash{}
+
+// Prefixes of the binary trie nodes, which make the hashes of different kinds of nodes distinct
+const (
+	binaryBranchPrefix    = 0x00
+	binaryExtensionPrefix = 0x01
+	binaryLeafPrefix      = 0x02
+)
+
+// binaryHasher computes the hashes of the binary trie nodes. Unlike the hexary trie,
+// where the nodes are RLP encoded and the short ones are embedded into their parents,
+// each node of the binary trie is hashed with keccak256 as follows:
+//
+//	branch:    keccak(0x00 || hash(left) || hash(right))
+//	extension: keccak(0x01 || path || hash(child))
+//	leaf:      keccak(0x02 || path || keccak(value))
+//
+// The path is the number of its bits (2 bytes, big endian) followed by the bits packed
+// into bytes, most significant bit first. The value of an account leaf is the RLP encoding
+// of the account, with the root of its storage in the binary trie as the storage root.
+// An absent child, as well as an empty trie, hashes to EmptyBinaryRoot.
+type binaryHasher struct {
+	sha keccakState
+}
+
+func newBinaryHasher() *binaryHasher {
+	return &binaryHasher{sha: sha3.NewLegacyKeccak256().(keccakState)}
+}
+
+// hash computes the hash of the node. The hashes of the branch nodes are cached in
+// the nodes, so only the modified parts of the trie are re-hashed. The branch nodes
+// share the cache with the hexary hasher, so a binary trie has to be hashed with
+// one of the hashers only.
+func (h *binaryHasher) hash(nd node) (common.Hash, error) {
+	switch n := nd.(type) {
+	case nil:
+		return EmptyBinaryRoot, nil
+	case hashNode:
+		return common.BytesToHash(n), nil
+	case *duoNode:
+		if !n.flags.dirty {
+			return common.BytesToHash(n.flags.hash[:]), nil
+		}
+		var children [2]node
+		i1, i2 := n.childrenIdx()
+		if i1 > 1 || i2 > 1 {
+			return common.Hash{}, fmt.Errorf("invalid binary branch with children %d and %d", i1, i2)
+		}
+		children[i1], children[i2] = n.child1, n.child2
+		hash, err := h.branch(children[0], children[1])
+		if err != nil {
+			return common.Hash{}, err
+		}
+		copy(n.flags.hash[:], hash[:])
+		n.flags.dirty = false
+		return hash, nil
+	case *fullNode:
+		if !n.flags.dirty {
+			return common.BytesToHash(n.flags.hash[:]), nil
+		}
+		for i, child := range n.Children[2:] {
+			if child != nil {
+				return common.Hash{}, fmt.Errorf("invalid binary branch with child %d", i+2)
+			}
+		}
+		hash, err := h.branch(n.Children[0], n.Children[1])
+		if err != nil {
+			return common.Hash{}, err
+		}
+		copy(n.flags.hash[:], hash[:])
+		n.flags.dirty = false
+		return hash, nil
+	case *shortNode:
+		switch v := n.Val.(type) {
+		case valueNode, *accountNode:
+			return h.leaf(n.Key, v)
+		default:
+			child, err := h.hash(v)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			return h.sum([]byte{binaryExtensionPrefix}, encodeBinaryPath(n.Key), child[:]), nil
+		}
+	case valueNode, *accountNode:
+		return h.leaf(nil, n)
+	default:
+		return common.Hash{}, fmt.Errorf("unexpected node: %T", nd)
+	}
+}
+
+func (h *binaryHasher) branch(left, right node) (common.Hash, error) {
+	leftHash, err := h.hash(left)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	rightHash, err := h.hash(right)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return h.sum([]byte{binaryBranchPrefix}, leftHash[:], rightHash[:]), nil
+}
+
+func (h *binaryHasher) leaf(path []byte, value node) (common.Hash, error) {
+	var valueHash common.Hash
+	switch v := value.(type) {
+	case valueNode:
+		valueHash = h.sum(v)
+	case *accountNode:
+		storageRoot, err := h.hash(v.storage)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		v.Root = storageRoot
+		v.hashCorrect = true
+		encoded := pool.GetBuffer(v.EncodingLengthForHashing())
+		v.EncodeForHashing(encoded.B)
+		valueHash = h.sum(encoded.Bytes())
+		pool.PutBuffer(encoded)
+	}
+	return h.sum([]byte{binaryLeafPrefix}, encodeBinaryPath(path), valueHash[:]), nil
+}
+
+// sum hashes the concatenation of the parts.
+func (h *binaryHasher) sum(parts ...[]byte) common.Hash {
+	var hash common.Hash
+	h.sha.Reset()
+	for _, part := range parts {
+		h.sha.Write(part)
+	}
+	h.sha.Read(hash[:])
+	return hash
+}
+
+// encodeBinaryPath encodes the path of the binary trie node (one bit per byte,
+// optionally terminated by 16) as its length in bits followed by the packed bits.
+func encodeBinaryPath(path []byte) []byte {
+	if len(path) > 0 && path[len(path)-1] == 16 {
+		path = path[:len(path)-1]
+	}
+	encoded := make([]byte, 2+(len(path)+7)/8)
+	binary.BigEndian.PutUint16(encoded, uint16(len(path)))
+	for i, bit := range path {
+		if bit != 0 {
+			encoded[2+i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return encoded
+}
+
+// NewBinaryTrie creates an empty binary trie.
+func NewBinaryTrie() *BinaryTrie {
+	return (*BinaryTrie)(NewBinary(common.Hash{}))
+}
+
+// Hash returns the root hash of the binary trie, computed with the binary hashing
+// scheme (see binaryHasher). The hashes of the unmodified subtries are reused.
+func (b *BinaryTrie) Hash() (common.Hash, error) {
+	return newBinaryHasher().hash(b.root)
+}
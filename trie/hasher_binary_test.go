@@ -0,0 +1,155 @@
+package trie
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+type binaryItem struct {
+	path      []byte // one bit per byte
+	valueHash common.Hash
+}
+
+func binaryPath(key []byte) []byte {
+	bin := keyHexToBin(keybytesToHex(key))
+	return bin[:len(bin)-1]
+}
+
+// referenceBinaryHash computes the root of the binary trie containing the items directly from the
+// definition of the binary hashing scheme, without building the trie.
+func referenceBinaryHash(items []binaryItem, depth int) common.Hash {
+	h := newBinaryHasher()
+	switch len(items) {
+	case 0:
+		return EmptyBinaryRoot
+	case 1:
+		return h.sum([]byte{binaryLeafPrefix}, encodeBinaryPath(items[0].path[depth:]), items[0].valueHash[:])
+	}
+	prefixLen := 0
+Prefix:
+	for {
+		for _, item := range items[1:] {
+			if item.path[depth+prefixLen] != items[0].path[depth+prefixLen] {
+				break Prefix
+			}
+		}
+		prefixLen++
+	}
+	var left, right []binaryItem
+	for _, item := range items {
+		if item.path[depth+prefixLen] == 0 {
+			left = append(left, item)
+		} else {
+			right = append(right, item)
+		}
+	}
+	leftHash := referenceBinaryHash(left, depth+prefixLen+1)
+	rightHash := referenceBinaryHash(right, depth+prefixLen+1)
+	branch := h.sum([]byte{binaryBranchPrefix}, leftHash[:], rightHash[:])
+	if prefixLen == 0 {
+		return branch
+	}
+	return h.sum([]byte{binaryExtensionPrefix}, encodeBinaryPath(items[0].path[depth:depth+prefixLen]), branch[:])
+}
+
+func referenceBinaryValues(values map[string][]byte) []binaryItem {
+	items := make([]binaryItem, 0, len(values))
+	for key, value := range values {
+		items = append(items, binaryItem{path: binaryPath([]byte(key)), valueHash: crypto.Keccak256Hash(value)})
+	}
+	return items
+}
+
+func TestBinaryTrieHash(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tr := NewBinaryTrie()
+	values := make(map[string][]byte)
+	check := func() {
+		t.Helper()
+		hash, err := tr.Hash()
+		if err != nil {
+			t.Fatalf("could not hash binary trie: %v", err)
+		}
+		if expected := referenceBinaryHash(referenceBinaryValues(values), 0); hash != expected {
+			t.Fatalf("root mismatch: have %x, want %x", hash, expected)
+		}
+	}
+	check()
+
+	keys := make([][]byte, 256)
+	for i := range keys {
+		keys[i] = make([]byte, 8)
+		rnd.Read(keys[i])
+		value := make([]byte, 1+rnd.Intn(40))
+		rnd.Read(value)
+		tr.Trie().Update(keys[i], value, 0)
+		values[string(keys[i])] = value
+	}
+	check()
+
+	// Only the modified parts of the trie are re-hashed, the rest has to stay consistent
+	for i, key := range keys {
+		switch i % 3 {
+		case 0:
+			tr.Trie().Delete(key, 0)
+			delete(values, string(key))
+		case 1:
+			value := []byte{byte(i)}
+			tr.Trie().Update(key, value, 0)
+			values[string(key)] = value
+		}
+		if i%16 == 0 {
+			check()
+		}
+	}
+	check()
+}
+
+func TestBinaryTrieHashAccounts(t *testing.T) {
+	tr := NewBinaryTrie()
+	addrHashes := []common.Hash{crypto.Keccak256Hash([]byte{1}), crypto.Keccak256Hash([]byte{2}), crypto.Keccak256Hash([]byte{3})}
+	storage := make(map[string][]byte)
+	for i := 0; i < 10; i++ {
+		keyHash := crypto.Keccak256Hash([]byte{byte(i)})
+		storage[string(keyHash[:])] = []byte{byte(i + 1)}
+	}
+
+	var items []binaryItem
+	for i, addrHash := range addrHashes {
+		account := accounts.NewAccount()
+		account.Nonce = uint64(i)
+		account.Balance.SetInt64(int64(1000 * (i + 1)))
+		tr.Trie().UpdateAccount(addrHash[:], &account)
+		account.Root = EmptyBinaryRoot
+		if i == 0 {
+			for keyHash, value := range storage {
+				tr.Trie().Update(append(addrHash[:], keyHash...), value, 0)
+			}
+			account.Root = referenceBinaryHash(referenceBinaryValues(storage), 0)
+		}
+		encoded := make([]byte, account.EncodingLengthForHashing())
+		account.EncodeForHashing(encoded)
+		items = append(items, binaryItem{path: binaryPath(addrHash[:]), valueHash: crypto.Keccak256Hash(encoded)})
+	}
+
+	hash, err := tr.Hash()
+	if err != nil {
+		t.Fatalf("could not hash binary trie: %v", err)
+	}
+	if expected := referenceBinaryHash(items, 0); hash != expected {
+		t.Fatalf("root mismatch: have %x, want %x", hash, expected)
+	}
+	// The storage root of the account is replaced by the one of the binary trie
+	acc, _ := tr.Trie().GetAccount(addrHashes[0][:])
+	if expected := referenceBinaryHash(referenceBinaryValues(storage), 0); acc.Root != expected {
+		t.Errorf("storage root mismatch: have %x, want %x", acc.Root, expected)
+	}
+	if acc.Balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("balance mismatch: have %d, want %d", &acc.Balance, 1000)
+	}
+}
@@ -17,6 +17,7 @@
 package trie
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
@@ -283,3 +284,90 @@ func (n shortNode) String() string    { return n.fstring("") }
 func (n hashNode) String() string     { return n.fstring("") }
 func (n valueNode) String() string    { return n.fstring("") }
 func (an accountNode) String() string { return an.fstring("") }
+
+// decodeRef decodes the reference to a child node of a branch or an extension node.
+// Only hashes are supported, since embedded nodes are only possible for tiny subtries
+// that are never requested separately from their parents.
+func decodeRef(buf []byte) (node, []byte, error) {
+	kind, val, rest, err := rlp.Split(buf)
+	if err != nil {
+		return nil, buf, err
+	}
+	switch {
+	case kind == rlp.List:
+		return nil, buf, fmt.Errorf("embedded nodes are not supported")
+	case kind == rlp.String && len(val) == 0:
+		return nil, rest, nil
+	case kind == rlp.String && len(val) == common.HashLength:
+		return hashNode(common.CopyBytes(val)), rest, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid RLP string size %d (want 0 or 32)", len(val))
+	}
+}
+
+// decodeNode decodes the RLP of a branch or an extension node with the given hash.
+// Children of the node are represented by hashNodes.
+func decodeNode(hash []byte, buf []byte) (node, error) {
+	elems, _, err := rlp.SplitList(buf)
+	if err != nil {
+		return nil, fmt.Errorf("decode error: %v", err)
+	}
+	c, err := rlp.CountValues(elems)
+	if err != nil {
+		return nil, fmt.Errorf("decode error: %v", err)
+	}
+	switch c {
+	case 2:
+		kbuf, rest, err := rlp.SplitString(elems)
+		if err != nil {
+			return nil, err
+		}
+		key := compactToHex(kbuf)
+		if hasTerm(key) {
+			return nil, fmt.Errorf("unexpected leaf node")
+		}
+		child, _, err := decodeRef(rest)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return nil, fmt.Errorf("extension node without child")
+		}
+		return &shortNode{Key: key, Val: child}, nil
+	case 17:
+		var children [17]node
+		var mask uint32
+		var count int
+		for i := 0; i < 16; i++ {
+			child, rest, err := decodeRef(elems)
+			if err != nil {
+				return nil, err
+			}
+			elems = rest
+			if child != nil {
+				children[i] = child
+				mask |= uint32(1) << uint(i)
+				count++
+			}
+		}
+		if val, _, err := rlp.SplitString(elems); err != nil {
+			return nil, err
+		} else if len(val) > 0 {
+			return nil, fmt.Errorf("unexpected value in branch node")
+		}
+		if count < 2 {
+			return nil, fmt.Errorf("branch node with %d children", count)
+		}
+		var flags nodeFlag
+		copy(flags.hash[:], hash)
+		if count == 2 {
+			n := &duoNode{mask: mask, flags: flags}
+			i1, i2 := n.childrenIdx()
+			n.child1, n.child2 = children[i1], children[i2]
+			return n, nil
+		}
+		return &fullNode{Children: children, flags: flags}, nil
+	default:
+		return nil, fmt.Errorf("invalid number of list elements: %v", c)
+	}
+}
@@ -19,274 +19,127 @@
 package trie
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"math/big"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/trie/rlphacks"
+	"github.com/ledgerwatch/turbo-geth/trie/witness"
 	"github.com/ugorji/go/codec"
 )
 
 type WitnessTapeStats map[string]int
 
-// TapeBuilder stores the sequence of values that is getting serialised using CBOR into a byte buffer
-type TapeBuilder struct {
-	buffer  bytes.Buffer     // Byte buffer where the CBOR-encoded values end up being written
-	handle  codec.CborHandle // Object used to control the behavior of CBOR encoding
-	encoder *codec.Encoder   // Values are supplied to this object (via its Encode function)
-}
-
-// init allocates a new encoder, binding it to the buffer and the handle
-func (t *TapeBuilder) init() {
-	t.encoder = codec.NewEncoder(&t.buffer, &t.handle)
-}
-
+// Names of the tapes of the serialised block witness
 const (
-	KeyTape       = "keys"
-	ValueTape     = "values"
-	NonceTape     = "nonces"
-	BalanceTape   = "balances"
-	HashesTape    = "hashes"
-	CodesTape     = "codes"
-	StructureTape = "structure"
+	KeyTape       = witness.KeyTape
+	ValueTape     = witness.ValueTape
+	NonceTape     = witness.NonceTape
+	BalanceTape   = witness.BalanceTape
+	HashesTape    = witness.HashesTape
+	CodesTape     = witness.CodesTape
+	StructureTape = witness.StructureTape
 )
 
 // BlockWitnessBuilder accumulates data that can later be turned into a serialised
-// version of the block witness
-// All buffers are streams of CBOR-encoded items (not a CBOR array, but individual items back-to-back)
-// `Keys` are binary strings
-// `Values` are binary strings
-// `Nonces` are uint64 integers
-// `Balances` instances of big.Int
-// `Hashes` are binary strings, all of size 32
-// `Codes` are binary strings
-// `Structure` are integers (for opcodes themselves), potentially followed by binary strings (key for EXTENSION) or
-// integers (bitmaps for BRANCH or length of LEAF or number of hashes for HASH)
+// version of the block witness. The format of the witness is described in the witness package.
 type BlockWitnessBuilder struct {
-	Keys      TapeBuilder // Sequence of keys that are consumed by LEAF, LEAFHASH, ACCOUNTLEAF, and ACCOUNTLEAFHASH opcodes
-	Values    TapeBuilder // Sequence of values that are consumed by LEAF, and LEAFHASH opcodes
-	Nonces    TapeBuilder // Sequence of nonces that are consumed by ACCOUNTLEAF or ACCOUNTLEAFHASH opcodes
-	Balances  TapeBuilder // Sequence of balances that are consumed by ACCOUNTLEAF or ACCOUNTLEAFHASH opcodes
-	Hashes    TapeBuilder // Sequence of hashes that are consumed by the HASH opcode
-	Codes     TapeBuilder // Sequence of contract codes that are consumed by the CODE opcode
-	Structure TapeBuilder // Sequence of opcodes and operands that define the structure of the witness
-	trace     bool
+	encoder *witness.Encoder
+	trace   bool
 }
 
 // Instruction is "enum" type for defining the opcodes of the stack machine that reconstructs the structure of tries from Structure tape
-type Instruction uint8
+type Instruction = witness.Instruction
 
+// Opcodes of the stack machine, see the witness package for their description
 const (
-	// OpLeaf consumes key from key tape, value from value tape, creates leaf node and pushes it onto the node stack, its hash onto the hash stack
-	OpLeaf Instruction = iota
-	// OpLeafHash consumes key from key tape, value from value tape, computes hash of would-be leaf node and pushes it onto the hash stack
-	OpLeafHash
-	// OpExtension pops a node from the node stack, constructs extension node from it and its operand's key, and pushes this extension node onto
-	// the node stack, its hash onto the hash stack
-	OpExtension
-	// OpExtensionHash pops a hash from the hash stack, computes the hash of would-be extension node from it and its operand's key,
-	// and pushes this hash onto the hash stack
-	OpExtensionHash
-	// OpBranch has operand, which is a bitset representing digits in the branch node. Pops the children nodes from the node stack (the number of
-	// children is equal to the number of bits in the bitset), constructs branch node and pushes it onto the node stack, its hash onto the hash stack
-	OpBranch
-	// OpBranchHash has operand, which is a bitset representing digits in the branch node. Pops the children hashes from the hash stack (the number of
-	// children hashes is equal to the number of bits in the bitset), computes the hash of would-be branch node and pushes that hash onto the hash stack
-	OpBranchHash
-	// OpHash consumes given (in the operant) number of hash from the hash tape, and pushes them onto the stack. The first item consumed ends up
-	// the deepest on the stack, the last item consumed ends up on the top of the stack.
-	OpHash
-	// OpCode consumes bytecode item from the code tape, construct code node and pushes it onto the node stack, its hash onto the hash stack.
-	OpCode
-	// OpAccountLeaf consumes key from the key tape, and two values from the value tape, one for nonce, another for balance. It constructs
-	// an account node (without any storage and code) and pushes it onto the node stack, its hash onto the hash stack.
-	OpAccountLeaf
-	// OpAccountLeafHash consumes key from the key tape, and two values from the value tape, one for nonce, another for balance.
-	// It computes the hash of would-be account node (without any storage and code) and pushes it onto the hash stack.
-	OpAccountLeafHash
-	// OpEmptyRoot places nil onto the node stack, and empty root hash onto the hash stack.
-	OpEmptyRoot
+	OpLeaf            = witness.OpLeaf
+	OpLeafHash        = witness.OpLeafHash
+	OpExtension       = witness.OpExtension
+	OpExtensionHash   = witness.OpExtensionHash
+	OpBranch          = witness.OpBranch
+	OpBranchHash      = witness.OpBranchHash
+	OpHash            = witness.OpHash
+	OpCode            = witness.OpCode
+	OpAccountLeaf     = witness.OpAccountLeaf
+	OpAccountLeafHash = witness.OpAccountLeafHash
+	OpEmptyRoot       = witness.OpEmptyRoot
 )
 
 // NewBlockWitnessBuilder creates an initialised block witness builder ready for use
 func NewBlockWitnessBuilder(trace bool) *BlockWitnessBuilder {
-	var bwb BlockWitnessBuilder
-	bwb.trace = trace
-	bwb.Keys.init()
-	bwb.Values.init()
-	bwb.Nonces.init()
-	bwb.Balances.init()
-	bwb.Hashes.init()
-	bwb.Codes.init()
-	bwb.Structure.init()
-	return &bwb
+	return &BlockWitnessBuilder{encoder: witness.NewEncoder(), trace: trace}
 }
 
 // keyValue supplies the next key for the key tape
 func (bwb *BlockWitnessBuilder) supplyKey(key []byte) error {
-	if err := bwb.Keys.encoder.Encode(key); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.SupplyKey(key)
 }
 
 func (bwb *BlockWitnessBuilder) supplyValue(value []byte) error {
-	if err := bwb.Values.encoder.Encode(value); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.SupplyValue(value)
 }
 
 func (bwb *BlockWitnessBuilder) supplyNonce(nonce uint64) error {
-	if err := bwb.Nonces.encoder.Encode(&nonce); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.SupplyNonce(nonce)
 }
 
 // TODO [Alexey] utilise CBOR tag to make this value as bit integer rather than just a string of bytes
 func (bwb *BlockWitnessBuilder) supplyBalance(balance *big.Int) error {
-	var v = balance.Bytes()
-	if err := bwb.Balances.encoder.Encode(v); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.SupplyBalance(balance)
 }
 
 func (bwb *BlockWitnessBuilder) supplyCode(code []byte) error {
-	if err := bwb.Codes.encoder.Encode(code); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.SupplyCode(code)
 }
 
 func (bwb *BlockWitnessBuilder) supplyHash(hash common.Hash) error {
-	if err := bwb.Hashes.encoder.Encode(hash[:]); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.SupplyHash(hash)
 }
 
 func (bwb *BlockWitnessBuilder) leaf(length int) error {
-	o := OpLeaf
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&length); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.Leaf(length)
 }
 
 func (bwb *BlockWitnessBuilder) leafHash(length int) error {
-	o := OpLeafHash
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&length); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.LeafHash(length)
 }
 
 func (bwb *BlockWitnessBuilder) extension(key []byte) error {
-	o := OpExtension
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(key); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.Extension(key)
 }
 
 func (bwb *BlockWitnessBuilder) extensionHash(key []byte) error {
-	o := OpExtensionHash
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(key); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.ExtensionHash(key)
 }
 
 func (bwb *BlockWitnessBuilder) branch(set uint32) error {
-	o := OpBranch
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&set); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.Branch(set)
 }
 
 func (bwb *BlockWitnessBuilder) branchHash(set uint32) error {
-	o := OpBranchHash
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&set); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.BranchHash(set)
 }
 
 func (bwb *BlockWitnessBuilder) hash(number int) error {
-	o := OpHash
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&number); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.Hash(number)
 }
 
 func (bwb *BlockWitnessBuilder) code() error {
-	o := OpCode
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.Code()
 }
 
 func (bwb *BlockWitnessBuilder) accountLeaf(length int, fieldSet uint32) error {
-	o := OpAccountLeaf
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&length); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&fieldSet); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.AccountLeaf(length, fieldSet)
 }
 
 func (bwb *BlockWitnessBuilder) accountLeafHash(length int, fieldSet uint32) error {
-	o := OpAccountLeafHash
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&length); err != nil {
-		return err
-	}
-	if err := bwb.Structure.encoder.Encode(&fieldSet); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.AccountLeafHash(length, fieldSet)
 }
 
 func (bwb *BlockWitnessBuilder) emptyRoot() error {
-	o := OpEmptyRoot
-	if err := bwb.Structure.encoder.Encode(&o); err != nil {
-		return err
-	}
-	return nil
+	return bwb.encoder.EmptyRoot()
 }
 
 // MakeBlockWitness constructs block witness from the given trie and the
@@ -455,44 +308,10 @@ func (bwb *BlockWitnessBuilder) makeBlockWitness(
 // and writes it into the given writer
 // returns stats (tape lengths) and stuff
 func (bwb *BlockWitnessBuilder) WriteTo(w io.Writer) (WitnessTapeStats, error) {
-	// Calculate the lengths of all the tapes and write them as an array
-	var lens = map[string]int{
-		KeyTape:       bwb.Keys.buffer.Len(),
-		ValueTape:     bwb.Values.buffer.Len(),
-		NonceTape:     bwb.Nonces.buffer.Len(),
-		BalanceTape:   bwb.Balances.buffer.Len(),
-		HashesTape:    bwb.Hashes.buffer.Len(),
-		CodesTape:     bwb.Codes.buffer.Len(),
-		StructureTape: bwb.Structure.buffer.Len(),
-	}
-	var handle codec.CborHandle
-	handle.EncodeOptions.Canonical = true
-	encoder := codec.NewEncoder(w, &handle)
-	if err := encoder.Encode(&lens); err != nil {
-		return nil, err
-	}
-	if _, err := bwb.Keys.buffer.WriteTo(w); err != nil {
-		return nil, err
-	}
-	if _, err := bwb.Values.buffer.WriteTo(w); err != nil {
-		return nil, err
-	}
-	if _, err := bwb.Nonces.buffer.WriteTo(w); err != nil {
-		return nil, err
-	}
-	if _, err := bwb.Balances.buffer.WriteTo(w); err != nil {
-		return nil, err
-	}
-	if _, err := bwb.Hashes.buffer.WriteTo(w); err != nil {
-		return nil, err
-	}
-	if _, err := bwb.Codes.buffer.WriteTo(w); err != nil {
+	lens, err := bwb.encoder.Serialise(w)
+	if err != nil {
 		return nil, err
 	}
-	if _, err := bwb.Structure.buffer.WriteTo(w); err != nil {
-		return nil, err
-	}
-
 	return WitnessTapeStats(lens), nil
 }
 
@@ -578,6 +397,15 @@ func (cht *CborHashTape) Next() (common.Hash, error) {
 	return hash, nil
 }
 
+// BlockWitnessTapeStats reads the lengths of the tapes from the header of the serialised block witness
+func BlockWitnessTapeStats(bw []byte) (WitnessTapeStats, error) {
+	h, err := witness.ReadHeader(bw)
+	if err != nil {
+		return nil, err
+	}
+	return WitnessTapeStats(h.Lengths), nil
+}
+
 // BlockWitnessToTrie creates trie and code map, given serialised representation of block witness
 func BlockWitnessToTrie(bw []byte, trace bool) (*Trie, map[common.Hash][]byte, error) {
 	return BlockWitnessToTrieBin(bw, trace, false)
@@ -586,145 +414,66 @@ func BlockWitnessToTrie(bw []byte, trace bool) (*Trie, map[common.Hash][]byte, e
 // BlockWitnessToTrie creates trie and code map, given serialised representation of block witness
 func BlockWitnessToTrieBin(bw []byte, trace bool, isBinary bool) (*Trie, map[common.Hash][]byte, error) {
 	codeMap := make(map[common.Hash][]byte)
-	var lens map[string]int
-	var handle codec.CborHandle
-	decoder := codec.NewDecoderBytes(bw, &handle)
-	if err := decoder.Decode(&lens); err != nil {
+	decoder, err := witness.NewDecoder(bw)
+	if err != nil {
 		return nil, nil, err
 	}
 	hb := NewHashBuilder(false)
-	// It is important to read the tapes in the same order as they were written
-	startOffset := decoder.NumBytesRead()
-	endOffset := startOffset + lens[KeyTape]
-
-	keyTape := NewCborBytesTape(bw[startOffset:endOffset])
-
-	startOffset = endOffset
-	endOffset = startOffset + lens[ValueTape]
-	valueTape := NewRlpSerializableBytesTape(NewCborBytesTape(bw[startOffset:endOffset]))
-
-	startOffset = endOffset
-	endOffset = startOffset + lens[NonceTape]
-	nonceTape := NewCborUint64Tape(bw[startOffset:endOffset])
-	startOffset = endOffset
-	endOffset = startOffset + lens[BalanceTape]
-	balanceTape := NewCborBigIntTape(bw[startOffset:endOffset])
-	startOffset = endOffset
-	endOffset = startOffset + lens[HashesTape]
-
-	hashTape := NewCborHashTape(bw[startOffset:endOffset])
-	startOffset = endOffset
-	endOffset = startOffset + lens[CodesTape]
-
-	codeTape := NewCborBytesTape(bw[startOffset:endOffset])
-	startOffset = endOffset
-	endOffset = startOffset + lens[StructureTape]
-	structureB := bw[startOffset:endOffset]
-	decoder.ResetBytes(structureB)
-	for decoder.NumBytesRead() < len(structureB) {
-		var opcode Instruction
-		if err := decoder.Decode(&opcode); err != nil {
+	for {
+		op, err := decoder.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
 			return nil, nil, err
 		}
-		hashOnly := false
-		switch opcode {
-		case OpLeafHash:
-			hashOnly = true
-			opcode = OpLeaf
-			fallthrough
+		switch op.Opcode {
 		case OpLeaf:
 			if trace {
-				if hashOnly {
-					fmt.Printf("LEAFHASH ")
-				} else {
-					fmt.Printf("LEAF ")
-				}
+				fmt.Printf("LEAF ")
 			}
-			var length int
-			if err := decoder.Decode(&length); err != nil {
+			if err := hb.leaf(op.Length, op.Key, rlphacks.RlpSerializableBytes(op.Value)); err != nil {
 				return nil, nil, err
 			}
-			keyHex, err := keyTape.Next()
-			if err != nil {
-				return nil, nil, err
+		case OpLeafHash:
+			if trace {
+				fmt.Printf("LEAFHASH ")
 			}
-			val, err := valueTape.Next()
-			if err != nil {
+			if err := hb.leafHash(op.Length, op.Key, rlphacks.RlpSerializableBytes(op.Value)); err != nil {
 				return nil, nil, err
 			}
-			if hashOnly {
-				if err := hb.leafHash(length, keyHex, val); err != nil {
-					return nil, nil, err
-				}
-			} else {
-				if err := hb.leaf(length, keyHex, val); err != nil {
-					return nil, nil, err
-				}
-			}
-		case OpExtensionHash:
-			hashOnly = true
-			opcode = OpExtension
-			fallthrough
 		case OpExtension:
 			if trace {
-				if hashOnly {
-					fmt.Printf("EXTENSIONHASH ")
-				} else {
-					fmt.Printf("EXTENSION ")
-				}
+				fmt.Printf("EXTENSION ")
 			}
-			var key []byte
-			if err := decoder.Decode(&key); err != nil {
+			if err := hb.extension(op.Key); err != nil {
 				return nil, nil, err
 			}
-			if hashOnly {
-				if err := hb.extensionHash(key); err != nil {
-					return nil, nil, err
-				}
-			} else {
-				if err := hb.extension(key); err != nil {
-					return nil, nil, err
-				}
+		case OpExtensionHash:
+			if trace {
+				fmt.Printf("EXTENSIONHASH ")
+			}
+			if err := hb.extensionHash(op.Key); err != nil {
+				return nil, nil, err
 			}
-
-		case OpBranchHash:
-			hashOnly = true
-			opcode = OpBranch
-			fallthrough
 		case OpBranch:
 			if trace {
-				if hashOnly {
-					fmt.Printf("BRANCHHASH ")
-				} else {
-					fmt.Printf("BRANCH ")
-				}
+				fmt.Printf("BRANCH ")
 			}
-			var set uint16
-			if err := decoder.Decode(&set); err != nil {
+			if err := hb.branch(op.Mask); err != nil {
 				return nil, nil, err
 			}
-			if hashOnly {
-				if err := hb.branchHash(set); err != nil {
-					return nil, nil, err
-				}
-			} else {
-				if err := hb.branch(set); err != nil {
-					return nil, nil, err
-				}
+		case OpBranchHash:
+			if trace {
+				fmt.Printf("BRANCHHASH ")
+			}
+			if err := hb.branchHash(op.Mask); err != nil {
+				return nil, nil, err
 			}
 		case OpHash:
 			if trace {
 				fmt.Printf("HASH ")
 			}
-			var number int
-			if err := decoder.Decode(&number); err != nil {
-				return nil, nil, err
-			}
-			for i := 0; i < number; i++ {
-				hash, err := hashTape.Next()
-				if err != nil {
-					return nil, nil, err
-				}
+			for _, hash := range op.Hashes {
 				if err := hb.hash(hash); err != nil {
 					return nil, nil, err
 				}
@@ -733,71 +482,32 @@ func BlockWitnessToTrieBin(bw []byte, trace bool, isBinary bool) (*Trie, map[com
 			if trace {
 				fmt.Printf("CODE ")
 			}
-			code, err := codeTape.Next()
-			if err != nil {
-				return nil, nil, err
-			}
-			if codeHash, err := hb.code(code); err == nil {
-				codeMap[codeHash] = code
+			if codeHash, err := hb.code(op.Code); err == nil {
+				codeMap[codeHash] = op.Code
 			} else {
 				return nil, nil, err
 			}
-
-		case OpAccountLeafHash:
-			hashOnly = true
-			opcode = OpAccountLeaf
-			fallthrough
 		case OpAccountLeaf:
-			var length int
-			var fieldSet uint32
-			if err := decoder.Decode(&length); err != nil {
-				return nil, nil, err
+			if trace {
+				fmt.Printf("ACCOUNTLEAF(%b) ", op.FieldSet)
 			}
-			if err := decoder.Decode(&fieldSet); err != nil {
+			if err := hb.accountLeaf(op.Length, op.Key, 0, op.Balance, op.Nonce, op.FieldSet); err != nil {
 				return nil, nil, err
 			}
+		case OpAccountLeafHash:
 			if trace {
-				if hashOnly {
-					fmt.Printf("ACCOUNTLEAFHASH (%b)", fieldSet)
-				} else {
-					fmt.Printf("ACCOUNTLEAF(%b) ", fieldSet)
-				}
+				fmt.Printf("ACCOUNTLEAFHASH (%b)", op.FieldSet)
 			}
-			keyHex, err := keyTape.Next()
-			if err != nil {
+			if err := hb.accountLeafHash(op.Length, op.Key, 0, op.Balance, op.Nonce, op.FieldSet); err != nil {
 				return nil, nil, err
 			}
-			balance := big.NewInt(0)
-			if fieldSet&uint32(2) != 0 {
-				balance, err = balanceTape.Next()
-				if err != nil {
-					return nil, nil, err
-				}
-			}
-			nonce := uint64(0)
-			if fieldSet&uint32(1) != 0 {
-				nonce, err = nonceTape.Next()
-				if err != nil {
-					return nil, nil, err
-				}
-			}
-			if hashOnly {
-
-				if err := hb.accountLeafHash(length, keyHex, 0, balance, nonce, fieldSet); err != nil {
-					return nil, nil, err
-				}
-			} else {
-				if err := hb.accountLeaf(length, keyHex, 0, balance, nonce, fieldSet); err != nil {
-					return nil, nil, err
-				}
-			}
 		case OpEmptyRoot:
 			if trace {
 				fmt.Printf("EMPTYROOT ")
 			}
 			hb.emptyRoot()
 		default:
-			return nil, nil, fmt.Errorf("unknown opcode: %d", opcode)
+			return nil, nil, fmt.Errorf("unknown opcode: %d", op.Opcode)
 		}
 	}
 	if trace {
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/trie/witness"
 )
 
 func TestSupplyKeyValue(t *testing.T) {
@@ -12,14 +13,14 @@ func TestSupplyKeyValue(t *testing.T) {
 	if err := bwb.supplyKey([]byte("key")); err != nil {
 		t.Errorf("Could not supply key: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x436b6579"), bwb.Keys.buffer.Bytes()) {
-		t.Errorf("Expected 0x436b6579 in keys tape, got: %x", bwb.Keys.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x436b6579"), bwb.encoder.Tape(KeyTape)) {
+		t.Errorf("Expected 0x436b6579 in keys tape, got: %x", bwb.encoder.Tape(KeyTape))
 	}
 	if err := bwb.supplyValue([]byte("value")); err != nil {
 		t.Errorf("Could not supply value: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x4576616c7565"), bwb.Values.buffer.Bytes()) {
-		t.Errorf("Expected 0x4576616c7565 in values tape, got: %x", bwb.Values.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x4576616c7565"), bwb.encoder.Tape(ValueTape)) {
+		t.Errorf("Expected 0x4576616c7565 in values tape, got: %x", bwb.encoder.Tape(ValueTape))
 	}
 }
 
@@ -28,8 +29,8 @@ func TestSupplyHash(t *testing.T) {
 	if err := bwb.supplyHash(common.HexToHash("0x9583498348fc48393abc")); err != nil {
 		t.Errorf("Could not supply hash: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x5820000000000000000000000000000000000000000000009583498348fc48393abc"), bwb.Hashes.buffer.Bytes()) {
-		t.Errorf("Expected 0x5820000000000000000000000000000000000000000000009583498348fc48393abc in hash tape, got: %x", bwb.Hashes.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x5820000000000000000000000000000000000000000000009583498348fc48393abc"), bwb.encoder.Tape(HashesTape)) {
+		t.Errorf("Expected 0x5820000000000000000000000000000000000000000000009583498348fc48393abc in hash tape, got: %x", bwb.encoder.Tape(HashesTape))
 	}
 }
 
@@ -38,8 +39,8 @@ func TestSupplyCode(t *testing.T) {
 	if err := bwb.supplyCode(common.FromHex("0x9583498348fc48393abc58bc")); err != nil {
 		t.Errorf("Could not supply code: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x4c9583498348fc48393abc58bc"), bwb.Codes.buffer.Bytes()) {
-		t.Errorf("Expected 0x4c9583498348fc48393abc58bc in codes tape, got: %x", bwb.Codes.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x4c9583498348fc48393abc58bc"), bwb.encoder.Tape(CodesTape)) {
+		t.Errorf("Expected 0x4c9583498348fc48393abc58bc in codes tape, got: %x", bwb.encoder.Tape(CodesTape))
 	}
 }
 
@@ -48,8 +49,8 @@ func TestOpLeaf(t *testing.T) {
 	if err := bwb.leaf(56); err != nil {
 		t.Errorf("Could not call leaf: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x001838"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x001838 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x001838"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x001838 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 func TestOpLeafHash(t *testing.T) {
@@ -57,8 +58,8 @@ func TestOpLeafHash(t *testing.T) {
 	if err := bwb.leafHash(56); err != nil {
 		t.Errorf("Could not call leafHash: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x011838"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x011838 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x011838"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x011838 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -67,8 +68,8 @@ func TestOpExtension(t *testing.T) {
 	if err := bwb.extension(common.FromHex("0x0f05")); err != nil {
 		t.Errorf("Could not call extension: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x02420f05"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x02420f05 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x02420f05"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x02420f05 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -77,8 +78,8 @@ func TestOpExtensionHash(t *testing.T) {
 	if err := bwb.extensionHash(common.FromHex("0x0f05")); err != nil {
 		t.Errorf("Could not call extensionHash: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x03420f05"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x03420f05 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x03420f05"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x03420f05 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -87,8 +88,8 @@ func TestOpBranch(t *testing.T) {
 	if err := bwb.branch(1 + 4); err != nil {
 		t.Errorf("Could not call branch: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x0405"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x0405 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x0405"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x0405 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -97,8 +98,8 @@ func TestOpBranchHash(t *testing.T) {
 	if err := bwb.branchHash(1 + 4); err != nil {
 		t.Errorf("Could not call branchHash: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x0505"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x0505 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x0505"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x0505 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -107,8 +108,8 @@ func TestOpHash(t *testing.T) {
 	if err := bwb.hash(3); err != nil {
 		t.Errorf("Could not call hash: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x0603"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x0603 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x0603"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x0603 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -117,8 +118,8 @@ func TestOpCode(t *testing.T) {
 	if err := bwb.code(); err != nil {
 		t.Errorf("Could not call code: %v", err)
 	}
-	if !bytes.Equal(common.FromHex("0x07"), bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected 0x07 in structure tape, got: %x", bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(common.FromHex("0x07"), bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected 0x07 in structure tape, got: %x", bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -128,8 +129,8 @@ func TestOpAccountLeaf(t *testing.T) {
 		t.Errorf("Could not call acccountLeaf: %v", err)
 	}
 	expected := common.FromHex("0x08183803")
-	if !bytes.Equal(expected, bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(expected, bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.encoder.Tape(StructureTape))
 	}
 }
 func TestOpAccountLeafHash(t *testing.T) {
@@ -138,8 +139,8 @@ func TestOpAccountLeafHash(t *testing.T) {
 		t.Errorf("Could not call accountLeafHash: %v", err)
 	}
 	expected := common.FromHex("0x09183803")
-	if !bytes.Equal(expected, bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(expected, bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -149,8 +150,8 @@ func TestOpEmptyRoot(t *testing.T) {
 		t.Errorf("Could not call emptyRoot: %v", err)
 	}
 	expected := common.FromHex("0x0a")
-	if !bytes.Equal(expected, bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(expected, bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -164,8 +165,8 @@ func TestMakeBlockWitness(t *testing.T) {
 		t.Errorf("Could not make block witness: %v", err)
 	}
 	expected := common.FromHex("0x0601024704010402040304")
-	if !bytes.Equal(expected, bwb.Structure.buffer.Bytes()) {
-		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.Structure.buffer.Bytes())
+	if !bytes.Equal(expected, bwb.encoder.Tape(StructureTape)) {
+		t.Errorf("Expected %x in structure tape, got: %x", expected, bwb.encoder.Tape(StructureTape))
 	}
 }
 
@@ -183,10 +184,13 @@ func TestSerialiseBlockWitness(t *testing.T) {
 		t.Errorf("Could not make block witness: %v", err)
 	}
 
-	expected := common.FromHex("0xa76862616c616e6365730065636f64657300666861736865731822646b65797300666e6f6e63657300697374727563747572650b6676616c756573005820858f70a4b1e6aa71a7edc574d2ca946495a038aa37ce13dc7b7ed15661a6ff2f0601024704010402040304")
+	expected := common.FromHex("0x01a76862616c616e6365730065636f64657300666861736865731822646b65797300666e6f6e63657300697374727563747572650b6676616c756573005820858f70a4b1e6aa71a7edc574d2ca946495a038aa37ce13dc7b7ed15661a6ff2f0601024704010402040304")
 	if !bytes.Equal(expected, b.Bytes()) {
 		t.Errorf("Expected %x, got: %x", expected, b.Bytes())
 	}
+	if err := witness.Validate(b.Bytes()); err != nil {
+		t.Errorf("Serialised block witness is not valid: %v", err)
+	}
 	tr1, _, err := BlockWitnessToTrie(b.Bytes(), false)
 	if err != nil {
 		t.Errorf("Could not restore trie from the block witness: %v", err)
@@ -1139,6 +1139,131 @@ func (t *Trie) DeepHash(keyPrefix []byte) (bool, common.Hash) {
 	return true, accNode.Root
 }
 
+// NodeRefAtHexPrefix returns the reference to the node located at the specified hex prefix,
+// i.e. what the parent node would contain for it: the hash of the node, or the node's RLP
+// if it is shorter than 32 bytes. The root node (empty prefix) is always referenced by its hash.
+// If the prefix points into the middle of a key for a leaf node or of an extension node,
+// the reference is computed for a modified node, where the key prefix is removed from the key.
+// Second returned value is `false` if there is no node at the specified prefix.
+func (t *Trie) NodeRefAtHexPrefix(hexPrefix []byte) ([]byte, bool, error) {
+	nd := t.root
+	pos := 0
+	for pos < len(hexPrefix) {
+		switch n := nd.(type) {
+		case nil:
+			return nil, false, nil
+		case *shortNode:
+			matchlen := prefixLen(hexPrefix[pos:], n.Key)
+			if matchlen == len(n.Key) {
+				nd = n.Val
+				pos += matchlen
+			} else if pos+matchlen == len(hexPrefix) {
+				nd = &shortNode{Key: n.Key[matchlen:], Val: n.Val}
+				pos += matchlen
+			} else {
+				return nil, false, nil
+			}
+		case *duoNode:
+			i1, i2 := n.childrenIdx()
+			switch hexPrefix[pos] {
+			case i1:
+				nd = n.child1
+			case i2:
+				nd = n.child2
+			default:
+				return nil, false, nil
+			}
+			pos++
+		case *fullNode:
+			nd = n.Children[hexPrefix[pos]]
+			pos++
+		case valueNode, *accountNode:
+			return nil, false, nil
+		case hashNode:
+			return nil, false, fmt.Errorf("premature hashNode: pos %d, hexPrefix %x", pos, hexPrefix)
+		default:
+			panic(fmt.Sprintf("Unknown node: %T", n))
+		}
+	}
+	if nd == nil {
+		return nil, false, nil
+	}
+	h := t.newHasherFunc()
+	defer returnHasherToPool(h)
+	var ref [common.HashLength]byte
+	refLen, err := h.hash(nd, len(hexPrefix) == 0, ref[:])
+	if err != nil {
+		return nil, false, err
+	}
+	return common.CopyBytes(ref[:refLen]), true, nil
+}
+
+// FirstHashNode finds the first hashNode on the path to the key (in the KEYBYTES encoding).
+// For storage items, the key must be the concatenation of the contract's address hash and
+// the hash of the item's key. It returns the hex prefix at which the hashNode is located
+// (for storage items, including the nibbles of the address hash), and the hash.
+// Third returned value is `false` if there is no hashNode on the path.
+func (t *Trie) FirstHashNode(key []byte) ([]byte, []byte, bool) {
+	nd := t.root
+	hex := keybytesToHex(key)
+	pos := 0
+	for {
+		switch n := nd.(type) {
+		case nil:
+			return nil, nil, false
+		case *shortNode:
+			matchlen := prefixLen(hex[pos:], n.Key)
+			if matchlen == len(n.Key) || n.Key[matchlen] == 16 {
+				nd = n.Val
+			} else {
+				return nil, nil, false
+			}
+			pos += matchlen
+		case *duoNode:
+			i1, i2 := n.childrenIdx()
+			switch hex[pos] {
+			case i1:
+				nd = n.child1
+			case i2:
+				nd = n.child2
+			default:
+				return nil, nil, false
+			}
+			pos++
+		case *fullNode:
+			nd = n.Children[hex[pos]]
+			pos++
+		case valueNode:
+			return nil, nil, false
+		case *accountNode:
+			if pos == len(hex) {
+				return nil, nil, false
+			}
+			nd = n.storage
+		case hashNode:
+			return common.CopyBytes(hex[:pos]), common.CopyBytes(n), true
+		default:
+			panic(fmt.Sprintf("Unknown node: %T", n))
+		}
+	}
+}
+
+// HookNodeRLP replaces the hashNode located at the hex prefix with the node decoded from its RLP.
+// The node must be a branch or an extension node, and its children become hashNodes.
+// It is used to expand the trie one level at a time, when the subtrie is too large
+// to be fetched at once.
+func (t *Trie) HookNodeRLP(hexPrefix []byte, hash []byte, nodeRLP []byte) error {
+	if !bytes.Equal(crypto.Keccak256(nodeRLP), hash) {
+		return fmt.Errorf("node %x hash mismatch, expected %x", hexPrefix, hash)
+	}
+	n, err := decodeNode(hash, nodeRLP)
+	if err != nil {
+		return fmt.Errorf("node %x: %v", hexPrefix, err)
+	}
+	t.hook(hexPrefix, n)
+	return nil
+}
+
 func (t *Trie) unload(hex []byte, h *hasher) {
 	nd := t.root
 	var parent node
@@ -490,3 +490,122 @@ func TestDeepHash(t *testing.T) {
 		}
 	}
 }
+
+func TestNodeRefAtHexPrefix(t *testing.T) {
+	keyVals := map[string]string{
+		"\x10a": "value1",
+		"\x11b": "value2",
+		"\x20c": "a much longer value, so that the leaf is not embedded into its parent",
+		"\x21d": "value4",
+	}
+	trie := New(common.Hash{})
+	for key, value := range keyVals {
+		trie.Update([]byte(key), []byte(value), 0)
+	}
+
+	ref, found, err := trie.NodeRefAtHexPrefix([]byte{})
+	if err != nil || !found {
+		t.Fatalf("Expected the root node, got found %t, err %v", found, err)
+	}
+	if root := trie.Hash(); !bytes.Equal(ref, root[:]) {
+		t.Errorf("Root reference mismatch: %x, expected %x", ref, root)
+	}
+
+	for _, hexPrefix := range [][]byte{{1}, {1, 0}, {1, 1, 6}, {2}, {2, 0}, {2, 0, 6, 3}} {
+		// A trie built from the leaves under the prefix only must produce the same reference
+		subTrie := New(common.Hash{})
+		for key, value := range keyVals {
+			if bytes.HasPrefix(keybytesToHex([]byte(key)), hexPrefix) {
+				subTrie.Update([]byte(key), []byte(value), 0)
+			}
+		}
+		ref1, found1, err1 := trie.NodeRefAtHexPrefix(hexPrefix)
+		ref2, found2, err2 := subTrie.NodeRefAtHexPrefix(hexPrefix)
+		if err1 != nil || err2 != nil || !found1 || !found2 {
+			t.Fatalf("Expected a node at prefix %x, got found %t/%t, err %v/%v", hexPrefix, found1, found2, err1, err2)
+		}
+		if !bytes.Equal(ref1, ref2) {
+			t.Errorf("Reference mismatch at prefix %x: %x, expected %x", hexPrefix, ref2, ref1)
+		}
+	}
+
+	if _, found, _ = trie.NodeRefAtHexPrefix([]byte{3}); found {
+		t.Errorf("Expected no node at prefix 3")
+	}
+	if _, found, _ = trie.NodeRefAtHexPrefix([]byte{1, 0, 7}); found {
+		t.Errorf("Expected no node at prefix 107")
+	}
+}
+
+// nodeRLPAtHexPrefix returns the RLP of the node located exactly at the hex prefix
+func nodeRLPAtHexPrefix(t *Trie, hexPrefix []byte) []byte {
+	nd := t.root
+	for pos := 0; pos < len(hexPrefix); {
+		switch n := nd.(type) {
+		case *shortNode:
+			nd = n.Val
+			pos += len(n.Key)
+		case *duoNode:
+			i1, _ := n.childrenIdx()
+			if hexPrefix[pos] == i1 {
+				nd = n.child1
+			} else {
+				nd = n.child2
+			}
+			pos++
+		case *fullNode:
+			nd = n.Children[hexPrefix[pos]]
+			pos++
+		}
+	}
+	h := newHasher(false)
+	defer returnHasherToPool(h)
+	enc, err := h.hashChildren(nd, 0)
+	if err != nil {
+		panic(err)
+	}
+	return common.CopyBytes(enc)
+}
+
+func TestHookNodeRLP(t *testing.T) {
+	full := New(common.Hash{})
+	var keys [][]byte
+	for i := 0; i < 256; i++ {
+		key := crypto.Keccak256([]byte{byte(i)})
+		keys = append(keys, key)
+		full.Update(key, crypto.Keccak256(key), 0)
+	}
+	root := full.Hash()
+
+	// Expand the trie from the root hash, one node at a time, until only the leaves are hashNodes
+	trie := New(root)
+	for _, key := range keys {
+		for {
+			hexPrefix, hash, found := trie.FirstHashNode(key)
+			if !found {
+				t.Fatalf("Expected a hashNode on the path to %x", key)
+			}
+			enc := nodeRLPAtHexPrefix(full, hexPrefix)
+			if err := trie.HookNodeRLP(hexPrefix, hash, enc); err != nil {
+				// Leaves cannot be hooked, they have to be fetched with their values
+				elems, _, _ := rlp.SplitList(enc)
+				if compact, _, _ := rlp.SplitString(elems); !hasTerm(compactToHex(compact)) {
+					t.Fatalf("Unexpected error for prefix %x: %v", hexPrefix, err)
+				}
+				break
+			}
+		}
+	}
+	if trie.Hash() != root {
+		t.Errorf("Root mismatch after hooking: %x, expected %x", trie.Hash(), root)
+	}
+	if _, ok := trie.Get(keys[0]); ok {
+		t.Errorf("Expected the leaf to be unresolved")
+	}
+
+	// Node not matching the hash is rejected
+	trie = New(root)
+	if err := trie.HookNodeRLP([]byte{}, root[:], nodeRLPAtHexPrefix(full, []byte{0})); err == nil {
+		t.Errorf("Expected hash mismatch error")
+	}
+}
@@ -0,0 +1,371 @@
+package witness
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ugorji/go/codec"
+)
+
+// VersionLegacy is the version of the witnesses written without the version byte
+const VersionLegacy byte = 0
+
+// Header describes the layout of a serialised witness
+type Header struct {
+	Version byte           // Version of the format
+	Lengths map[string]int // Lengths of the tapes in bytes
+	Size    int            // Size of the version byte and the header in bytes
+}
+
+// Major types of the CBOR items
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborMap   = 5
+
+	cborNull = 0xf6 // Initial byte of the null value
+)
+
+// isCborMap tells whether the byte starts a CBOR map, which is how the legacy witnesses start
+func isCborMap(b byte) bool {
+	return b>>5 == cborMap
+}
+
+// ReadHeader reads and validates the version and the header of the serialised witness.
+// The lengths of the tapes have to add up to the rest of the witness.
+func ReadHeader(witness []byte) (*Header, error) {
+	if len(witness) == 0 {
+		return nil, fmt.Errorf("empty witness")
+	}
+	h := &Header{}
+	offset := 0
+	if isCborMap(witness[0]) {
+		h.Version = VersionLegacy
+	} else {
+		h.Version = witness[0]
+		offset = 1
+	}
+	if h.Version != VersionLegacy && h.Version != Version1 {
+		return nil, fmt.Errorf("unsupported witness version: %d", h.Version)
+	}
+	lens, size, err := readLengths(witness[offset:])
+	if err != nil {
+		return nil, fmt.Errorf("malformed witness header: %v", err)
+	}
+	h.Lengths = lens
+	h.Size = offset + size
+	if len(h.Lengths) != len(tapeOrder) {
+		return nil, fmt.Errorf("witness header has %d tapes, expected %d", len(h.Lengths), len(tapeOrder))
+	}
+	remaining := len(witness) - h.Size
+	for _, name := range tapeOrder {
+		length, ok := h.Lengths[name]
+		if !ok {
+			return nil, fmt.Errorf("witness header misses tape %q", name)
+		}
+		if length < 0 || length > remaining {
+			return nil, fmt.Errorf("invalid length of tape %q: %d, %d bytes remaining", name, length, remaining)
+		}
+		remaining -= length
+	}
+	if remaining != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after the witness tapes", remaining)
+	}
+	return h, nil
+}
+
+// readLengths parses the CBOR map of the header. It is parsed by hand rather than by the CBOR decoder,
+// so that the lengths of the items declared in the malformed headers cannot make it allocate a lot of memory.
+func readLengths(data []byte) (map[string]int, int, error) {
+	major, entries, pos, err := readCborHead(data, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if major != cborMap || entries > uint64(len(tapeOrder)) {
+		return nil, 0, fmt.Errorf("expected map of at most %d entries", len(tapeOrder))
+	}
+	lens := make(map[string]int, entries)
+	for i := uint64(0); i < entries; i++ {
+		var length uint64
+		if major, length, pos, err = readCborHead(data, pos); err != nil {
+			return nil, 0, err
+		}
+		if major != cborText || length > uint64(len(data)-pos) {
+			return nil, 0, fmt.Errorf("invalid name of tape")
+		}
+		name := string(data[pos : pos+int(length)])
+		pos += int(length)
+		if major, length, pos, err = readCborHead(data, pos); err != nil {
+			return nil, 0, err
+		}
+		if major != cborUint || length > uint64(len(data)) {
+			return nil, 0, fmt.Errorf("invalid length of tape %q", name)
+		}
+		if _, ok := lens[name]; ok {
+			return nil, 0, fmt.Errorf("duplicate tape %q", name)
+		}
+		lens[name] = int(length)
+	}
+	return lens, pos, nil
+}
+
+// readCborHead reads the initial byte of the CBOR item at the position, and the argument that follows it.
+// It returns the major type of the item, its argument (the value, length or number of entries), and
+// the position after the argument. The indefinite lengths are not supported.
+func readCborHead(data []byte, pos int) (byte, uint64, int, error) {
+	if pos >= len(data) {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	major, info := data[pos]>>5, data[pos]&0x1f
+	pos++
+	if info < 24 {
+		return major, uint64(info), pos, nil
+	}
+	if info > 27 {
+		return 0, 0, 0, fmt.Errorf("unsupported additional information %d", info)
+	}
+	size := 1 << (info - 24)
+	if size > len(data)-pos {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	var arg uint64
+	for _, b := range data[pos : pos+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	return major, arg, pos + size, nil
+}
+
+// Operator is a decoded opcode of the structure tape, together with its operands
+// and the values it consumes from the other tapes
+type Operator struct {
+	Opcode   Instruction
+	Length   int           // OpLeaf, OpLeafHash, OpAccountLeaf, OpAccountLeafHash
+	Key      []byte        // OpLeaf, OpLeafHash, OpAccountLeaf, OpAccountLeafHash (from the key tape), OpExtension, OpExtensionHash
+	Value    []byte        // OpLeaf, OpLeafHash
+	Mask     uint16        // OpBranch, OpBranchHash
+	FieldSet uint32        // OpAccountLeaf, OpAccountLeafHash
+	Nonce    uint64        // OpAccountLeaf, OpAccountLeafHash
+	Balance  *big.Int      // OpAccountLeaf, OpAccountLeafHash
+	Hashes   []common.Hash // OpHash
+	Code     []byte        // OpCode
+}
+
+// tapeReader decodes CBOR items from a tape, keeping track of how much of it is consumed
+type tapeReader struct {
+	name    string
+	data    []byte
+	decoder *codec.Decoder
+}
+
+func newTapeReader(name string, data []byte) *tapeReader {
+	var handle codec.CborHandle // Object used to control the behavior of CBOR decoding
+	return &tapeReader{name: name, data: data, decoder: codec.NewDecoderBytes(data, &handle)}
+}
+
+func (t *tapeReader) done() bool {
+	return t.decoder.NumBytesRead() >= len(t.data)
+}
+
+// decode decodes the next item of the tape, which has to be of the given major type. The major type is
+// checked upfront, so that the decoder is not made to allocate the arrays or maps of the declared lengths.
+func (t *tapeReader) decode(major byte, v interface{}) error {
+	if t.done() {
+		return fmt.Errorf("tape %q exhausted", t.name)
+	}
+	b := t.data[t.decoder.NumBytesRead()]
+	// Older encoders wrote nil byte strings as null
+	if m := b >> 5; m != major && !(major == cborBytes && b == cborNull) {
+		return fmt.Errorf("unexpected item of major type %d in tape %q, expected %d", b>>5, t.name, major)
+	}
+	if err := t.decoder.Decode(v); err != nil {
+		return fmt.Errorf("malformed item in tape %q: %v", t.name, err)
+	}
+	if t.decoder.NumBytesRead() > len(t.data) {
+		return fmt.Errorf("item overruns tape %q", t.name)
+	}
+	return nil
+}
+
+func (t *tapeReader) nextBytes() ([]byte, error) {
+	var b []byte
+	if err := t.decode(cborBytes, &b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Decoder reads the operators of the serialised witness one by one, validating the witness
+// along the way: the values of the tapes, the depth of the stack, and that all the tapes
+// are consumed completely by the end of the structure tape.
+type Decoder struct {
+	header    *Header
+	tapes     map[string]*tapeReader
+	structure *tapeReader
+	depth     int  // Depth of the stack of the machine executing the structure tape
+	finished  bool // Whether the structure tape has been validated until the end
+}
+
+// NewDecoder reads the header of the serialised witness and prepares for decoding the operators
+func NewDecoder(witness []byte) (*Decoder, error) {
+	h, err := ReadHeader(witness)
+	if err != nil {
+		return nil, err
+	}
+	d := &Decoder{header: h, tapes: make(map[string]*tapeReader, len(tapeOrder))}
+	offset := h.Size
+	for _, name := range tapeOrder {
+		d.tapes[name] = newTapeReader(name, witness[offset:offset+h.Lengths[name]])
+		offset += h.Lengths[name]
+	}
+	d.structure = d.tapes[StructureTape]
+	return d, nil
+}
+
+// Header returns the header of the witness
+func (d *Decoder) Header() *Header {
+	return d.header
+}
+
+// Next decodes the next operator of the structure tape. It returns io.EOF after the last operator,
+// if the witness is well formed.
+func (d *Decoder) Next() (*Operator, error) {
+	if d.structure.done() {
+		if !d.finished {
+			if err := d.finish(); err != nil {
+				return nil, err
+			}
+			d.finished = true
+		}
+		return nil, io.EOF
+	}
+	op := &Operator{}
+	if err := d.structure.decode(cborUint, &op.Opcode); err != nil {
+		return nil, err
+	}
+	pops, pushes := 0, 1
+	var err error
+	switch op.Opcode {
+	case OpLeaf, OpLeafHash:
+		if err = d.structure.decode(cborUint, &op.Length); err != nil {
+			return nil, err
+		}
+		if op.Key, err = d.tapes[KeyTape].nextBytes(); err != nil {
+			return nil, err
+		}
+		if op.Length < 0 || op.Length > len(op.Key) {
+			return nil, fmt.Errorf("invalid length of leaf: %d, key %x", op.Length, op.Key)
+		}
+		if op.Value, err = d.tapes[ValueTape].nextBytes(); err != nil {
+			return nil, err
+		}
+	case OpExtension, OpExtensionHash:
+		if err = d.structure.decode(cborBytes, &op.Key); err != nil {
+			return nil, err
+		}
+		if len(op.Key) == 0 {
+			return nil, fmt.Errorf("empty key of extension")
+		}
+		pops = 1
+	case OpBranch, OpBranchHash:
+		if err = d.structure.decode(cborUint, &op.Mask); err != nil {
+			return nil, err
+		}
+		if op.Mask == 0 {
+			return nil, fmt.Errorf("empty mask of branch")
+		}
+		pops = bits.OnesCount16(op.Mask)
+	case OpHash:
+		var number int
+		if err = d.structure.decode(cborUint, &number); err != nil {
+			return nil, err
+		}
+		if number <= 0 {
+			return nil, fmt.Errorf("invalid number of hashes: %d", number)
+		}
+		for i := 0; i < number; i++ {
+			b, err := d.tapes[HashesTape].nextBytes()
+			if err != nil {
+				return nil, err
+			}
+			if len(b) != common.HashLength {
+				return nil, fmt.Errorf("invalid length of hash: %d", len(b))
+			}
+			op.Hashes = append(op.Hashes, common.BytesToHash(b))
+		}
+		pushes = number
+	case OpCode:
+		if op.Code, err = d.tapes[CodesTape].nextBytes(); err != nil {
+			return nil, err
+		}
+	case OpAccountLeaf, OpAccountLeafHash:
+		if err = d.structure.decode(cborUint, &op.Length); err != nil {
+			return nil, err
+		}
+		if err = d.structure.decode(cborUint, &op.FieldSet); err != nil {
+			return nil, err
+		}
+		if op.FieldSet > 15 {
+			return nil, fmt.Errorf("invalid fields of account leaf: %b", op.FieldSet)
+		}
+		if op.Key, err = d.tapes[KeyTape].nextBytes(); err != nil {
+			return nil, err
+		}
+		if op.Length < 0 || op.Length > len(op.Key) {
+			return nil, fmt.Errorf("invalid length of account leaf: %d, key %x", op.Length, op.Key)
+		}
+		op.Balance = new(big.Int)
+		if op.FieldSet&2 != 0 {
+			b, err := d.tapes[BalanceTape].nextBytes()
+			if err != nil {
+				return nil, err
+			}
+			op.Balance.SetBytes(b)
+		}
+		if op.FieldSet&1 != 0 {
+			if err = d.tapes[NonceTape].decode(cborUint, &op.Nonce); err != nil {
+				return nil, err
+			}
+		}
+		pops = bits.OnesCount32(op.FieldSet & 12)
+	case OpEmptyRoot:
+	default:
+		return nil, fmt.Errorf("unknown opcode: %d", op.Opcode)
+	}
+	if d.depth < pops {
+		return nil, fmt.Errorf("stack underflow: opcode %d pops %d items, stack depth %d", op.Opcode, pops, d.depth)
+	}
+	d.depth += pushes - pops
+	return op, nil
+}
+
+// finish checks the state of the decoder after the last operator
+func (d *Decoder) finish() error {
+	if d.depth > 1 {
+		return fmt.Errorf("%d items left on the stack, expected 1", d.depth)
+	}
+	for _, name := range tapeOrder {
+		if t := d.tapes[name]; !t.done() {
+			return fmt.Errorf("%d bytes of tape %q not consumed", len(t.data)-t.decoder.NumBytesRead(), name)
+		}
+	}
+	return nil
+}
+
+// Validate decodes the whole witness, checking that it is well formed
+func Validate(witness []byte) error {
+	d, err := NewDecoder(witness)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := d.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
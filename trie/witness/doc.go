@@ -0,0 +1,59 @@
+/*
+Package witness implements the serialisation format of the block witnesses, which carry the parts of
+the state trie and the contract codes required to execute a block without having the state.
+
+# Format
+
+The witness is a version byte, followed by the header and the tapes:
+
+	witness = version || header || tape_1 || ... || tape_n
+
+The version is a single byte, currently 0x01. The header is a CBOR map (in canonical form) from the
+names of the tapes (text strings) to their lengths in bytes (unsigned integers). Version 1 defines
+the following tapes, all of which must be present in the header, and which follow it in this order:
+
+	keys       byte strings, the keys of the leaves (one nibble per byte, possibly with the terminator 16)
+	values     byte strings, the values of the leaves
+	nonces     unsigned integers, the nonces of the accounts
+	balances   byte strings, the balances of the accounts (big endian, without leading zeroes)
+	hashes     byte strings of 32 bytes, the hashes of the nodes and of the contract codes
+	codes      byte strings, the contract codes
+	structure  the opcodes (unsigned integers), each followed by its operands
+
+Every tape is a sequence of CBOR items written back to back (not a CBOR array). The items of other
+types than the ones listed above are rejected. The lengths of the tapes have to add up to the length
+of the witness after the header.
+
+The witnesses written before the version byte was introduced start with the header straight away.
+As the header is a CBOR map, its first byte is in the range 0xa0-0xbf, so such witnesses are told apart
+from the versioned ones, and are decoded as version 0, which has the same layout as version 1.
+
+# Structure
+
+The structure tape is a program of the stack machine, which reconstructs the trie bottom up. Every
+opcode pushes exactly one item (a node) onto the stack, after popping the items it consumes:
+
+	opcode              operands           tapes consumed           pops
+	0  LEAF             length             keys, values             0
+	1  LEAFHASH         length             keys, values             0
+	2  EXTENSION        key                                         1
+	3  EXTENSIONHASH    key                                         1
+	4  BRANCH           mask                                        number of bits in mask
+	5  BRANCHHASH       mask                                        number of bits in mask
+	6  HASH             number             hashes (number times)    0, pushes number items instead of one
+	7  CODE                                codes                    0
+	8  ACCOUNTLEAF      length, fields     keys, balances, nonces   number of bits 4 and 8 in fields
+	9  ACCOUNTLEAFHASH  length, fields     keys, balances, nonces   number of bits 4 and 8 in fields
+	10 EMPTYROOT                                                    0
+
+The length operand of the leaves is the number of the trailing nibbles of the key, which belong to the leaf.
+The mask of a branch is a 16-bit bitmap of its children, which are popped in the ascending order of the
+digits, the last child being on the top of the stack. The fields of an account leaf are a bitmap of its
+fields present in the witness: 1 for the nonce, 2 for the balance, 4 for the storage root and 8 for the
+code hash. The storage root is on the top of the stack, the code hash is below it. The balance and the
+nonce are only consumed from their tapes if their bits are set.
+
+A well formed witness leaves exactly one item on the stack, the root of the trie, unless the trie is
+empty, in which case the structure tape is empty too. All the tapes have to be consumed completely.
+*/
+package witness
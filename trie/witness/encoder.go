@@ -0,0 +1,234 @@
+package witness
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ugorji/go/codec"
+)
+
+// Version1 is the first version of the witness format with the version byte
+const Version1 byte = 1
+
+// CurrentVersion is the version of the witnesses produced by the Encoder
+const CurrentVersion = Version1
+
+// Names of the tapes, as they appear in the header
+const (
+	KeyTape       = "keys"
+	ValueTape     = "values"
+	NonceTape     = "nonces"
+	BalanceTape   = "balances"
+	HashesTape    = "hashes"
+	CodesTape     = "codes"
+	StructureTape = "structure"
+)
+
+// tapeOrder is the order in which the tapes follow the header
+var tapeOrder = []string{KeyTape, ValueTape, NonceTape, BalanceTape, HashesTape, CodesTape, StructureTape}
+
+// Instruction is "enum" type for defining the opcodes of the stack machine that reconstructs the structure of tries from Structure tape
+type Instruction uint8
+
+const (
+	// OpLeaf consumes key from key tape, value from value tape, creates leaf node and pushes it onto the node stack, its hash onto the hash stack
+	OpLeaf Instruction = iota
+	// OpLeafHash consumes key from key tape, value from value tape, computes hash of would-be leaf node and pushes it onto the hash stack
+	OpLeafHash
+	// OpExtension pops a node from the node stack, constructs extension node from it and its operand's key, and pushes this extension node onto
+	// the node stack, its hash onto the hash stack
+	OpExtension
+	// OpExtensionHash pops a hash from the hash stack, computes the hash of would-be extension node from it and its operand's key,
+	// and pushes this hash onto the hash stack
+	OpExtensionHash
+	// OpBranch has operand, which is a bitset representing digits in the branch node. Pops the children nodes from the node stack (the number of
+	// children is equal to the number of bits in the bitset), constructs branch node and pushes it onto the node stack, its hash onto the hash stack
+	OpBranch
+	// OpBranchHash has operand, which is a bitset representing digits in the branch node. Pops the children hashes from the hash stack (the number of
+	// children hashes is equal to the number of bits in the bitset), computes the hash of would-be branch node and pushes that hash onto the hash stack
+	OpBranchHash
+	// OpHash consumes given (in the operant) number of hash from the hash tape, and pushes them onto the stack. The first item consumed ends up
+	// the deepest on the stack, the last item consumed ends up on the top of the stack.
+	OpHash
+	// OpCode consumes bytecode item from the code tape, construct code node and pushes it onto the node stack, its hash onto the hash stack.
+	OpCode
+	// OpAccountLeaf consumes key from the key tape, and two values from the value tape, one for nonce, another for balance. It constructs
+	// an account node (without any storage and code) and pushes it onto the node stack, its hash onto the hash stack.
+	OpAccountLeaf
+	// OpAccountLeafHash consumes key from the key tape, and two values from the value tape, one for nonce, another for balance.
+	// It computes the hash of would-be account node (without any storage and code) and pushes it onto the hash stack.
+	OpAccountLeafHash
+	// OpEmptyRoot places nil onto the node stack, and empty root hash onto the hash stack.
+	OpEmptyRoot
+)
+
+// tape stores the sequence of values that is getting serialised using CBOR into a byte buffer
+type tape struct {
+	buffer  bytes.Buffer     // Byte buffer where the CBOR-encoded values end up being written
+	handle  codec.CborHandle // Object used to control the behavior of CBOR encoding
+	encoder *codec.Encoder   // Values are supplied to this object (via its Encode function)
+}
+
+// init allocates a new encoder, binding it to the buffer and the handle
+func (t *tape) init() {
+	t.encoder = codec.NewEncoder(&t.buffer, &t.handle)
+}
+
+// encode appends the values to the tape
+func (t *tape) encode(values ...interface{}) error {
+	for _, v := range values {
+		if err := t.encoder.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encoder accumulates the tapes of the witness, and serialises them with the header.
+// The values are supplied to their tapes independently of the opcodes, which consume them,
+// but the order of the values within each tape has to match the order of the opcodes.
+type Encoder struct {
+	tapes map[string]*tape
+}
+
+// NewEncoder creates an encoder with empty tapes
+func NewEncoder() *Encoder {
+	e := &Encoder{tapes: make(map[string]*tape, len(tapeOrder))}
+	for _, name := range tapeOrder {
+		t := &tape{}
+		t.init()
+		e.tapes[name] = t
+	}
+	return e
+}
+
+// Tape returns the content of the tape accumulated so far
+func (e *Encoder) Tape(name string) []byte {
+	if t, ok := e.tapes[name]; ok {
+		return t.buffer.Bytes()
+	}
+	return nil
+}
+
+// nonNil makes sure that the byte string is not encoded as null
+func nonNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+// SupplyKey appends the key of a leaf to the key tape
+func (e *Encoder) SupplyKey(key []byte) error {
+	return e.tapes[KeyTape].encode(nonNil(key))
+}
+
+// SupplyValue appends the value of a leaf to the value tape
+func (e *Encoder) SupplyValue(value []byte) error {
+	return e.tapes[ValueTape].encode(nonNil(value))
+}
+
+// SupplyNonce appends the nonce of an account to the nonce tape
+func (e *Encoder) SupplyNonce(nonce uint64) error {
+	return e.tapes[NonceTape].encode(&nonce)
+}
+
+// SupplyBalance appends the balance of an account to the balance tape
+func (e *Encoder) SupplyBalance(balance *big.Int) error {
+	return e.tapes[BalanceTape].encode(balance.Bytes())
+}
+
+// SupplyHash appends a hash to the hash tape
+func (e *Encoder) SupplyHash(hash common.Hash) error {
+	return e.tapes[HashesTape].encode(hash[:])
+}
+
+// SupplyCode appends a contract code to the code tape
+func (e *Encoder) SupplyCode(code []byte) error {
+	return e.tapes[CodesTape].encode(nonNil(code))
+}
+
+func (e *Encoder) op(o Instruction, operands ...interface{}) error {
+	return e.tapes[StructureTape].encode(append([]interface{}{&o}, operands...)...)
+}
+
+// Leaf appends OpLeaf to the structure tape
+func (e *Encoder) Leaf(length int) error {
+	return e.op(OpLeaf, &length)
+}
+
+// LeafHash appends OpLeafHash to the structure tape
+func (e *Encoder) LeafHash(length int) error {
+	return e.op(OpLeafHash, &length)
+}
+
+// Extension appends OpExtension to the structure tape
+func (e *Encoder) Extension(key []byte) error {
+	return e.op(OpExtension, nonNil(key))
+}
+
+// ExtensionHash appends OpExtensionHash to the structure tape
+func (e *Encoder) ExtensionHash(key []byte) error {
+	return e.op(OpExtensionHash, nonNil(key))
+}
+
+// Branch appends OpBranch to the structure tape
+func (e *Encoder) Branch(set uint32) error {
+	return e.op(OpBranch, &set)
+}
+
+// BranchHash appends OpBranchHash to the structure tape
+func (e *Encoder) BranchHash(set uint32) error {
+	return e.op(OpBranchHash, &set)
+}
+
+// Hash appends OpHash to the structure tape
+func (e *Encoder) Hash(number int) error {
+	return e.op(OpHash, &number)
+}
+
+// Code appends OpCode to the structure tape
+func (e *Encoder) Code() error {
+	return e.op(OpCode)
+}
+
+// AccountLeaf appends OpAccountLeaf to the structure tape
+func (e *Encoder) AccountLeaf(length int, fieldSet uint32) error {
+	return e.op(OpAccountLeaf, &length, &fieldSet)
+}
+
+// AccountLeafHash appends OpAccountLeafHash to the structure tape
+func (e *Encoder) AccountLeafHash(length int, fieldSet uint32) error {
+	return e.op(OpAccountLeafHash, &length, &fieldSet)
+}
+
+// EmptyRoot appends OpEmptyRoot to the structure tape
+func (e *Encoder) EmptyRoot() error {
+	return e.op(OpEmptyRoot)
+}
+
+// Serialise writes the version byte, the header and the tapes into the given writer.
+// It returns the lengths of the tapes.
+func (e *Encoder) Serialise(w io.Writer) (map[string]int, error) {
+	lens := make(map[string]int, len(tapeOrder))
+	for _, name := range tapeOrder {
+		lens[name] = e.tapes[name].buffer.Len()
+	}
+	if _, err := w.Write([]byte{CurrentVersion}); err != nil {
+		return nil, err
+	}
+	var handle codec.CborHandle
+	handle.EncodeOptions.Canonical = true
+	encoder := codec.NewEncoder(w, &handle)
+	if err := encoder.Encode(&lens); err != nil {
+		return nil, err
+	}
+	for _, name := range tapeOrder {
+		if _, err := e.tapes[name].buffer.WriteTo(w); err != nil {
+			return nil, err
+		}
+	}
+	return lens, nil
+}
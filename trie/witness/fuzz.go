@@ -0,0 +1,97 @@
+// +build gofuzz
+
+package witness
+
+import (
+	"bytes"
+	"io"
+)
+
+// Fuzz implements a go-fuzz fuzzer method to test the decoding of the witnesses.
+// The witnesses, which are decoded successfully, are re-encoded and have to stay valid.
+func Fuzz(data []byte) int {
+	d, err := NewDecoder(data)
+	if err != nil {
+		return 0
+	}
+	e := NewEncoder()
+	for {
+		op, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0
+		}
+		if err := reencode(e, op); err != nil {
+			panic(err)
+		}
+	}
+	if d.Header().Version != CurrentVersion {
+		return 1
+	}
+	var b bytes.Buffer
+	if _, err := e.Serialise(&b); err != nil {
+		panic(err)
+	}
+	if err := Validate(b.Bytes()); err != nil {
+		panic(err)
+	}
+	return 1
+}
+
+// reencode supplies the operator and its values to the encoder
+func reencode(e *Encoder, op *Operator) error {
+	switch op.Opcode {
+	case OpLeaf, OpLeafHash:
+		if err := e.SupplyKey(op.Key); err != nil {
+			return err
+		}
+		if err := e.SupplyValue(op.Value); err != nil {
+			return err
+		}
+		if op.Opcode == OpLeaf {
+			return e.Leaf(op.Length)
+		}
+		return e.LeafHash(op.Length)
+	case OpExtension:
+		return e.Extension(op.Key)
+	case OpExtensionHash:
+		return e.ExtensionHash(op.Key)
+	case OpBranch:
+		return e.Branch(uint32(op.Mask))
+	case OpBranchHash:
+		return e.BranchHash(uint32(op.Mask))
+	case OpHash:
+		for _, hash := range op.Hashes {
+			if err := e.SupplyHash(hash); err != nil {
+				return err
+			}
+		}
+		return e.Hash(len(op.Hashes))
+	case OpCode:
+		if err := e.SupplyCode(op.Code); err != nil {
+			return err
+		}
+		return e.Code()
+	case OpAccountLeaf, OpAccountLeafHash:
+		if err := e.SupplyKey(op.Key); err != nil {
+			return err
+		}
+		if op.FieldSet&1 != 0 {
+			if err := e.SupplyNonce(op.Nonce); err != nil {
+				return err
+			}
+		}
+		if op.FieldSet&2 != 0 {
+			if err := e.SupplyBalance(op.Balance); err != nil {
+				return err
+			}
+		}
+		if op.Opcode == OpAccountLeaf {
+			return e.AccountLeaf(op.Length, op.FieldSet)
+		}
+		return e.AccountLeafHash(op.Length, op.FieldSet)
+	default:
+		return e.EmptyRoot()
+	}
+}
@@ -0,0 +1,231 @@
+package witness
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// encodeTestWitness encodes the witness of a small trie: an account with the code and the storage
+// of two items, under a branch with a hashed sibling
+func encodeTestWitness(t *testing.T) []byte {
+	e := NewEncoder()
+	steps := []error{
+		e.SupplyCode([]byte{0x60, 0x01, 0x00}),
+		e.Code(),
+		e.SupplyKey([]byte{1, 2, 16}),
+		e.SupplyValue([]byte{0x01}),
+		e.Leaf(3),
+		e.SupplyKey([]byte{2, 3, 16}),
+		e.SupplyValue([]byte{0x02}),
+		e.Leaf(3),
+		e.Branch(6),
+		e.Extension([]byte{5}),
+		e.SupplyKey([]byte{1, 1, 1, 16}),
+		e.SupplyNonce(3),
+		e.SupplyBalance(big.NewInt(1000)),
+		e.AccountLeaf(4, 15),
+		e.SupplyHash(common.HexToHash("0x01")),
+		e.Hash(1),
+		e.Branch(3),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	var b bytes.Buffer
+	if _, err := e.Serialise(&b); err != nil {
+		t.Fatalf("could not serialise witness: %v", err)
+	}
+	return b.Bytes()
+}
+
+func decodeAll(witness []byte) ([]*Operator, error) {
+	d, err := NewDecoder(witness)
+	if err != nil {
+		return nil, err
+	}
+	var ops []*Operator
+	for {
+		op, err := d.Next()
+		if err == io.EOF {
+			return ops, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	w := encodeTestWitness(t)
+	if w[0] != CurrentVersion {
+		t.Fatalf("expected version %d, got %d", CurrentVersion, w[0])
+	}
+	ops, err := decodeAll(w)
+	if err != nil {
+		t.Fatalf("could not decode witness: %v", err)
+	}
+	opcodes := []Instruction{OpCode, OpLeaf, OpLeaf, OpBranch, OpExtension, OpAccountLeaf, OpHash, OpBranch}
+	if len(ops) != len(opcodes) {
+		t.Fatalf("expected %d operators, got %d", len(opcodes), len(ops))
+	}
+	for i, op := range ops {
+		if op.Opcode != opcodes[i] {
+			t.Errorf("operator %d: expected opcode %d, got %d", i, opcodes[i], op.Opcode)
+		}
+	}
+	if !bytes.Equal(ops[0].Code, []byte{0x60, 0x01, 0x00}) {
+		t.Errorf("wrong code: %x", ops[0].Code)
+	}
+	if ops[2].Length != 3 || !bytes.Equal(ops[2].Key, []byte{2, 3, 16}) || !bytes.Equal(ops[2].Value, []byte{0x02}) {
+		t.Errorf("wrong leaf: %d %x %x", ops[2].Length, ops[2].Key, ops[2].Value)
+	}
+	if ops[3].Mask != 6 {
+		t.Errorf("wrong mask: %b", ops[3].Mask)
+	}
+	if acc := ops[5]; acc.FieldSet != 15 || acc.Nonce != 3 || acc.Balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("wrong account leaf: %b %d %d", acc.FieldSet, acc.Nonce, acc.Balance)
+	}
+	if len(ops[6].Hashes) != 1 || ops[6].Hashes[0] != common.HexToHash("0x01") {
+		t.Errorf("wrong hashes: %x", ops[6].Hashes)
+	}
+}
+
+func TestLegacyWitness(t *testing.T) {
+	// Witness serialised before the version byte was introduced
+	legacy := common.FromHex("0xa76862616c616e6365730065636f64657300666861736865731822646b65797300666e6f6e63657300697374727563747572650b6676616c756573005820858f70a4b1e6aa71a7edc574d2ca946495a038aa37ce13dc7b7ed15661a6ff2f0601024704010402040304")
+	h, err := ReadHeader(legacy)
+	if err != nil {
+		t.Fatalf("could not read header: %v", err)
+	}
+	if h.Version != VersionLegacy || h.Lengths[HashesTape] != 34 || h.Lengths[StructureTape] != 11 {
+		t.Errorf("wrong header: %+v", h)
+	}
+	if err := Validate(legacy); err != nil {
+		t.Errorf("legacy witness is not valid: %v", err)
+	}
+	if err := Validate(append([]byte{Version1}, legacy...)); err != nil {
+		t.Errorf("versioned witness is not valid: %v", err)
+	}
+	// Older encoders wrote the empty byte strings as null
+	nullCode := encodeStructure(t, func(e *Encoder) error {
+		if err := e.tapes[CodesTape].encode([]byte(nil)); err != nil {
+			return err
+		}
+		return e.Code()
+	})
+	if ops, err := decodeAll(nullCode); err != nil || len(ops) != 1 || len(ops[0].Code) != 0 {
+		t.Errorf("null code is not decoded: %v", err)
+	}
+}
+
+// encodeStructure serialises the witness with the given structure tape and the other tapes empty,
+// except for the ones supplied by the function
+func encodeStructure(t *testing.T, f func(e *Encoder) error) []byte {
+	e := NewEncoder()
+	if err := f(e); err != nil {
+		t.Fatalf("could not encode witness: %v", err)
+	}
+	var b bytes.Buffer
+	if _, err := e.Serialise(&b); err != nil {
+		t.Fatalf("could not serialise witness: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestMalformedWitness(t *testing.T) {
+	valid := encodeTestWitness(t)
+	tests := []struct {
+		name    string
+		witness []byte
+		err     string
+	}{
+		{"empty", nil, "empty witness"},
+		{"unknown version", append([]byte{2}, valid[1:]...), "unsupported witness version"},
+		{"truncated", valid[:len(valid)-1], "invalid length of tape"},
+		{"trailing bytes", append(common.CopyBytes(valid), 0), "trailing bytes"},
+		{"malformed header", []byte{Version1, 0xa7, 0x01}, "malformed witness header"},
+		{"extension underflow", encodeStructure(t, func(e *Encoder) error {
+			return e.Extension([]byte{1})
+		}), "stack underflow"},
+		{"branch underflow", encodeStructure(t, func(e *Encoder) error {
+			if err := e.EmptyRoot(); err != nil {
+				return err
+			}
+			return e.Branch(3)
+		}), "stack underflow"},
+		{"account underflow", encodeStructure(t, func(e *Encoder) error {
+			_ = e.SupplyKey([]byte{1, 16})
+			return e.AccountLeaf(2, 12)
+		}), "stack underflow"},
+		{"leftover items", encodeStructure(t, func(e *Encoder) error {
+			_ = e.EmptyRoot()
+			return e.EmptyRoot()
+		}), "items left on the stack"},
+		{"missing key", encodeStructure(t, func(e *Encoder) error {
+			return e.Leaf(1)
+		}), "tape \"keys\" exhausted"},
+		{"long leaf", encodeStructure(t, func(e *Encoder) error {
+			_ = e.SupplyKey([]byte{1, 16})
+			_ = e.SupplyValue([]byte{1})
+			return e.Leaf(3)
+		}), "invalid length of leaf"},
+		{"unconsumed value", encodeStructure(t, func(e *Encoder) error {
+			_ = e.SupplyValue([]byte{1})
+			return e.EmptyRoot()
+		}), "not consumed"},
+		{"short hash", encodeStructure(t, func(e *Encoder) error {
+			_ = e.tapes[HashesTape].encode([]byte{1, 2, 3})
+			return e.Hash(1)
+		}), "invalid length of hash"},
+		{"unknown opcode", encodeStructure(t, func(e *Encoder) error {
+			return e.op(OpEmptyRoot + 1)
+		}), "unknown opcode"},
+	}
+	for _, test := range tests {
+		err := Validate(test.witness)
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestCorruptedWitness(t *testing.T) {
+	valid := encodeTestWitness(t)
+	h, err := ReadHeader(valid)
+	if err != nil {
+		t.Fatalf("could not read header: %v", err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		corrupted := common.CopyBytes(valid)
+		// Half of the time, only the tapes are corrupted, so that the header stays valid
+		start := 0
+		if i%2 == 0 {
+			start = h.Size
+		}
+		for j := 0; j < 1+rnd.Intn(4); j++ {
+			corrupted[start+rnd.Intn(len(corrupted)-start)] = byte(rnd.Intn(256))
+		}
+		if rnd.Intn(4) == 0 {
+			corrupted = corrupted[:rnd.Intn(len(corrupted))]
+		}
+		// Only checks that the decoder does not panic
+		if ops, err := decodeAll(corrupted); err == nil {
+			for _, op := range ops {
+				if op.Opcode > OpEmptyRoot {
+					t.Fatalf("unknown opcode %d accepted", op.Opcode)
+				}
+			}
+		}
+	}
+}